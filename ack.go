@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Режимы подтверждения доставки
+const (
+	// Успех определяется по HTTP-статусу и критериям endpoint
+	ackModeStatus = "status"
+	// Бэкенд обязан вернуть {"ack": true, "event_id": "<id отправленного события>"}
+	ackModeStrict = "strict"
+)
+
+// backendAck - контракт ответа бэкенда на принятое событие
+type backendAck struct {
+	Ack     bool   `json:"ack"`
+	EventID string `json:"event_id"`
+}
+
+// verifyAck проверяет, что бэкенд явно подтвердил получение события
+func verifyAck(body, eventID string) error {
+	var ack backendAck
+	if err := json.Unmarshal([]byte(body), &ack); err != nil {
+		return fmt.Errorf("response is not a valid ack: %v", err)
+	}
+	if !ack.Ack {
+		return fmt.Errorf("backend did not acknowledge event %s", eventID)
+	}
+	if ack.EventID != eventID {
+		return fmt.Errorf("ack is for event %q, expected %s", ack.EventID, eventID)
+	}
+	return nil
+}
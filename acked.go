@@ -0,0 +1,60 @@
+package main
+
+import "agent-ws/state"
+
+var (
+	// Хэш поля data последнего подтвержденного панелью события по типу
+	// и игроку (dedupKey). Обновляется воркерами доставки.
+	ackedHashes = state.New[string]()
+	// Хэш содержимого файлов при запуске: пока по игроку не было
+	// подтвержденных событий, считается, что панель знает это содержимое
+	baselineHashes = state.New[string]()
+)
+
+// rememberAcked запоминает содержимое события, которое подтвердила панель
+func rememberAcked(eventData EventData) {
+	if eventData.ContentHash == "" {
+		return
+	}
+	ackedHashes.Set(dedupKey(eventData.Type, instanceKey(eventData.Instance, eventData.SteamID64)), eventData.ContentHash)
+}
+
+// eventDataHash считает хэш поля data, с которым содержимое файла ушло бы панели
+func eventDataHash(t *WatchTarget, steamID, content string) string {
+	ev, _ := t.newEvent(opChange, steamID, content)
+	data := ev.Data
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	return hashContent(string(data))
+}
+
+// contentAcked сообщает, что панель уже подтвердила это содержимое файла.
+// Сравнение идет с подтвержденным, а не с последним прочитанным
+// содержимым: изменение, которое не дошло до панели, не теряется.
+func contentAcked(t *WatchTarget, filename, steamID, content string) bool {
+	if acked, ok := ackedHashes.Get(dedupKey(t.EventType, instanceKey(t.instance, steamID))); ok {
+		return acked == eventDataHash(t, steamID, content)
+	}
+	baseline, ok := baselineHashes.Get(filename)
+	return ok && baseline == hashContent(content)
+}
+
+// queuedHashes возвращает хэши содержимого событий, ждущих доставки, по
+// игрокам: такое содержимое уже в пути к панели и повторно не отправляется
+func queuedHashes() map[string]map[string]bool {
+	queued := make(map[string]map[string]bool)
+	events, err := eventQueueStore.pending()
+	if err != nil {
+		deliveryLog.Errorf("Error reading persistent queue: %v", err)
+		return queued
+	}
+	for _, ev := range events {
+		key := dedupKey(ev.Type, instanceKey(ev.Instance, ev.SteamID64))
+		if queued[key] == nil {
+			queued[key] = make(map[string]bool)
+		}
+		queued[key][ev.ContentHash] = true
+	}
+	return queued
+}
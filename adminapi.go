@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-ws/logging"
+	"agent-ws/state"
+)
+
+// AdminAPIConfig - локальный HTTP API для управления агентом
+type AdminAPIConfig struct {
+	// Адрес прослушивания, например 127.0.0.1:8089 (пусто - выключено)
+	Listen string `json:"listen"`
+	Token  string `json:"token"`
+	// Разрешить адрес прослушивания не на loopback: API станет доступен из сети
+	AllowRemote bool `json:"allow_remote"`
+	// GET /cache возвращает содержимое сохранения, а не только хэш и размер
+	ExposeContent bool `json:"expose_content"`
+	// pprof, expvar и дамп горутин и очередей под /debug/ (по умолчанию выключены)
+	Debug bool `json:"debug"`
+}
+
+func (c AdminAPIConfig) validate() error {
+	if c.Listen == "" {
+		return nil
+	}
+	if c.Token == "" {
+		return fmt.Errorf("admin_api.token is required when admin API is enabled")
+	}
+	host, _, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return fmt.Errorf("admin_api.listen: %v", err)
+	}
+	if c.AllowRemote {
+		return nil
+	}
+	// Пустой хост - все интерфейсы
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("admin_api.listen %s is not a loopback address; set admin_api.allow_remote to expose the admin API to the network", c.Listen)
+	}
+	return nil
+}
+
+const (
+	// Сколько обработчик API ждет своей очереди в основном цикле
+	adminCallTimeout = 30 * time.Second
+	// Сколько ждем завершения активных запросов при остановке агента
+	adminShutdownTimeout = 5 * time.Second
+)
+
+// adminCall - действие API, выполняемое в основном цикле,
+// чтобы не обращаться к состоянию агента из других горутин.
+// Действие получает контекст основного цикла, а не запроса: отключение
+// клиента API не должно прерывать начатую сверку папок.
+type adminCall struct {
+	run  func(ctx context.Context, fileStates *state.Store[time.Time])
+	done chan struct{}
+}
+
+var (
+	adminCalls     = make(chan adminCall)
+	agentStartTime = time.Now()
+	lastEventTime  time.Time
+	paused         bool
+)
+
+// runAdminAPI обслуживает локальный API до отмены контекста агента.
+// Занятый адрес не останавливает агент: привязка повторяется, пока адрес
+// не освободится (после перезапуска его может еще держать старый процесс).
+func runAdminAPI(ctx context.Context, c AdminAPIConfig) error {
+	if c.Listen == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", handleAdminHealth)
+	mux.HandleFunc("GET /status", handleAdminStatus)
+	mux.HandleFunc("GET /metrics", handleAdminMetrics)
+	mux.HandleFunc("GET /queue", handleAdminQueue)
+	mux.HandleFunc("GET /cache/{steamid}", handleAdminCache)
+	mux.HandleFunc("GET /players/{steamid}", handleAdminPlayer)
+	mux.HandleFunc("POST /resync", handleAdminResync)
+	mux.HandleFunc("POST /pause", handleAdminPause)
+	mux.HandleFunc("POST /resume", handleAdminResume)
+	mux.HandleFunc("GET /blocklist", handleAdminBlocklist)
+	mux.HandleFunc("PUT /blocklist/{steamid}", handleAdminBlock)
+	mux.HandleFunc("DELETE /blocklist/{steamid}", handleAdminUnblock)
+	mux.HandleFunc("GET /log-level", handleAdminLogLevel)
+	mux.HandleFunc("PUT /log-level", handleAdminSetLogLevel)
+	mux.HandleFunc("GET /backups/{steamid}", handleAdminBackups)
+	mux.HandleFunc("POST /restore/{steamid}", handleAdminRestore)
+	mux.HandleFunc("GET /game-writes", handleAdminGameWrites)
+	mux.HandleFunc("GET /audit", handleAdminAudit)
+	if c.Debug {
+		registerDebugHandlers(mux)
+	}
+
+	server := &http.Server{
+		Addr:              c.Listen,
+		Handler:           requireAdminToken(c.Token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Запросы отменяются вместе с агентом
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	l, err := listenWithRetry(ctx, adminLog, "admin API", c.Listen)
+	if err != nil {
+		return nil
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		adminLog.Infof("Admin API listening on %s", c.Listen)
+		serveErr <- server.Serve(l)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("admin API stopped: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		adminLog.Errorf("Error shutting down admin API: %v", err)
+	}
+	<-serveErr
+	return nil
+}
+
+// listenWithRetry открывает адрес, повторяя попытки с растущей паузой.
+// Возвращает ошибку только при отмене контекста.
+func listenWithRetry(ctx context.Context, l *logging.Logger, name, addr string) (net.Listener, error) {
+	for backoff := watcherMinBackoff; ; backoff = min(backoff*2, watcherMaxBackoff) {
+		listener, err := net.Listen("tcp", addr)
+		if err == nil {
+			return listener, nil
+		}
+		l.Warnf("Cannot listen on %s for %s: %v; retrying in %v", addr, name, err, backoff)
+		if err := sleepContext(ctx, backoff); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// requireAdminToken пропускает запросы с заголовком Authorization: Bearer <token>.
+// Токен без префикса "Bearer " тоже принимается.
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inMainLoop выполняет fn в основном цикле и ждет завершения
+func inMainLoop(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, fileStates *state.Store[time.Time])) bool {
+	call := adminCall{run: fn, done: make(chan struct{})}
+
+	select {
+	case adminCalls <- call:
+	case <-time.After(adminCallTimeout):
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "agent is busy, try again later"})
+		return false
+	case <-r.Context().Done():
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "agent is shutting down"})
+		return false
+	}
+
+	<-call.done
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		adminLog.Errorf("Error writing admin API response: %v", err)
+	}
+}
+
+// handleAdminHealth отвечает без обращения к основному циклу,
+// поэтому работает, даже если цикл занят. Пока watcher не работает,
+// агент жив, но отвечает 503 со статусом degraded.
+func handleAdminHealth(w http.ResponseWriter, r *http.Request) {
+	status, code := "ok", http.StatusOK
+	if !watcherState.healthy() {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]interface{}{
+		"status":  status,
+		"uptime":  time.Since(agentStartTime).Round(time.Second).String(),
+		"version": versionInfo(),
+		"watcher": watcherState.status(),
+	})
+}
+
+func handleAdminStatus(w http.ResponseWriter, r *http.Request) {
+	var status map[string]interface{}
+	if !inMainLoop(w, r, func(_ context.Context, fileStates *state.Store[time.Time]) {
+		pending := 0
+		if pendingEvents != nil {
+			pending = len(pendingEvents.items)
+		}
+		paths := make([]string, 0, len(watchTargets))
+		for _, t := range watchTargets {
+			paths = append(paths, t.Path)
+		}
+		status = map[string]interface{}{
+			"uptime":         time.Since(agentStartTime).Round(time.Second).String(),
+			"version":        versionInfo(),
+			"watch_paths":    paths,
+			"api_url":        cfg.APIURL,
+			"memory_profile": cfg.MemoryProfile,
+			"tracked_files":  fileStates.Len(),
+			"pending_events": pending,
+			"queued_events":  eventQueueStore.len(),
+			"paused":         paused,
+			"watcher":        watcherState.status(),
+		}
+		// watch_path устарел и оставлен для существующих скриптов:
+		// папка игроков или первая отслеживаемая папка
+		if players := playersTarget(""); players != nil {
+			status["watch_path"] = players.Path
+		} else if len(paths) > 0 {
+			status["watch_path"] = paths[0]
+		}
+		if !lastEventTime.IsZero() {
+			status["last_event"] = lastEventTime.Format(time.RFC3339)
+		}
+		status["throttle"] = throttleStatus()
+		if deferredEvents != nil {
+			status["backpressure"] = map[string]interface{}{
+				"active":         backpressureActive,
+				"deferred_files": len(deferredEvents.items),
+				"dropped_events": backpressureDropped,
+			}
+		}
+	}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func handleAdminQueue(w http.ResponseWriter, r *http.Request) {
+	type queuedEvent struct {
+		File      string `json:"file"`
+		SteamID   string `json:"steamid64"`
+		Op        string `json:"op"`
+		UpdatedAt string `json:"updated_at"`
+	}
+
+	queue := []queuedEvent{}
+	if !inMainLoop(w, r, func(context.Context, *state.Store[time.Time]) {
+		if pendingEvents == nil {
+			return
+		}
+		for _, filename := range pendingEvents.order {
+			if item, ok := pendingEvents.items[filename]; ok {
+				queue = append(queue, queuedEvent{
+					File:      filepath.Base(item.filename),
+					SteamID:   item.steamID,
+					Op:        item.op.String(),
+					UpdatedAt: item.updatedAt.Format(time.RFC3339),
+				})
+			}
+		}
+	}) {
+		return
+	}
+	// Недоставленные события из очереди на диске
+	type undeliveredEvent struct {
+		EventID  string `json:"event_id"`
+		SteamID  string `json:"steamid64"`
+		Event    string `json:"event"`
+		Sequence uint64 `json:"sequence"`
+	}
+	undelivered := []undeliveredEvent{}
+	if events, err := eventQueueStore.pending(); err == nil {
+		for _, ev := range events {
+			undelivered = append(undelivered, undeliveredEvent{
+				EventID:  ev.EventID,
+				SteamID:  ev.SteamID64,
+				Event:    ev.Event,
+				Sequence: ev.Sequence,
+			})
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pending": queue, "undelivered": undelivered})
+}
+
+func handleAdminCache(w http.ResponseWriter, r *http.Request) {
+	steamID := r.PathValue("steamid")
+
+	var entry map[string]interface{}
+	if !inMainLoop(w, r, func(_ context.Context, fileStates *state.Store[time.Time]) {
+		for filename, modTime := range fileStates.Snapshot() {
+			if getSteamIDFromFilename(filename) != steamID {
+				continue
+			}
+			entry = map[string]interface{}{
+				"steamid64": steamID,
+				"file":      filepath.Base(filename),
+				"mod_time":  modTime.Format(time.RFC3339),
+			}
+			if hash, ok := cachedHash(filename); ok {
+				entry["hash"] = hash
+			}
+			if content, ok := fileCache.Get(filename); ok {
+				entry["size"] = len(content)
+				if cfg.AdminAPI.ExposeContent {
+					entry["content"] = content
+				}
+			}
+			return
+		}
+	}) {
+		return
+	}
+
+	if entry == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": fmt.Sprintf("steamid %s is not tracked", steamID)})
+		return
+	}
+	writeJSON(w, http.StatusOK, entry)
+}
+
+func handleAdminResync(w http.ResponseWriter, r *http.Request) {
+	if !inMainLoop(w, r, resyncDirectory) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"result": "resync finished"})
+}
+
+func handleAdminPause(w http.ResponseWriter, r *http.Request) {
+	if !inMainLoop(w, r, func(context.Context, *state.Store[time.Time]) {
+		pauseEmission("admin API")
+	}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": true})
+}
+
+// handleAdminResume возобновляет отправку со сверкой папок;
+// ?resync=false - без сверки
+func handleAdminResume(w http.ResponseWriter, r *http.Request) {
+	resync := r.URL.Query().Get("resync") != "false"
+	if !inMainLoop(w, r, func(ctx context.Context, fileStates *state.Store[time.Time]) {
+		resumeEmission(ctx, "admin API", resync, fileStates)
+	}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"paused": false})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+)
+
+// Переменная окружения с ключом шифрования, имеет приоритет над конфигом
+const stateKeyEnv = "AGENT_WS_STATE_KEY"
+
+// Заголовок зашифрованных файлов состояния
+var encryptedStateMagic = []byte("AGENTWS-AESGCM1\n")
+
+// stateCipher шифрует сохраняемое на диск состояние (очередь событий
+// с данными игроков, номера событий). nil - шифрование выключено.
+var stateCipher cipher.AEAD
+
+// initStateEncryption подготавливает AES-256-GCM по ключу из окружения или конфига.
+// Ключ - 32 байта в base64.
+func initStateEncryption(configKey string) error {
+	key := configKey
+	if env := os.Getenv(stateKeyEnv); env != "" {
+		key = env
+	}
+	if key == "" {
+		stateCipher = nil
+		return nil
+	}
+
+	gcm, err := newAESGCM(key)
+	if err != nil {
+		return fmt.Errorf("state encryption key: %v", err)
+	}
+	stateCipher = gcm
+	agentLog.Infof("Encryption of persisted state is enabled")
+	return nil
+}
+
+// newAESGCM создает AES-256-GCM по ключу из 32 байт в base64
+func newAESGCM(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("key must be base64: %v", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(raw))
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealState шифрует данные перед записью на диск
+func sealState(data []byte) ([]byte, error) {
+	if stateCipher == nil {
+		return data, nil
+	}
+
+	nonce := make([]byte, stateCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %v", err)
+	}
+
+	out := append([]byte{}, encryptedStateMagic...)
+	out = append(out, nonce...)
+	return stateCipher.Seal(out, nonce, data, encryptedStateMagic), nil
+}
+
+// openState расшифровывает данные, прочитанные с диска. Незашифрованные файлы,
+// записанные до включения шифрования, читаются как есть.
+func openState(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedStateMagic) {
+		return data, nil
+	}
+	if stateCipher == nil {
+		return nil, fmt.Errorf("file is encrypted but no state encryption key is configured")
+	}
+
+	data = data[len(encryptedStateMagic):]
+	if len(data) < stateCipher.NonceSize() {
+		return nil, fmt.Errorf("encrypted file is truncated")
+	}
+	nonce, sealed := data[:stateCipher.NonceSize()], data[stateCipher.NonceSize():]
+	plain, err := stateCipher.Open(nil, nonce, sealed, encryptedStateMagic)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %v", err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Действия журнала изменений
+const (
+	auditWrite = "write"
+	auditRCON  = "rcon"
+)
+
+// auditEntry - запись журнала изменений, которые агент вносит в папку игры
+// и на сервер. Каждая запись содержит хэш предыдущей, поэтому правка или
+// удаление записи в середине журнала обнаруживается проверкой цепочки.
+type auditEntry struct {
+	Seq       uint64            `json:"seq"`
+	Time      string            `json:"time"`
+	Action    string            `json:"action"`
+	Command   string            `json:"command,omitempty"`
+	CommandID string            `json:"command_id,omitempty"`
+	Target    string            `json:"target,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Success   bool              `json:"success"`
+	Error     string            `json:"error,omitempty"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+// auditLog - журнал только на дозапись. Записи добавляются из основного
+// цикла, а читаются из обработчиков локального API.
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+	last string
+}
+
+// Журнал изменений (nil - выключен)
+var auditTrail *auditLog
+
+func initAuditLog(path string) error {
+	if path == "" {
+		return nil
+	}
+	entries, err := readAuditEntries(path)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	a := &auditLog{path: path, file: file}
+	if n := len(entries); n > 0 {
+		a.seq, a.last = entries[n-1].Seq, entries[n-1].Hash
+		if brokenAt, ok := verifyAuditChain(entries); !ok {
+			agentLog.Warnf("Audit log %s is broken at entry %d: it was modified outside the agent", path, brokenAt)
+		}
+	}
+	auditTrail = a
+	return nil
+}
+
+func closeAuditLog() {
+	if auditTrail != nil {
+		auditTrail.file.Close()
+		auditTrail = nil
+	}
+}
+
+// recordAudit добавляет в журнал запись об изменении с его итогом err
+// и сразу сбрасывает ее на диск
+func recordAudit(e auditEntry, err error) {
+	a := auditTrail
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e.Success = err == nil
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.Seq = a.seq + 1
+	e.Time = time.Now().UTC().Format(time.RFC3339Nano)
+	e.PrevHash = a.last
+	e.Hash = auditHash(e)
+
+	line, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		agentLog.Errorf("Error encoding audit entry: %v", jsonErr)
+		return
+	}
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		agentLog.Errorf("Error writing audit log %s: %v", a.path, err)
+		return
+	}
+	if err := a.file.Sync(); err != nil {
+		agentLog.Errorf("Error syncing audit log %s: %v", a.path, err)
+	}
+	a.seq, a.last = e.Seq, e.Hash
+}
+
+// auditHash считает хэш записи без поля hash
+func auditHash(e auditEntry) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyAuditChain проверяет номера и хэши записей. При нарушении
+// возвращает номер первой записи, не прошедшей проверку.
+func verifyAuditChain(entries []auditEntry) (uint64, bool) {
+	prev := ""
+	for i, e := range entries {
+		if (i > 0 && e.Seq != entries[i-1].Seq+1) || e.PrevHash != prev || auditHash(e) != e.Hash {
+			return e.Seq, false
+		}
+		prev = e.Hash
+	}
+	return 0, true
+}
+
+func readAuditEntries(path string) ([]auditEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []auditEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e auditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("audit log %s line %d: %v", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// handleAdminAudit выгружает журнал изменений с результатом проверки цепочки:
+// GET /audit?since=<seq> - записи с номером больше seq
+func handleAdminAudit(w http.ResponseWriter, r *http.Request) {
+	a := auditTrail
+	if a == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "audit log is disabled"})
+		return
+	}
+	var since uint64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be an entry number"})
+			return
+		}
+		since = n
+	}
+
+	a.mu.Lock()
+	entries, err := readAuditEntries(a.path)
+	a.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// Цепочка проверяется целиком, даже если выгружается только хвост
+	brokenAt, verified := verifyAuditChain(entries)
+	list := []auditEntry{}
+	for _, e := range entries {
+		if e.Seq > since {
+			list = append(list, e)
+		}
+	}
+	response := map[string]interface{}{"entries": list, "verified": verified}
+	if !verified {
+		response["broken_at"] = brokenAt
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// backendResponse - контракт JSON-ответа бэкенда. Поля необязательны:
+// бэкенд может вернуть их на верхнем уровне или в объекте error.
+type backendResponse struct {
+	Success   *bool         `json:"success"`
+	Code      string        `json:"code"`
+	Message   string        `json:"message"`
+	Retryable *bool         `json:"retryable"`
+	Error     *backendError `json:"error"`
+}
+
+// backendError - ошибка, которую бэкенд вернул в ответе на событие
+type backendError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// false - повтор не поможет (событие отклонено), по умолчанию true
+	Retryable *bool `json:"retryable"`
+}
+
+func (e *backendError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("backend error: %s", e.Message)
+	}
+	return fmt.Sprintf("backend error %s: %s", e.Code, e.Message)
+}
+
+// retryable сообщает, имеет ли смысл отправлять событие повторно
+func (e *backendError) retryable() bool {
+	return e.Retryable == nil || *e.Retryable
+}
+
+// parseBackendError разбирает ответ бэкенда и возвращает ошибку, если
+// бэкенд явно сообщил о неудаче ({"success": false} или объект error).
+// Ответ не в формате JSON ошибкой бэкенда не считается.
+func parseBackendError(body string) *backendError {
+	var resp backendResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		return nil
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if resp.Success != nil && !*resp.Success {
+		return &backendError{Code: resp.Code, Message: resp.Message, Retryable: resp.Retryable}
+	}
+	return nil
+}
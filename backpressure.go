@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// BackpressureConfig - пороги очереди недоставленных событий
+type BackpressureConfig struct {
+	// Размер очереди, при котором включается backpressure (0 - выключено)
+	HighWatermark int `json:"high_watermark"`
+	// Размер очереди, при снижении до которого backpressure снимается
+	LowWatermark int `json:"low_watermark"`
+	// События, которые отбрасываются, пока backpressure включен (например change-dino-data)
+	DropEvents []string `json:"drop_events"`
+	// Отбрасывать также все события с приоритетом ниже указанного (0 - не отбрасывать)
+	DropBelowPriority int `json:"drop_below_priority"`
+}
+
+func (b BackpressureConfig) validate() error {
+	if b.HighWatermark < 0 || b.LowWatermark < 0 {
+		return fmt.Errorf("backpressure watermarks must not be negative")
+	}
+	if b.HighWatermark > 0 && b.LowWatermark >= b.HighWatermark {
+		return fmt.Errorf("backpressure.low_watermark must be less than high_watermark")
+	}
+	return nil
+}
+
+var (
+	backpressureActive bool
+	// Ссылки на измененные файлы, содержимое которых будет прочитано после снятия backpressure
+	deferredEvents      *eventQueue
+	backpressureDropped int
+	// Переполнение очереди отложенных файлов уже попало в лог за этот период
+	deferredOverflowLogged bool
+)
+
+func initBackpressure() {
+	if cfg.Backpressure.HighWatermark > 0 {
+		deferredEvents = newEventQueue(cfg.MaxPendingEvents)
+	}
+}
+
+// updateBackpressure включает или снимает backpressure по размеру очереди
+// недоставленных событий. Порогов два, чтобы режим не переключался на каждом событии.
+func updateBackpressure(ctx context.Context, fileStates *state.Store[time.Time]) {
+	if cfg.Backpressure.HighWatermark == 0 {
+		return
+	}
+
+	depth := eventQueueStore.len()
+	switch {
+	case !backpressureActive && depth >= cfg.Backpressure.HighWatermark:
+		backpressureActive = true
+		deliveryLog.Warnf("BACKPRESSURE ON | Queued: %d | High watermark: %d | File contents are deferred",
+			depth, cfg.Backpressure.HighWatermark)
+		notify(alertBackpressure, SeverityWarning, "Event queue is backing up",
+			fmt.Sprintf("%d undelivered events queued (high watermark %d), file reads are deferred",
+				depth, cfg.Backpressure.HighWatermark))
+
+	case backpressureActive && depth <= cfg.Backpressure.LowWatermark:
+		backpressureActive = false
+		deliveryLog.Infof("BACKPRESSURE OFF | Queued: %d | Deferred files: %d | Dropped events: %d",
+			depth, len(deferredEvents.items), backpressureDropped)
+		backpressureDropped = 0
+		deferredOverflowLogged = false
+		deferred := deferredEvents.takeSettled(0)
+		sortPendingByPriority(deferred)
+		for _, ev := range deferred {
+			handlePendingEvent(ctx, ev, fileStates)
+		}
+	}
+}
+
+// deferFileEvent откладывает изменение файла до снятия backpressure. Если
+// очередь отложенных файлов заполнена, событие теряется (метрика queue_full),
+// а изменение находит проверка пропущенных событий или resync.
+func deferFileEvent(filename, steamID string, op fsnotify.Op) {
+	if deferredEvents.push(filename, steamID, op) {
+		return
+	}
+	backpressureDropped++
+	if !deferredOverflowLogged {
+		deferredOverflowLogged = true
+		watchLog.Warnf("Deferred file queue is full (%d files), dropping %s event for %s; the change will be picked up by the gap scan or resync",
+			deferredEvents.capacity, op, filepath.Base(filename))
+		return
+	}
+	watchLog.Debugf("Deferred file queue is full, dropping %s event for %s", op, filepath.Base(filename))
+}
+
+// dropUnderBackpressure проверяет, что событие нужно отбросить по политике backpressure
+func dropUnderBackpressure(event string) bool {
+	if !backpressureActive {
+		return false
+	}
+	for _, name := range cfg.Backpressure.DropEvents {
+		if name == event {
+			backpressureDropped++
+			return true
+		}
+	}
+	if eventPriority(event) < cfg.Backpressure.DropBelowPriority {
+		backpressureDropped++
+		return true
+	}
+	return false
+}
+
+// fileEventName возвращает имя события, которое будет отправлено для изменения файла
+func fileEventName(filename string, op fsnotify.Op) string {
+	t := targetFor(filename)
+	if t == nil {
+		return ""
+	}
+	switch {
+	case op&fsnotify.Create != 0:
+		return t.eventName(opAdd)
+	case op&fsnotify.Write != 0:
+		return t.eventName(opChange)
+	}
+	return t.eventName(opDelete)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// BackupConfig - локальные копии сохранений игроков для восстановления
+// на момент времени независимо от панели
+type BackupConfig struct {
+	// Папка копий (пусто - выключено). Копии лежат в <dir>/<steamid>/<время>.json,
+	// у экземпляров серверов - в <dir>/<экземпляр>/<steamid>/
+	Dir string `json:"dir"`
+	// Сжатие копий: none или zstd
+	Compression string `json:"compression"`
+	// Не чаще одной копии игрока за min_interval (игра пишет файлы часто)
+	MinInterval Duration `json:"min_interval"`
+	// Копии старше keep_for удаляются; у игрока остается не больше
+	// max_versions последних копий (0 - без ограничения)
+	KeepFor     Duration `json:"keep_for"`
+	MaxVersions int      `json:"max_versions"`
+	// Выгрузка копий в S3-совместимое хранилище
+	S3 S3BackupConfig `json:"s3"`
+}
+
+const (
+	backupCompressionNone = "none"
+	backupCompressionZstd = "zstd"
+)
+
+// Формат времени в именах копий (UTC, сортируется как строка)
+const backupTimeLayout = "20060102T150405.000Z"
+
+// Как часто удаляются устаревшие копии всех игроков
+const backupSweepInterval = time.Hour
+
+func (c BackupConfig) validate() error {
+	if c.Dir == "" {
+		return nil
+	}
+	switch c.Compression {
+	case "", backupCompressionNone, backupCompressionZstd:
+	default:
+		return fmt.Errorf("backup.compression must be %s or %s", backupCompressionNone, backupCompressionZstd)
+	}
+	if c.MinInterval.Duration < 0 || c.KeepFor.Duration < 0 || c.MaxVersions < 0 {
+		return fmt.Errorf("backup: min_interval, keep_for and max_versions must not be negative")
+	}
+	return c.S3.validate(c.Dir)
+}
+
+var (
+	// Время последней копии по экземпляру и SteamID
+	lastBackups = make(map[string]time.Time)
+	lastSweep   time.Time
+)
+
+// backupVersion - одна копия сохранения игрока
+type backupVersion struct {
+	At   time.Time
+	Path string
+}
+
+// backupSave сохраняет копию файла игрока, если с прошлой копии прошло min_interval
+func backupSave(filename, steamID, content string) {
+	c := cfg.Backup
+	if c.Dir == "" || !isPlayerFile(filename) || content == "" {
+		return
+	}
+	instance := targetFor(filename).instance
+	key := instanceKey(instance, steamID)
+	now := time.Now()
+	if last, ok := lastBackups[key]; ok && now.Sub(last) < c.MinInterval.Duration {
+		return
+	}
+
+	path, err := writeBackup(c, instance, steamID, filepath.Ext(filename), []byte(content), now)
+	if err != nil {
+		agentLog.Errorf("Error backing up save of SteamID %s: %v", steamID, err)
+		return
+	}
+	lastBackups[key] = now
+	watchLog.Debugf("Backed up save of SteamID %s to %s", steamID, path)
+	prunePlayerBackups(instance, steamID, now)
+}
+
+// backupDir возвращает папку копий игрока
+func backupDir(instance, steamID string) string {
+	return filepath.Join(cfg.Backup.Dir, instance, steamID)
+}
+
+func writeBackup(c BackupConfig, instance, steamID, ext string, content []byte, at time.Time) (string, error) {
+	dir := filepath.Join(c.Dir, instance, steamID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := at.UTC().Format(backupTimeLayout) + ext
+	if c.Compression == backupCompressionZstd {
+		name += ".zst"
+		var buf bytes.Buffer
+		enc, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return "", err
+		}
+		enc.Write(content)
+		if err := enc.Close(); err != nil {
+			return "", err
+		}
+		content = buf.Bytes()
+	}
+
+	// Копии только для чтения: их меняет лишь очистка по сроку хранения
+	path := filepath.Join(dir, name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0444); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	uploadBackup(instance, steamID, name, content)
+	return path, nil
+}
+
+// listBackups возвращает копии игрока от старых к новым
+func listBackups(instance, steamID string) ([]backupVersion, error) {
+	// SteamID и экземпляр приходят из команд и API и становятся частью пути
+	if steamID == "" || steamID != filepath.Base(steamID) || strings.HasPrefix(steamID, ".") {
+		return nil, fmt.Errorf("invalid SteamID %q", steamID)
+	}
+	if instance != "" && instanceFor(instance) == nil {
+		return nil, fmt.Errorf("unknown instance %q", instance)
+	}
+	dir := backupDir(instance, steamID)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []backupVersion
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		stamp, _, _ := strings.Cut(name, "Z")
+		at, err := time.Parse(backupTimeLayout, stamp+"Z")
+		if err != nil {
+			continue
+		}
+		versions = append(versions, backupVersion{At: at, Path: filepath.Join(dir, name)})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].At.Before(versions[j].At) })
+	return versions, nil
+}
+
+// readBackup возвращает содержимое копии, распаковывая сжатые
+func readBackup(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if !strings.HasSuffix(path, ".zst") {
+		return io.ReadAll(f)
+	}
+	dec, err := zstd.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	return io.ReadAll(dec)
+}
+
+// prunePlayerBackups удаляет копии игрока старше keep_for и сверх max_versions
+func prunePlayerBackups(instance, steamID string, now time.Time) {
+	versions, err := listBackups(instance, steamID)
+	if err != nil {
+		agentLog.Errorf("Error listing backups of SteamID %s: %v", steamID, err)
+		return
+	}
+
+	keep := cfg.Backup.MaxVersions
+	for i, v := range versions {
+		expired := cfg.Backup.KeepFor.Duration > 0 && now.Sub(v.At) > cfg.Backup.KeepFor.Duration
+		excess := keep > 0 && len(versions)-i > keep
+		if !expired && !excess {
+			continue
+		}
+		// Файлы только для чтения на Windows удаляются после снятия атрибута
+		os.Chmod(v.Path, 0644)
+		if err := os.Remove(v.Path); err != nil {
+			agentLog.Errorf("Error removing backup %s: %v", v.Path, err)
+		}
+	}
+}
+
+// sweepBackups раз в час удаляет устаревшие копии игроков,
+// файлы которых давно не менялись
+func sweepBackups() {
+	if cfg.Backup.Dir == "" || cfg.Backup.KeepFor.Duration <= 0 {
+		return
+	}
+	now := time.Now()
+	if now.Sub(lastSweep) < backupSweepInterval {
+		return
+	}
+	lastSweep = now
+
+	sweepBackupDir("", now)
+	for _, inst := range cfg.Instances {
+		sweepBackupDir(inst.Name, now)
+	}
+}
+
+func sweepBackupDir(instance string, now time.Time) {
+	entries, err := os.ReadDir(filepath.Join(cfg.Backup.Dir, instance))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			agentLog.Errorf("Error reading backup directory: %v", err)
+		}
+		return
+	}
+	for _, entry := range entries {
+		// Папки экземпляров лежат рядом с папками игроков общей конфигурации
+		if entry.IsDir() && (instance != "" || instanceFor(entry.Name()) == nil) {
+			prunePlayerBackups(instance, entry.Name(), now)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-ws/objstore"
+)
+
+// S3BackupConfig - выгрузка копий сохранений в S3-совместимое хранилище,
+// чтобы история сохранений пережила потерю игровой машины
+type S3BackupConfig struct {
+	// Бакет (пусто - выключено)
+	Bucket    string `json:"bucket"`
+	Endpoint  string `json:"endpoint"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key"`
+	SecretKey string `json:"secret_key"`
+	PathStyle bool   `json:"path_style"`
+	// Префикс ключей: <prefix>/[<экземпляр>/]<steamid>/<время>.json[.zst]
+	Prefix       string `json:"prefix"`
+	StorageClass string `json:"storage_class"`
+	// Копии в бакете удаляются правилом жизненного цикла через
+	// expire_days дней (0 - правило бакета не меняется)
+	ExpireDays int `json:"expire_days"`
+}
+
+func (c S3BackupConfig) validate(dir string) error {
+	if c.Bucket == "" {
+		return nil
+	}
+	if dir == "" {
+		return fmt.Errorf("backup.s3 requires backup.dir")
+	}
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return fmt.Errorf("backup.s3.access_key and backup.s3.secret_key are required")
+	}
+	if c.ExpireDays < 0 {
+		return fmt.Errorf("backup.s3.expire_days must not be negative")
+	}
+	return nil
+}
+
+const (
+	// Сколько копий ждут выгрузки; при переполнении новые копии
+	// остаются только локально
+	backupUploadBuffer = 1000
+	backupUploadTries  = 3
+	backupUploadDelay  = 5 * time.Second
+)
+
+type backupObject struct {
+	key  string
+	data []byte
+}
+
+// backupUploader выгружает копии в фоне, не задерживая обработку событий
+type backupUploader struct {
+	store   *objstore.Client
+	objects chan backupObject
+	wg      sync.WaitGroup
+}
+
+var uploader *backupUploader
+
+func initBackupUpload(c S3BackupConfig) error {
+	if c.Bucket == "" {
+		return nil
+	}
+	store, err := objstore.New(httpClient, objstore.Config{
+		Endpoint:     c.Endpoint,
+		Region:       c.Region,
+		Bucket:       c.Bucket,
+		AccessKey:    c.AccessKey,
+		SecretKey:    c.SecretKey,
+		PathStyle:    c.PathStyle,
+		StorageClass: c.StorageClass,
+	})
+	if err != nil {
+		return err
+	}
+
+	uploader = &backupUploader{store: store, objects: make(chan backupObject, backupUploadBuffer)}
+	uploader.wg.Add(1)
+	go uploader.run()
+
+	if c.ExpireDays > 0 {
+		if err := store.SetExpiration(context.Background(), backupKeyPrefix(c), c.ExpireDays); err != nil {
+			agentLog.Warnf("Could not set backup expiration on bucket %s: %v", c.Bucket, err)
+		}
+	}
+	agentLog.Infof("Backups are uploaded to bucket %s", c.Bucket)
+	return nil
+}
+
+// closeBackupUpload дожидается выгрузки накопленных копий
+func closeBackupUpload() {
+	if uploader == nil {
+		return
+	}
+	close(uploader.objects)
+	uploader.wg.Wait()
+	uploader = nil
+}
+
+func backupKeyPrefix(c S3BackupConfig) string {
+	if prefix := strings.Trim(c.Prefix, "/"); prefix != "" {
+		return prefix + "/"
+	}
+	return ""
+}
+
+// uploadBackup ставит копию в очередь выгрузки
+func uploadBackup(instance, steamID, name string, data []byte) {
+	if uploader == nil {
+		return
+	}
+	key := backupKeyPrefix(cfg.Backup.S3) + path.Join(instance, steamID, name)
+	select {
+	case uploader.objects <- backupObject{key: key, data: data}:
+	default:
+		agentLog.Warnf("Backup upload queue is full, %s stays only on local disk", key)
+	}
+}
+
+func (u *backupUploader) run() {
+	defer u.wg.Done()
+	for obj := range u.objects {
+		var err error
+		for attempt := 1; attempt <= backupUploadTries; attempt++ {
+			if err = u.store.Put(context.Background(), obj.key, obj.data, "application/octet-stream"); err == nil {
+				break
+			}
+			if attempt < backupUploadTries {
+				time.Sleep(backupUploadDelay * time.Duration(attempt))
+			}
+		}
+		if err != nil {
+			agentLog.Errorf("Error uploading backup %s after %d attempts: %v", obj.key, backupUploadTries, err)
+		}
+	}
+}
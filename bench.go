@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-ws/simulate"
+	"agent-ws/sink"
+)
+
+// Имя и тип событий нагрузочного теста: панель не должна принять их
+// за данные настоящих игроков
+const benchEventName = "bench"
+
+// benchResult - итог прогона с одним числом воркеров
+type benchResult struct {
+	workers   int
+	sent      int
+	failed    int
+	elapsed   time.Duration
+	latencies []time.Duration
+	// Пик занятой кучи и выделено всего за прогон
+	peakHeap   uint64
+	totalAlloc uint64
+}
+
+// runBench - команда agent-ws bench: отправляет синтетические события
+// в настроенный sink и показывает пропускную способность, задержки и память
+func runBench(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	sinkName := fs.String("sink", "http", "sink to send events to")
+	count := fs.Int("events", 1000, "number of events per run")
+	workersList := fs.String("workers", strconv.Itoa(cfg.DeliveryWorkers), "comma-separated worker counts, one run per value")
+	rate := fs.Float64("rate", 0, "events per second (0 - as fast as possible)")
+	players := fs.Int("players", 100, "number of distinct SteamIDs")
+	seed := fs.Int64("seed", 1, "random seed for event payloads")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	workerCounts, err := parseWorkerCounts(*workersList)
+	if err != nil {
+		fmt.Println("Invalid --workers:", err)
+		return 2
+	}
+	if *count < 1 || *players < 1 {
+		fmt.Println("--events and --players must be positive")
+		return 2
+	}
+
+	if *sinkName == "http" {
+		if err := initHTTPClient(); err != nil {
+			fmt.Println("Error initializing HTTP client:", err)
+			return 1
+		}
+		if err := initPayloadEncryption(cfg.PayloadEncryption); err != nil {
+			fmt.Println("Error initializing payload encryption:", err)
+			return 1
+		}
+	} else if _, ok := cfg.Sinks[*sinkName]; !ok {
+		fmt.Printf("Sink %q is not configured\n", *sinkName)
+		return 2
+	}
+	target, err := sink.Open(*sinkName, cfg.Sinks[*sinkName])
+	if err != nil {
+		fmt.Println("Error opening sink:", err)
+		return 1
+	}
+	defer target.Close()
+
+	events := benchEvents(*count, *players, *seed)
+	fmt.Printf("Sending %d %q events to sink %s\n", *count, benchEventName, *sinkName)
+
+	for _, workers := range workerCounts {
+		result := runBenchPass(ctx, target, events, workers, *rate)
+		printBenchResult(result)
+		if ctx.Err() != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseWorkerCounts(value string) ([]int, error) {
+	var counts []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("%q is not a positive number", part)
+		}
+		counts = append(counts, n)
+	}
+	return counts, nil
+}
+
+// benchEvents готовит события заранее, чтобы генерация не попала в замер
+func benchEvents(count, players int, seed int64) []EventData {
+	rng := rand.New(rand.NewSource(seed))
+	events := make([]EventData, count)
+	for i := range events {
+		events[i] = EventData{
+			SteamID64: simulate.SteamID(uint64(rng.Intn(players))),
+			Type:      benchEventName,
+			Event:     benchEventName,
+			Data:      simulate.Save(rng),
+			EventID:   newEventID(),
+			Sequence:  uint64(i + 1),
+		}
+	}
+	return events
+}
+
+// runBenchPass отправляет события пулом воркеров; при rate > 0 события
+// выдаются воркерам с заданной частотой
+func runBenchPass(ctx context.Context, target sink.Sink, events []EventData, workers int, rate float64) benchResult {
+	result := benchResult{workers: workers, latencies: make([]time.Duration, 0, len(events))}
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	stopSampling := sampleHeap(&result.peakHeap)
+
+	jobs := make(chan EventData)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range jobs {
+				sent := time.Now()
+				err := target.Send(ctx, ev)
+				latency := time.Since(sent)
+
+				mu.Lock()
+				if err != nil {
+					result.failed++
+				} else {
+					result.sent++
+					result.latencies = append(result.latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+feed:
+	for _, ev := range events {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		select {
+		case jobs <- ev:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	result.elapsed = time.Since(start)
+
+	stopSampling()
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	result.totalAlloc = after.TotalAlloc - before.TotalAlloc
+	return result
+}
+
+// sampleHeap следит за пиком занятой кучи до вызова возвращенной функции
+func sampleHeap(peak *uint64) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		var m runtime.MemStats
+		for {
+			runtime.ReadMemStats(&m)
+			if m.HeapAlloc > *peak {
+				*peak = m.HeapAlloc
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// percentile возвращает p-й перцентиль отсортированных задержек
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+func printBenchResult(r benchResult) {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	fmt.Printf("\nWorkers: %d\n", r.workers)
+	fmt.Printf("  Sent: %d, failed: %d in %v\n", r.sent, r.failed, r.elapsed.Round(time.Millisecond))
+	if r.elapsed > 0 {
+		fmt.Printf("  Throughput: %.1f events/s\n", float64(r.sent)/r.elapsed.Seconds())
+	}
+	fmt.Printf("  Latency: p50 %v, p95 %v, p99 %v, max %v\n",
+		percentile(r.latencies, 50).Round(time.Microsecond),
+		percentile(r.latencies, 95).Round(time.Microsecond),
+		percentile(r.latencies, 99).Round(time.Microsecond),
+		percentile(r.latencies, 100).Round(time.Microsecond))
+	perEvent := uint64(0)
+	if total := r.sent + r.failed; total > 0 {
+		perEvent = r.totalAlloc / uint64(total)
+	}
+	fmt.Printf("  Memory: peak heap %.1f MB, allocated %.1f MB (%d bytes/event)\n",
+		float64(r.peakHeap)/(1024*1024), float64(r.totalAlloc)/(1024*1024), perEvent)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// steamBlocklist - SteamID, события файлов которых не отправляются
+// (тестовые аккаунты администраторов, боты). Список из конфигурации
+// дополняется файлом, который меняется через API или вручную и
+// перечитывается без перезапуска агента.
+type steamBlocklist struct {
+	mu      sync.Mutex
+	path    string
+	static  map[string]bool
+	runtime map[string]bool
+	modTime time.Time
+}
+
+var blocklist *steamBlocklist
+
+func initBlocklist() {
+	blocklist = &steamBlocklist{
+		path:    cfg.BlocklistFile,
+		static:  make(map[string]bool),
+		runtime: make(map[string]bool),
+	}
+	for _, id := range cfg.BlockedSteamIDs {
+		blocklist.static[id] = true
+	}
+	blocklist.reload()
+}
+
+// isBlocked проверяет, что события SteamID не отправляются
+func isBlocked(steamID string) bool {
+	if blocklist == nil || steamID == "" {
+		return false
+	}
+	blocklist.mu.Lock()
+	defer blocklist.mu.Unlock()
+	return blocklist.static[steamID] || blocklist.runtime[steamID]
+}
+
+// reload перечитывает файл списка, если он изменился с прошлого чтения
+func (b *steamBlocklist) reload() {
+	if b.path == "" {
+		return
+	}
+	info, err := os.Stat(b.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			agentLog.Errorf("Error checking blocklist file %s: %v", b.path, err)
+		}
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if info.ModTime().Equal(b.modTime) {
+		return
+	}
+
+	data, err := os.ReadFile(b.path)
+	if err != nil {
+		agentLog.Errorf("Error reading blocklist file %s: %v", b.path, err)
+		return
+	}
+	var ids []string
+	if err := json.Unmarshal(data, &ids); err != nil {
+		// Оставляем прежний список: файл мог быть сохранен с ошибкой
+		agentLog.Errorf("Error parsing blocklist file %s: %v", b.path, err)
+		return
+	}
+
+	b.runtime = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		b.runtime[id] = true
+	}
+	b.modTime = info.ModTime()
+	agentLog.Infof("Loaded blocklist: %d SteamIDs from %s, %d from config", len(b.runtime), b.path, len(b.static))
+}
+
+// set добавляет SteamID в файл списка или удаляет из него
+func (b *steamBlocklist) set(steamID string, blocked bool) error {
+	if b.path == "" {
+		return fmt.Errorf("blocklist_file is not configured")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if blocked {
+		b.runtime[steamID] = true
+	} else {
+		delete(b.runtime, steamID)
+	}
+
+	data, err := json.MarshalIndent(sortedIDs(b.runtime), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(b.path, data); err != nil {
+		return fmt.Errorf("save blocklist: %v", err)
+	}
+	if info, err := os.Stat(b.path); err == nil {
+		b.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// list возвращает SteamID из конфигурации и из файла списка
+func (b *steamBlocklist) list() (static, runtime []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return sortedIDs(b.static), sortedIDs(b.runtime)
+}
+
+func sortedIDs(set map[string]bool) []string {
+	ids := make([]string, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func handleAdminBlocklist(w http.ResponseWriter, r *http.Request) {
+	static, runtime := blocklist.list()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"config": static, "runtime": runtime})
+}
+
+func handleAdminBlock(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, true)
+}
+
+func handleAdminUnblock(w http.ResponseWriter, r *http.Request) {
+	updateBlocklist(w, r, false)
+}
+
+func updateBlocklist(w http.ResponseWriter, r *http.Request, blocked bool) {
+	steamID := r.PathValue("steamid")
+	if err := blocklist.set(steamID, blocked); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	action := "unblocked"
+	if blocked {
+		action = "blocked"
+	}
+	agentLog.Infof("SteamID %s %s via admin API", steamID, action)
+	result := map[string]interface{}{"steamid64": steamID, "blocked": isBlocked(steamID)}
+	if !blocked && isBlocked(steamID) {
+		result["note"] = "steamid is blocked in config"
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"agent-ws/logging"
+)
+
+// Заголовки, значения которых не попадают в дамп. Значения заголовков
+// из конфигурации (headers) маскируются всегда: там обычно токены доступа.
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Cf-Access-Client-Secret", signatureHeader}
+
+// Части имен JSON-полей, значения которых не попадают в дамп
+var secretFieldMarkers = []string{"token", "secret", "password", "api_key", "apikey", "signature"}
+
+var (
+	// Лог полных запросов и ответов неудачных отправок (nil - выключен)
+	bodyDumpLogger *log.Logger
+	bodyDumpHandle *os.File
+)
+
+func initBodyDump(path string) error {
+	if path == "" {
+		return nil
+	}
+	var err error
+	bodyDumpLogger, bodyDumpHandle, err = logging.Open(path)
+	if err != nil {
+		return err
+	}
+	bodyDumpLogger.SetOutput(logRedactor.Writer(bodyDumpHandle))
+	return nil
+}
+
+func closeBodyDump() {
+	if bodyDumpHandle != nil {
+		bodyDumpHandle.Close()
+	}
+}
+
+// truncateBody обрезает тело ответа для основного лога до log_body_limit
+func truncateBody(body string) string {
+	if cfg.LogBodyLimit > 0 && len(body) > cfg.LogBodyLimit {
+		return body[:cfg.LogBodyLimit] + "... [truncated]"
+	}
+	return body
+}
+
+// dumpFailedExchange пишет в отдельный лог полные запрос и ответ неудачной
+// отправки. resp равен nil, если ответа не было.
+func dumpFailedExchange(req *http.Request, resp *http.Response, respBody string, reason string) {
+	if bodyDumpLogger == nil {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("FAILED SEND | " + req.Method + " " + req.URL.Redacted() + " | " + reason + "\n")
+	writeRedactedHeaders(&b, req.Header)
+	b.WriteString(redactBody(requestBody(req)) + "\n")
+	if resp != nil {
+		b.WriteString("--- response " + resp.Status + "\n")
+		writeRedactedHeaders(&b, resp.Header)
+		b.WriteString(redactBody(respBody) + "\n")
+	}
+	bodyDumpLogger.Print(b.String())
+}
+
+// requestBody перечитывает тело запроса; тело потокового запроса недоступно
+func requestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return "[body not captured]"
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "[body not captured]"
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "[body not captured]"
+	}
+	return string(data)
+}
+
+func writeRedactedHeaders(b *strings.Builder, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := strings.Join(header[name], ", ")
+		if isSecretHeader(name) {
+			value = logging.Redacted
+		}
+		b.WriteString(name + ": " + value + "\n")
+	}
+}
+
+func isSecretHeader(name string) bool {
+	for _, secret := range secretHeaders {
+		if strings.EqualFold(name, secret) {
+			return true
+		}
+	}
+	for configured := range cfg.Headers {
+		if strings.EqualFold(name, configured) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody маскирует секретные поля JSON; тело не в JSON пишется как есть
+func redactBody(body string) string {
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactJSON(parsed))
+	if err != nil {
+		return body
+	}
+	return string(redacted)
+}
+
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSecretField(key) {
+				v[key] = logging.Redacted
+			} else {
+				v[key] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactJSON(item)
+		}
+	}
+	return value
+}
+
+func isSecretField(key string) bool {
+	key = strings.ToLower(key)
+	for _, marker := range secretFieldMarkers {
+		if strings.Contains(key, marker) {
+			return true
+		}
+	}
+	return false
+}
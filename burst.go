@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// Сводное событие массового сохранения
+const eventBulkSave = "bulk-save"
+
+// BurstConfig - пакетный режим на время массового сохранения: Evrima
+// периодически сохраняет всех игроков разом, и сотни событий подряд
+// копятся со слиянием по файлу вместо обработки по одному
+type BurstConfig struct {
+	// Сколько событий подряд включают пакетный режим (0 - выключено)
+	Threshold int `json:"threshold"`
+	// Наибольшая пауза между событиями одной пачки
+	Gap Duration `json:"gap"`
+	// Сколько ждать после последнего события, прежде чем обработать пакет
+	Settle Duration `json:"settle"`
+	// Пакет обрабатывается не позже, даже если запись не прекращается
+	MaxDuration Duration `json:"max_duration"`
+}
+
+func (c BurstConfig) validate() error {
+	if c.Threshold < 0 {
+		return fmt.Errorf("burst.threshold must not be negative")
+	}
+	if c.Threshold > 0 && (c.Gap.Duration <= 0 || c.Settle.Duration <= 0 || c.MaxDuration.Duration <= 0) {
+		return fmt.Errorf("burst.gap, settle and max_duration must be positive")
+	}
+	return nil
+}
+
+// burst - накапливаемый пакет событий
+type burst struct {
+	queue     *eventQueue
+	events    int
+	startedAt time.Time
+	lastEvent time.Time
+}
+
+// Текущий пакет (nil - события обрабатываются по одному). Используется
+// только в основном цикле.
+var activeBurst *burst
+
+// collectBurst забирает события, идущие сразу за event с паузами меньше gap.
+// Если их набралось не меньше порога, включается пакетный режим.
+// Возвращает все забранные события по порядку.
+func collectBurst(event fsnotify.Event) []fsnotify.Event {
+	events := []fsnotify.Event{event}
+	if cfg.Burst.Threshold <= 0 || activeBurst != nil || paused || fileWatcher == nil {
+		return events
+	}
+
+	source := fileWatcher.Events()
+	timer := time.NewTimer(cfg.Burst.Gap.Duration)
+	defer timer.Stop()
+	for len(events) < cfg.Burst.Threshold {
+		select {
+		case next, ok := <-source:
+			if !ok {
+				return events
+			}
+			events = append(events, next)
+			timer.Reset(cfg.Burst.Gap.Duration)
+		case <-timer.C:
+			return events
+		}
+	}
+
+	now := time.Now()
+	activeBurst = &burst{queue: newEventQueue(cfg.MaxPendingEvents), startedAt: now, lastEvent: now}
+	watchLog.Infof("Burst of file events detected, collecting them into a batch")
+	return events
+}
+
+// push добавляет событие в пакет со слиянием по файлу
+func (b *burst) push(filename, steamID string, op fsnotify.Op) {
+	b.events++
+	b.lastEvent = time.Now()
+	b.queue.push(filename, steamID, op)
+}
+
+// flushBurst обрабатывает пакет, когда запись затихла или пакет копится
+// дольше max_duration, и отправляет сводное событие bulk-save
+func flushBurst(ctx context.Context, fileStates *state.Store[time.Time]) {
+	b := activeBurst
+	now := time.Now()
+	if now.Sub(b.lastEvent) < cfg.Burst.Settle.Duration && now.Sub(b.startedAt) < cfg.Burst.MaxDuration.Duration {
+		return
+	}
+	activeBurst = nil
+
+	items := b.queue.takeSettled(0)
+	sortPendingByPriority(items)
+	counts := make(map[string]int)
+	for _, ev := range items {
+		switch {
+		case ev.op&fsnotify.Create != 0:
+			counts[opAdd]++
+		case ev.op&fsnotify.Write != 0:
+			counts[opChange]++
+		default:
+			counts[opDelete]++
+		}
+		handlePendingEvent(ctx, ev, fileStates)
+	}
+
+	if b.queue.dropped > 0 {
+		watchLog.Warnf("Burst batch is full (capacity %d), dropped %d events", b.queue.capacity, b.queue.dropped)
+	}
+	watchLog.Infof("Burst batch processed: %d file events coalesced into %d (%d added, %d changed, %d deleted) in %v",
+		b.events, len(items), counts[opAdd], counts[opChange], counts[opDelete], b.lastEvent.Sub(b.startedAt).Round(time.Millisecond))
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"started_at": b.startedAt.UTC().Format(time.RFC3339Nano),
+		"ended_at":   b.lastEvent.UTC().Format(time.RFC3339Nano),
+		"events":     b.events,
+		"files":      len(items),
+		"added":      counts[opAdd],
+		"changed":    counts[opChange],
+		"deleted":    counts[opDelete],
+		"dropped":    b.queue.dropped,
+	})
+	sendEventWithRetry(ctx, EventData{
+		Type:  "server",
+		Event: eventBulkSave,
+		Data:  data,
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+const cliUsage = `Usage: agent-ws [command]
+
+Without a command the agent starts watching.
+--log-level <spec> sets log levels for the agent and commands,
+e.g. --log-level debug or --log-level info,watcher=trace.
+
+Commands:
+  version       print version, commit and build date
+  validate-config
+                check the configuration, directories, disk space, TLS and API access:
+                validate-config [--config <path>] [--timeout 10s]
+  doctor        send a test save through watcher, debounce, transform and the API:
+                doctor [--timeout 30s]
+  status        show whether a player's save is synced to the panel (queries the admin API):
+                status --steamid X [--instance N]
+  self-update   download and install the latest signed release
+  replay        re-send archived or queued events:
+                replay --from <time> --to <time> [--steamid X] [--source archive|queue] [--dry-run]
+  simulate      generate and churn player saves in a test directory:
+                simulate --dir <path> [--players N] [--duration 1m] [--create R] [--write R]
+                [--delete R] [--rename R] [--seed N] [--partial-writes]
+  bench         send synthetic events to a sink and report throughput, latency and memory:
+                bench [--sink http] [--events N] [--workers 1,4,8] [--rate R] [--players N]
+  diff          compare two player snapshots (snapshot files or save directories) by player:
+                diff [--steamid X] [--summary] [--instance N] <snapshot-a> <snapshot-b|live>`
+
+// runCLI выполняет команду командной строки вместо запуска агента
+func runCLI(args []string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "version", "--version":
+		return runVersion()
+	case "self-update":
+		if err := initHTTPClient(); err != nil {
+			fmt.Println("Error initializing HTTP client:", err)
+			return 1
+		}
+		return runSelfUpdate(ctx)
+	case "replay":
+		return runReplay(ctx, args[1:])
+	case "simulate":
+		return runSimulate(ctx, args[1:])
+	case "bench":
+		return runBench(ctx, args[1:])
+	case "diff":
+		return runDiff(args[1:])
+	case "doctor":
+		return runDoctor(ctx, args[1:])
+	case "status":
+		return runStatus(ctx, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(cliUsage)
+		return 0
+	}
+
+	fmt.Printf("Unknown command %q\n\n%s\n", args[0], cliUsage)
+	return 2
+}
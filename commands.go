@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+
+	"agent-ws/state"
+)
+
+// CommandsConfig - настройки получения команд от бэкенда
+type CommandsConfig struct {
+	// Endpoint, возвращающий список команд для агента (пусто - выключено)
+	PollURL string `json:"poll_url"`
+	// Endpoint для отправки результатов выполнения команд
+	ResultURL    string   `json:"result_url"`
+	PollInterval Duration `json:"poll_interval"`
+	// Прием команд входящими запросами панели
+	Webhook CommandWebhookConfig `json:"webhook"`
+}
+
+// Command - команда агенту от бэкенда или локального API
+type Command struct {
+	ID   string            `json:"id"`
+	Name string            `json:"command"`
+	Args map[string]string `json:"args,omitempty"`
+}
+
+// CommandResult - результат выполнения команды
+type CommandResult struct {
+	ID      string      `json:"id"`
+	Command string      `json:"command"`
+	Success bool        `json:"success"`
+	Message string      `json:"message,omitempty"`
+	Report  interface{} `json:"report,omitempty"`
+	// Запись в папку игры отложена; итог придет отдельным результатом с тем же id
+	Pending   bool   `json:"pending,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// Сколько последних результатов хранится для повторно доставленных команд
+const commandResultsKept = 256
+
+// Результаты последних команд по id: панель повторяет запрос webhook, если не
+// дождалась ответа, а опрос может вернуть команду еще раз, если ее результат
+// не дошел. Команда не должна выполниться дважды. Меняются только в основном цикле.
+var (
+	commandResults     = make(map[string]CommandResult)
+	commandResultOrder []string
+)
+
+// restartRequested выставляется командой restart; основной цикл
+// завершает работу и запускает новый экземпляр агента
+var restartRequested bool
+
+// executeCommand выполняет команду и возвращает результат.
+// Вызывается только из основного цикла.
+func executeCommand(ctx context.Context, cmd Command, fileStates *state.Store[time.Time]) CommandResult {
+	commandLog.Infof("Executing command %s (id: %s)", cmd.Name, cmd.ID)
+
+	result := CommandResult{ID: cmd.ID, Command: cmd.Name}
+	switch cmd.Name {
+	case "diagnose":
+		report := runDiagnostics(ctx)
+		result.Success = report.OK
+		result.Report = report
+		if !report.OK {
+			result.Message = "some checks failed"
+		}
+	case "pause":
+		pauseEmission("backend command")
+		result.Success, result.Message = true, "event emission paused"
+	case "resume":
+		resumeEmission(ctx, "backend command", cmd.Args["resync"] != "false", fileStates)
+		result.Success, result.Message = true, "event emission resumed"
+	case "restart":
+		result.Success, result.Message = restartSubsystem(cmd.Args["target"])
+	case "announce", "kick", "ban", "save":
+		result.Success, result.Message = executeRCONCommand(ctx, cmd)
+	case "restore":
+		result.Success, result.Message = executeRestoreCommand(ctx, cmd, fileStates)
+	case "apply_save":
+		result.Success, result.Message = executeApplySaveCommand(ctx, cmd, fileStates)
+	default:
+		result.Message = fmt.Sprintf("unknown command %q", cmd.Name)
+	}
+	result.Pending = gameWritePending(cmd.ID)
+
+	result.Timestamp = time.Now().Format(time.RFC3339)
+	commandLog.Infof("Command %s finished: success=%v %s", cmd.Name, result.Success, result.Message)
+	return result
+}
+
+// restartSubsystem перезапускает процесс агента или отдельную подсистему
+func restartSubsystem(target string) (bool, string) {
+	switch target {
+	case "", "process":
+		restartRequested = true
+		return true, "agent process restart scheduled"
+	case "watcher":
+		if err := restartWatcher(); err != nil {
+			return false, err.Error()
+		}
+		return true, "file watcher restarted"
+	case "server_log":
+		// Опрос лога запускается основным циклом только для включенного при
+		// старте лога, поэтому перезапуск не может его включить
+		if serverLogTailer == nil {
+			return false, "server log is disabled (server_log.enabled is false), nothing to restart"
+		}
+		if err := initServerLog(cfg.ServerLog); err != nil {
+			return false, err.Error()
+		}
+		return true, "server log tailer restarted"
+	case "notifiers":
+		if err := initNotifiers(cfg.Notifiers); err != nil {
+			return false, err.Error()
+		}
+		return true, "notifiers restarted"
+	}
+	return false, fmt.Sprintf("unknown restart target %q", target)
+}
+
+// restartIfRequested запускает замену агента после команды restart или
+// обновления. Если запустить ее не удалось, процесс завершается с ошибкой,
+// чтобы агента перезапустил менеджер служб.
+func restartIfRequested() {
+	if !restartRequested {
+		return
+	}
+	agentLog.Infof("=== Restarting agent process ===")
+	if err := spawnReplacementProcess(); err != nil {
+		agentLog.Errorf("Error restarting agent process: %v", err)
+		logFileHandle.Close()
+		os.Exit(1)
+	}
+}
+
+// spawnReplacementProcess запускает новый экземпляр агента с теми же аргументами
+func spawnReplacementProcess() error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Start()
+}
+
+// pollCommands забирает ожидающие команды у бэкенда и отправляет результаты
+func pollCommands(ctx context.Context, fileStates *state.Store[time.Time]) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.Commands.PollURL, nil)
+	if err != nil {
+		commandLog.Errorf("Error polling commands: %v", err)
+		return
+	}
+	setPanelHeaders(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		commandLog.Errorf("Error polling commands: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == 204 {
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		commandLog.Errorf("Error polling commands: status %d - %s", resp.StatusCode, truncateBody(string(body)))
+		return
+	}
+
+	var commands []Command
+	if err := json.Unmarshal(body, &commands); err != nil {
+		commandLog.Errorf("Error parsing commands response: %v", err)
+		return
+	}
+
+	// Результат повторной команды отправляется снова: первый мог не дойти
+	for _, cmd := range commands {
+		result, _ := executeCommandOnce(ctx, cmd, fileStates)
+		reportCommandResult(ctx, result)
+	}
+}
+
+// executeCommandOnce выполняет команду, если команда с тем же id еще не
+// выполнялась, иначе возвращает сохраненный результат. Второе значение -
+// была ли команда выполнена сейчас. Вызывается только из основного цикла.
+func executeCommandOnce(ctx context.Context, cmd Command, fileStates *state.Store[time.Time]) (CommandResult, bool) {
+	if previous, ok := commandResults[cmd.ID]; ok && cmd.ID != "" {
+		commandLog.Infof("Command %s (id: %s) already executed, returning previous result", cmd.Name, cmd.ID)
+		return previous, false
+	}
+	result := executeCommand(ctx, cmd, fileStates)
+	if cmd.ID != "" {
+		rememberCommandResult(result)
+	}
+	return result, true
+}
+
+func rememberCommandResult(result CommandResult) {
+	commandResults[result.ID] = result
+	commandResultOrder = append(commandResultOrder, result.ID)
+	if len(commandResultOrder) > commandResultsKept {
+		delete(commandResults, commandResultOrder[0])
+		commandResultOrder = commandResultOrder[1:]
+	}
+}
+
+func reportCommandResult(ctx context.Context, result CommandResult) {
+	if cfg.Commands.ResultURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		commandLog.Errorf("Error marshaling command result: %v", err)
+		return
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Commands.ResultURL, bytes.NewReader(body))
+	if err != nil {
+		commandLog.Errorf("Error reporting command result %s: %v", result.ID, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setPanelHeaders(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		commandLog.Errorf("Error reporting command result %s: %v", result.ID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		commandLog.Errorf("Error reporting command result %s: status %d", result.ID, resp.StatusCode)
+	}
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agent-ws/config"
+	"agent-ws/sink"
+)
+
+const configFile = `C:\EVRIMA\agent-ws.json`
+
+// Режимы обработки слишком больших payload
+const (
+	oversizeTruncate  = "truncate"
+	oversizeChunk     = "chunk"
+	oversizeMultipart = "multipart"
+)
+
+// Кодирование тела запросов к API
+const (
+	contentJSON      = "json"
+	contentForm      = "form"
+	contentMultipart = "multipart"
+)
+
+// Config - настройки агента, читаемые из JSON-файла.
+// Отсутствующие поля получают значения по умолчанию.
+type Config struct {
+	// Endpoint API панели для событий
+	APIURL string `json:"api_url"`
+
+	// Идентификация агента и игрового сервера
+	Identity IdentityConfig `json:"identity"`
+
+	// Отслеживаемые папки базы Evrima (по умолчанию - только Players)
+	WatchTargets []WatchTarget `json:"watch_targets"`
+	// Несколько серверов Evrima на одной машине: у каждого свои папки,
+	// API, заголовки, имя сервера и sink
+	Instances []InstanceConfig `json:"instances"`
+	// Ждать появления отсутствующих папок перед запуском вместо повторных попыток
+	WaitForDirectory bool `json:"wait_for_directory"`
+	// Интервал сверки папок с состоянием агента для поиска событий,
+	// потерянных при переполнении буфера ОС (0 - выключено)
+	GapScanInterval Duration `json:"gap_scan_interval"`
+	// Шаблоны имен файлов, которые не обрабатываются (временные, резервные копии)
+	IgnorePatterns []string `json:"ignore_patterns"`
+
+	// Отчеты о доставке по часам для статистики панели
+	DeliveryReport DeliveryReportConfig `json:"delivery_report"`
+
+	// Интервал сводки метрик событий в логе (0 - выключено)
+	MetricsLogInterval Duration `json:"metrics_log_interval"`
+	// Контроль места на диске с логом и очередью
+	DiskWatchdog DiskWatchdogConfig `json:"disk_watchdog"`
+	// Уровень лога (error, warn, info, debug, trace) и уровни отдельных
+	// модулей: watcher, delivery, commands, admin, agent
+	LogLevel  string            `json:"log_level"`
+	LogLevels map[string]string `json:"log_levels"`
+	// Сколько символов тела ответа писать в лог (0 - без обрезки)
+	LogBodyLimit int `json:"log_body_limit"`
+	// Лог полных запросов и ответов неудачных отправок с маскированием
+	// секретов (пусто - выключено)
+	BodyDumpFile string `json:"body_dump_file"`
+	// Журнал записей в папку игры и команд RCON с цепочкой хэшей
+	// (пусто - выключено)
+	AuditLogFile string `json:"audit_log_file"`
+	// Отправка лога на syslog-сервер или HTTP endpoint
+	LogShipping LogShippingConfig `json:"log_shipping"`
+	// Трассировка конвейера событий в OpenTelemetry-коллектор
+	Tracing TracingConfig `json:"tracing"`
+	// Маскирование секретов и полей сохранений в логах
+	Redaction RedactionConfig `json:"redaction"`
+
+	// Число параллельных воркеров доставки (1 - доставка в основном цикле).
+	// События одного SteamID всегда доставляются по порядку одним воркером.
+	DeliveryWorkers int `json:"delivery_workers"`
+	// Схема события в API: 1 - прежний формат, 2 - конверт с payload и хэшами
+	EventSchema int `json:"event_schema"`
+	// Отправлять data строкой с экранированным JSON, как прежние версии агента
+	DataAsString bool `json:"data_as_string"`
+	// Кодирование тела запросов к API: json, form (x-www-form-urlencoded)
+	// или multipart (поля события и файл сохранения) - для прежних панелей
+	ContentType string `json:"content_type"`
+
+	// Максимальный размер поля data в байтах (0, по умолчанию, - без ограничения)
+	MaxPayloadSize int `json:"max_payload_size"`
+	// Что делать с payload больше лимита: truncate, chunk или multipart
+	OversizeMode string `json:"oversize_mode"`
+	// Endpoint для загрузки больших файлов через multipart/form-data
+	MultipartURL string `json:"multipart_url"`
+
+	// Ключ AES-256 (base64) для шифрования на диске очереди, номеров событий,
+	// вытесненного кэша содержимого и снимков snapshot_dir. Архив sink archive,
+	// body_dump_file и резервные копии сохранений (backup) им не шифруются -
+	// их защищают правами на папку. Можно задать через переменную окружения
+	// AGENT_WS_STATE_KEY.
+	StateEncryptionKey string `json:"state_encryption_key"`
+
+	// Файл с номерами последних подтвержденных событий по SteamID
+	SequenceFile string `json:"sequence_file"`
+
+	// События по файлам, которые уже есть при запуске: cache - только
+	// кэшировать, add - отправить каждый как новый, resync - сверить папки
+	StartupMode string `json:"startup_mode"`
+	// Отправлять при старте всю папку игроков одним событием full-snapshot
+	SnapshotOnStartup bool `json:"snapshot_on_startup"`
+	// Папка, куда при старте сохраняется снимок папки игроков
+	// для команды diff (пусто - не сохранять)
+	SnapshotDir string `json:"snapshot_dir"`
+
+	// Локальные копии сохранений игроков
+	Backup BackupConfig `json:"backup"`
+
+	// Папка очереди недоставленных событий и интервал повторной отправки
+	QueueDir           string   `json:"queue_dir"`
+	QueueRetryInterval Duration `json:"queue_retry_interval"`
+	// Подтверждение доставки: status (по HTTP-статусу) или strict (обязателен JSON ack)
+	AckMode string `json:"ack_mode"`
+
+	// Не отправлять события в HTTP API (только в дополнительные sink)
+	DisableHTTP bool `json:"disable_http"`
+
+	// Дополнительные места доставки событий: имя sink (database, redis,
+	// kafka, nats, mqtt, websocket, file, archive) -> его настройки
+	Sinks map[string]json.RawMessage `json:"sinks"`
+	// Секции database, redis и broker прежних версий: при загрузке
+	// переносятся в sinks
+	LegacyDatabase json.RawMessage `json:"database,omitempty"`
+	LegacyRedis    json.RawMessage `json:"redis,omitempty"`
+	LegacyBroker   json.RawMessage `json:"broker,omitempty"`
+
+	// Повторные попытки, таймауты и circuit breaker доставки: общая
+	// политика и политики отдельных sink (http, database, redis, ...)
+	Retry     RetryPolicy            `json:"retry"`
+	SinkRetry map[string]RetryPolicy `json:"sink_retry"`
+
+	// Тело событий отдельных sink (http, redis, kafka, nats, mqtt, websocket,
+	// file) по шаблону - для панелей, ожидающих другой формат
+	SinkTemplates map[string]sink.TemplateConfig `json:"sink_templates"`
+
+	// Ключ HMAC для подписи исходящих событий (пусто - без подписи)
+	SigningKey string `json:"signing_key"`
+
+	// User-Agent и дополнительные заголовки запросов к панели
+	// (например, CF-Access-Client-Id и CF-Access-Client-Secret)
+	UserAgent string            `json:"user_agent"`
+	Headers   map[string]string `json:"headers"`
+
+	// Таймауты исходящих запросов по фазам
+	Timeouts TimeoutsConfig `json:"timeouts"`
+	// HTTP/2, повторное использование соединений и кэш DNS
+	Transport TransportConfig `json:"transport"`
+	// Доставка событий потоком NDJSON вместо запроса на событие
+	Streaming StreamingConfig `json:"streaming"`
+
+	// Шифрование поля data на уровне приложения
+	PayloadEncryption PayloadEncryptionConfig `json:"payload_encryption"`
+
+	// TLS для исходящих запросов
+	TLS TLSConfig `json:"tls"`
+
+	// Прокси для исходящих запросов
+	Proxy ProxyConfig `json:"proxy"`
+
+	// Профиль памяти: default (полный кэш содержимого) или bounded
+	// (только хэши, очередь событий с ограничением и слиянием)
+	MemoryProfile string `json:"memory_profile"`
+	// Максимальное число ожидающих событий в bounded-режиме
+	MaxPendingEvents int `json:"max_pending_events"`
+	// Лимит содержимого файлов в памяти (0 - без ограничения) и папка,
+	// куда вытесняется содержимое давно не менявшихся файлов
+	ContentCacheSizeMB int    `json:"content_cache_size_mb"`
+	ContentCacheDir    string `json:"content_cache_dir"`
+	// Сжатие содержимого в кэше и вытесненного на диск: zstd или none
+	ContentCacheCompression string `json:"content_cache_compression"`
+
+	// SteamID, события файлов которых не отправляются, и файл с дополнительным
+	// списком, который меняется через API и перечитывается на лету
+	BlockedSteamIDs []string `json:"blocked_steamids"`
+	BlocklistFile   string   `json:"blocklist_file"`
+
+	// Включение отдельных событий и их имена для бэкенда, в том числе
+	// служебных heartbeat и version
+	Events map[string]EventTypeConfig `json:"events"`
+
+	// Приоритеты событий: при накопившейся очереди события с большим
+	// приоритетом отправляются первыми
+	EventPriorities map[string]int `json:"event_priorities"`
+
+	// События присутствия игроков по записи их файлов
+	Presence PresenceConfig `json:"presence"`
+	// События гибели динозавров по изменению сохранений
+	DeathEvents DeathEventsConfig `json:"death_events"`
+	// События достижения порогов роста динозавров
+	GrowthMilestones GrowthMilestonesConfig `json:"growth_milestones"`
+
+	// Пакетный режим на время массового сохранения игроков
+	Burst BurstConfig `json:"burst"`
+
+	// Координаты игроков на изображении карты
+	MapCoordinates MapCoordinatesConfig `json:"map_coordinates"`
+	// Канал живой карты с позицией и ростом игроков
+	LiveMap LiveMapConfig `json:"live_map"`
+
+	// Окна обслуживания, в которые события копятся в очереди или отбрасываются
+	Maintenance []MaintenanceWindow `json:"maintenance"`
+
+	// Пороги очереди недоставленных событий и политика отбрасывания
+	Backpressure BackpressureConfig `json:"backpressure"`
+
+	// Окно, в течение которого одинаковые события по игроку не отправляются повторно (0 - выключено)
+	DedupWindow Duration `json:"dedup_window"`
+
+	// Чтение лога сервера и отправка событий типа "server"
+	ServerLog ServerLogConfig `json:"server_log"`
+
+	// Получение команд от бэкенда
+	Commands CommandsConfig `json:"commands"`
+
+	// Первичная синхронизация со снимком состояния бэкенда
+	Priming PrimingConfig `json:"priming"`
+
+	// Сверка очереди с последними событиями, принятыми бэкендом
+	OffsetSync OffsetSyncConfig `json:"offset_sync"`
+
+	// Проверка, не новее ли сохранение на панели, перед add после сверки папки
+	ConflictCheck ConflictCheckConfig `json:"conflict_check"`
+
+	// Запись сохранений, измененных в панели
+	SaveEdits SaveEditsConfig `json:"save_edits"`
+
+	// Запись в папку игры при запущенном сервере
+	GameWrites GameWritesConfig `json:"game_writes"`
+
+	// RCON сервера для выполнения игровых команд
+	RCON RCONConfig `json:"rcon"`
+
+	// Критерии успешной доставки для отдельных endpoint
+	SuccessCriteria []SuccessCriteria `json:"success_criteria"`
+
+	// Локальный API управления агентом
+	AdminAPI AdminAPIConfig `json:"admin_api"`
+
+	// Режимы конвейеров по типу события: live, dry-run или shadow
+	Pipelines map[string]PipelineConfig `json:"pipelines"`
+
+	// Обновление агента из канала релизов
+	Update UpdateConfig `json:"update"`
+
+	// Каналы уведомлений об ошибках агента
+	Notifiers []NotifierConfig `json:"notifiers"`
+}
+
+var cfg Config
+
+// Duration - длительность в конфиге: строка вида "30s" или число секунд
+type Duration = config.Duration
+
+func defaultConfig() Config {
+	return Config{
+		APIURL:          defaultAPIURL,
+		EventSchema:     schemaV1,
+		DeliveryWorkers: 1,
+		Retry:           defaultRetryPolicy(),
+		IgnorePatterns:  defaultIgnorePatterns,
+
+		MetricsLogInterval: Duration{Duration: 5 * time.Minute},
+		GapScanInterval:    Duration{Duration: 5 * time.Minute},
+		DiskWatchdog: DiskWatchdogConfig{
+			Interval:       Duration{Duration: time.Minute},
+			WarnFreeMB:     2048,
+			CriticalFreeMB: 500,
+		},
+		LogLevel:     "info",
+		LogBodyLimit: 500,
+		Tracing:      TracingConfig{SampleRate: 1},
+		OversizeMode: oversizeTruncate,
+		ContentType:  contentJSON,
+
+		DeliveryReport: DeliveryReportConfig{
+			Interval: Duration{Duration: 15 * time.Minute},
+		},
+
+		SequenceFile:       `C:\EVRIMA\agent-ws.sequences.json`,
+		BlocklistFile:      `C:\EVRIMA\agent-ws.blocklist.json`,
+		QueueDir:           `C:\EVRIMA\agent-ws-queue`,
+		QueueRetryInterval: Duration{Duration: 30 * time.Second},
+		AckMode:            ackModeStatus,
+		StartupMode:        startupCache,
+
+		Timeouts: TimeoutsConfig{
+			Dial:           Duration{Duration: 10 * time.Second},
+			TLSHandshake:   Duration{Duration: 10 * time.Second},
+			ResponseHeader: Duration{Duration: 20 * time.Second},
+			Request:        Duration{Duration: 30 * time.Second},
+		},
+		Transport: TransportConfig{
+			HTTP2:               true,
+			KeepAlive:           Duration{Duration: 90 * time.Second},
+			MaxIdleConnsPerHost: 10,
+			Prewarm:             true,
+		},
+		Streaming: StreamingConfig{
+			MaxDuration: Duration{Duration: 10 * time.Second},
+			MaxEvents:   500,
+			Compression: streamCompressionGzip,
+		},
+
+		MemoryProfile:    memoryProfileDefault,
+		MaxPendingEvents: 10000,
+
+		ContentCacheSizeMB:      64,
+		ContentCacheDir:         `C:\EVRIMA\agent-ws-cache`,
+		ContentCacheCompression: cacheCompressionZstd,
+
+		EventPriorities: defaultEventPriorities(),
+
+		DedupWindow: Duration{Duration: 10 * time.Second},
+
+		Presence: PresenceConfig{
+			IdleThreshold: Duration{Duration: 10 * time.Minute},
+		},
+		DeathEvents: DeathEventsConfig{
+			AliveField: "bIsAlive",
+			GrowthDrop: 0.1,
+		},
+
+		Burst: BurstConfig{
+			Threshold:   50,
+			Gap:         Duration{Duration: 50 * time.Millisecond},
+			Settle:      Duration{Duration: 1 * time.Second},
+			MaxDuration: Duration{Duration: 30 * time.Second},
+		},
+
+		MapCoordinates: MapCoordinatesConfig{
+			LocationField: "Location_Isle_V3",
+		},
+		LiveMap: LiveMapConfig{
+			Interval: Duration{Duration: 2 * time.Second},
+		},
+
+		Backup: BackupConfig{
+			Compression: backupCompressionNone,
+			MinInterval: Duration{Duration: 5 * time.Minute},
+			KeepFor:     Duration{Duration: 7 * 24 * time.Hour},
+			MaxVersions: 100,
+		},
+
+		ServerLog: ServerLogConfig{
+			Path:         `C:\EVRIMA\surv_server\TheIsle\Saved\Logs\TheIsle.log`,
+			PollInterval: Duration{Duration: 1 * time.Second},
+		},
+
+		Commands: CommandsConfig{
+			PollInterval: Duration{Duration: 15 * time.Second},
+		},
+
+		Priming: PrimingConfig{
+			MarkerFile: `C:\EVRIMA\agent-ws.primed`,
+		},
+
+		ConflictCheck: ConflictCheckConfig{
+			Policy: conflictKeepPanel,
+		},
+
+		SaveEdits: SaveEditsConfig{
+			RequireOffline: true,
+		},
+
+		GameWrites: GameWritesConfig{
+			ProcessName: "TheIsleServer-Win64-Shipping.exe",
+			Policy:      gameWriteDefer,
+			MaxWait:     Duration{Duration: 24 * time.Hour},
+		},
+
+		RCON: RCONConfig{
+			Timeout: Duration{Duration: 5 * time.Second},
+		},
+
+		Update: UpdateConfig{
+			CheckInterval: Duration{Duration: 6 * time.Hour},
+		},
+	}
+}
+
+func loadConfig(path string) (Config, error) {
+	c := defaultConfig()
+	if err := config.Load(path, &c); err != nil {
+		return c, err
+	}
+
+	notes, err := migrateLegacySinks(&c)
+	if err != nil {
+		return c, err
+	}
+	for _, note := range notes {
+		agentLog.Warnf("Config: %s", note)
+	}
+
+	if err := c.validate(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	if c.APIURL == "" {
+		return fmt.Errorf("api_url is required")
+	}
+
+	if err := validateEventSchema(c.EventSchema); err != nil {
+		return err
+	}
+
+	if err := validateIgnorePatterns(c.IgnorePatterns); err != nil {
+		return err
+	}
+
+	if err := validateLogLevels(c); err != nil {
+		return err
+	}
+
+	if err := validateLogShipping(c.LogShipping); err != nil {
+		return err
+	}
+
+	if err := validateTracing(c.Tracing); err != nil {
+		return err
+	}
+
+	if c.LogBodyLimit < 0 {
+		return fmt.Errorf("log_body_limit must not be negative")
+	}
+
+	if c.MaxPayloadSize < 0 {
+		return fmt.Errorf("max_payload_size must not be negative")
+	}
+
+	if c.DeliveryReport.URL != "" && c.DeliveryReport.Interval.Duration <= 0 {
+		return fmt.Errorf("delivery_report.interval must be positive")
+	}
+
+	if c.DeliveryWorkers < 1 {
+		return fmt.Errorf("delivery_workers must be at least 1")
+	}
+
+	if c.GapScanInterval.Duration < 0 {
+		return fmt.Errorf("gap_scan_interval must not be negative")
+	}
+
+	if err := c.DiskWatchdog.validate(); err != nil {
+		return err
+	}
+
+	if c.Identity.HeartbeatInterval.Duration < 0 {
+		return fmt.Errorf("identity.heartbeat_interval must not be negative")
+	}
+
+	if err := validateMaintenanceWindows(c.Maintenance); err != nil {
+		return err
+	}
+
+	if err := c.Backpressure.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Presence.validate(); err != nil {
+		return err
+	}
+	if err := c.DeathEvents.validate(); err != nil {
+		return err
+	}
+	if err := c.GrowthMilestones.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Backup.validate(); err != nil {
+		return err
+	}
+
+	if c.DedupWindow.Duration < 0 {
+		return fmt.Errorf("dedup_window must not be negative")
+	}
+
+	if c.ServerLog.Enabled && c.ServerLog.PollInterval.Duration <= 0 {
+		return fmt.Errorf("server_log.poll_interval must be positive")
+	}
+
+	if c.Commands.PollURL != "" && c.Commands.PollInterval.Duration <= 0 {
+		return fmt.Errorf("commands.poll_interval must be positive")
+	}
+	if err := c.Commands.Webhook.validate(); err != nil {
+		return err
+	}
+
+	if c.RCON.Address != "" && c.RCON.Timeout.Duration <= 0 {
+		return fmt.Errorf("rcon.timeout must be positive")
+	}
+
+	if err := c.AdminAPI.validate(); err != nil {
+		return err
+	}
+
+	if err := validateSinks(c); err != nil {
+		return err
+	}
+
+	if err := validateInstances(c); err != nil {
+		return err
+	}
+
+	if err := validateRetryPolicies(c); err != nil {
+		return err
+	}
+
+	if err := validateSinkTemplates(c); err != nil {
+		return err
+	}
+
+	if err := validateHeaders(c.Headers); err != nil {
+		return err
+	}
+
+	if err := c.Timeouts.validate(); err != nil {
+		return err
+	}
+	if err := c.Transport.validate(); err != nil {
+		return err
+	}
+	if err := c.Streaming.validate(c); err != nil {
+		return err
+	}
+	if err := c.ConflictCheck.validate(); err != nil {
+		return err
+	}
+	if err := c.GameWrites.validate(); err != nil {
+		return err
+	}
+	if err := c.Burst.validate(); err != nil {
+		return err
+	}
+	if err := c.MapCoordinates.validate(); err != nil {
+		return err
+	}
+	if err := c.LiveMap.validate(); err != nil {
+		return err
+	}
+
+	if c.QueueRetryInterval.Duration <= 0 {
+		return fmt.Errorf("queue_retry_interval must be positive")
+	}
+	switch c.AckMode {
+	case ackModeStatus, ackModeStrict:
+	default:
+		return fmt.Errorf("unknown ack_mode %q", c.AckMode)
+	}
+	switch c.StartupMode {
+	case startupCache, startupAdd, startupResync:
+	default:
+		return fmt.Errorf("unknown startup_mode %q", c.StartupMode)
+	}
+
+	if err := c.Update.validate(); err != nil {
+		return err
+	}
+
+	if err := validatePipelines(c.Pipelines); err != nil {
+		return err
+	}
+
+	switch c.MemoryProfile {
+	case memoryProfileDefault, memoryProfileBounded:
+	default:
+		return fmt.Errorf("unknown memory_profile %q", c.MemoryProfile)
+	}
+	if c.MaxPendingEvents <= 0 {
+		return fmt.Errorf("max_pending_events must be positive")
+	}
+	if c.ContentCacheSizeMB < 0 {
+		return fmt.Errorf("content_cache_size_mb must not be negative")
+	}
+	switch c.ContentCacheCompression {
+	case cacheCompressionNone, cacheCompressionZstd:
+	default:
+		return fmt.Errorf("unknown content_cache_compression %q", c.ContentCacheCompression)
+	}
+
+	if err := validateContentType("content_type", c.ContentType); err != nil {
+		return err
+	}
+
+	switch c.OversizeMode {
+	case oversizeTruncate, oversizeChunk:
+	case oversizeMultipart:
+		if c.MultipartURL == "" {
+			return fmt.Errorf("multipart_url is required when oversize_mode is %q", oversizeMultipart)
+		}
+	default:
+		return fmt.Errorf("unknown oversize_mode %q", c.OversizeMode)
+	}
+	return nil
+}
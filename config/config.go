@@ -0,0 +1,58 @@
+// Package config содержит общие для настроек агента типы и чтение
+// JSON-файла конфигурации поверх значений по умолчанию.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Duration - длительность в конфиге: строка вида "30s" или число секунд
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %v", v, err)
+		}
+		d.Duration = parsed
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Load читает JSON-файл поверх значений, уже записанных в dst.
+// Если файла нет, dst не меняется и ошибки нет.
+func Load(path string, dst interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Файла нет - работаем на значениях по умолчанию
+			return nil
+		}
+		return fmt.Errorf("read config: %v", err)
+	}
+
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("parse config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+	}{
+		{`"30s"`, 30 * time.Second},
+		{`"1h30m"`, 90 * time.Minute},
+		{`15`, 15 * time.Second},
+		{`0.5`, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		var d Duration
+		if err := json.Unmarshal([]byte(tt.input), &d); err != nil {
+			t.Fatalf("%s: %v", tt.input, err)
+		}
+		if d.Duration != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.input, d.Duration, tt.want)
+		}
+	}
+
+	for _, input := range []string{`"soon"`, `true`, `{}`} {
+		var d Duration
+		if err := json.Unmarshal([]byte(input), &d); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestDurationRoundTrip(t *testing.T) {
+	data, err := json.Marshal(Duration{Duration: 90 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d Duration
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatal(err)
+	}
+	if d.Duration != 90*time.Second {
+		t.Fatalf("got %v after round trip of %s", d.Duration, data)
+	}
+}
+
+type testConfig struct {
+	Name     string   `json:"name"`
+	Interval Duration `json:"interval"`
+}
+
+// Поля, которых нет в файле, сохраняют значения по умолчанию
+func TestLoadKeepsDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, []byte(`{"name": "evrima-1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := testConfig{Name: "default", Interval: Duration{Duration: time.Minute}}
+	if err := Load(path, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "evrima-1" || c.Interval.Duration != time.Minute {
+		t.Fatalf("got %+v", c)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	c := testConfig{Name: "default"}
+	if err := Load(filepath.Join(t.TempDir(), "missing.json"), &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "default" {
+		t.Fatalf("defaults changed: %+v", c)
+	}
+}
+
+func TestLoadInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.json")
+	if err := os.WriteFile(path, []byte(`{"name": `), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(path, &testConfig{}); err == nil {
+		t.Fatal("expected parse error")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-ws/state"
+)
+
+// ConflictCheckConfig - проверка перед отправкой add после сверки папки:
+// если сохранение на панели новее файла (например, его правили в панели),
+// агент не затирает его молча
+type ConflictCheckConfig struct {
+	// Endpoint состояния игрока на бэкенде: {steamid} и {instance}
+	// заменяются значениями (пусто - выключено). Ответ: {"hash": "...", "updated_at": "RFC3339"}
+	URL string `json:"url"`
+	// keep_panel - отправить событие конфликта и не отправлять файл,
+	// overwrite - отправить событие конфликта и затем файл
+	Policy string `json:"policy"`
+}
+
+const (
+	conflictKeepPanel = "keep_panel"
+	conflictOverwrite = "overwrite"
+)
+
+// Событие о расхождении файла и панели
+const conflictEvent = "save-conflict"
+
+func (c ConflictCheckConfig) validate() error {
+	switch c.Policy {
+	case conflictKeepPanel, conflictOverwrite:
+		return nil
+	}
+	return fmt.Errorf("conflict_check.policy must be %s or %s", conflictKeepPanel, conflictOverwrite)
+}
+
+// backendSave - сохранение игрока, как его хранит бэкенд
+type backendSave struct {
+	Hash      string `json:"hash"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// saveConflict - данные события конфликта
+type saveConflict struct {
+	File             string `json:"file"`
+	FileHash         string `json:"file_hash"`
+	FileModifiedAt   string `json:"file_modified_at"`
+	BackendHash      string `json:"backend_hash"`
+	BackendUpdatedAt string `json:"backend_updated_at"`
+	Resolution       string `json:"resolution"`
+}
+
+// checkResyncConflict проверяет новый при сверке файл игрока против бэкенда.
+// Возвращает true, если файл обработан и add отправлять не нужно.
+// При ошибке запроса файл отправляется как обычно.
+func checkResyncConflict(ctx context.Context, t *WatchTarget, filename, steamID string, fileStates *state.Store[time.Time]) bool {
+	if cfg.ConflictCheck.URL == "" || t.Type != "player" {
+		return false
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	hash, ok := localHash(filename)
+	if !ok {
+		return false
+	}
+
+	endpoint := strings.NewReplacer(
+		"{steamid}", url.PathEscape(steamID),
+		"{instance}", url.PathEscape(t.instance),
+	).Replace(cfg.ConflictCheck.URL)
+	var remote backendSave
+	if err := fetchBackendJSON(ctx, endpoint, &remote); err != nil {
+		if !errors.Is(err, errBackendNotFound) {
+			watchLog.Warnf("Error checking backend save of SteamID %s, sending file: %v", steamID, err)
+		}
+		return false
+	}
+	if remote.Hash == "" || remote.Hash == hash {
+		return false
+	}
+	updatedAt, err := time.Parse(time.RFC3339, remote.UpdatedAt)
+	if err != nil || !updatedAt.After(info.ModTime()) {
+		return false
+	}
+
+	policy := cfg.ConflictCheck.Policy
+	watchLog.Warnf("Backend save of SteamID %s (updated %s) is newer than %s (modified %s), resolution: %s",
+		steamID, updatedAt.Format(time.RFC3339), filepath.Base(filename), info.ModTime().Format(time.RFC3339), policy)
+
+	data, err := json.Marshal(saveConflict{
+		File:             filepath.Base(filename),
+		FileHash:         hash,
+		FileModifiedAt:   info.ModTime().UTC().Format(time.RFC3339),
+		BackendHash:      remote.Hash,
+		BackendUpdatedAt: remote.UpdatedAt,
+		Resolution:       policy,
+	})
+	if err != nil {
+		watchLog.Errorf("Error encoding conflict event: %v", err)
+		return false
+	}
+	sendEventWithRetry(ctx, EventData{
+		SteamID64: steamID,
+		Type:      t.EventType,
+		Event:     conflictEvent,
+		Data:      data,
+		Instance:  t.instance,
+	})
+
+	if policy == conflictOverwrite {
+		return false
+	}
+
+	// Файл отслеживается без отправки: следующие изменения уйдут как change,
+	// а его текущее содержимое остается в локальных копиях
+	content, err := readFileContentWithRetry(ctx, filename)
+	if err != nil {
+		watchLog.Errorf("Error reading file %s: %v", filepath.Base(filename), err)
+		return true
+	}
+	cacheContent(filename, content)
+	backupSave(filename, steamID, content)
+	fileStates.Set(filename, info.ModTime())
+	return true
+}
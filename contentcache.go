@@ -0,0 +1,238 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Сжатие содержимого в кэше: none или zstd
+const (
+	cacheCompressionNone = "none"
+	cacheCompressionZstd = "zstd"
+)
+
+// contentCache - кэш содержимого файлов с ограничением по размеру. В памяти
+// хранится содержимое недавно измененных файлов, остальное вытесняется
+// в папку на диске. Хэши всех файлов хранятся отдельно в fileHashes.
+// Со сжатием содержимое хранится в zstd и распаковывается только при
+// чтении (события удаления, сравнения), лимит считается по сжатому объему.
+type contentCache struct {
+	mu       sync.Mutex
+	maxBytes int // 0 - без ограничения
+	size     int
+	rawSize  int        // Объем содержимого до сжатия
+	order    *list.List // В начале - недавно использованные
+	items    map[string]*list.Element
+	spillDir string // Пусто - вытесненное содержимое не сохраняется
+
+	// nil - содержимое хранится как есть
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+type cacheEntry struct {
+	filename string
+	blob     []byte
+	rawSize  int
+}
+
+func newContentCache(maxBytes int, spillDir, compression string) (*contentCache, error) {
+	if spillDir != "" {
+		if err := os.MkdirAll(spillDir, 0755); err != nil {
+			return nil, fmt.Errorf("create content cache dir: %v", err)
+		}
+		// Содержимое прошлого запуска устарело: кэш заполнится при сканировании папок
+		old, _ := filepath.Glob(filepath.Join(spillDir, "*.cache"))
+		for _, path := range old {
+			os.Remove(path)
+		}
+	}
+	c := &contentCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+		spillDir: spillDir,
+	}
+	if compression == cacheCompressionZstd {
+		var err error
+		if c.enc, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest)); err != nil {
+			return nil, err
+		}
+		if c.dec, err = zstd.NewReader(nil); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// pack сжимает содержимое для хранения
+func (c *contentCache) pack(content string) []byte {
+	if c.enc == nil {
+		return []byte(content)
+	}
+	return c.enc.EncodeAll([]byte(content), nil)
+}
+
+func (c *contentCache) unpack(filename string, blob []byte) (string, bool) {
+	if c.dec == nil {
+		return string(blob), true
+	}
+	data, err := c.dec.DecodeAll(blob, nil)
+	if err != nil {
+		watchLog.Errorf("Error decompressing cached content of %s: %v", filepath.Base(filename), err)
+		return "", false
+	}
+	return string(data), true
+}
+
+func (c *contentCache) Set(filename, content string) {
+	blob := c.pack(content)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[filename]; ok {
+		entry := elem.Value.(*cacheEntry)
+		c.size += len(blob) - len(entry.blob)
+		c.rawSize += len(content) - entry.rawSize
+		entry.blob, entry.rawSize = blob, len(content)
+		c.order.MoveToFront(elem)
+	} else {
+		c.push(&cacheEntry{filename: filename, blob: blob, rawSize: len(content)})
+		// Свежее содержимое в памяти важнее вытесненной копии
+		c.removeSpilled(filename)
+	}
+	c.evict()
+}
+
+func (c *contentCache) push(entry *cacheEntry) {
+	c.items[entry.filename] = c.order.PushFront(entry)
+	c.size += len(entry.blob)
+	c.rawSize += entry.rawSize
+}
+
+// Get ищет содержимое в памяти, затем среди вытесненного на диск.
+// Прочитанное с диска возвращается в память как недавно использованное.
+func (c *contentCache) Get(filename string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[filename]; ok {
+		c.order.MoveToFront(elem)
+		return c.unpack(filename, elem.Value.(*cacheEntry).blob)
+	}
+
+	blob, ok := c.readSpilled(filename)
+	if !ok {
+		return "", false
+	}
+	content, ok := c.unpack(filename, blob)
+	if !ok {
+		return "", false
+	}
+	c.removeSpilled(filename)
+	c.push(&cacheEntry{filename: filename, blob: blob, rawSize: len(content)})
+	c.evict()
+	return content, true
+}
+
+func (c *contentCache) Delete(filename string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[filename]; ok {
+		entry := elem.Value.(*cacheEntry)
+		c.size -= len(entry.blob)
+		c.rawSize -= entry.rawSize
+		c.order.Remove(elem)
+		delete(c.items, filename)
+	}
+	c.removeSpilled(filename)
+}
+
+// Len возвращает число файлов, содержимое которых хранится в памяти
+func (c *contentCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Size возвращает объем содержимого в памяти в байтах (после сжатия)
+func (c *contentCache) Size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// RawSize возвращает объем содержимого в памяти до сжатия
+func (c *contentCache) RawSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rawSize
+}
+
+// evict вытесняет давно не использованные файлы, пока кэш больше лимита.
+// Последний добавленный файл остается в памяти, даже если он больше лимита.
+func (c *contentCache) evict() {
+	for c.maxBytes > 0 && c.size > c.maxBytes && c.order.Len() > 1 {
+		elem := c.order.Back()
+		entry := elem.Value.(*cacheEntry)
+		c.order.Remove(elem)
+		delete(c.items, entry.filename)
+		c.size -= len(entry.blob)
+		c.rawSize -= entry.rawSize
+		c.spill(entry)
+	}
+}
+
+func (c *contentCache) spillPath(filename string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(filename)))
+	return filepath.Join(c.spillDir, hex.EncodeToString(sum[:16])+".cache")
+}
+
+// spill сохраняет вытесненное содержимое на диск (сжатым, если сжатие
+// включено): оно понадобится для события удаления, если файл игрока пропадет
+func (c *contentCache) spill(entry *cacheEntry) {
+	if c.spillDir == "" {
+		return
+	}
+	data, err := sealState(entry.blob)
+	if err == nil {
+		err = writeFileAtomic(c.spillPath(entry.filename), data)
+	}
+	if err != nil {
+		watchLog.Errorf("Error spilling cached content of %s: %v", filepath.Base(entry.filename), err)
+	}
+}
+
+func (c *contentCache) readSpilled(filename string) ([]byte, bool) {
+	if c.spillDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.spillPath(filename))
+	if err != nil {
+		return nil, false
+	}
+	if data, err = openState(data); err != nil {
+		watchLog.Errorf("Error reading spilled content of %s: %v", filepath.Base(filename), err)
+		return nil, false
+	}
+	return data, true
+}
+
+func (c *contentCache) removeSpilled(filename string) {
+	if c.spillDir == "" {
+		return
+	}
+	if err := os.Remove(c.spillPath(filename)); err != nil && !os.IsNotExist(err) {
+		watchLog.Errorf("Error removing spilled content of %s: %v", filepath.Base(filename), err)
+	}
+}
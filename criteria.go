@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Виды ответов, которые не являются ответом API
+const (
+	responseHTML      = "html"
+	responseChallenge = "cloudflare_challenge"
+	responseMarker    = "forbidden_marker"
+)
+
+// Признаки страницы проверки Cloudflare (JS challenge, капча)
+var cloudflareChallengeMarkers = []string{"/cdn-cgi/challenge-platform/", "cf-chl-", "<title>Just a moment...</title>"}
+
+// SuccessCriteria - что считается успешной доставкой для конкретного endpoint
+type SuccessCriteria struct {
+	// Endpoint; "*" - критерии для всех endpoint без собственных
+	URL string `json:"url"`
+	// Допустимые HTTP-коды (пусто - любой 2xx)
+	StatusCodes []int `json:"status_codes"`
+	// Ответ обязан быть JSON (подразумевается, если заданы required_fields)
+	RequireJSON bool `json:"require_json"`
+	// Поля JSON-ответа и их ожидаемые значения, например {"success": true, "data.ok": 1}
+	RequiredFields map[string]interface{} `json:"required_fields"`
+	// Подстроки, наличие которых в ответе означает страницу ошибки
+	ForbiddenMarkers []string `json:"forbidden_markers"`
+}
+
+// responseVerdict - результат проверки ответа по критериям endpoint
+type responseVerdict struct {
+	success bool
+	// Вид ответа, не являющегося ответом API (пусто - ответ API)
+	kind   string
+	reason string
+}
+
+// criteriaFor возвращает критерии для endpoint, общие критерии "*"
+// или критерии по умолчанию
+func criteriaFor(url string) SuccessCriteria {
+	var fallback SuccessCriteria
+	for _, c := range cfg.SuccessCriteria {
+		switch c.URL {
+		case url:
+			return c
+		case "*":
+			fallback = c
+		}
+	}
+	return fallback
+}
+
+// evaluateResponse проверяет ответ по критериям endpoint. Страница вместо
+// ответа API определяется по Content-Type, а не по тексту: ответ может
+// содержать эхо сохранения игрока с любыми строками.
+func evaluateResponse(url string, resp *http.Response, body string) responseVerdict {
+	criteria := criteriaFor(url)
+
+	if isCloudflareChallenge(resp, body) {
+		return responseVerdict{
+			kind:   responseChallenge,
+			reason: "request was stopped by a Cloudflare challenge or Access login",
+		}
+	}
+	if contentType := responseContentType(resp, body); isHTMLContentType(contentType) {
+		return responseVerdict{
+			kind:   responseHTML,
+			reason: fmt.Sprintf("response Content-Type is %s", contentType),
+		}
+	}
+
+	for _, marker := range criteria.ForbiddenMarkers {
+		if strings.Contains(body, marker) {
+			return responseVerdict{
+				kind:   responseMarker,
+				reason: fmt.Sprintf("response contains forbidden marker %q", marker),
+			}
+		}
+	}
+
+	if !statusAccepted(criteria.StatusCodes, resp.StatusCode) {
+		return responseVerdict{reason: fmt.Sprintf("unexpected status code %d", resp.StatusCode)}
+	}
+
+	if criteria.RequireJSON || len(criteria.RequiredFields) > 0 {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(body), &parsed); err != nil {
+			return responseVerdict{reason: fmt.Sprintf("response is not valid JSON: %v", err)}
+		}
+		for path, expected := range criteria.RequiredFields {
+			actual, ok := lookupJSONPath(parsed, path)
+			if !ok {
+				return responseVerdict{reason: fmt.Sprintf("required field %q is missing", path)}
+			}
+			// Оба значения получены JSON-декодированием, поэтому числа - float64
+			if !reflect.DeepEqual(actual, expected) {
+				return responseVerdict{reason: fmt.Sprintf("field %q is %v, expected %v", path, actual, expected)}
+			}
+		}
+	}
+
+	return responseVerdict{success: true}
+}
+
+// responseContentType возвращает тип содержимого ответа; без заголовка
+// Content-Type тип определяется по началу тела
+func responseContentType(resp *http.Response, body string) string {
+	header := resp.Header.Get("Content-Type")
+	if header == "" {
+		header = http.DetectContentType([]byte(body))
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return strings.ToLower(header)
+	}
+	return mediaType
+}
+
+func isHTMLContentType(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// isCloudflareChallenge распознает страницу проверки Cloudflare и
+// перенаправление на вход Cloudflare Access
+func isCloudflareChallenge(resp *http.Response, body string) bool {
+	if resp.Header.Get("Cf-Mitigated") == "challenge" {
+		return true
+	}
+	if resp.Request != nil && strings.HasSuffix(resp.Request.URL.Hostname(), ".cloudflareaccess.com") {
+		return true
+	}
+	if !strings.EqualFold(resp.Header.Get("Server"), "cloudflare") {
+		return false
+	}
+	for _, marker := range cloudflareChallengeMarkers {
+		if strings.Contains(body, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+func statusAccepted(codes []int, statusCode int) bool {
+	if len(codes) == 0 {
+		return statusCode >= 200 && statusCode < 300
+	}
+	for _, code := range codes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupJSONPath достает значение по пути вида "data.result.ok"
+func lookupJSONPath(value interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
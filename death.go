@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Событие гибели динозавра
+const eventDinoDeath = "dino-death"
+
+// Признаки гибели в переходе сохранения
+const (
+	deathAliveFlag   = "alive_flag"
+	deathNewDino     = "new_dino"
+	deathGrowthReset = "growth_reset"
+	deathFileReset   = "file_reset"
+)
+
+// DeathEventsConfig - вывод гибели динозавра из изменения сохранения:
+// флаг жизни сброшен, класс сменился, рост упал или сохранение обнулено
+type DeathEventsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Поле сохранения с флагом жизни
+	AliveField string `json:"alive_field"`
+	// На сколько должен упасть рост, чтобы это считалось новой жизнью
+	GrowthDrop float64 `json:"growth_drop"`
+}
+
+func (c DeathEventsConfig) validate() error {
+	if c.Enabled && c.GrowthDrop <= 0 {
+		return fmt.Errorf("death_events.growth_drop must be positive")
+	}
+	return nil
+}
+
+// detectDeath сравнивает прежнее и новое состояние динозавра игрока и,
+// если прежний динозавр погиб, отправляет событие dino-death с его сводкой
+func detectDeath(ctx context.Context, filename, steamID string, previous, current dinoState) {
+	if !cfg.DeathEvents.Enabled {
+		return
+	}
+	before := previous.fields
+	reason := deathReason(before, current.fields)
+	if reason == "" {
+		return
+	}
+
+	t := targetFor(filename)
+	summary := map[string]interface{}{
+		"reason":        reason,
+		"previous_hash": previous.hash,
+	}
+	for name, field := range map[string]string{
+		"character_class": "CharacterClass",
+		"gender":          "bGender",
+		"location":        cfg.MapCoordinates.LocationField,
+		"marks":           "MarksTemp",
+	} {
+		if v, ok := before[field]; ok {
+			summary[name] = v
+		}
+	}
+	if growth := saveNumber(before["Growth"]); growth != nil {
+		summary["growth"] = *growth
+	}
+	if position := positionFromSave(t.instance, before); position != nil {
+		summary["position"] = position
+	}
+	data, _ := json.Marshal(summary)
+
+	watchLog.Infof("Dino of SteamID %s died (%s), file %s", steamID, reason, filepath.Base(filename))
+	sendEventWithRetry(ctx, EventData{
+		SteamID64:  steamID,
+		Type:       "death",
+		Event:      eventDinoDeath,
+		Data:       data,
+		Instance:   t.instance,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339Nano),
+	})
+}
+
+// deathReason возвращает признак гибели или пустую строку
+func deathReason(before, after map[string]interface{}) string {
+	if alive, ok := before[cfg.DeathEvents.AliveField].(bool); ok && alive {
+		if now, ok := after[cfg.DeathEvents.AliveField].(bool); ok && !now {
+			return deathAliveFlag
+		}
+	}
+
+	class, _ := before["CharacterClass"].(string)
+	if class == "" {
+		return ""
+	}
+	switch newClass, _ := after["CharacterClass"].(string); {
+	case newClass == "":
+		return deathFileReset
+	case newClass != class:
+		return deathNewDino
+	}
+
+	oldGrowth, newGrowth := saveNumber(before["Growth"]), saveNumber(after["Growth"])
+	if oldGrowth != nil && newGrowth != nil && *oldGrowth-*newGrowth >= cfg.DeathEvents.GrowthDrop {
+		return deathGrowthReset
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"sync"
+	"time"
+
+	"agent-ws/state"
+)
+
+var publishDebugVars sync.Once
+
+// registerDebugHandlers подключает pprof, expvar и дамп состояния агента
+// для поиска утечек памяти и зависаний. Доступны только с токеном admin API.
+func registerDebugHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/pprof/", pprof.Index)
+	mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+	mux.HandleFunc("GET /debug/dump", handleDebugDump)
+
+	publishDebugVars.Do(func() {
+		expvar.Publish("agent_ws", expvar.Func(func() interface{} {
+			return map[string]interface{}{
+				"uptime_seconds":   int64(time.Since(agentStartTime).Seconds()),
+				"goroutines":       runtime.NumGoroutine(),
+				"queued_events":    eventQueueStore.len(),
+				"in_flight":        inFlightEvents.Len(),
+				"cached_files":     fileCache.Len(),
+				"cached_bytes":     fileCache.Size(),
+				"cached_raw_bytes": fileCache.RawSize(),
+				"watcher":          watcherState.status(),
+			}
+		}))
+	})
+}
+
+// handleDebugDump выводит память, очереди и стеки всех горутин.
+// Стеки пишутся без обращения к основному циклу, чтобы дамп
+// работал и тогда, когда цикл завис.
+func handleDebugDump(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	fmt.Fprintf(w, "=== agent-ws dump %s ===\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(w, "uptime: %v, goroutines: %d\n", time.Since(agentStartTime).Round(time.Second), runtime.NumGoroutine())
+	fmt.Fprintf(w, "heap alloc: %d, heap in use: %d, sys: %d, gc cycles: %d\n",
+		mem.HeapAlloc, mem.HeapInuse, mem.Sys, mem.NumGC)
+	fmt.Fprintf(w, "cached files: %d, queued events: %d, in flight: %d\n",
+		fileCache.Len(), eventQueueStore.len(), inFlightEvents.Len())
+
+	fmt.Fprintln(w, "\n=== pending events ===")
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	if !dumpPendingEvents(ctx, w) {
+		fmt.Fprintln(w, "main loop is busy, pending events are not available")
+	}
+
+	fmt.Fprintln(w, "\n=== goroutines ===")
+	if err := runtimepprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		fmt.Fprintf(w, "error writing goroutine dump: %v\n", err)
+	}
+}
+
+// dumpPendingEvents выводит отложенные события из основного цикла
+func dumpPendingEvents(ctx context.Context, w http.ResponseWriter) bool {
+	var lines []string
+	call := adminCall{
+		run: func(_ context.Context, fileStates *state.Store[time.Time]) {
+			lines = append(lines, fmt.Sprintf("tracked files: %d, paused: %v, backpressure: %v",
+				fileStates.Len(), paused, backpressureActive))
+			for _, q := range []struct {
+				name  string
+				queue *eventQueue
+			}{{"pending", pendingEvents}, {"deferred", deferredEvents}} {
+				if q.queue == nil {
+					continue
+				}
+				lines = append(lines, fmt.Sprintf("%s: %d of %d", q.name, len(q.queue.items), q.queue.capacity))
+				for _, filename := range q.queue.order {
+					if item, ok := q.queue.items[filename]; ok {
+						lines = append(lines, fmt.Sprintf("  %s %s %s", filepath.Base(item.filename),
+							item.op, item.updatedAt.Format(time.RFC3339)))
+					}
+				}
+			}
+		},
+		done: make(chan struct{}),
+	}
+
+	select {
+	case adminCalls <- call:
+	case <-ctx.Done():
+		return false
+	}
+	<-call.done
+
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+	return true
+}
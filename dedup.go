@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"agent-ws/state"
+)
+
+// deliveredEvent - последнее доставленное событие по типу и SteamID
+type deliveredEvent struct {
+	event string
+	hash  string
+	at    time.Time
+}
+
+var (
+	lastDelivered   = state.New[deliveredEvent]()
+	lastDedupPruned time.Time
+)
+
+// isDuplicateEvent проверяет, было ли за окно дедупликации доставлено
+// событие с тем же содержимым. Изменение с тем же содержимым, что и
+// только что отправленное добавление, тоже считается дубликатом.
+func isDuplicateEvent(eventType, steamID, event, hash string) bool {
+	window := cfg.DedupWindow.Duration
+	if window <= 0 {
+		return false
+	}
+	pruneDelivered(window)
+
+	last, ok := lastDelivered.Get(dedupKey(eventType, steamID))
+	if !ok || time.Since(last.at) > window || last.hash != hash {
+		return false
+	}
+
+	if last.event == event {
+		return true
+	}
+	return isAddThenChange(last.event, event)
+}
+
+func rememberDelivered(eventType, steamID, event, hash string) {
+	if cfg.DedupWindow.Duration <= 0 {
+		return
+	}
+	lastDelivered.Set(dedupKey(eventType, steamID), deliveredEvent{event: event, hash: hash, at: time.Now()})
+}
+
+func dedupKey(eventType, steamID string) string {
+	return eventType + "/" + steamID
+}
+
+// pruneDelivered удаляет записи старше окна, не чаще одного раза за окно
+func pruneDelivered(window time.Duration) {
+	if time.Since(lastDedupPruned) < window {
+		return
+	}
+	for key, last := range lastDelivered.Snapshot() {
+		if time.Since(last.at) > window {
+			lastDelivered.Delete(key)
+		}
+	}
+	lastDedupPruned = time.Now()
+}
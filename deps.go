@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"os"
+
+	"agent-ws/watcher"
+)
+
+// FileSystem - чтение сохранений игроков
+type FileSystem interface {
+	Open(name string) (fs.File, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// osFileSystem читает файлы с диска
+type osFileSystem struct{}
+
+func (osFileSystem) Open(name string) (fs.File, error)     { return os.Open(name) }
+func (osFileSystem) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+func (osFileSystem) ReadFile(name string) ([]byte, error)  { return os.ReadFile(name) }
+
+// Deps - внешние зависимости конвейера событий: файловая система, источник
+// событий папки, транспорт до бэкенда и процесс игрового сервера.
+// Агент работает с ними только через эти поля, тесты подставляют свои.
+type Deps struct {
+	// Источник событий для отслеживаемых папок
+	Watch func(paths []string) (watcher.Source, error)
+	Files FileSystem
+	// Транспорт HTTP-клиента (nil - собирается из настроек tls, proxy и transport)
+	Transport http.RoundTripper
+	// Запущен ли процесс сервера (проверка перед записью в папку игры)
+	ServerRunning func() (bool, error)
+}
+
+func defaultDeps() Deps {
+	return Deps{
+		Watch: watcher.New,
+		Files: osFileSystem{},
+		ServerRunning: func() (bool, error) {
+			return processRunning(cfg.GameWrites.ProcessName)
+		},
+	}
+}
+
+// Зависимости текущего запуска; main использует defaultDeps,
+// тесты заменяют отдельные поля
+var deps = defaultDeps()
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Минимальный запас свободного места на диске с логом
+const minFreeDiskSpace = 100 * 1024 * 1024
+
+// DiagnosticCheck - результат одной проверки самодиагностики
+type DiagnosticCheck struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Detail   string `json:"detail"`
+	Duration string `json:"duration"`
+}
+
+// DiagnosticReport - отчет самодиагностики агента
+type DiagnosticReport struct {
+	OK        bool              `json:"ok"`
+	Checks    []DiagnosticCheck `json:"checks"`
+	Timestamp string            `json:"timestamp"`
+}
+
+// runDiagnostics выполняет предстартовые проверки, проверку связи с API и диска
+func runDiagnostics(ctx context.Context) DiagnosticReport {
+	report := DiagnosticReport{OK: true}
+
+	checks := []struct {
+		name string
+		run  func() (string, error)
+	}{
+		{"config", checkConfig},
+		{"watch_path", checkWatchPath},
+		{"api_connectivity", func() (string, error) { return checkAPIConnectivity(ctx) }},
+		{"disk_space", checkDiskSpace},
+	}
+
+	for _, c := range checks {
+		start := time.Now()
+		detail, err := c.run()
+		check := DiagnosticCheck{
+			Name:     c.name,
+			OK:       err == nil,
+			Detail:   detail,
+			Duration: time.Since(start).String(),
+		}
+		if err != nil {
+			check.Detail = err.Error()
+			report.OK = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	report.Timestamp = time.Now().Format(time.RFC3339)
+	return report
+}
+
+func checkConfig() (string, error) {
+	c := cfg
+	if err := c.validate(); err != nil {
+		return "", err
+	}
+	return "configuration is valid", nil
+}
+
+func checkWatchPath() (string, error) {
+	var details []string
+	for _, t := range watchTargets {
+		info, err := os.Stat(t.Path)
+		if err != nil {
+			return "", err
+		}
+		if !info.IsDir() {
+			return "", fmt.Errorf("%s is not a directory", t.Path)
+		}
+
+		files, err := os.ReadDir(t.Path)
+		if err != nil {
+			return "", err
+		}
+		details = append(details, fmt.Sprintf("%d entries in %s", len(files), t.Path))
+	}
+	return strings.Join(details, "; "), nil
+}
+
+func checkAPIConnectivity(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", cfg.APIURL, nil)
+	if err != nil {
+		return "", err
+	}
+	// За Cloudflare Access без заголовков доступа панель недоступна
+	setPanelHeaders(req)
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	// Любой ответ сервера означает, что сеть и TLS в порядке
+	return fmt.Sprintf("HTTP %d in %v", resp.StatusCode, time.Since(start)), nil
+}
+
+func checkDiskSpace() (string, error) {
+	dir := filepath.Dir(logFile)
+	free, err := diskFreeBytes(dir)
+	if err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("%d MB free on %s", free/(1024*1024), dir)
+	if free < minFreeDiskSpace {
+		return "", fmt.Errorf("low disk space: %s", detail)
+	}
+	return detail, nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Операнд команды diff, означающий текущую папку игроков
+const liveSnapshot = "live"
+
+// runDiff - команда agent-ws diff: сравнение двух снимков папки игроков
+// (или снимка с текущей папкой) по игрокам - для разбора жалоб
+// вроде "пропал динозавр"
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	steamID := fs.String("steamid", "", "compare only this SteamID")
+	summary := fs.Bool("summary", false, "list changed players without field differences")
+	instance := fs.String("instance", "", "server instance whose players directory is live")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fmt.Println("Usage: agent-ws diff [--steamid X] [--summary] [--instance N] <snapshot-a> <snapshot-b|live>")
+		return 2
+	}
+
+	a, err := openDiffOperand(fs.Arg(0), *instance)
+	if err != nil {
+		fmt.Println("Error reading", fs.Arg(0)+":", err)
+		return 1
+	}
+	b, err := openDiffOperand(fs.Arg(1), *instance)
+	if err != nil {
+		fmt.Println("Error reading", fs.Arg(1)+":", err)
+		return 1
+	}
+
+	fmt.Printf("A: %s (%d players, taken %s)\n", fs.Arg(0), a.Count, a.GeneratedAt)
+	fmt.Printf("B: %s (%d players, taken %s)\n\n", fs.Arg(1), b.Count, b.GeneratedAt)
+
+	changes := diffSnapshots(a, b, *steamID)
+	for _, c := range changes {
+		printPlayerDiff(c, *summary)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No differences")
+	} else {
+		fmt.Printf("\n%d players differ\n", len(changes))
+	}
+	return 0
+}
+
+// openDiffOperand читает операнд diff: файл снимка, папку с сохранениями
+// или live - папку игроков из конфигурации
+func openDiffOperand(operand, instance string) (playerSnapshot, error) {
+	if operand == liveSnapshot {
+		if err := initWatchTargets(cfg.WatchTargets); err != nil {
+			return playerSnapshot{}, err
+		}
+		t := playersTarget(instance)
+		if t == nil {
+			return playerSnapshot{}, fmt.Errorf("no watch target with type player")
+		}
+		return scanSnapshot(t.Path)
+	}
+
+	info, err := os.Stat(operand)
+	if err != nil {
+		return playerSnapshot{}, err
+	}
+	if info.IsDir() {
+		return scanSnapshot(operand)
+	}
+	// Снимки из snapshot_dir зашифрованы, если задан ключ состояния
+	if err := initStateEncryption(cfg.StateEncryptionKey); err != nil {
+		return playerSnapshot{}, err
+	}
+	return loadSnapshot(operand)
+}
+
+// playerDiff - отличие файла игрока между снимками; a или b равны nil,
+// если файла нет в соответствующем снимке
+type playerDiff struct {
+	steamID string
+	a, b    *snapshotFile
+}
+
+func diffSnapshots(a, b playerSnapshot, steamID string) []playerDiff {
+	index := func(s playerSnapshot) map[string]*snapshotFile {
+		files := make(map[string]*snapshotFile, len(s.Files))
+		for i := range s.Files {
+			files[s.Files[i].SteamID64] = &s.Files[i]
+		}
+		return files
+	}
+	filesA, filesB := index(a), index(b)
+
+	ids := make(map[string]bool)
+	for id := range filesA {
+		ids[id] = true
+	}
+	for id := range filesB {
+		ids[id] = true
+	}
+
+	var changes []playerDiff
+	for id := range ids {
+		if steamID != "" && id != steamID {
+			continue
+		}
+		fa, fb := filesA[id], filesB[id]
+		if fa != nil && fb != nil && fa.Hash == fb.Hash {
+			continue
+		}
+		changes = append(changes, playerDiff{steamID: id, a: fa, b: fb})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].steamID < changes[j].steamID })
+	return changes
+}
+
+func printPlayerDiff(d playerDiff, summary bool) {
+	switch {
+	case d.b == nil:
+		fmt.Printf("- %s removed (was %d bytes, modified %s)\n", d.steamID, d.a.Size, d.a.ModTime)
+		return
+	case d.a == nil:
+		fmt.Printf("+ %s added (%d bytes, modified %s)\n", d.steamID, d.b.Size, d.b.ModTime)
+		return
+	}
+
+	fmt.Printf("~ %s changed (%d -> %d bytes, modified %s -> %s)\n",
+		d.steamID, d.a.Size, d.b.Size, d.a.ModTime, d.b.ModTime)
+	if summary {
+		return
+	}
+
+	fieldsA, okA := flattenSave(d.a.Content)
+	fieldsB, okB := flattenSave(d.b.Content)
+	if !okA || !okB {
+		fmt.Printf("    content is not JSON, hash %.12s -> %.12s\n", d.a.Hash, d.b.Hash)
+		return
+	}
+
+	keys := make(map[string]bool)
+	for key := range fieldsA {
+		keys[key] = true
+	}
+	for key := range fieldsB {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	for _, key := range sorted {
+		va, inA := fieldsA[key]
+		vb, inB := fieldsB[key]
+		switch {
+		case !inA:
+			fmt.Printf("    + %s: %s\n", key, vb)
+		case !inB:
+			fmt.Printf("    - %s: %s\n", key, va)
+		case va != vb:
+			fmt.Printf("    ~ %s: %s -> %s\n", key, va, vb)
+		}
+	}
+}
+
+// flattenSave раскладывает JSON-сохранение в пары путь -> значение,
+// например Stats.Health -> 950 или Mutations[0] -> "Hematophagy"
+func flattenSave(content string) (map[string]string, bool) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return nil, false
+	}
+	fields := make(map[string]string)
+	flattenValue("", v, fields)
+	return fields, true
+}
+
+func flattenValue(path string, v interface{}, fields map[string]string) {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for key, value := range x {
+			if path != "" {
+				key = path + "." + key
+			}
+			flattenValue(key, value, fields)
+		}
+		if len(x) == 0 && path != "" {
+			fields[path] = "{}"
+		}
+	case []interface{}:
+		for i, value := range x {
+			flattenValue(path+"["+strconv.Itoa(i)+"]", value, fields)
+		}
+		if len(x) == 0 && path != "" {
+			fields[path] = "[]"
+		}
+	default:
+		data, _ := json.Marshal(x)
+		fields[path] = string(data)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"agent-ws/state"
+)
+
+// dinoState - поля сохранения, по переходам которых выводятся события
+// гибели и порогов роста, и хэш содержимого. Хранится отдельно от кэша
+// содержимого, поэтому работает и в bounded-режиме памяти.
+type dinoState struct {
+	fields map[string]interface{}
+	hash   string
+}
+
+// Последнее состояние динозавра по имени файла. Используется только в основном цикле.
+var dinoStates = state.New[dinoState]()
+
+// dinoTracking сообщает, что нужны переходы состояния динозавров
+func dinoTracking() bool {
+	return cfg.DeathEvents.Enabled || len(cfg.GrowthMilestones.Thresholds) > 0
+}
+
+// parseDino выбирает из сохранения нужные для переходов поля
+func parseDino(content string) (dinoState, bool) {
+	var save map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &save); err != nil {
+		return dinoState{}, false
+	}
+	fields := make(map[string]interface{})
+	for _, key := range []string{"CharacterClass", "Growth", "bGender", "MarksTemp",
+		cfg.DeathEvents.AliveField, cfg.MapCoordinates.LocationField} {
+		if v, ok := save[key]; ok {
+			fields[key] = v
+		}
+	}
+	return dinoState{fields: fields, hash: hashContent(content)}, true
+}
+
+// rememberDino запоминает состояние динозавра без вывода событий
+func rememberDino(filename, content string) {
+	if !dinoTracking() || !isPlayerFile(filename) {
+		return
+	}
+	if d, ok := parseDino(content); ok {
+		dinoStates.Set(filename, d)
+	}
+}
+
+// dinoWritten сравнивает новое содержимое сохранения с прежним состоянием
+// динозавра, отправляет события гибели и порогов роста и запоминает новое
+func dinoWritten(ctx context.Context, filename, steamID, content string) {
+	if !dinoTracking() || !isPlayerFile(filename) {
+		return
+	}
+	after, ok := parseDino(content)
+	if !ok {
+		return
+	}
+	if before, ok := dinoStates.Get(filename); ok {
+		detectDeath(ctx, filename, steamID, before, after)
+		detectGrowthMilestones(ctx, filename, steamID, before, after)
+	}
+	dinoStates.Set(filename, after)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/logging"
+)
+
+// DiskWatchdogConfig - контроль свободного места на томах с логом и
+// очередью и объема файлов самого агента: заполненный диск роняет и
+// игровой сервер
+type DiskWatchdogConfig struct {
+	// Интервал проверки (0 - выключено)
+	Interval Duration `json:"interval"`
+	// Меньше warn_free_mb - предупреждение, меньше critical_free_mb -
+	// в лог пишутся только предупреждения и ошибки
+	WarnFreeMB     int `json:"warn_free_mb"`
+	CriticalFreeMB int `json:"critical_free_mb"`
+	// Предупреждение, если лог, очередь, кэш и копии заняли больше (0 - не проверяется)
+	MaxArtifactsMB int `json:"max_artifacts_mb"`
+}
+
+func (c DiskWatchdogConfig) validate() error {
+	if c.Interval.Duration < 0 {
+		return fmt.Errorf("disk_watchdog.interval must not be negative")
+	}
+	if c.WarnFreeMB < 0 || c.CriticalFreeMB < 0 || c.MaxArtifactsMB < 0 {
+		return fmt.Errorf("disk_watchdog limits must not be negative")
+	}
+	if c.CriticalFreeMB > c.WarnFreeMB {
+		return fmt.Errorf("disk_watchdog.critical_free_mb must not exceed warn_free_mb")
+	}
+	return nil
+}
+
+// Состояния места на диске
+const (
+	diskOK       = "ok"
+	diskLow      = "low"
+	diskCritical = "critical"
+)
+
+// diskWatchdog - последнее состояние проверки; меняется и читается
+// только основным циклом
+type diskWatchdog struct {
+	state       string
+	freeMB      uint64
+	volume      string
+	artifactsMB uint64
+	oversized   bool
+	checkedAt   time.Time
+}
+
+var diskWatch = diskWatchdog{state: diskOK}
+
+// checkDiskHealth проверяет место на томах с логом и очередью. При нехватке
+// отправляет уведомление, а в критическом состоянии ограничивает лог
+// уровнем warn, пока место не освободится.
+func checkDiskHealth() {
+	c := cfg.DiskWatchdog
+	w := &diskWatch
+	w.checkedAt = time.Now()
+
+	// Том с наименьшим свободным местом определяет состояние
+	w.freeMB, w.volume = 0, ""
+	for _, dir := range []string{filepath.Dir(logFile), cfg.QueueDir} {
+		free, err := diskFreeBytes(dir)
+		if err != nil {
+			agentLog.Debugf("Error checking free space on %s: %v", dir, err)
+			continue
+		}
+		if w.volume == "" || free/(1024*1024) < w.freeMB {
+			w.freeMB, w.volume = free/(1024*1024), dir
+		}
+	}
+
+	state := diskOK
+	switch {
+	case w.volume == "":
+		return
+	case w.freeMB < uint64(c.CriticalFreeMB):
+		state = diskCritical
+	case w.freeMB < uint64(c.WarnFreeMB):
+		state = diskLow
+	}
+	if state != w.state {
+		diskStateChanged(w.state, state)
+		w.state = state
+	}
+
+	if c.MaxArtifactsMB > 0 {
+		w.artifactsMB = artifactsSize() / (1024 * 1024)
+		oversized := w.artifactsMB > uint64(c.MaxArtifactsMB)
+		if oversized && !w.oversized {
+			agentLog.Warnf("Agent files take %d MB, over the %d MB limit", w.artifactsMB, c.MaxArtifactsMB)
+			notify(alertDiskSpace, SeverityWarning, "Agent files are growing",
+				fmt.Sprintf("Log, queue, cache and backups take %d MB (limit %d MB).", w.artifactsMB, c.MaxArtifactsMB))
+		}
+		w.oversized = oversized
+	}
+}
+
+func diskStateChanged(from, to string) {
+	w := &diskWatch
+	message := fmt.Sprintf("%d MB free on %s", w.freeMB, w.volume)
+
+	if to == diskCritical {
+		logLevels.Limit(logging.LevelWarn)
+	} else if from == diskCritical {
+		logLevels.Unlimit()
+	}
+
+	switch to {
+	case diskCritical:
+		agentLog.Errorf("Disk space is critical: %s, logging limited to warnings and errors", message)
+		notify(alertDiskSpace, SeverityCritical, "Disk is almost full",
+			message+". Verbose logging is paused; free space before the game server is affected.")
+	case diskLow:
+		agentLog.Warnf("Disk space is low: %s", message)
+		notify(alertDiskSpace, SeverityWarning, "Disk space is low", message+".")
+	default:
+		agentLog.Infof("Disk space recovered: %s", message)
+		notify(alertDiskSpace, SeverityInfo, "Disk space recovered", message+".")
+	}
+}
+
+// artifactsSize возвращает объем файлов агента: лог, лог тел запросов,
+// очередь, кэш содержимого, копии и снимки
+func artifactsSize() uint64 {
+	var total uint64
+	for _, file := range []string{logFile, cfg.BodyDumpFile} {
+		if info, err := os.Stat(file); err == nil && file != "" {
+			total += uint64(info.Size())
+		}
+	}
+	for _, dir := range []string{cfg.QueueDir, cfg.ContentCacheDir, cfg.Backup.Dir, cfg.SnapshotDir} {
+		if dir == "" {
+			continue
+		}
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if info, err := d.Info(); err == nil && !d.IsDir() {
+				total += uint64(info.Size())
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+// status возвращает состояние диска для heartbeat
+func (w *diskWatchdog) status() map[string]interface{} {
+	status := map[string]interface{}{
+		"state":         w.state,
+		"free_mb":       w.freeMB,
+		"log_throttled": w.state == diskCritical,
+	}
+	if cfg.DiskWatchdog.MaxArtifactsMB > 0 {
+		status["artifacts_mb"] = w.artifactsMB
+	}
+	return status
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+
+	"agent-ws/state"
+)
+
+// Глубина очереди одного воркера доставки. Когда она заполнена,
+// основной цикл ждет, а не копит события в памяти.
+const dispatchQueueDepth = 100
+
+// keyedDispatcher раздает задачи воркерам по хэшу ключа: задачи одного
+// ключа (SteamID) выполняет один воркер строго в порядке постановки,
+// задачи разных ключей выполняются параллельно
+type keyedDispatcher struct {
+	queues []chan func()
+	wg     sync.WaitGroup
+}
+
+func newKeyedDispatcher(workers, depth int) *keyedDispatcher {
+	d := &keyedDispatcher{queues: make([]chan func(), workers)}
+	for i := range d.queues {
+		queue := make(chan func(), depth)
+		d.queues[i] = queue
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for job := range queue {
+				job()
+			}
+		}()
+	}
+	return d
+}
+
+// submit ставит задачу в очередь воркера ключа
+func (d *keyedDispatcher) submit(key string, job func()) {
+	d.queues[workerIndex(key, len(d.queues))] <- job
+}
+
+// close дожидается выполнения поставленных задач и останавливает воркеры
+func (d *keyedDispatcher) close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+func workerIndex(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(workers))
+}
+
+var (
+	// Воркеры доставки (nil - события доставляются в основном цикле)
+	deliveryDispatcher *keyedDispatcher
+	// События, переданные воркерам и еще не доставленные
+	inFlightEvents = state.New[struct{}]()
+)
+
+func initDispatcher() {
+	if cfg.DeliveryWorkers > 1 {
+		deliveryDispatcher = newKeyedDispatcher(cfg.DeliveryWorkers, dispatchQueueDepth)
+		deliveryLog.Infof("Delivering events with %d workers, ordered per SteamID", cfg.DeliveryWorkers)
+	}
+}
+
+func closeDispatcher() {
+	if deliveryDispatcher != nil {
+		deliveryDispatcher.close()
+	}
+}
+
+// deliveryKey - ключ очередности доставки: события с одним ключом уходят
+// по порядку. Совпадает с ключом номеров событий (экземпляр и SteamID).
+func deliveryKey(eventData EventData) string {
+	return instanceKey(eventData.Instance, eventData.SteamID64)
+}
+
+// dispatchDelivery доставляет событие сразу или через воркер его ключа доставки.
+// hash пустой для повторной доставки из очереди.
+func dispatchDelivery(ctx context.Context, eventData EventData, hash string) {
+	if deliveryDispatcher == nil {
+		completeDelivery(ctx, eventData, hash)
+		return
+	}
+
+	inFlightEvents.Set(eventData.EventID, struct{}{})
+	deliveryDispatcher.submit(deliveryKey(eventData), func() {
+		defer inFlightEvents.Delete(eventData.EventID)
+		completeDelivery(ctx, eventData, hash)
+	})
+}
+
+// completeDelivery доставляет событие и после подтверждения убирает его
+// из очереди. Возвращает false, если событие осталось в очереди.
+// Может выполняться в воркере, поэтому трогает только
+// потокобезопасное состояние.
+func completeDelivery(ctx context.Context, eventData EventData, hash string) bool {
+	// В режиме потока событие подтверждается ответом на весь поток
+	if streamable(eventData) {
+		err := streamEvent(eventData, hash)
+		if err == nil {
+			return true
+		}
+		deliveryLog.Warnf("Error streaming event %s, sending it separately: %v", eventData.EventID, err)
+	}
+
+	deliverCtx, span := tracer.Start(ctx, "deliver")
+	span.SetAttr("event_id", eventData.EventID)
+	span.SetAttr("sequence", eventData.Sequence)
+	err := deliverEvent(deliverCtx, eventData)
+	span.SetError(err)
+	span.End()
+
+	rejected := errors.Is(err, errEventRejected)
+	if err != nil {
+		playerSyncs.failed(eventData, err)
+	}
+	if err != nil && !rejected {
+		metrics.eventFailed(eventData)
+		deliveryLog.Warnf("Event %s for SteamID %s stays in persistent queue for redelivery",
+			eventData.EventID, eventData.SteamID64)
+		return false
+	}
+
+	_, ack := tracer.Start(ctx, "ack")
+	defer ack.End()
+	// Отклоненное событие тоже не остается в очереди, иначе оно повторялось бы вечно
+	eventQueueStore.remove(eventData.EventID)
+	sequences.ack(instanceKey(eventData.Instance, eventData.SteamID64), eventData.Sequence)
+	if rejected {
+		metrics.eventDropped("rejected")
+		return true
+	}
+
+	metrics.eventDelivered(eventData)
+	playerSyncs.acked(eventData)
+	rememberAcked(eventData)
+	if hash != "" {
+		rememberDelivered(eventData.Type, instanceKey(eventData.Instance, eventData.SteamID64), eventData.Event, hash)
+	}
+	return true
+}
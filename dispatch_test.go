@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+// События одного SteamID должны выполняться в порядке постановки,
+// даже когда воркеров много, а задачи занимают разное время
+func TestKeyedDispatcherPreservesPerKeyOrder(t *testing.T) {
+	const (
+		keys        = 50
+		eventsPerID = 200
+	)
+
+	d := newKeyedDispatcher(8, 16)
+
+	var mu sync.Mutex
+	got := make(map[string][]int)
+
+	// Несколько производителей, у каждого свой набор ключей,
+	// как у основного цикла и повторной доставки из очереди
+	var producers sync.WaitGroup
+	for p := 0; p < 5; p++ {
+		producers.Add(1)
+		go func(p int) {
+			defer producers.Done()
+			for seq := 0; seq < eventsPerID; seq++ {
+				for k := p; k < keys; k += 5 {
+					key := fmt.Sprintf("7656119%010d", k)
+					d.submit(key, func() {
+						if rand.Intn(10) == 0 {
+							time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+						}
+						mu.Lock()
+						got[key] = append(got[key], seq)
+						mu.Unlock()
+					})
+				}
+			}
+		}(p)
+	}
+	producers.Wait()
+	d.close()
+
+	if len(got) != keys {
+		t.Fatalf("got events for %d keys, want %d", len(got), keys)
+	}
+	for key, seqs := range got {
+		if len(seqs) != eventsPerID {
+			t.Fatalf("key %s: got %d events, want %d", key, len(seqs), eventsPerID)
+		}
+		for i, seq := range seqs {
+			if seq != i {
+				t.Fatalf("key %s: event %d delivered at position %d", key, seq, i)
+			}
+		}
+	}
+}
+
+// Медленная доставка одного игрока не должна задерживать остальных
+func TestKeyedDispatcherRunsKeysInParallel(t *testing.T) {
+	const workers = 4
+	d := newKeyedDispatcher(workers, 1)
+	defer d.close()
+
+	slow, fast := "76561190000000001", ""
+	for i := 2; fast == ""; i++ {
+		key := fmt.Sprintf("7656119%010d", i)
+		if workerIndex(key, workers) != workerIndex(slow, workers) {
+			fast = key
+		}
+	}
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	d.submit(slow, func() { <-release })
+	d.submit(fast, func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("event for another SteamID was blocked by a slow delivery")
+	}
+	close(release)
+}
+
+func TestWorkerIndexIsStable(t *testing.T) {
+	for _, key := range []string{"", "76561198000000000", "server"} {
+		first := workerIndex(key, 16)
+		for i := 0; i < 10; i++ {
+			if got := workerIndex(key, 16); got != first {
+				t.Fatalf("workerIndex(%q) = %d, then %d", key, first, got)
+			}
+		}
+		if first < 0 || first >= 16 {
+			t.Fatalf("workerIndex(%q) = %d, out of range", key, first)
+		}
+	}
+}
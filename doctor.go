@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/watcher"
+)
+
+// Тип и имя события самопроверки: панель должна принимать и не применять их
+const doctorEvent = "test"
+
+// SteamID тестового сохранения - наименьший допустимый SteamID64
+const doctorSteamID = "76561197960265728"
+
+// runDoctor - команда agent-ws doctor: прогон одного сохранения через весь
+// конвейер агента в тестовой папке - watcher, debounce, чтение, transform
+// и отправку в API событием типа test - с результатом по каждой стадии
+func runDoctor(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of the whole self-test")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	var checker configChecker
+	stages := []struct {
+		name string
+		run  func(*doctorRun) (string, error)
+	}{
+		{"config", (*doctorRun).checkConfig},
+		{"sandbox", (*doctorRun).createSandbox},
+		{"watcher", (*doctorRun).detectFile},
+		{"debounce", (*doctorRun).debounce},
+		{"read", (*doctorRun).readFile},
+		{"transform", (*doctorRun).transform},
+		{"deliver", (*doctorRun).deliver},
+	}
+
+	run := &doctorRun{ctx: ctx}
+	defer run.cleanup()
+
+	failed := false
+	for _, stage := range stages {
+		if failed {
+			checker.add(checkSkip, stage.name, "skipped after a failed stage", "")
+			continue
+		}
+		start := time.Now()
+		detail, err := stage.run(run)
+		if err != nil {
+			failed = true
+			checker.add(checkFail, stage.name, err.Error(), doctorFixes[stage.name])
+			continue
+		}
+		checker.add(checkOK, stage.name, fmt.Sprintf("%s (%v)", detail, time.Since(start).Round(time.Millisecond)), "")
+	}
+
+	if failed {
+		fmt.Println("\nSelf-test failed")
+		return 1
+	}
+	fmt.Println("\nSelf-test passed")
+	return 0
+}
+
+// Подсказки для упавших стадий самопроверки
+var doctorFixes = map[string]string{
+	"config":    "run agent-ws validate-config for details",
+	"sandbox":   "check free space and write access to the temp directory",
+	"watcher":   "check the file watch limits of the system and antivirus exclusions",
+	"read":      "check that no other process locks new files in the temp directory",
+	"transform": "check transforms of the player watch target",
+	"deliver":   "run agent-ws validate-config to check API access and credentials",
+}
+
+// doctorRun - состояние самопроверки между стадиями
+type doctorRun struct {
+	ctx      context.Context
+	dir      string
+	filename string
+	source   watcher.Source
+	content  string
+	event    EventData
+}
+
+func (d *doctorRun) cleanup() {
+	if d.source != nil {
+		d.source.Close()
+	}
+	if d.dir != "" {
+		os.RemoveAll(d.dir)
+	}
+}
+
+func (d *doctorRun) checkConfig() (string, error) {
+	return checkConfig()
+}
+
+// createSandbox создает временную папку с профилем папки игроков, но с
+// событиями test, и подписывает на нее watcher
+func (d *doctorRun) createSandbox() (string, error) {
+	dir, err := os.MkdirTemp("", "agent-ws-doctor-")
+	if err != nil {
+		return "", err
+	}
+	d.dir = dir
+
+	if err := initWatchTargets(cfg.WatchTargets); err != nil {
+		return "", err
+	}
+	target := WatchTarget{Name: "players", Parser: parserRaw}
+	if t := playersTarget(""); t != nil {
+		target = *t
+	}
+	target.Name = "doctor"
+	target.Path = dir
+	target.Type, target.EventType = doctorEvent, doctorEvent
+	target.AddEvent, target.ChangeEvent, target.DeleteEvent, target.MigrateEvent = doctorEvent, doctorEvent, doctorEvent, doctorEvent
+	target.instance = ""
+
+	// Самопроверка идет только через тестовую папку
+	cfg.Instances = nil
+	if err := initWatchTargets([]WatchTarget{target}); err != nil {
+		return "", err
+	}
+
+	d.source, err = deps.Watch([]string{dir})
+	if err != nil {
+		return "", err
+	}
+	return "watching " + dir, nil
+}
+
+// detectFile записывает тестовое сохранение и ждет события watcher
+func (d *doctorRun) detectFile() (string, error) {
+	d.filename = filepath.Join(d.dir, doctorSteamID+".json")
+	save := fmt.Sprintf(`{"agent_ws_doctor":true,"created_at":%q}`, time.Now().UTC().Format(time.RFC3339))
+	if err := os.WriteFile(d.filename, []byte(save), 0644); err != nil {
+		return "", err
+	}
+
+	for {
+		select {
+		case ev, ok := <-d.source.Events():
+			if !ok {
+				return "", fmt.Errorf("watcher stopped")
+			}
+			if filepath.Clean(ev.Name) == d.filename {
+				detectedAt.Set(d.filename, time.Now())
+				return fmt.Sprintf("%s event for %s", fsOpName(ev.Op), filepath.Base(ev.Name)), nil
+			}
+		case err := <-d.source.Errors():
+			return "", fmt.Errorf("watcher error: %v", err)
+		case <-d.ctx.Done():
+			return "", fmt.Errorf("no file system event for %s", filepath.Base(d.filename))
+		}
+	}
+}
+
+// debounce выдерживает ту же паузу, что и основной цикл для новых файлов
+func (d *doctorRun) debounce() (string, error) {
+	if err := debounce(d.ctx, 1*time.Second); err != nil {
+		return "", err
+	}
+	return "waited for the write to settle", nil
+}
+
+func (d *doctorRun) readFile() (string, error) {
+	content, err := readEventContent(d.ctx, d.filename)
+	if err != nil {
+		return "", err
+	}
+	d.content = content
+	return fmt.Sprintf("%d bytes", len(content)), nil
+}
+
+func (d *doctorRun) transform() (string, error) {
+	steamID := getSteamIDFromFilename(d.filename)
+	var err error
+	if d.event, err = fileEvent(d.ctx, d.filename, opAdd, steamID, d.content); err != nil {
+		return "", err
+	}
+	if d.event.Event != doctorEvent || d.event.SteamID64 != doctorSteamID {
+		return "", fmt.Errorf("unexpected event %s for %s", d.event.Event, d.event.SteamID64)
+	}
+	return fmt.Sprintf("%d transforms applied, data %d bytes", len(watchTargets[0].transformers), len(d.event.Data)), nil
+}
+
+// deliver отправляет тестовое событие в API панели одной попыткой
+func (d *doctorRun) deliver() (string, error) {
+	if err := initHTTPClient(); err != nil {
+		return "", err
+	}
+	if err := initPayloadEncryption(cfg.PayloadEncryption); err != nil {
+		return "", err
+	}
+	initIdentity()
+
+	d.event.EventID = newEventID()
+	resp := sendEvent(d.ctx, tagEvent(d.event))
+	if !resp.Success {
+		if resp.Error != "" {
+			return "", fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Error)
+		}
+		return "", fmt.Errorf("HTTP %d: API did not accept the test event", resp.StatusCode)
+	}
+	return fmt.Sprintf("accepted by %s (HTTP %d)", endpointFor(d.event), resp.StatusCode), nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+
+	"agent-ws/events"
+)
+
+// Заголовки события с зашифрованным полем data
+const (
+	encryptionHeader      = "X-Encryption"
+	encryptionKeyIDHeader = "X-Encryption-Key-Id"
+	encryptionAlgorithm   = "aes-256-gcm"
+)
+
+// PayloadEncryptionConfig - шифрование поля data общим с панелью ключом,
+// для панелей в локальной сети без TLS
+type PayloadEncryptionConfig struct {
+	// Идентификатор ключа, по которому панель выбирает ключ для расшифровки
+	KeyID string `json:"key_id"`
+	// Ключ AES-256 в base64 (пусто - выключено)
+	Key string `json:"key"`
+}
+
+var payloadCipher cipher.AEAD
+
+func initPayloadEncryption(c PayloadEncryptionConfig) error {
+	if c.Key == "" {
+		payloadCipher = nil
+		return nil
+	}
+	if c.KeyID == "" {
+		return fmt.Errorf("payload_encryption.key_id is required")
+	}
+
+	gcm, err := newAESGCM(c.Key)
+	if err != nil {
+		return fmt.Errorf("payload encryption key: %v", err)
+	}
+	payloadCipher = gcm
+	deliveryLog.Infof("Payload encryption is enabled (key id: %s)", c.KeyID)
+	return nil
+}
+
+// encryptPayload заменяет data на base64(nonce + шифротекст). Идентификатор
+// события используется как дополнительные данные, чтобы шифротекст
+// нельзя было подставить в другое событие.
+func encryptPayload(eventData EventData) (EventData, error) {
+	if payloadCipher == nil {
+		return eventData, nil
+	}
+
+	nonce := make([]byte, payloadCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return eventData, fmt.Errorf("generate nonce: %v", err)
+	}
+
+	sealed := payloadCipher.Seal(nonce, nonce, []byte(events.Text(eventData.Data)), []byte(eventData.EventID))
+	eventData.Data = events.String(base64.StdEncoding.EncodeToString(sealed))
+	eventData.Encrypted = true
+	return eventData, nil
+}
+
+func setEncryptionHeaders(req *http.Request, eventData EventData) {
+	if !eventData.Encrypted {
+		return
+	}
+	req.Header.Set(encryptionHeader, encryptionAlgorithm)
+	req.Header.Set(encryptionKeyIDHeader, cfg.PayloadEncryption.KeyID)
+}
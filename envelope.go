@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"agent-ws/state"
+)
+
+// Версии схемы события, отправляемого в API
+const (
+	schemaV1 = 1
+	schemaV2 = 2
+)
+
+// eventEnvelopeV2 - типизированный конверт события. Содержимое файла лежит
+// в payload, а хэши текущего и предыдущего содержимого позволяют бэкенду
+// заметить пропущенное событие.
+type eventEnvelopeV2 struct {
+	SchemaVersion int             `json:"schema_version"`
+	EventID       string          `json:"event_id"`
+	AgentID       string          `json:"agent_id"`
+	ServerName    string          `json:"server_name"`
+	Instance      string          `json:"instance,omitempty"`
+	OccurredAt    string          `json:"occurred_at"`
+	Sequence      uint64          `json:"sequence"`
+	SteamID64     string          `json:"steamid64"`
+	OldSteamID64  string          `json:"old_steamid64,omitempty"`
+	Type          string          `json:"type"`
+	Op            string          `json:"op"`
+	ContentHash   string          `json:"content_hash"`
+	Payload       json.RawMessage `json:"payload"`
+	PreviousHash  string          `json:"previous_hash,omitempty"`
+
+	Encrypted     bool   `json:"encrypted,omitempty"`
+	Replayed      bool   `json:"replayed,omitempty"`
+	ReplayOf      string `json:"replay_of,omitempty"`
+	Truncated     bool   `json:"truncated,omitempty"`
+	OriginalSize  int    `json:"original_size,omitempty"`
+	ChunkID       string `json:"chunk_id,omitempty"`
+	ParentEventID string `json:"parent_event_id,omitempty"`
+	ChunkIndex    int    `json:"chunk_index,omitempty"`
+	ChunkTotal    int    `json:"chunk_total,omitempty"`
+}
+
+// Хэш последнего отправленного содержимого по типу и SteamID
+var lastContentHashes = state.New[string]()
+
+func validateEventSchema(version int) error {
+	if version != schemaV1 && version != schemaV2 {
+		return fmt.Errorf("event_schema must be %d or %d, got %d", schemaV1, schemaV2, version)
+	}
+	return nil
+}
+
+// stampEvent добавляет время события (если оно не известно) и хэши содержимого
+func stampEvent(eventData EventData, hash string) EventData {
+	key := dedupKey(eventData.Type, instanceKey(eventData.Instance, eventData.SteamID64))
+	eventData.PreviousHash, _ = lastContentHashes.Get(key)
+	eventData.ContentHash = hash
+	if eventData.OccurredAt == "" {
+		eventData.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	lastContentHashes.Set(key, hash)
+	return eventData
+}
+
+// wireEvent возвращает событие в настроенной схеме. В v1 поля,
+// появившиеся в v2, не отправляются, чтобы формат не менялся.
+func wireEvent(eventData EventData) interface{} {
+	if cfg.EventSchema != schemaV2 {
+		eventData.Op = ""
+		eventData.OccurredAt = ""
+		eventData.ContentHash = ""
+		eventData.PreviousHash = ""
+		return eventData
+	}
+
+	op := eventData.Op
+	if op == "" {
+		// События не от файлов (heartbeat, лог сервера) передают свое имя
+		op = eventData.Event
+	}
+	return eventEnvelopeV2{
+		SchemaVersion: schemaV2,
+		EventID:       eventData.EventID,
+		AgentID:       eventData.AgentID,
+		ServerName:    eventData.ServerName,
+		Instance:      eventData.Instance,
+		OccurredAt:    eventData.OccurredAt,
+		Sequence:      eventData.Sequence,
+		SteamID64:     eventData.SteamID64,
+		OldSteamID64:  eventData.OldSteamID64,
+		Type:          eventData.Type,
+		Op:            op,
+		ContentHash:   eventData.ContentHash,
+		Payload:       eventData.Data,
+		PreviousHash:  eventData.PreviousHash,
+		Encrypted:     eventData.Encrypted,
+		Replayed:      eventData.Replayed,
+		ReplayOf:      eventData.ReplayOf,
+		Truncated:     eventData.Truncated,
+		OriginalSize:  eventData.OriginalSize,
+		ChunkID:       eventData.ChunkID,
+		ParentEventID: eventData.ParentEventID,
+		ChunkIndex:    eventData.ChunkIndex,
+		ChunkTotal:    eventData.ChunkTotal,
+	}
+}
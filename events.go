@@ -0,0 +1,24 @@
+package main
+
+// EventTypeConfig - настройка отдельного события (add-dino-data, change-dino-data, ...)
+type EventTypeConfig struct {
+	// false - событие не отправляется (по умолчанию включено)
+	Enabled *bool `json:"enabled"`
+	// Имя события, которое ожидает бэкенд (пусто - без изменений)
+	Name string `json:"name"`
+}
+
+// eventEnabled проверяет, что событие не выключено в конфигурации
+func eventEnabled(event string) bool {
+	c, ok := cfg.Events[event]
+	return !ok || c.Enabled == nil || *c.Enabled
+}
+
+// wireEventName возвращает имя события для бэкенда. Внутри агента
+// (дедупликация, приоритеты, очередь) используются исходные имена.
+func wireEventName(event string) string {
+	if c, ok := cfg.Events[event]; ok && c.Name != "" {
+		return c.Name
+	}
+	return event
+}
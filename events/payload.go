@@ -0,0 +1,112 @@
+// Package events формирует поле data событий: встраивание содержимого
+// файла, обрезку и разбиение на части по лимиту размера. Лимиты
+// передаются явно, поэтому функции не зависят от конфигурации агента.
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"unicode/utf8"
+
+	"agent-ws/sink"
+)
+
+// TruncatedMarker добавляется в конец обрезанного data
+const TruncatedMarker = "... [truncated]"
+
+// Payload встраивает содержимое файла в событие: корректный JSON -
+// как есть, любой другой текст - JSON-строкой
+func Payload(content string) json.RawMessage {
+	if content == "" {
+		return nil
+	}
+	if json.Valid([]byte(content)) {
+		return json.RawMessage(content)
+	}
+	return String(content)
+}
+
+// String кодирует текст как JSON-строку с экранированием
+// кавычек, обратных слэшей и управляющих символов
+func String(s string) json.RawMessage {
+	data, _ := json.Marshal(s)
+	return data
+}
+
+// Text возвращает исходный текст data: содержимое JSON-строки или сам JSON
+func Text(data json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	return string(data)
+}
+
+// runeBoundary сдвигает позицию разреза назад, чтобы не разрывать UTF-8 символ
+func runeBoundary(data string, cut int) int {
+	for cut > 0 && cut < len(data) && !utf8.RuneStart(data[cut]) {
+		cut--
+	}
+	return cut
+}
+
+// Truncate обрезает data до limit байт и добавляет маркер обрезки
+func Truncate(ev sink.Event, limit int) sink.Event {
+	limit -= len(TruncatedMarker)
+	if limit < 0 {
+		limit = 0
+	}
+
+	// Обрезанный JSON уже не разобрать, поэтому data становится строкой
+	data := Text(ev.Data)
+	ev.OriginalSize = len(ev.Data)
+	ev.Data = String(data[:runeBoundary(data, limit)] + TruncatedMarker)
+	ev.Truncated = true
+	return ev
+}
+
+// Split разбивает data на части не больше limit байт с порядковыми номерами.
+// Каждая часть получает свой event_id (<event_id>-<номер>), иначе бэкенд
+// или брокер, отбрасывающие повторы по идентификатору, приняли бы только первую.
+// chunk_id не меняется при повторной разбивке того же события, чтобы бэкенд
+// собрал части, принятые в разных попытках доставки.
+func Split(ev sink.Event, limit int) []sink.Event {
+	data := Text(ev.Data)
+	chunkID := ev.EventID
+	if chunkID == "" {
+		sum := sha256.Sum256(ev.Data)
+		chunkID = ev.SteamID64 + "-" + hex.EncodeToString(sum[:8])
+	}
+
+	var parts []string
+	for len(data) > 0 {
+		cut := len(data)
+		if cut > limit {
+			cut = runeBoundary(data, limit)
+			if cut == 0 {
+				// Лимит меньше одного символа - режем по байтам
+				cut = limit
+			}
+		}
+		parts = append(parts, data[:cut])
+		data = data[cut:]
+	}
+
+	chunks := make([]sink.Event, 0, len(parts))
+	for i, part := range parts {
+		chunk := ev
+		chunk.Data = String(part)
+		if ev.EventID != "" {
+			chunk.EventID = fmt.Sprintf("%s-%d", ev.EventID, i+1)
+			chunk.ParentEventID = ev.EventID
+		}
+		chunk.OriginalSize = len(ev.Data)
+		chunk.ChunkID = chunkID
+		chunk.ChunkIndex = i + 1
+		chunk.ChunkTotal = len(parts)
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
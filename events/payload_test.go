@@ -0,0 +1,118 @@
+package events
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"agent-ws/sink"
+)
+
+func TestPayload(t *testing.T) {
+	if got := Payload(""); got != nil {
+		t.Errorf("empty content: got %s, want nil", got)
+	}
+
+	save := `{"CharacterClass":"Carnotaurus","Growth":0.75}`
+	if got := string(Payload(save)); got != save {
+		t.Errorf("JSON content: got %s, want embedded as is", got)
+	}
+
+	text := "line \"one\"\nline two"
+	got := Payload(text)
+	var decoded string
+	if err := json.Unmarshal(got, &decoded); err != nil || decoded != text {
+		t.Errorf("text content: got %s, want JSON string of %q", got, text)
+	}
+	if Text(got) != text {
+		t.Errorf("Text(%s) = %q, want %q", got, Text(got), text)
+	}
+}
+
+func TestTruncateKeepsRunes(t *testing.T) {
+	ev := sink.Event{SteamID64: "76561198000000001", Data: String(strings.Repeat("ж", 100))}
+
+	const limit = 40
+	got := Truncate(ev, limit)
+	data := Text(got.Data)
+	if !got.Truncated || got.OriginalSize != len(ev.Data) {
+		t.Fatalf("truncation not recorded: %+v", got)
+	}
+	if len(data) > limit || !strings.HasSuffix(data, TruncatedMarker) {
+		t.Fatalf("got %d bytes %q, want at most %d with marker", len(data), data, limit)
+	}
+	if !utf8.ValidString(data) {
+		t.Fatalf("truncation split a rune: %q", data)
+	}
+}
+
+func TestSplitReassembles(t *testing.T) {
+	content := `{"Location":"X=1 Y=2 Z=3","Name":"Тираннозавр"}`
+	ev := sink.Event{SteamID64: "76561198000000001", Data: Payload(content)}
+
+	chunks := Split(ev, 10)
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks, want several", len(chunks))
+	}
+
+	var joined strings.Builder
+	for i, chunk := range chunks {
+		part := Text(chunk.Data)
+		if len(part) > 10 || !utf8.ValidString(part) {
+			t.Fatalf("chunk %d is %q", i+1, part)
+		}
+		if chunk.ChunkIndex != i+1 || chunk.ChunkTotal != len(chunks) || chunk.ChunkID != chunks[0].ChunkID {
+			t.Fatalf("chunk %d has wrong numbering: %+v", i+1, chunk)
+		}
+		joined.WriteString(part)
+	}
+	if joined.String() != content {
+		t.Fatalf("reassembled %q, want %q", joined.String(), content)
+	}
+}
+
+func TestSplitGivesChunksDistinctIDs(t *testing.T) {
+	ev := sink.Event{
+		SteamID64: "76561198000000001",
+		EventID:   "0f8e2a4c-1b3d-4e5f-8a9b-0c1d2e3f4a5b",
+		Data:      String(strings.Repeat("a", 35)),
+	}
+
+	chunks := Split(ev, 10)
+	seen := make(map[string]bool)
+	for _, chunk := range chunks {
+		if chunk.EventID == "" || chunk.EventID == ev.EventID || seen[chunk.EventID] {
+			t.Fatalf("chunk %d has id %q, want a distinct one", chunk.ChunkIndex, chunk.EventID)
+		}
+		seen[chunk.EventID] = true
+		if chunk.ParentEventID != ev.EventID {
+			t.Fatalf("chunk %d parent id = %q, want %q", chunk.ChunkIndex, chunk.ParentEventID, ev.EventID)
+		}
+	}
+	if len(seen) != 4 {
+		t.Fatalf("got %d chunk ids, want 4", len(seen))
+	}
+}
+
+// Повторная разбивка того же события дает тот же chunk_id
+func TestSplitChunkIDStable(t *testing.T) {
+	ev := sink.Event{
+		SteamID64: "76561198000000001",
+		EventID:   "0f8e2a4c-1b3d-4e5f-8a9b-0c1d2e3f4a5b",
+		Data:      String(strings.Repeat("a", 35)),
+	}
+	if first, retry := Split(ev, 10), Split(ev, 10); first[0].ChunkID != retry[0].ChunkID {
+		t.Fatalf("chunk id changed between splits: %q, %q", first[0].ChunkID, retry[0].ChunkID)
+	}
+
+	ev.EventID = ""
+	first, retry := Split(ev, 10), Split(ev, 10)
+	if first[0].ChunkID == "" || first[0].ChunkID != retry[0].ChunkID {
+		t.Fatalf("chunk id without event id: %q, %q", first[0].ChunkID, retry[0].ChunkID)
+	}
+	ev.Data = String(strings.Repeat("b", 35))
+	if other := Split(ev, 10); other[0].ChunkID == first[0].ChunkID {
+		t.Fatalf("different content got the same chunk id %q", other[0].ChunkID)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+// В Unix блокировки файлов игрой не видны: занятость сохранений
+// определяется только по запущенному процессу сервера
+const lockDetection = false
+
+// isLockViolation сообщает, что файл открыт игрой без общего доступа.
+// В Unix открытый на запись файл не мешает чтению.
+func isLockViolation(err error) bool {
+	return false
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// В Windows игра держит открытые сохранения без общего доступа, и запись
+// в занятый файл завершается ошибкой блокировки
+const lockDetection = true
+
+// isLockViolation сообщает, что файл открыт игрой без общего доступа
+func isLockViolation(err error) bool {
+	return errors.Is(err, windows.ERROR_SHARING_VIOLATION) || errors.Is(err, windows.ERROR_LOCK_VIOLATION)
+}
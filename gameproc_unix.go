@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processRunning проверяет, есть ли процесс с именем исполняемого файла name.
+// Сервер под Wine виден с виндовым путем в командной строке.
+func processRunning(name string) (bool, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return false, fmt.Errorf("process list is not available: %v", err)
+	}
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", e.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		exe, _, _ := bytes.Cut(cmdline, []byte{0})
+		base := string(exe)
+		if i := strings.LastIndexAny(base, `/\`); i >= 0 {
+			base = base[i+1:]
+		}
+		if strings.EqualFold(base, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// GameWritesConfig - запись агентом в папку игры (restore, apply_save)
+// с учетом того, что сервер держит файлы игроков открытыми
+type GameWritesConfig struct {
+	// Имя процесса сервера Evrima
+	ProcessName string `json:"process_name"`
+	// Что делать, если файл сейчас нельзя записать:
+	// defer - повторять, пока игра не отпустит файл (в Unix блокировки
+	// не видны, поэтому запись ждет остановки сервера);
+	// next_restart - пока сервер запущен, не писать, а дождаться его остановки;
+	// abort - сразу вернуть ошибку
+	Policy string `json:"policy"`
+	// Сколько отложенная запись ждет, прежде чем отменится
+	MaxWait Duration `json:"max_wait"`
+}
+
+const (
+	gameWriteDefer       = "defer"
+	gameWriteNextRestart = "next_restart"
+	gameWriteAbort       = "abort"
+)
+
+func (c GameWritesConfig) validate() error {
+	switch c.Policy {
+	case gameWriteDefer, gameWriteNextRestart, gameWriteAbort:
+	default:
+		return fmt.Errorf("game_writes.policy must be %s, %s or %s", gameWriteDefer, gameWriteNextRestart, gameWriteAbort)
+	}
+	if c.ProcessName == "" && (c.Policy == gameWriteNextRestart || !lockDetection) {
+		if !lockDetection {
+			return fmt.Errorf("game_writes.process_name is required: file locks of the game cannot be detected on this host")
+		}
+		return fmt.Errorf("game_writes.process_name is required for policy %s", gameWriteNextRestart)
+	}
+	if c.MaxWait.Duration <= 0 {
+		return fmt.Errorf("game_writes.max_wait must be positive")
+	}
+	return nil
+}
+
+// saveLockedError - игра держит файл открытым без общего доступа
+type saveLockedError struct {
+	name string
+}
+
+func (e *saveLockedError) Error() string {
+	return fmt.Sprintf("save %s is locked by the game, try again when the player is offline", e.name)
+}
+
+// gameWrite - запись файла в папку игры по команде
+type gameWrite struct {
+	filename string
+	content  []byte
+	// Команда, которой отправляется итог отложенной записи
+	command   string
+	commandID string
+	// Хэш файла на момент команды: если игра с тех пор переписала файл,
+	// запись не выполняется (пусто - без проверки)
+	expectHash string
+	// Правка панели: событие файла после записи не отправляется обратно
+	panelEdit bool
+
+	queuedAt time.Time
+	// Запись ждет остановки процесса сервера
+	nextRestart bool
+}
+
+// Отложенные записи. Используется только в основном цикле.
+var pendingGameWrites []*gameWrite
+
+// writeGameFile записывает файл в папку игры по политике game_writes.
+// Если запись отложена, возвращает причину; итог придет панели отдельным
+// результатом команды.
+func writeGameFile(ctx context.Context, w *gameWrite, fileStates *state.Store[time.Time]) (string, error) {
+	policy := cfg.GameWrites.Policy
+	// Без обнаружения блокировок запущенный сервер считается держащим все сохранения
+	if policy == gameWriteNextRestart || !lockDetection {
+		running, err := deps.ServerRunning()
+		if err != nil {
+			return "", fmt.Errorf("detect game server process: %v", err)
+		}
+		if running {
+			if policy == gameWriteAbort {
+				return "", &saveLockedError{name: filepath.Base(w.filename)}
+			}
+			return queueGameWrite(w, true), nil
+		}
+	}
+
+	err := performGameWrite(ctx, w, restoreAttempts, fileStates)
+	var locked *saveLockedError
+	if errors.As(err, &locked) && policy != gameWriteAbort {
+		return queueGameWrite(w, policy == gameWriteNextRestart), nil
+	}
+	return "", err
+}
+
+func queueGameWrite(w *gameWrite, nextRestart bool) string {
+	w.queuedAt, w.nextRestart = time.Now(), nextRestart
+	pendingGameWrites = append(pendingGameWrites, w)
+
+	reason := "save is locked by the game, write deferred until it is released"
+	switch {
+	case nextRestart && cfg.GameWrites.Policy == gameWriteNextRestart:
+		reason = "game server is running, write scheduled for the next restart"
+	case nextRestart:
+		reason = "game server is running, write deferred until it stops"
+	}
+	commandLog.Infof("Write of %s deferred: %s", filepath.Base(w.filename), reason)
+	return reason
+}
+
+// performGameWrite подменяет файл новым содержимым
+func performGameWrite(ctx context.Context, w *gameWrite, attempts int, fileStates *state.Store[time.Time]) error {
+	var previous string
+	if current, err := os.ReadFile(w.filename); err == nil {
+		previous = hashContent(string(current))
+	}
+	if w.expectHash != "" && previous != "" && previous != w.expectHash {
+		return fmt.Errorf("%s changed since the write was requested", filepath.Base(w.filename))
+	}
+
+	hash := hashContent(string(w.content))
+	if w.panelEdit {
+		appliedEdits.Set(w.filename, hash)
+	}
+	err := replaceSave(ctx, w.filename, w.content, attempts)
+	// Повторы отложенной записи, пока файл занят, в журнал не попадают
+	var locked *saveLockedError
+	if !errors.As(err, &locked) {
+		recordAudit(auditEntry{
+			Action:    auditWrite,
+			Command:   w.command,
+			CommandID: w.commandID,
+			Target:    w.filename,
+			Details:   map[string]string{"previous_hash": previous, "content_hash": hash},
+		}, err)
+	}
+	if err != nil {
+		if w.panelEdit {
+			appliedEdits.Delete(w.filename)
+		}
+		return err
+	}
+	if w.panelEdit {
+		cacheContent(w.filename, string(w.content))
+		if info, err := os.Stat(w.filename); err == nil {
+			fileStates.Set(w.filename, info.ModTime())
+		}
+	}
+	return nil
+}
+
+// processGameWrites повторяет отложенные записи: при запущенном сервере
+// ждут записи до рестарта, остальные пробуются одной попыткой
+func processGameWrites(ctx context.Context, fileStates *state.Store[time.Time]) {
+	if len(pendingGameWrites) == 0 {
+		return
+	}
+
+	running, detectErr := false, error(nil)
+	for _, w := range pendingGameWrites {
+		if w.nextRestart {
+			running, detectErr = deps.ServerRunning()
+			break
+		}
+	}
+
+	kept := pendingGameWrites[:0]
+	for _, w := range pendingGameWrites {
+		if waited := time.Since(w.queuedAt); waited > cfg.GameWrites.MaxWait.Duration {
+			finishGameWrite(ctx, w, fmt.Errorf("write of %s not done in %v, cancelled", filepath.Base(w.filename), waited.Round(time.Second)))
+			continue
+		}
+		if w.nextRestart && (running || detectErr != nil) {
+			kept = append(kept, w)
+			continue
+		}
+
+		err := performGameWrite(ctx, w, 1, fileStates)
+		var locked *saveLockedError
+		if errors.As(err, &locked) {
+			kept = append(kept, w)
+			continue
+		}
+		finishGameWrite(ctx, w, err)
+	}
+	clear(pendingGameWrites[len(kept):])
+	pendingGameWrites = kept
+}
+
+// finishGameWrite сообщает итог отложенной записи
+func finishGameWrite(ctx context.Context, w *gameWrite, err error) {
+	name := filepath.Base(w.filename)
+	result := CommandResult{ID: w.commandID, Command: w.command, Success: err == nil}
+	if err != nil {
+		commandLog.Errorf("Deferred write of %s failed: %v", name, err)
+		result.Message = err.Error()
+	} else {
+		commandLog.Infof("Deferred write of %s done after %v", name, time.Since(w.queuedAt).Round(time.Second))
+		result.Message = fmt.Sprintf("deferred write of %s done", name)
+	}
+	result.Timestamp = time.Now().Format(time.RFC3339)
+	reportCommandResult(ctx, result)
+}
+
+// gameWritePending сообщает, что запись по команде отложена
+func gameWritePending(commandID string) bool {
+	for _, w := range pendingGameWrites {
+		if w.commandID == commandID {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingGameWrite - отложенная запись в ответе GET /game-writes
+type pendingGameWrite struct {
+	File        string `json:"file"`
+	Command     string `json:"command,omitempty"`
+	CommandID   string `json:"command_id,omitempty"`
+	QueuedAt    string `json:"queued_at"`
+	NextRestart bool   `json:"next_restart"`
+}
+
+// handleAdminGameWrites возвращает отложенные записи в папку игры
+func handleAdminGameWrites(w http.ResponseWriter, r *http.Request) {
+	list := []pendingGameWrite{}
+	if !inMainLoop(w, r, func(context.Context, *state.Store[time.Time]) {
+		for _, pw := range pendingGameWrites {
+			list = append(list, pendingGameWrite{
+				File:        filepath.Base(pw.filename),
+				Command:     pw.command,
+				CommandID:   pw.commandID,
+				QueuedAt:    pw.queuedAt.Format(time.RFC3339),
+				NextRestart: pw.nextRestart,
+			})
+		}
+	}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"writes": list})
+}
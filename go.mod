@@ -2,6 +2,21 @@ module agent-ws
 
 go 1.24.3
 
-require github.com/fsnotify/fsnotify v1.9.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/go-sql-driver/mysql v1.9.3
+	github.com/klauspost/compress v1.18.0
+	github.com/lib/pq v1.10.9
+	github.com/nats-io/nats.go v1.44.0
+	github.com/segmentio/kafka-go v0.4.49
+	golang.org/x/sync v0.16.0
+	golang.org/x/sys v0.32.0
+)
 
-require golang.org/x/sys v0.13.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/nats-io/nkeys v0.4.11 // indirect
+	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	golang.org/x/crypto v0.37.0 // indirect
+)
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Заголовки, которые агент выставляет сам и которые нельзя переопределить
+var reservedHeaders = []string{"Host", "Content-Type", "Content-Length", "User-Agent", "Idempotency-Key"}
+
+// validateHeaders проверяет дополнительные заголовки из конфигурации
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t:\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("header %s: value must not contain line breaks", name)
+		}
+		for _, reserved := range reservedHeaders {
+			if strings.EqualFold(name, reserved) {
+				return fmt.Errorf("header %s is set by the agent and cannot be overridden", name)
+			}
+		}
+	}
+	return nil
+}
+
+// setPanelHeaders добавляет User-Agent и дополнительные заголовки к запросам
+// к панели (Cloudflare Access, ключи API). Запросы к сторонним сервисам -
+// уведомлениям и каналу обновлений - их не получают.
+func setPanelHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", userAgent())
+	for name, value := range cfg.Headers {
+		req.Header.Set(name, value)
+	}
+}
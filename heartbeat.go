@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// watchPathStatus - доступность отслеживаемой папки
+type watchPathStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// sendHeartbeat отправляет событие heartbeat тем же получателям, что и
+// остальные события (с учетом disable_http и sinks). Следующее уйдет
+// через интервал, поэтому в очередь оно не сохраняется.
+// По пропавшим heartbeat панель определяет, что агент не в сети.
+func sendHeartbeat(ctx context.Context) {
+	if isThrottled() || !eventEnabled("heartbeat") {
+		return
+	}
+
+	pending := 0
+	if pendingEvents != nil {
+		pending = len(pendingEvents.items)
+	}
+
+	paths := make([]watchPathStatus, 0, len(watchTargets))
+	for _, t := range watchTargets {
+		status := watchPathStatus{Name: t.Name, Path: t.Path, Reachable: true}
+		if _, err := os.Stat(t.Path); err != nil {
+			status.Reachable = false
+			status.Error = err.Error()
+		}
+		paths = append(paths, status)
+	}
+
+	heartbeat := map[string]interface{}{
+		"version":        agentVersion,
+		"commit":         agentCommit,
+		"build_date":     agentBuildDate,
+		"hostname":       agentHostname,
+		"timestamp":      time.Now().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(agentStartTime).Seconds()),
+		"pending_events": pending,
+		"queued_events":  eventQueueStore.len(),
+		"paused":         paused,
+		"watch_paths":    paths,
+		"watcher":        watcherState.status(),
+	}
+	if !lastEventTime.IsZero() {
+		heartbeat["last_event"] = lastEventTime.Format(time.RFC3339)
+	}
+	if !diskWatch.checkedAt.IsZero() {
+		heartbeat["disk"] = diskWatch.status()
+	}
+
+	data, err := json.Marshal(heartbeat)
+	if err != nil {
+		agentLog.Errorf("Error encoding heartbeat: %v", err)
+		return
+	}
+
+	deliverEvent(ctx, tagEvent(EventData{
+		SteamID64: cfg.Identity.AgentID,
+		Type:      "agent",
+		Event:     "heartbeat",
+		Data:      data,
+		EventID:   newEventID(),
+	}))
+}
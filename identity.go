@@ -0,0 +1,42 @@
+package main
+
+import "os"
+
+// IdentityConfig - идентификация агента, когда одна панель принимает
+// события с нескольких игровых серверов
+type IdentityConfig struct {
+	// Идентификатор агента (по умолчанию - имя хоста)
+	AgentID    string `json:"agent_id"`
+	ServerName string `json:"server_name"`
+	MapName    string `json:"map_name"`
+	// Интервал события heartbeat, например 60s (0, по умолчанию, - выключено)
+	HeartbeatInterval Duration `json:"heartbeat_interval"`
+}
+
+var agentHostname string
+
+// initIdentity определяет имя хоста и идентификатор агента по умолчанию
+func initIdentity() {
+	hostname, err := os.Hostname()
+	if err != nil {
+		agentLog.Errorf("Error getting hostname: %v", err)
+	}
+	agentHostname = hostname
+
+	if cfg.Identity.AgentID == "" {
+		cfg.Identity.AgentID = hostname
+	}
+	agentLog.Infof("Agent identity: id=%s, server=%s, map=%s, version=%s",
+		cfg.Identity.AgentID, cfg.Identity.ServerName, cfg.Identity.MapName, agentVersion)
+}
+
+// tagEvent добавляет к событию данные об агенте и сервере
+func tagEvent(eventData EventData) EventData {
+	eventData.AgentID = cfg.Identity.AgentID
+	eventData.ServerName = cfg.Identity.ServerName
+	eventData.MapName = mapNameFor(eventData.Instance)
+	if inst := instanceFor(eventData.Instance); inst != nil && inst.ServerName != "" {
+		eventData.ServerName = inst.ServerName
+	}
+	return eventData
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Файлы, которые по умолчанию не считаются сохранениями: временные файлы
+// редакторов, резервные копии игры и скрытые файлы
+var defaultIgnorePatterns = []string{"*.tmp", "*.bak", "*~", "*_backup*", ".*"}
+
+// validateIgnorePatterns проверяет синтаксис шаблонов ignore_patterns
+func validateIgnorePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// isIgnored проверяет имя файла по шаблонам ignore_patterns без учета
+// регистра. Такие файлы не отслеживаются и не порождают событий.
+func isIgnored(filename string) bool {
+	base := strings.ToLower(filepath.Base(filename))
+	for _, pattern := range cfg.IgnorePatterns {
+		if matched, _ := filepath.Match(strings.ToLower(pattern), base); matched {
+			return true
+		}
+	}
+	return false
+}
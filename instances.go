@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"agent-ws/sink"
+)
+
+// InstanceConfig - отдельный сервер Evrima на той же машине. События
+// из папок экземпляра уходят на его API с его заголовками, именем сервера
+// и sink; очередь, номера событий и копии ведутся отдельно по экземплярам.
+type InstanceConfig struct {
+	Name         string        `json:"name"`
+	WatchTargets []WatchTarget `json:"watch_targets"`
+	// Пустые поля берутся из общей конфигурации
+	APIURL     string            `json:"api_url"`
+	Headers    map[string]string `json:"headers"`
+	ServerName string            `json:"server_name"`
+	MapName    string            `json:"map_name"`
+	// Кодирование тела запросов к API экземпляра: json, form или multipart
+	ContentType string `json:"content_type"`
+	// Дополнительные sink экземпляра вместо общих (HTTP API - всегда)
+	Sinks map[string]json.RawMessage `json:"sinks"`
+}
+
+func validateInstances(c *Config) error {
+	seen := make(map[string]bool)
+	for i, inst := range c.Instances {
+		if inst.Name == "" {
+			return fmt.Errorf("instance #%d: name is required", i+1)
+		}
+		// Имя экземпляра - часть путей копий сохранений
+		if inst.Name != filepath.Base(inst.Name) || strings.HasPrefix(inst.Name, ".") {
+			return fmt.Errorf("instance %q: name must be a plain directory name", inst.Name)
+		}
+		if seen[inst.Name] {
+			return fmt.Errorf("instance %s is defined twice", inst.Name)
+		}
+		seen[inst.Name] = true
+		if len(inst.WatchTargets) == 0 {
+			return fmt.Errorf("instance %s: watch_targets are required", inst.Name)
+		}
+		for name := range inst.Sinks {
+			if name == "http" || !sink.Registered(name) {
+				return fmt.Errorf("instance %s: unknown sink %q (available: %v)", inst.Name, name, sink.Names())
+			}
+		}
+		if inst.ContentType != "" {
+			if err := validateContentType("instance "+inst.Name+": content_type", inst.ContentType); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func instanceHasSink(c *Config, name string) bool {
+	for _, inst := range c.Instances {
+		if inst.Sinks[name] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// instanceFor возвращает настройки экземпляра; nil - общая конфигурация
+func instanceFor(name string) *InstanceConfig {
+	if name == "" {
+		return nil
+	}
+	for i := range cfg.Instances {
+		if cfg.Instances[i].Name == name {
+			return &cfg.Instances[i]
+		}
+	}
+	return nil
+}
+
+// instanceWatchTargets возвращает папки всех экземпляров с пометкой экземпляра
+func instanceWatchTargets() []WatchTarget {
+	var targets []WatchTarget
+	for _, inst := range cfg.Instances {
+		for _, t := range inst.WatchTargets {
+			t.instance = inst.Name
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// instanceKey - ключ игрока в состоянии агента (номера событий, dedup):
+// одинаковые SteamID на разных серверах не должны смешиваться
+func instanceKey(instance, steamID string) string {
+	if instance == "" {
+		return steamID
+	}
+	return instance + "/" + steamID
+}
+
+// setInstanceHeaders добавляет к запросу заголовки экземпляра события
+func setInstanceHeaders(req *http.Request, eventData EventData) {
+	if inst := instanceFor(eventData.Instance); inst != nil {
+		for name, value := range inst.Headers {
+			req.Header.Set(name, value)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"agent-ws/sink"
+)
+
+// Виды канала живой карты
+const (
+	liveMapUDP  = "udp"
+	liveMapMQTT = "mqtt"
+)
+
+// Событие обновления живой карты (для MQTT - в шаблоне топика {event})
+const eventPlayerPosition = "player-position"
+
+// LiveMapConfig - канал живой карты: только позиция и рост игроков, не чаще
+// одного обновления игрока за интервал, отдельно от событий изменения
+type LiveMapConfig struct {
+	// udp или mqtt (пусто - выключено)
+	Transport string `json:"transport"`
+	// udp: адрес получателя host:port, каждое обновление - датаграмма JSON
+	Address string `json:"address"`
+	// mqtt: настройки брокера, как у sink mqtt
+	MQTT json.RawMessage `json:"mqtt"`
+	// Интервал отправки обновлений
+	Interval Duration `json:"interval"`
+}
+
+func (c LiveMapConfig) validate() error {
+	switch c.Transport {
+	case "":
+		return nil
+	case liveMapUDP:
+		if c.Address == "" {
+			return fmt.Errorf("live_map.address is required for transport %s", liveMapUDP)
+		}
+	case liveMapMQTT:
+		if len(c.MQTT) == 0 {
+			return fmt.Errorf("live_map.mqtt is required for transport %s", liveMapMQTT)
+		}
+	default:
+		return fmt.Errorf("live_map.transport must be %s or %s", liveMapUDP, liveMapMQTT)
+	}
+	if c.Interval.Duration <= 0 {
+		return fmt.Errorf("live_map.interval must be positive")
+	}
+	return nil
+}
+
+// liveMapUpdate - обновление игрока на живой карте
+type liveMapUpdate struct {
+	SteamID64  string         `json:"steamid64"`
+	Instance   string         `json:"instance,omitempty"`
+	ServerName string         `json:"server_name,omitempty"`
+	MapName    string         `json:"map_name,omitempty"`
+	Position   *sink.Position `json:"position,omitempty"`
+	Growth     *float64       `json:"growth,omitempty"`
+	Time       string         `json:"time"`
+}
+
+var (
+	// Последнее обновление по игроку, ждущее отправки, и последнее
+	// отправленное. Используются только в основном цикле.
+	liveMapPending = make(map[string]liveMapUpdate)
+	liveMapSent    = make(map[string]string)
+	// Пачки обновлений для отправителя; если он не успевает, пачка отбрасывается
+	liveMapOut = make(chan []liveMapUpdate, 4)
+)
+
+// liveMapWritten запоминает позицию и рост игрока из записанного сохранения
+func liveMapWritten(filename, steamID, content string) {
+	if cfg.LiveMap.Transport == "" || !isPlayerFile(filename) {
+		return
+	}
+	var save map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &save); err != nil {
+		return
+	}
+
+	instance := targetFor(filename).instance
+	u := liveMapUpdate{
+		SteamID64: steamID,
+		Instance:  instance,
+		Position:  positionFromSave(instance, save),
+		Growth:    saveNumber(save["Growth"]),
+	}
+	if u.Position == nil && u.Growth == nil {
+		return
+	}
+	liveMapPending[instanceKey(instance, steamID)] = u
+}
+
+// saveNumber читает число, которое Evrima хранит строкой или числом
+func saveNumber(v interface{}) *float64 {
+	switch n := v.(type) {
+	case float64:
+		return &n
+	case string:
+		if f, err := strconv.ParseFloat(n, 64); err == nil {
+			return &f
+		}
+	}
+	return nil
+}
+
+// flushLiveMap передает отправителю изменившиеся с прошлой отправки обновления
+func flushLiveMap() {
+	if len(liveMapPending) == 0 {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var batch []liveMapUpdate
+	for key, u := range liveMapPending {
+		sent, _ := json.Marshal(u)
+		if liveMapSent[key] == string(sent) {
+			continue
+		}
+		liveMapSent[key] = string(sent)
+
+		tagged := tagEvent(EventData{Instance: u.Instance})
+		u.ServerName, u.MapName, u.Time = tagged.ServerName, tagged.MapName, now
+		batch = append(batch, u)
+	}
+	clear(liveMapPending)
+	if len(batch) == 0 {
+		return
+	}
+
+	select {
+	case liveMapOut <- batch:
+	default:
+		deliveryLog.Warnf("Live map sender is behind, dropped %d updates", len(batch))
+	}
+}
+
+// forgetLiveMap убирает удаленного игрока из состояния живой карты
+func forgetLiveMap(filename, steamID string) {
+	if t := targetFor(filename); t != nil {
+		key := instanceKey(t.instance, steamID)
+		delete(liveMapPending, key)
+		delete(liveMapSent, key)
+	}
+}
+
+// liveMapPublisher отправляет обновление живой карты
+type liveMapPublisher interface {
+	publish(ctx context.Context, u liveMapUpdate) error
+	Close() error
+}
+
+type udpPublisher struct {
+	conn net.Conn
+}
+
+func (p udpPublisher) publish(_ context.Context, u liveMapUpdate) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = p.conn.Write(data)
+	return err
+}
+
+func (p udpPublisher) Close() error {
+	return p.conn.Close()
+}
+
+type mqttPublisher struct {
+	sink sink.Sink
+}
+
+func (p mqttPublisher) publish(ctx context.Context, u liveMapUpdate) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return p.sink.Send(ctx, EventData{
+		SteamID64:  u.SteamID64,
+		Type:       "livemap",
+		Event:      eventPlayerPosition,
+		Data:       data,
+		Instance:   u.Instance,
+		ServerName: u.ServerName,
+		MapName:    u.MapName,
+		AgentID:    cfg.Identity.AgentID,
+	})
+}
+
+func (p mqttPublisher) Close() error {
+	return p.sink.Close()
+}
+
+func openLiveMapPublisher(c LiveMapConfig) (liveMapPublisher, error) {
+	if c.Transport == liveMapMQTT {
+		s, err := sink.Open("mqtt", c.MQTT)
+		if err != nil {
+			return nil, err
+		}
+		return mqttPublisher{sink: s}, nil
+	}
+	conn, err := net.Dial("udp", c.Address)
+	if err != nil {
+		return nil, err
+	}
+	return udpPublisher{conn: conn}, nil
+}
+
+// runLiveMap отправляет обновления живой карты вне основного цикла,
+// чтобы медленный получатель не задерживал обработку файлов
+func runLiveMap(ctx context.Context, c LiveMapConfig) error {
+	if c.Transport == "" {
+		return nil
+	}
+	publisher, err := openLiveMapPublisher(c)
+	if err != nil {
+		return fmt.Errorf("live map: %v", err)
+	}
+	defer publisher.Close()
+	deliveryLog.Infof("Live map updates are sent via %s every %v", c.Transport, c.Interval.Duration)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case batch := <-liveMapOut:
+			for _, u := range batch {
+				if err := publisher.publish(ctx, u); err != nil {
+					deliveryLog.Warnf("Error sending live map update for SteamID %s: %v", u.SteamID64, err)
+				}
+			}
+		}
+	}
+}
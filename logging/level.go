@@ -0,0 +1,190 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Level - уровень подробности лога
+type Level int
+
+const (
+	LevelError Level = iota
+	LevelWarn
+	LevelInfo
+	LevelDebug
+	LevelTrace
+)
+
+var levelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+func (l Level) String() string {
+	if l < LevelError || l > LevelTrace {
+		return "unknown"
+	}
+	return levelNames[l]
+}
+
+// ParseLevel разбирает имя уровня: error, warn, info, debug или trace
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "warning" {
+		return LevelWarn, nil
+	}
+	for i, n := range levelNames {
+		if n == name {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q (use error, warn, info, debug or trace)", name)
+}
+
+// Levels - общий уровень лога и уровни отдельных модулей.
+// Уровни можно менять на лету из любой горутины.
+type Levels struct {
+	mu      sync.RWMutex
+	base    Level
+	modules map[string]Level
+	// Временное ограничение подробности поверх всех уровней
+	limit   Level
+	limited bool
+}
+
+func NewLevels(base Level) *Levels {
+	return &Levels{base: base, modules: make(map[string]Level)}
+}
+
+// Enabled проверяет, пишутся ли сообщения уровня level модуля module
+func (l *Levels) Enabled(module string, level Level) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.limited && level > l.limit {
+		return false
+	}
+	if moduleLevel, ok := l.modules[module]; ok {
+		return level <= moduleLevel
+	}
+	return level <= l.base
+}
+
+// SetBase задает общий уровень для модулей без собственного
+func (l *Levels) SetBase(level Level) {
+	l.mu.Lock()
+	l.base = level
+	l.mu.Unlock()
+}
+
+// SetModule задает уровень модуля
+func (l *Levels) SetModule(module string, level Level) {
+	l.mu.Lock()
+	l.modules[module] = level
+	l.mu.Unlock()
+}
+
+// ResetModule возвращает модуль к общему уровню
+func (l *Levels) ResetModule(module string) {
+	l.mu.Lock()
+	delete(l.modules, module)
+	l.mu.Unlock()
+}
+
+// Limit ограничивает подробность всех модулей уровнем level, не меняя
+// заданных уровней, например пока на диске кончается место
+func (l *Levels) Limit(level Level) {
+	l.mu.Lock()
+	l.limit, l.limited = level, true
+	l.mu.Unlock()
+}
+
+// Unlimit снимает ограничение, заданное Limit
+func (l *Levels) Unlimit() {
+	l.mu.Lock()
+	l.limited = false
+	l.mu.Unlock()
+}
+
+// Apply разбирает спецификацию вида "info" или "debug,watcher=trace,delivery=warn":
+// уровень без имени модуля становится общим
+func (l *Levels) Apply(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		module, name, found := strings.Cut(part, "=")
+		if !found {
+			module, name = "", part
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		if module == "" {
+			l.SetBase(level)
+		} else {
+			l.SetModule(strings.TrimSpace(module), level)
+		}
+	}
+	return nil
+}
+
+// Snapshot возвращает общий уровень и уровни модулей
+func (l *Levels) Snapshot() (string, map[string]string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	modules := make(map[string]string, len(l.modules))
+	for module, level := range l.modules {
+		modules[module] = level.String()
+	}
+	return l.base.String(), modules
+}
+
+// Logger пишет сообщения одного модуля с учетом его уровня. Вывод
+// берется при каждой записи, поэтому лог можно подменить после создания.
+type Logger struct {
+	module string
+	levels *Levels
+	output func() *log.Logger
+}
+
+func NewLogger(module string, levels *Levels, output func() *log.Logger) *Logger {
+	return &Logger{module: module, levels: levels, output: output}
+}
+
+// Module возвращает имя модуля логгера
+func (l *Logger) Module() string {
+	return l.module
+}
+
+// Enabled проверяет, пишутся ли сообщения уровня level; позволяет не
+// готовить дорогие сообщения трассировки зря
+func (l *Logger) Enabled(level Level) bool {
+	return l.levels.Enabled(l.module, level)
+}
+
+func (l *Logger) logf(level Level, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	prefix := fmt.Sprintf("%-5s [%s] ", strings.ToUpper(level.String()), l.module)
+	l.output().Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) { l.logf(LevelError, format, args...) }
+func (l *Logger) Warnf(format string, args ...interface{})  { l.logf(LevelWarn, format, args...) }
+func (l *Logger) Infof(format string, args ...interface{})  { l.logf(LevelInfo, format, args...) }
+func (l *Logger) Debugf(format string, args ...interface{}) { l.logf(LevelDebug, format, args...) }
+func (l *Logger) Tracef(format string, args ...interface{}) { l.logf(LevelTrace, format, args...) }
+
+// Modules возвращает имена модулей логгеров по алфавиту
+func Modules(loggers ...*Logger) []string {
+	names := make([]string, 0, len(loggers))
+	for _, l := range loggers {
+		names = append(names, l.module)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLevelsApply(t *testing.T) {
+	levels := NewLevels(LevelInfo)
+	if err := levels.Apply("warn, watcher=trace,delivery=debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		module string
+		level  Level
+		want   bool
+	}{
+		{"agent", LevelWarn, true},
+		{"agent", LevelInfo, false},
+		{"watcher", LevelTrace, true},
+		{"delivery", LevelDebug, true},
+		{"delivery", LevelTrace, false},
+	}
+	for _, tt := range tests {
+		if got := levels.Enabled(tt.module, tt.level); got != tt.want {
+			t.Errorf("Enabled(%s, %s) = %v, want %v", tt.module, tt.level, got, tt.want)
+		}
+	}
+
+	levels.ResetModule("watcher")
+	if levels.Enabled("watcher", LevelInfo) {
+		t.Error("reset module should follow the base level")
+	}
+	if err := levels.Apply("verbose"); err == nil {
+		t.Error("expected error for unknown level")
+	}
+}
+
+func TestLoggerFiltersByLevel(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.New(&buf, "", 0)
+	levels := NewLevels(LevelInfo)
+	logger := NewLogger("watcher", levels, func() *log.Logger { return out })
+
+	logger.Debugf("hidden")
+	logger.Warnf("file %s is locked", "a.json")
+	levels.SetModule("watcher", LevelDebug)
+	logger.Debugf("shown")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"WARN  [watcher] file a.json is locked", "DEBUG [watcher] shown"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("log = %q, want %q", lines, want)
+	}
+}
+
+func TestLevelsLimit(t *testing.T) {
+	levels := NewLevels(LevelInfo)
+	levels.SetModule("watcher", LevelTrace)
+
+	levels.Limit(LevelWarn)
+	if levels.Enabled("watcher", LevelDebug) || levels.Enabled("agent", LevelInfo) {
+		t.Error("limit should hide messages above warn")
+	}
+	if !levels.Enabled("agent", LevelError) {
+		t.Error("limit should keep errors")
+	}
+
+	levels.Unlimit()
+	if !levels.Enabled("watcher", LevelTrace) {
+		t.Error("module level should return after unlimit")
+	}
+}
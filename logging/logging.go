@@ -0,0 +1,29 @@
+// Package logging открывает лог агента. Логгер передается подсистемам
+// явно, поэтому в тестах его можно заменить на Discard.
+package logging
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// Open открывает файл лога для дозаписи и возвращает логгер и файл,
+// который вызывающий закрывает при остановке
+func Open(path string) (*log.Logger, *os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, nil, err
+	}
+	return New(f), f, nil
+}
+
+// New создает логгер агента с форматом времени до микросекунд
+func New(w io.Writer) *log.Logger {
+	return log.New(w, "", log.LstdFlags|log.Lmicroseconds)
+}
+
+// Discard - логгер без вывода
+func Discard() *log.Logger {
+	return New(io.Discard)
+}
@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted - чем заменяются замаскированные значения
+const Redacted = "[REDACTED]"
+
+// Значения короче не маскируются, иначе маскировались бы случайные совпадения
+const minSecretLength = 4
+
+// Redactor маскирует секреты в строках лога перед записью: известные
+// значения (токены, ключи, значения заголовков) и значения JSON-полей
+// с заданными именами, в том числе внутри JSON, экранированного в строку.
+// Правила можно менять на лету, например после загрузки конфигурации.
+type Redactor struct {
+	mu     sync.RWMutex
+	values []string
+	fields []*regexp.Regexp
+}
+
+func NewRedactor() *Redactor {
+	return &Redactor{}
+}
+
+// SetRules задает маскируемые значения и имена JSON-полей
+func (r *Redactor) SetRules(values, fields []string) {
+	var secrets []string
+	for _, v := range values {
+		if len(v) >= minSecretLength {
+			secrets = append(secrets, v)
+		}
+	}
+	// Длинные значения первыми: значение может содержать другое
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+
+	patterns := make([]*regexp.Regexp, 0, len(fields))
+	for _, field := range fields {
+		patterns = append(patterns, fieldPattern(field))
+	}
+
+	r.mu.Lock()
+	r.values, r.fields = secrets, patterns
+	r.mu.Unlock()
+}
+
+// fieldPattern находит значение поля: строку, число или литерал.
+// Кавычки могут быть экранированы, если JSON записан строкой.
+func fieldPattern(field string) *regexp.Regexp {
+	return regexp.MustCompile(`(\\?"` + regexp.QuoteMeta(field) + `\\?"\s*:\s*)` +
+		`(\\?"(?:[^"\\]|\\[^"])*\\?"|[^,}\]\s]+)`)
+}
+
+// Redact возвращает строку с замаскированными секретами
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, v := range r.values {
+		s = strings.ReplaceAll(s, v, Redacted)
+	}
+	for _, p := range r.fields {
+		s = p.ReplaceAllString(s, "${1}"+Redacted)
+	}
+	return s
+}
+
+// Writer оборачивает w: каждая запись проходит через Redact. log.Logger
+// пишет строку лога одним вызовом, поэтому секрет не разрезается между записями.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return redactingWriter{r: r, w: w}
+}
+
+type redactingWriter struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
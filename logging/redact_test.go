@@ -0,0 +1,44 @@
+package logging
+
+import (
+	"bytes"
+	"log"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor()
+	r.SetRules([]string{"s3cr3t-token", "abc", ""}, []string{"Location_Isle_V3", "Growth"})
+
+	tests := []struct {
+		in, want string
+	}{
+		{"Authorization: Bearer s3cr3t-token", "Authorization: Bearer [REDACTED]"},
+		// Короткие значения не маскируются
+		{"abc", "abc"},
+		{`{"Location_Isle_V3": "X=1 Y=2", "Growth": 0.75, "Health": 1}`,
+			`{"Location_Isle_V3": [REDACTED], "Growth": [REDACTED], "Health": 1}`},
+		// JSON, экранированный в строку
+		{`"data":"{\"Location_Isle_V3\":\"X=1 Y=2\",\"Health\":1}"`,
+			`"data":"{\"Location_Isle_V3\":[REDACTED],\"Health\":1}"`},
+	}
+	for _, tt := range tests {
+		if got := r.Redact(tt.in); got != tt.want {
+			t.Errorf("Redact(%s) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactingLogger(t *testing.T) {
+	r := NewRedactor()
+	var buf bytes.Buffer
+	logger := log.New(r.Writer(&buf), "", 0)
+
+	logger.Print("token s3cr3t-token")
+	r.SetRules([]string{"s3cr3t-token"}, nil)
+	logger.Print("token s3cr3t-token")
+
+	if want := "token s3cr3t-token\ntoken [REDACTED]\n"; buf.String() != want {
+		t.Fatalf("log = %q, want %q", buf.String(), want)
+	}
+}
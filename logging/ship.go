@@ -0,0 +1,255 @@
+package logging
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Facility syslog для сообщений агента (local0)
+const syslogFacility = 16
+
+// ShipOptions - общие настройки отправки лога на удаленный сервер
+type ShipOptions struct {
+	// Строки ниже этого уровня не отправляются
+	MinLevel Level
+	// Размер пачки и интервал, по которому отправляется неполная пачка
+	BatchSize     int
+	FlushInterval time.Duration
+	// Сколько строк ждут отправки; при переполнении новые строки отбрасываются
+	BufferSize int
+	// Имя хоста и приложения в сообщениях
+	Hostname string
+	AppName  string
+	// Вызывается при ошибке отправки пачки (пачка при этом теряется)
+	OnError func(error)
+}
+
+func (o *ShipOptions) defaults() {
+	if o.BatchSize <= 0 {
+		o.BatchSize = 100
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = 5 * time.Second
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = 10000
+	}
+	if o.AppName == "" {
+		o.AppName = "agent-ws"
+	}
+	if o.OnError == nil {
+		o.OnError = func(error) {}
+	}
+}
+
+// Shipper - io.Writer, который копит строки лога и отправляет их пачками
+// в фоне. Запись не блокирует логирование: если получатель недоступен
+// и буфер заполнен, строки отбрасываются.
+type Shipper struct {
+	opts    ShipOptions
+	send    func(lines []string) error
+	lines   chan string
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+func newShipper(opts ShipOptions, send func([]string) error) *Shipper {
+	opts.defaults()
+	s := &Shipper{
+		opts:    opts,
+		send:    send,
+		lines:   make(chan string, opts.BufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Shipper) Write(p []byte) (int, error) {
+	line := strings.TrimRight(string(p), "\n")
+	if lineLevel(line) > s.opts.MinLevel {
+		return len(p), nil
+	}
+	select {
+	case <-s.done:
+	case s.lines <- line:
+	default:
+		s.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Dropped возвращает число строк, отброшенных из-за переполнения буфера
+func (s *Shipper) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close отправляет накопленные строки и останавливает отправку
+func (s *Shipper) Close() error {
+	s.once.Do(func() { close(s.done) })
+	<-s.stopped
+	return nil
+}
+
+func (s *Shipper) run() {
+	defer close(s.stopped)
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, s.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(batch); err != nil {
+			s.opts.OnError(fmt.Errorf("ship %d log lines: %v", len(batch), err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case line := <-s.lines:
+			batch = append(batch, line)
+			if len(batch) >= s.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.done:
+			for {
+				select {
+				case line := <-s.lines:
+					batch = append(batch, line)
+					if len(batch) >= s.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// lineLevel определяет уровень строки по метке модульного логгера;
+// строки без метки (например, фатальные ошибки запуска) считаются ошибками
+func lineLevel(line string) Level {
+	for i := LevelError; i <= LevelTrace; i++ {
+		if strings.Contains(line, fmt.Sprintf(" %-5s [", strings.ToUpper(i.String()))) {
+			return i
+		}
+	}
+	return LevelError
+}
+
+// NewSyslogShipper отправляет лог на syslog-сервер в формате RFC 5424.
+// network - udp или tcp; по TCP сообщения разделяются подсчетом октетов (RFC 6587).
+func NewSyslogShipper(network, address string, opts ShipOptions) (*Shipper, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unsupported syslog network %q (use udp or tcp)", network)
+	}
+	opts.defaults()
+
+	var conn net.Conn
+	send := func(lines []string) error {
+		if conn == nil {
+			c, err := net.DialTimeout(network, address, 10*time.Second)
+			if err != nil {
+				return err
+			}
+			conn = c
+		}
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		for _, line := range lines {
+			msg := formatSyslog(line, opts.Hostname, opts.AppName)
+			if network == "tcp" {
+				msg = fmt.Sprintf("%d %s", len(msg), msg)
+			}
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				// Соединение переустанавливается при следующей пачке
+				conn.Close()
+				conn = nil
+				return err
+			}
+		}
+		return nil
+	}
+	return newShipper(opts, send), nil
+}
+
+func formatSyslog(line, hostname, app string) string {
+	severity := 6
+	switch lineLevel(line) {
+	case LevelError:
+		severity = 3
+	case LevelWarn:
+		severity = 4
+	case LevelDebug, LevelTrace:
+		severity = 7
+	}
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s - - - %s",
+		syslogFacility*8+severity, time.Now().UTC().Format(time.RFC3339Nano), hostname, app, line)
+}
+
+// NewHTTPShipper отправляет лог пачками на HTTP endpoint: POST с телом
+// NDJSON, сжатым gzip, по одной записи {time, host, app, level, message} на строку
+func NewHTTPShipper(client *http.Client, url string, headers map[string]string, opts ShipOptions) *Shipper {
+	opts.defaults()
+
+	send := func(lines []string) error {
+		var body bytes.Buffer
+		gz := gzip.NewWriter(&body)
+		enc := json.NewEncoder(gz)
+		now := time.Now().UTC().Format(time.RFC3339Nano)
+		for _, line := range lines {
+			if err := enc.Encode(map[string]string{
+				"time":    now,
+				"host":    opts.Hostname,
+				"app":     opts.AppName,
+				"level":   lineLevel(line).String(),
+				"message": line,
+			}); err != nil {
+				return err
+			}
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", url, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		req.Header.Set("Content-Encoding", "gzip")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil
+	}
+	return newShipper(opts, send)
+}
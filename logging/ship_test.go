@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogShipper(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	shipper, err := NewSyslogShipper("udp", conn.LocalAddr().String(), ShipOptions{
+		MinLevel: LevelWarn,
+		Hostname: "server-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewLogger("delivery", NewLevels(LevelDebug), func() *log.Logger { return New(shipper) })
+	logger.Debugf("not shipped")
+	logger.Errorf("send failed")
+	shipper.Close()
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0.err = 16*8+3
+	if !strings.HasPrefix(msg, "<131>1 ") || !strings.Contains(msg, " server-1 agent-ws - - - ") ||
+		!strings.HasSuffix(msg, "ERROR [delivery] send failed") {
+		t.Fatalf("syslog message = %q", msg)
+	}
+}
+
+func TestHTTPShipperBatchesGzip(t *testing.T) {
+	batches := make(chan []map[string]string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Authorization") != "Bearer t" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var batch []map[string]string
+		scanner := bufio.NewScanner(gz)
+		for scanner.Scan() {
+			var entry map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				t.Error(err)
+			}
+			batch = append(batch, entry)
+		}
+		batches <- batch
+	}))
+	defer server.Close()
+
+	shipper := NewHTTPShipper(server.Client(), server.URL, map[string]string{"Authorization": "Bearer t"},
+		ShipOptions{MinLevel: LevelInfo, BatchSize: 2, FlushInterval: time.Hour})
+	logger := NewLogger("watcher", NewLevels(LevelInfo), func() *log.Logger { return New(shipper) })
+	for _, msg := range []string{"one", "two", "three"} {
+		logger.Infof("%s", msg)
+	}
+	shipper.Close()
+
+	var total int
+	for len(batches) > 0 {
+		batch := <-batches
+		for _, entry := range batch {
+			if entry["level"] != "info" || entry["app"] != "agent-ws" {
+				t.Errorf("entry = %v", entry)
+			}
+		}
+		total += len(batch)
+	}
+	if total != 3 {
+		t.Fatalf("shipped %d lines, want 3", total)
+	}
+}
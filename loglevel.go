@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"agent-ws/logging"
+)
+
+// Уровни лога: общий и по модулям. Меняются флагом --log-level,
+// конфигурацией и через API управления.
+var logLevels = logging.NewLevels(logging.LevelInfo)
+
+// Логгеры модулей агента
+var (
+	// Отслеживание папок, чтение файлов, лог сервера
+	watchLog = newModuleLogger("watcher")
+	// Отправка событий, очередь, sink
+	deliveryLog = newModuleLogger("delivery")
+	// Команды бэкенда и первичная синхронизация
+	commandLog = newModuleLogger("commands")
+	// Локальный API управления
+	adminLog = newModuleLogger("admin")
+	// Запуск, обновление, уведомления и прочее
+	agentLog = newModuleLogger("agent")
+
+	moduleLoggers = []*logging.Logger{watchLog, deliveryLog, commandLog, adminLog, agentLog}
+)
+
+func newModuleLogger(module string) *logging.Logger {
+	return logging.NewLogger(module, logLevels, func() *log.Logger { return fileLogger })
+}
+
+func isLogModule(name string) bool {
+	for _, l := range moduleLoggers {
+		if l.Module() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func validateLogLevels(c *Config) error {
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %v", err)
+	}
+	for module, level := range c.LogLevels {
+		if !isLogModule(module) {
+			return fmt.Errorf("log_levels: unknown module %q (available: %v)", module, logging.Modules(moduleLoggers...))
+		}
+		if _, err := logging.ParseLevel(level); err != nil {
+			return fmt.Errorf("log_levels.%s: %v", module, err)
+		}
+	}
+	return nil
+}
+
+// initLogLevels задает уровни из конфигурации; флаг --log-level их перекрывает
+func initLogLevels(c Config, override string) error {
+	if err := logLevels.Apply(c.LogLevel); err != nil {
+		return err
+	}
+	for module, level := range c.LogLevels {
+		if err := logLevels.Apply(module + "=" + level); err != nil {
+			return err
+		}
+	}
+	if err := logLevels.Apply(override); err != nil {
+		return fmt.Errorf("--log-level: %v", err)
+	}
+	return nil
+}
+
+// extractLogLevelFlag убирает из аргументов флаг --log-level, общий для
+// агента и команд, и возвращает его значение, например "debug,watcher=trace"
+func extractLogLevelFlag(args []string) (string, []string) {
+	var value string
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--log-level" && i+1 < len(args):
+			value = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--log-level="):
+			value = strings.TrimPrefix(arg, "--log-level=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest
+}
+
+func handleAdminLogLevel(w http.ResponseWriter, r *http.Request) {
+	base, modules := logLevels.Snapshot()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"level":   base,
+		"modules": modules,
+		"known":   logging.Modules(moduleLoggers...),
+	})
+}
+
+// handleAdminSetLogLevel меняет уровень на лету: {"level": "debug"} - общий,
+// {"module": "watcher", "level": "trace"} - модуля, пустой level возвращает
+// модуль к общему уровню. Изменение не сохраняется в конфигурацию.
+func handleAdminSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Module string `json:"module"`
+		Level  string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if req.Module != "" && !isLogModule(req.Module) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown module %q", req.Module)})
+		return
+	}
+
+	if req.Module != "" && req.Level == "" {
+		logLevels.ResetModule(req.Module)
+	} else {
+		level, err := logging.ParseLevel(req.Level)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		if req.Module == "" {
+			logLevels.SetBase(level)
+		} else {
+			logLevels.SetModule(req.Module, level)
+		}
+	}
+	adminLog.Infof("Log level changed via admin API: module=%q level=%q", req.Module, req.Level)
+	handleAdminLogLevel(w, r)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"agent-ws/logging"
+)
+
+// LogShippingConfig - отправка лога агента на удаленный сервер, чтобы
+// собирать логи нескольких игровых серверов без отдельного агента логов
+type LogShippingConfig struct {
+	// syslog или http (пусто - выключено)
+	Type string `json:"type"`
+	// Адрес syslog-сервера: udp://host:514 или tcp://host:601
+	Address string `json:"address"`
+	// Endpoint приема лога по HTTP и заголовки запроса (например, токен)
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// Минимальный отправляемый уровень (пусто - info)
+	MinLevel string `json:"min_level"`
+	// Размер пачки и интервал отправки неполной пачки
+	BatchSize     int      `json:"batch_size"`
+	FlushInterval Duration `json:"flush_interval"`
+}
+
+var logShipper *logging.Shipper
+
+func validateLogShipping(c LogShippingConfig) error {
+	switch c.Type {
+	case "":
+		return nil
+	case "syslog":
+		u, err := url.Parse(c.Address)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Host == "" {
+			return fmt.Errorf("log_shipping.address must be udp://host:port or tcp://host:port")
+		}
+	case "http":
+		if c.URL == "" {
+			return fmt.Errorf("log_shipping.url is required for http shipping")
+		}
+	default:
+		return fmt.Errorf("unknown log_shipping.type %q (use syslog or http)", c.Type)
+	}
+	if c.MinLevel != "" {
+		if _, err := logging.ParseLevel(c.MinLevel); err != nil {
+			return fmt.Errorf("log_shipping.min_level: %v", err)
+		}
+	}
+	if c.BatchSize < 0 || c.FlushInterval.Duration < 0 {
+		return fmt.Errorf("log_shipping.batch_size and flush_interval must not be negative")
+	}
+	return nil
+}
+
+// initLogShipping дублирует лог агента на удаленный сервер. Вызывается после
+// initHTTPClient: HTTP-отправка использует TLS и прокси агента.
+func initLogShipping(c LogShippingConfig) error {
+	if c.Type == "" {
+		return nil
+	}
+
+	minLevel := logging.LevelInfo
+	if c.MinLevel != "" {
+		minLevel, _ = logging.ParseLevel(c.MinLevel)
+	}
+	opts := logging.ShipOptions{
+		MinLevel:      minLevel,
+		BatchSize:     c.BatchSize,
+		FlushInterval: c.FlushInterval.Duration,
+		Hostname:      strings.ReplaceAll(cfg.Identity.AgentID, " ", "_"),
+		// Ошибки отправки не пишутся в лог, иначе они тоже ушли бы на отправку
+		OnError: func(err error) { log.Printf("Log shipping error: %v", err) },
+	}
+
+	var err error
+	switch c.Type {
+	case "syslog":
+		u, _ := url.Parse(c.Address)
+		logShipper, err = logging.NewSyslogShipper(u.Scheme, u.Host, opts)
+	case "http":
+		logShipper = logging.NewHTTPShipper(httpClient, c.URL, c.Headers, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	fileLogger.SetOutput(logRedactor.Writer(io.MultiWriter(logFileHandle, logShipper)))
+	agentLog.Infof("Shipping logs (%s and above) via %s", minLevel, c.Type)
+	return nil
+}
+
+// closeLogShipping отправляет оставшиеся строки; дальше лог пишется только в файл
+func closeLogShipping() {
+	if logShipper == nil {
+		return
+	}
+	fileLogger.SetOutput(logRedactor.Writer(logFileHandle))
+	logShipper.Close()
+	if dropped := logShipper.Dropped(); dropped > 0 {
+		agentLog.Warnf("Log shipping dropped %d lines because the receiver was too slow", dropped)
+	}
+}
@@ -2,36 +2,45 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"golang.org/x/sync/errgroup"
+
+	"agent-ws/events"
+	"agent-ws/logging"
+	"agent-ws/sink"
+	"agent-ws/state"
+	"agent-ws/tracing"
+	"agent-ws/watcher"
 )
 
 const (
 	watchPath       = `C:\EVRIMA\surv_server\TheIsle\Saved\Databases\Survival\Players`
-	apiURL          = "https://admin.twod.club/api/get-event"
+	defaultAPIURL   = "https://admin.twod.club/api/get-event"
 	checkInterval   = 2 * time.Second
 	logFile         = `C:\EVRIMA\file_watcher.log`
-	maxRetries      = 3
-	retryDelay      = 2 * time.Second
 	fileReadRetries = 5
 	fileReadDelay   = 500 * time.Millisecond
+	// Пауза между двумя чтениями при проверке, что файл дописан
+	fileStableDelay = 200 * time.Millisecond
+	// Предел паузы, растущей при блокировке файла игрой
+	fileLockMaxDelay = 5 * time.Second
 )
 
-type EventData struct {
-	SteamID64 string `json:"steamid64"`
-	Type      string `json:"type"`
-	Event     string `json:"event"`
-	Data      string `json:"data"`
-}
+// EventData - событие об изменении файла игрока или состояния сервера
+type EventData = sink.Event
 
 type ApiResponse struct {
 	StatusCode int    `json:"status_code"`
@@ -42,139 +51,532 @@ type ApiResponse struct {
 	Success    bool   `json:"success"`
 	Error      string `json:"error,omitempty"`
 	IsHTML     bool   `json:"is_html"`
+	// Запрос остановлен проверкой Cloudflare или входом Cloudflare Access
+	IsChallenge bool `json:"is_challenge"`
+	// Ошибка, которую вернул бэкенд в JSON-ответе
+	BackendError *backendError `json:"backend_error,omitempty"`
+
+	// Пауза, которую бэкенд попросил выдержать (429/503 с Retry-After)
+	RetryAfter time.Duration `json:"-"`
 }
 
 var (
 	fileLogger    *log.Logger
 	logFileHandle *os.File
 	httpClient    *http.Client
-	fileCache     map[string]string // Кэш для хранения содержимого файлов
+	fileCache     *contentCache // Кэш для хранения содержимого файлов
+	fileWatcher   watcher.Source
 )
 
 func main() {
-	// Инициализация кэша
-	fileCache = make(map[string]string)
+	// Инициализация кэша хэшей; кэш содержимого создается по конфигурации
+	fileHashes = state.New[string]()
 
 	// Инициализация логгера
 	if err := initLogger(); err != nil {
 		log.Fatal("Error initializing logger:", err)
 	}
 	defer logFileHandle.Close()
+	// Новый экземпляр стартует последним, когда закрыты адреса API,
+	// watcher, очередь и sink текущего
+	defer restartIfRequested()
+
+	// validate-config сам разбирает конфигурацию и сообщает об ошибках в ней
+	if len(os.Args) > 1 && os.Args[1] == "validate-config" {
+		code := runValidateConfig(os.Args[2:])
+		logFileHandle.Close()
+		os.Exit(code)
+	}
 
-	// Инициализация HTTP клиента
-	initHTTPClient()
+	// Загрузка конфигурации
+	var err error
+	cfg, err = loadConfig(configFile)
+	if err != nil {
+		fileLogger.Fatalf("Error loading config %s: %v", configFile, err)
+	}
+	applyRedaction(cfg)
+
+	// Уровни лога из конфигурации и флага --log-level
+	levelFlag, args := extractLogLevelFlag(os.Args[1:])
+	if err := initLogLevels(cfg, levelFlag); err != nil {
+		fileLogger.Fatalf("Error setting log level: %v", err)
+	}
 
-	fileLogger.Println("=== Starting file watcher ===")
-	fileLogger.Printf("Watch path: %s", watchPath)
-	fileLogger.Printf("API URL: %s", apiURL)
+	// Отдельный лог полных тел неудачных отправок
+	if err := initBodyDump(cfg.BodyDumpFile); err != nil {
+		fileLogger.Fatalf("Error opening body dump log: %v", err)
+	}
+	defer closeBodyDump()
+
+	// Команды командной строки выполняются вместо запуска агента
+	if len(args) > 0 {
+		code := runCLI(args)
+		closeBodyDump()
+		logFileHandle.Close()
+		os.Exit(code)
+	}
 
-	log.Println("Starting file watcher for:", watchPath)
+	// Идентификация агента
+	initIdentity()
 
-	// Проверяем существование папки
-	if _, err := os.Stat(watchPath); os.IsNotExist(err) {
-		fileLogger.Fatalf("Directory does not exist: %s", watchPath)
+	// Журнал изменений, которые агент вносит в папку игры и на сервер
+	if err := initAuditLog(cfg.AuditLogFile); err != nil {
+		fileLogger.Fatalf("Error opening audit log: %v", err)
 	}
+	defer closeAuditLog()
+
+	// Список SteamID, события которых не отправляются
+	initBlocklist()
 
-	// Создаем watcher
-	watcher, err := fsnotify.NewWatcher()
+	// Кэш содержимого файлов с вытеснением на диск
+	fileCache, err = newContentCache(cfg.ContentCacheSizeMB*1024*1024, cfg.ContentCacheDir, cfg.ContentCacheCompression)
 	if err != nil {
-		fileLogger.Fatal("Error creating watcher:", err)
+		fileLogger.Fatalf("Error initializing content cache: %v", err)
 	}
-	defer watcher.Close()
 
-	// Добавляем папку для отслеживания
-	err = watcher.Add(watchPath)
+	// Пороги очереди недоставленных событий
+	initBackpressure()
+
+	// Шифрование сохраняемого на диск состояния
+	if err := initStateEncryption(cfg.StateEncryptionKey); err != nil {
+		fileLogger.Fatalf("Error initializing state encryption: %v", err)
+	}
+
+	// Шифрование поля data при передаче
+	if err := initPayloadEncryption(cfg.PayloadEncryption); err != nil {
+		fileLogger.Fatalf("Error initializing payload encryption: %v", err)
+	}
+
+	// Загрузка номеров подтвержденных событий
+	sequences, err = loadSequences(cfg.SequenceFile)
 	if err != nil {
-		fileLogger.Fatal("Error adding watch path:", err)
+		fileLogger.Fatalf("Error loading sequences: %v", err)
 	}
+	defer sequences.flush()
 
-	fileLogger.Println("Watching directory:", watchPath)
-	log.Println("Watching directory:", watchPath)
+	// Открытие очереди недоставленных событий
+	eventQueueStore, err = openPersistentQueue(cfg.QueueDir)
+	if err != nil {
+		fileLogger.Fatalf("Error opening persistent queue: %v", err)
+	}
+
+	// Инициализация HTTP клиента
+	if err := initHTTPClient(); err != nil {
+		fileLogger.Fatalf("Error initializing HTTP client: %v", err)
+	}
+
+	// Отправка лога на удаленный сервер
+	if err := initLogShipping(cfg.LogShipping); err != nil {
+		fileLogger.Fatalf("Error initializing log shipping: %v", err)
+	}
+	defer closeLogShipping()
+
+	// Трассировка конвейера событий
+	initTracing(cfg.Tracing)
+	defer closeTracing()
+
+	// Выгрузка копий сохранений в объектное хранилище
+	if err := initBackupUpload(cfg.Backup.S3); err != nil {
+		fileLogger.Fatalf("Error initializing backup upload: %v", err)
+	}
+	defer closeBackupUpload()
+
+	// Дополнительные места доставки событий
+	if err := initSinks(); err != nil {
+		fileLogger.Fatalf("Error initializing sinks: %v", err)
+	}
+	defer closeSinks()
+	// Открытый поток событий завершается после воркеров
+	defer closeEventStream()
+
+	// Воркеры доставки; останавливаются раньше sink
+	initDispatcher()
+	defer closeDispatcher()
+
+	// Инициализация каналов уведомлений
+	if err := initNotifiers(cfg.Notifiers); err != nil {
+		fileLogger.Fatalf("Error initializing notifiers: %v", err)
+	}
+
+	// Инициализация чтения лога сервера
+	if err := initServerLog(cfg.ServerLog); err != nil {
+		fileLogger.Fatalf("Error initializing server log: %v", err)
+	}
+
+	// Профили отслеживаемых папок
+	if err := initWatchTargets(cfg.WatchTargets); err != nil {
+		fileLogger.Fatalf("Error initializing watch targets: %v", err)
+	}
+
+	agentLog.Infof("=== Starting file watcher ===")
+	agentLog.Infof("Agent version: %s (commit %s, built %s)", agentVersion, agentCommit, agentBuildDate)
+	for _, t := range watchTargets {
+		agentLog.Infof("Watch path: %s (target: %s, type: %s, event type: %s, parser: %s)", t.Path, t.Name, t.Type, t.EventType, t.Parser)
+	}
+	agentLog.Infof("API URL: %s", cfg.APIURL)
+	agentLog.Infof("Memory profile: %s", cfg.MemoryProfile)
+	agentLog.Infof("Max payload size: %d bytes, oversize mode: %s", cfg.MaxPayloadSize, cfg.OversizeMode)
+
+	// Корневой контекст агента: отменяется по Ctrl+C / SIGTERM и прерывает
+	// чтение файлов, отправку и паузы между попытками, в том числе при запуске
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// На новом сервере папки Players нет до первого сохранения
+	if cfg.WaitForDirectory {
+		if err := waitForDirectories(ctx); err != nil {
+			agentLog.Infof("Stopped waiting for watch directories: %v", err)
+			return
+		}
+	}
+
+	// Создаем watcher и добавляем папки для отслеживания. Если папки пока
+	// нет, агент не завершается, а повторяет попытки из основного цикла
+	for _, t := range watchTargets {
+		log.Println("Starting file watcher for:", t.Path)
+	}
+	if err := startWatcher(); err != nil {
+		watcherFailed(err)
+	}
+	defer func() {
+		if fileWatcher != nil {
+			fileWatcher.Close()
+		}
+	}()
+
+	for _, t := range watchTargets {
+		watchLog.Infof("Watching directory: %s", t.Path)
+		log.Println("Watching directory:", t.Path)
+	}
 
 	// Карта для отслеживания предыдущего состояния файлов
-	fileStates := make(map[string]time.Time)
+	fileStates := state.New[time.Time]()
+
+	// Соединения с API открываются, пока сканируются существующие файлы
+	go prewarmConnections(ctx)
 
 	// Инициализация - сканируем существующие файлы
-	initFileStates(fileStates)
+	if boundedMemory() {
+		pendingEvents = newEventQueue(cfg.MaxPendingEvents)
+		initFileStatesBounded(ctx, fileStates)
+	} else {
+		initFileStates(ctx, fileStates)
+	}
+
+	// Очередь и номера событий сверяются с бэкендом до первых отправок
+	syncBackendOffsets(ctx)
+
+	// Первичная синхронизация со снимком бэкенда
+	primeFromBackend(ctx, fileStates)
+
+	// События по существующим файлам, если панель их ждет
+	emitStartupEvents(ctx, fileStates)
+
+	// Версия агента для панели
+	sendVersionEvent(ctx)
+
+	// Полный снимок папки для пересборки состояния на бэкенде
+	takeStartupSnapshot(ctx, fileStates)
+
+	// Подсистемы завершаются вместе, если остановилась любая из них
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return runEventLoop(ctx, fileStates) })
+	g.Go(func() error { return runAdminAPI(ctx, cfg.AdminAPI) })
+	g.Go(func() error { return runCommandWebhook(ctx, cfg.Commands.Webhook) })
+	g.Go(func() error { return runLiveMap(ctx, cfg.LiveMap) })
+
+	err = g.Wait()
+	switch {
+	case errors.Is(err, errRestartRequested):
+		agentLog.Infof("=== Agent stopped for restart ===")
+	case err != nil && !errors.Is(err, context.Canceled):
+		agentLog.Errorf("Agent stopped with error: %v", err)
+	default:
+		agentLog.Infof("=== File watcher stopped ===")
+	}
+
+	// Даем отправиться уведомлениям, поставленным перед остановкой
+	waitNotifications(notifyShutdownTimeout)
+}
+
+// errRestartRequested завершает подсистемы агента перед перезапуском процесса
+var errRestartRequested = errors.New("agent restart requested")
+
+// runEventLoop - основной цикл: события файлов, периодические задачи и
+// вызовы локального API. Все состояние агента меняется только здесь.
+func runEventLoop(ctx context.Context, fileStates *state.Store[time.Time]) error {
+	// Таймер обработки очереди отложенных событий (bounded-режим)
+	pendingTicker := time.NewTicker(pendingSettleDelay / 2)
+	defer pendingTicker.Stop()
+
+	// Таймер опроса лога сервера (nil-канал, если выключен)
+	serverLogC, stopServerLog := optionalTicker(serverLogTailer != nil, cfg.ServerLog.PollInterval.Duration)
+	defer stopServerLog()
+
+	// Таймер опроса команд от бэкенда
+	commandsC, stopCommands := optionalTicker(cfg.Commands.PollURL != "", cfg.Commands.PollInterval.Duration)
+	defer stopCommands()
+
+	// Таймер события heartbeat
+	heartbeatC, stopHeartbeat := optionalTicker(cfg.Identity.HeartbeatInterval.Duration > 0, cfg.Identity.HeartbeatInterval.Duration)
+	defer stopHeartbeat()
+
+	// Таймер проверки обновлений агента
+	updateC, stopUpdate := optionalTicker(cfg.Update.ManifestURL != "" && cfg.Update.Auto, cfg.Update.CheckInterval.Duration)
+	defer stopUpdate()
+
+	// Таймер отправки отчетов о доставке
+	reportC, stopReport := optionalTicker(cfg.DeliveryReport.URL != "", cfg.DeliveryReport.Interval.Duration)
+	defer stopReport()
+
+	// Таймер сводки метрик в логе
+	metricsC, stopMetrics := optionalTicker(cfg.MetricsLogInterval.Duration > 0, cfg.MetricsLogInterval.Duration)
+	defer stopMetrics()
+
+	// Таймер повторной отправки событий из очереди
+	redeliveryTicker := time.NewTicker(cfg.QueueRetryInterval.Duration)
+	defer redeliveryTicker.Stop()
+
+	// Таймер проверки места на диске
+	diskC, stopDisk := optionalTicker(cfg.DiskWatchdog.Interval.Duration > 0, cfg.DiskWatchdog.Interval.Duration)
+	defer stopDisk()
+
+	// Таймер проверки пропущенных событий файловой системы
+	gapScanC, stopGapScan := optionalTicker(cfg.GapScanInterval.Duration > 0, cfg.GapScanInterval.Duration)
+	defer stopGapScan()
+
+	// Таймер отправки обновлений живой карты
+	liveMapC, stopLiveMap := optionalTicker(cfg.LiveMap.Transport != "", cfg.LiveMap.Interval.Duration)
+	defer stopLiveMap()
+
+	// Таймер проверки удаленных файлов и сохранения номеров событий
+	deletedTicker := time.NewTicker(checkInterval)
+	defer deletedTicker.Stop()
 
-	// Основной цикл обработки событий
 	for {
+		// Пока watcher не восстановлен, его каналы - nil и не выбираются
+		var watcherEvents <-chan fsnotify.Event
+		var watcherErrors <-chan error
+		if fileWatcher != nil {
+			watcherEvents, watcherErrors = fileWatcher.Events(), fileWatcher.Errors()
+		}
+
 		select {
-		case event, ok := <-watcher.Events:
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-watcherEvents:
 			if !ok {
-				return
+				watcherFailed(errors.New("watcher event channel closed"))
+				continue
+			}
+			// Массовое сохранение сервера приходит пачкой событий подряд
+			for _, event := range collectBurst(event) {
+				watchActivity(event)
+				handleFileEvent(ctx, event, fileStates)
 			}
-			handleFileEvent(event, fileStates)
 
-		case err, ok := <-watcher.Errors:
+		case err, ok := <-watcherErrors:
 			if !ok {
-				return
+				watcherFailed(errors.New("watcher error channel closed"))
+				continue
 			}
-			fileLogger.Println("Watcher error:", err)
+			watchLog.Errorf("Watcher error: %v", err)
 			log.Println("Watcher error:", err)
+			notify(alertWatcherError, SeverityWarning, "Watcher error", err.Error())
+			// Переполненный буфер событий ОС молча теряет события
+			if errors.Is(err, fsnotify.ErrEventOverflow) && !paused {
+				rescanLostEvents(ctx, watchTargets, rescanOverflow, "event buffer overflow", fileStates)
+			}
+
+		case <-pendingTicker.C:
+			if pendingEvents != nil && !backpressureActive {
+				processPendingEvents(ctx, fileStates)
+			}
+			if activeBurst != nil && !backpressureActive && !paused {
+				flushBurst(ctx, fileStates)
+			}
+
+		case <-serverLogC:
+			serverLogTailer.poll(ctx)
+
+		case <-commandsC:
+			pollCommands(ctx, fileStates)
+
+		case <-heartbeatC:
+			sendHeartbeat(ctx)
+
+		case <-updateC:
+			checkForUpdate(ctx)
+
+		case <-metricsC:
+			metrics.logSummary()
 
-		case <-time.After(checkInterval):
-			// Периодическая проверка на удаленные файлы
-			checkForDeletedFiles(fileStates)
+		case <-gapScanC:
+			scanForGaps(ctx, fileStates)
+
+		case <-diskC:
+			checkDiskHealth()
+
+		case <-reportC:
+			sendDeliveryReport(ctx)
+
+		case <-liveMapC:
+			flushLiveMap()
+
+		case <-redeliveryTicker.C:
+			if !paused {
+				redeliverQueued(ctx)
+			}
+			updateBackpressure(ctx, fileStates)
+
+		case call := <-adminCalls:
+			call.run(ctx, fileStates)
+			close(call.done)
+
+		case <-deletedTicker.C:
+			superviseWatcher(ctx, fileStates)
+			// Периодическая проверка на удаленные файлы. Пока папки недоступны,
+			// пропавшие файлы не считаются удаленными
+			if !paused && watcherState.healthy() {
+				flushExpiredRenames(ctx, fileStates)
+				checkForDeletedFiles(ctx, fileStates)
+			}
+			updateBackpressure(ctx, fileStates)
+			sequences.flush()
+			blocklist.reload()
+			sweepBackups()
+			processGameWrites(ctx, fileStates)
+			if !paused {
+				checkIdlePlayers(ctx)
+			}
+		}
+
+		// Текущий экземпляр завершает все подсистемы через отмену контекста,
+		// новый запускается из main после их остановки
+		if restartRequested {
+			return errRestartRequested
 		}
 	}
 }
 
+// startWatcher создает watcher и подписывает его на отслеживаемые папки
+func startWatcher() error {
+	paths := make([]string, 0, len(watchTargets))
+	for _, t := range watchTargets {
+		paths = append(paths, t.Path)
+	}
+
+	w, err := deps.Watch(paths)
+	if err != nil {
+		return err
+	}
+	fileWatcher = w
+	rememberWatchedDirs()
+	return nil
+}
+
+// optionalTicker возвращает канал тиков или nil-канал, если функция выключена
+func optionalTicker(enabled bool, interval time.Duration) (<-chan time.Time, func()) {
+	if !enabled {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
 func initLogger() error {
 	var err error
-	logFileHandle, err = os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	fileLogger, logFileHandle, err = logging.Open(logFile)
 	if err != nil {
 		return err
 	}
-
-	// Настраиваем логгер для записи в файл
-	fileLogger = log.New(logFileHandle, "", log.LstdFlags|log.Lmicroseconds)
+	fileLogger.SetOutput(logRedactor.Writer(logFileHandle))
+	log.SetOutput(logRedactor.Writer(os.Stderr))
 	return nil
 }
 
-func initHTTPClient() {
+func initHTTPClient() error {
+	tlsConfig, err := buildTLSConfig(cfg.TLS)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := proxyFunc(cfg.Proxy)
+	if err != nil {
+		return err
+	}
+
+	var transport http.RoundTripper = deps.Transport
+	if transport == nil {
+		t := newTransport(cfg.Transport, cfg.Timeouts)
+		t.TLSClientConfig = tlsConfig
+		t.Proxy = proxy
+		transport = t
+	}
 	httpClient = &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			MaxIdleConns:        100,
-			MaxIdleConnsPerHost: 10,
-			IdleConnTimeout:     90 * time.Second,
-		},
+		Timeout:   cfg.Timeouts.Request.Duration,
+		Transport: transport,
+	}
+	return nil
+}
+
+func initFileStates(ctx context.Context, fileStates *state.Store[time.Time]) {
+	for _, t := range watchTargets {
+		initTargetStates(ctx, t, fileStates)
 	}
+	watchLog.Infof("Initialized tracking for %d files", fileStates.Len())
 }
 
-func initFileStates(fileStates map[string]time.Time) {
-	files, err := os.ReadDir(watchPath)
+func initTargetStates(ctx context.Context, t *WatchTarget, fileStates *state.Store[time.Time]) {
+	files, err := os.ReadDir(t.Path)
 	if err != nil {
-		fileLogger.Printf("Error reading directory: %v", err)
+		watchLog.Errorf("Error reading directory: %v", err)
 		return
 	}
 
 	for _, file := range files {
-		if !file.IsDir() {
-			fullPath := filepath.Join(watchPath, file.Name())
-			if info, err := os.Stat(fullPath); err == nil {
-				fileStates[fullPath] = info.ModTime()
+		if ctx.Err() != nil {
+			return
+		}
+		if !file.IsDir() && !isIgnored(file.Name()) {
+			fullPath := filepath.Join(t.Path, file.Name())
+			if info, err := deps.Files.Stat(fullPath); err == nil {
+				fileStates.Set(fullPath, info.ModTime())
 				// Кэшируем содержимое существующих файлов
-				content, err := readFileContentWithRetry(fullPath)
+				content, err := readFileContentWithRetry(ctx, fullPath)
 				if err == nil {
-					fileCache[fullPath] = content
-					fileLogger.Printf("Cached content for file: %s, Size: %d bytes",
+					cacheContent(fullPath, content)
+					rememberDino(fullPath, content)
+					// При startup_mode resync содержимое сверяется заново
+					if cfg.StartupMode != startupResync {
+						baselineHashes.Set(fullPath, hashContent(content))
+					}
+					watchLog.Tracef("Cached content for file: %s, Size: %d bytes",
 						filepath.Base(fullPath), len(content))
 				} else {
-					fileLogger.Printf("Error caching file %s: %v", filepath.Base(fullPath), err)
+					watchLog.Errorf("Error caching file %s: %v", filepath.Base(fullPath), err)
 				}
 			}
 		}
 	}
-	fileLogger.Printf("Initialized tracking for %d files", len(fileStates))
 }
 
-func handleFileEvent(event fsnotify.Event, fileStates map[string]time.Time) {
+func handleFileEvent(ctx context.Context, event fsnotify.Event, fileStates *state.Store[time.Time]) {
 	filename := event.Name
 
+	// Временные и резервные файлы не обрабатываются
+	if isIgnored(filename) {
+		return
+	}
+
 	// Игнорируем директории
-	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+	if info, err := deps.Files.Stat(filename); err == nil && info.IsDir() {
+		return
+	}
+
+	// Файл должен лежать в одной из отслеживаемых папок
+	if targetFor(filename) == nil {
 		return
 	}
 
@@ -184,115 +586,186 @@ func handleFileEvent(event fsnotify.Event, fileStates map[string]time.Time) {
 		return
 	}
 
-	fileLogger.Printf("File event: %s, File: %s, SteamID: %s", event.Op.String(), filepath.Base(filename), steamID)
+	watchLog.Debugf("File event: %s, File: %s, SteamID: %s", event.Op.String(), filepath.Base(filename), steamID)
 	log.Printf("Event: %s, File: %s", event.Op.String(), filepath.Base(filename))
+	lastEventTime = time.Now()
+	metrics.fileEventDetected(filename, event.Op)
+
+	// На паузе события не обрабатываются, изменения догоняются через resync
+	if paused {
+		return
+	}
+
+	// При backpressure содержимое файлов не читается - сохраняем только ссылку
+	if backpressureActive {
+		if dropUnderBackpressure(fileEventName(filename, event.Op)) {
+			metrics.eventDropped("backpressure")
+			return
+		}
+		if pendingEvents == nil {
+			deferFileEvent(filename, steamID, event.Op)
+			return
+		}
+	}
+
+	// Во время массового сохранения события копятся в пакете
+	if activeBurst != nil {
+		activeBurst.push(filename, steamID, event.Op)
+		return
+	}
+
+	// В bounded-режиме события копятся в ограниченной очереди со слиянием
+	if pendingEvents != nil {
+		pendingEvents.push(filename, steamID, event.Op)
+		return
+	}
+
+	ctx, span := startFileTrace(ctx, filename, steamID, event.Op, time.Now())
+	defer span.End()
 
 	switch {
 	case event.Op&fsnotify.Create == fsnotify.Create:
 		// Для создания файла даем больше времени на запись
-		time.Sleep(1 * time.Second)
-		handleFileCreate(filename, steamID, fileStates)
+		if debounce(ctx, 1*time.Second) != nil {
+			return
+		}
+		handleFileCreate(ctx, filename, steamID, fileStates)
 
 	case event.Op&fsnotify.Write == fsnotify.Write:
 		// Для изменения файла даем время на завершение записи
-		time.Sleep(500 * time.Millisecond)
-		handleFileWrite(filename, steamID, fileStates)
+		if debounce(ctx, 500*time.Millisecond) != nil {
+			return
+		}
+		handleFileWrite(ctx, filename, steamID, fileStates)
 
 	case event.Op&fsnotify.Remove == fsnotify.Remove:
-		handleFileRemove(filename, steamID, fileStates)
+		handleFileRemove(ctx, filename, steamID, fileStates)
+
+	case event.Op&fsnotify.Rename == fsnotify.Rename:
+		handleFileRename(ctx, filename, steamID, fileStates)
 	}
 }
 
-func handleFileCreate(filename, steamID string, fileStates map[string]time.Time) {
-	content, err := readFileContentWithRetry(filename)
-	if err != nil {
-		fileLogger.Printf("Error reading created file %s after retries: %v", filename, err)
+// handleFileRename обрабатывает переименование файла. Новое имя придет
+// отдельным событием создания: если оно окажется другим SteamID, панель
+// получит событие переноса, иначе старое имя считается удаленным.
+func handleFileRename(ctx context.Context, filename, steamID string, fileStates *state.Store[time.Time]) {
+	if _, err := deps.Files.Stat(filename); err == nil {
+		return // Файл с этим именем снова на месте
+	}
+	if _, tracked := fileStates.Get(filename); !tracked {
+		return // Удаление уже обработано проверкой удаленных файлов
+	}
+	if holdRename(filename, steamID) {
 		return
 	}
+	handleFileRemove(ctx, filename, steamID, fileStates)
+}
 
-	// Кэшируем содержимое
-	fileCache[filename] = content
+func handleFileCreate(ctx context.Context, filename, steamID string, fileStates *state.Store[time.Time]) {
+	content, err := readEventContent(ctx, filename)
+	if err != nil {
+		watchLog.Errorf("Error reading created file %s after retries: %v", filename, err)
+		return
+	}
+	if takeAppliedEdit(filename, content) {
+		return // Правка панели, записанная агентом
+	}
 
-	eventData := EventData{
-		SteamID64: steamID,
-		Type:      "player",
-		Event:     "add-dino-data",
-		Data:      content,
+	// Файл мог появиться переименованием сохранения другого SteamID
+	if oldName, old, ok := takeRename(filename, steamID, content); ok {
+		handleFileMigrate(ctx, oldName, old, filename, steamID, content, fileStates)
+		return
 	}
 
-	fileLogger.Printf("Sending create event for SteamID %s, File size: %d bytes",
-		steamID, len(content))
-	sendEventWithRetry(eventData)
-	fileStates[filename] = time.Now()
+	// Кэшируем содержимое
+	cacheContent(filename, content)
+	rememberDino(filename, content)
+	backupSave(filename, steamID, content)
+
+	// Если преобразования не применились, событие не отправляется,
+	// но файл отслеживается дальше
+	if eventData, err := fileEvent(ctx, filename, opAdd, steamID, content); err == nil {
+		watchLog.Debugf("Sending create event for SteamID %s, File size: %d bytes",
+			steamID, len(content))
+		sendEventWithRetry(ctx, eventData)
+	}
+	fileStates.Set(filename, time.Now())
+	playerWritten(ctx, filename, steamID)
+	liveMapWritten(filename, steamID, content)
 }
 
-func handleFileWrite(filename, steamID string, fileStates map[string]time.Time) {
+func handleFileWrite(ctx context.Context, filename, steamID string, fileStates *state.Store[time.Time]) {
 	// Проверяем, действительно ли файл изменился
-	if info, err := os.Stat(filename); err == nil {
-		if oldTime, exists := fileStates[filename]; exists {
-			if info.ModTime().Equal(oldTime) {
-				return // Файл не изменился
-			}
-		}
-	} else {
-		fileLogger.Printf("Error stating file %s: %v", filename, err)
+	info, err := deps.Files.Stat(filename)
+	if err != nil {
+		watchLog.Errorf("Error stating file %s: %v", filename, err)
 		return
 	}
+	if oldTime, exists := fileStates.Get(filename); exists && info.ModTime().Equal(oldTime) {
+		return // Файл не изменился
+	}
 
-	content, err := readFileContentWithRetry(filename)
+	content, err := readEventContent(ctx, filename)
 	if err != nil {
-		fileLogger.Printf("Error reading modified file %s after retries: %v", filename, err)
+		watchLog.Errorf("Error reading modified file %s after retries: %v", filename, err)
 		return
 	}
+	if takeAppliedEdit(filename, content) {
+		return // Правка панели, записанная агентом
+	}
+
+	// Гибель прежнего динозавра и пороги роста видны по переходу
+	// от прежнего состояния динозавра
+	dinoWritten(ctx, filename, steamID, content)
 
 	// Обновляем кэш
-	fileCache[filename] = content
+	cacheContent(filename, content)
+	backupSave(filename, steamID, content)
 
-	eventData := EventData{
-		SteamID64: steamID,
-		Type:      "player",
-		Event:     "change-dino-data",
-		Data:      content,
+	if eventData, err := fileEvent(ctx, filename, opChange, steamID, content); err == nil {
+		watchLog.Debugf("Sending change event for SteamID %s, File size: %d bytes",
+			steamID, len(content))
+		sendEventWithRetry(ctx, eventData)
 	}
 
-	fileLogger.Printf("Sending change event for SteamID %s, File size: %d bytes",
-		steamID, len(content))
-	sendEventWithRetry(eventData)
-
-	// Обновляем время модификации
-	if info, err := os.Stat(filename); err == nil {
-		fileStates[filename] = info.ModTime()
-	}
+	// Запоминаем время изменения прочитанной версии: запись игры, пришедшая
+	// во время отправки, придет своим событием и не будет пропущена
+	fileStates.Set(filename, info.ModTime())
+	playerWritten(ctx, filename, steamID)
+	liveMapWritten(filename, steamID, content)
 }
 
-func handleFileRemove(filename, steamID string, fileStates map[string]time.Time) {
+func handleFileRemove(ctx context.Context, filename, steamID string, fileStates *state.Store[time.Time]) {
 	// Для удаленных файлов используем кэшированное содержимое
 	content := getCachedContent(filename)
 
-	eventData := EventData{
-		SteamID64: steamID,
-		Type:      "player",
-		Event:     "delete-dino-data",
-		Data:      content,
-	}
+	// Удаление отправляется и без data, если преобразования не применились
+	eventData, _ := fileEvent(ctx, filename, opDelete, steamID, content)
 
-	fileLogger.Printf("Sending delete event for SteamID %s, Cached data size: %d bytes",
+	watchLog.Debugf("Sending delete event for SteamID %s, Cached data size: %d bytes",
 		steamID, len(content))
-	sendEventWithRetry(eventData)
+	sendEventWithRetry(ctx, eventData)
 
 	// Удаляем из кэша и состояний
-	delete(fileCache, filename)
-	delete(fileStates, filename)
+	forgetContent(filename)
+	dinoStates.Delete(filename)
+	fileStates.Delete(filename)
+	playerRemoved(ctx, filename, steamID)
+	forgetLiveMap(filename, steamID)
 }
 
-func checkForDeletedFiles(fileStates map[string]time.Time) {
-	for filename := range fileStates {
-		if _, err := os.Stat(filename); os.IsNotExist(err) {
+func checkForDeletedFiles(ctx context.Context, fileStates *state.Store[time.Time]) {
+	for filename := range fileStates.Snapshot() {
+		if _, renamed := pendingRenames.Get(filename); renamed {
+			continue // Ждет нового имени
+		}
+		if _, err := deps.Files.Stat(filename); os.IsNotExist(err) {
 			// Файл был удален вне событий watcher
 			steamID := getSteamIDFromFilename(filename)
 			if steamID != "" {
-				fileLogger.Printf("Detected deleted file: %s", filepath.Base(filename))
-				handleFileRemove(filename, steamID, fileStates)
+				watchLog.Debugf("Detected deleted file: %s", filepath.Base(filename))
+				handleFileRemove(ctx, filename, steamID, fileStates)
 			}
 		}
 	}
@@ -307,28 +780,54 @@ func getSteamIDFromFilename(filename string) string {
 	return base[:len(base)-len(ext)]
 }
 
-func readFileContentWithRetry(filename string) (string, error) {
+// readFileContentWithRetry читает файл, пока он не окажется непустым и
+// дописанным. Пока файл заблокирован игрой, пауза между попытками растет.
+// JSON-файл, не разобравшийся до последней попытки, отправляется как есть.
+func readFileContentWithRetry(ctx context.Context, filename string) (string, error) {
 	var content string
 	var err error
+	lockDelay := fileReadDelay
+	checkJSON := expectsJSON(filename)
 
 	for attempt := 1; attempt <= fileReadRetries; attempt++ {
-		content, err = readFileContent(filename)
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		content, err = readStableContent(ctx, filename)
+		if err == nil && content != "" && checkJSON && !json.Valid([]byte(content)) {
+			// Обрезанное сохранение панель сохранила бы как поврежденное
+			if attempt == fileReadRetries {
+				watchLog.Warnf("File %s is still not complete JSON after %d attempts, sending as is",
+					filepath.Base(filename), attempt)
+				return content, nil
+			}
+			err = errIncompleteJSON
+		}
 		if err == nil && content != "" {
 			// Успешно прочитали непустой файл
-			fileLogger.Printf("Successfully read file %s on attempt %d, Size: %d bytes",
+			watchLog.Tracef("Successfully read file %s on attempt %d, Size: %d bytes",
 				filepath.Base(filename), attempt, len(content))
 			return content, nil
 		}
 
 		if attempt < fileReadRetries {
-			if err != nil {
-				fileLogger.Printf("Attempt %d failed for file %s: %v, retrying...",
+			delay := fileReadDelay
+			switch {
+			case isLockViolation(err):
+				watchLog.Tracef("Attempt %d: file %s is locked by another process, retrying in %v...",
+					attempt, filepath.Base(filename), lockDelay)
+				delay = lockDelay
+				lockDelay = min(lockDelay*2, fileLockMaxDelay)
+			case err != nil:
+				watchLog.Tracef("Attempt %d failed for file %s: %v, retrying...",
 					attempt, filepath.Base(filename), err)
-			} else {
-				fileLogger.Printf("Attempt %d: file %s is empty, retrying...",
+			default:
+				watchLog.Tracef("Attempt %d: file %s is empty, retrying...",
 					attempt, filepath.Base(filename))
 			}
-			time.Sleep(fileReadDelay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return "", err
+			}
 		}
 	}
 
@@ -340,11 +839,53 @@ func readFileContentWithRetry(filename string) (string, error) {
 		filepath.Base(filename), fileReadRetries)
 }
 
+// sleepContext ждет d или отмены контекста
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var (
+	// errFileChanging - содержимое файла изменилось между двумя чтениями
+	errFileChanging = errors.New("file is still being written")
+	// errIncompleteJSON - файл не разбирается как JSON, вероятно, дописывается
+	errIncompleteJSON = errors.New("file is not complete JSON")
+)
+
+// readStableContent читает файл дважды с паузой и возвращает содержимое,
+// только если оно не изменилось: игра могла еще дописывать сохранение
+func readStableContent(ctx context.Context, filename string) (string, error) {
+	first, err := readFileContent(filename)
+	if err != nil || first == "" {
+		return first, err
+	}
+
+	if err := sleepContext(ctx, fileStableDelay); err != nil {
+		return "", err
+	}
+
+	second, err := readFileContent(filename)
+	if err != nil {
+		return "", err
+	}
+	if second != first {
+		return "", errFileChanging
+	}
+	return second, nil
+}
+
 func readFileContent(filename string) (string, error) {
 	// Сначала проверяем размер файла
-	info, err := os.Stat(filename)
+	info, err := deps.Files.Stat(filename)
 	if err != nil {
-		return "", fmt.Errorf("stat error: %v", err)
+		return "", fmt.Errorf("stat error: %w", err)
 	}
 
 	// Если файл пустой, возвращаем пустую строку
@@ -352,9 +893,9 @@ func readFileContent(filename string) (string, error) {
 		return "", nil
 	}
 
-	content, err := os.ReadFile(filename)
+	content, err := deps.Files.ReadFile(filename)
 	if err != nil {
-		return "", fmt.Errorf("read error: %v", err)
+		return "", fmt.Errorf("read error: %w", err)
 	}
 
 	return string(content), nil
@@ -362,61 +903,242 @@ func readFileContent(filename string) (string, error) {
 
 // Получаем кэшированное содержимое файла
 func getCachedContent(filename string) string {
-	if content, exists := fileCache[filename]; exists {
+	if content, exists := fileCache.Get(filename); exists {
 		return content
 	}
 	return "" // Возвращаем пустую строку
 }
 
-func sendEventWithRetry(eventData EventData) {
+func sendEventWithRetry(ctx context.Context, eventData EventData) {
+	// Выключенные в конфигурации события не отправляются
+	if !eventEnabled(eventData.Event) {
+		metrics.eventDropped("disabled")
+		return
+	}
+
+	// События игроков из списка блокировки не отправляются
+	if isBlocked(eventData.SteamID64) {
+		deliveryLog.Debugf("Suppressing %s event for blocked SteamID %s", eventData.Event, eventData.SteamID64)
+		metrics.eventDropped("blocked")
+		return
+	}
+
 	// Если данные пустые, заменяем на пустой JSON объект
-	if eventData.Data == "" {
-		eventData.Data = "{}"
-		fileLogger.Printf("Empty data replaced with empty JSON object for SteamID %s", eventData.SteamID64)
+	if len(eventData.Data) == 0 {
+		eventData.Data = json.RawMessage("{}")
+		deliveryLog.Debugf("Empty data replaced with empty JSON object for SteamID %s", eventData.SteamID64)
+	}
+
+	// При переполненной очереди низкоприоритетные события отбрасываются
+	if dropUnderBackpressure(eventData.Event) {
+		deliveryLog.Debugf("Dropping %s event for SteamID %s under backpressure", eventData.Event, eventData.SteamID64)
+		recordOutcome(eventData, sink.OutcomeDropped, "backpressure")
+		metrics.eventDropped("backpressure")
+		return
 	}
 
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		apiResponse := sendEvent(eventData)
+	// В окне обслуживания часть событий не нужна панели
+	if maintenanceSuppresses(eventData.Event) {
+		deliveryLog.Debugf("Suppressing %s event for SteamID %s during maintenance window", eventData.Event, eventData.SteamID64)
+		recordOutcome(eventData, sink.OutcomeDropped, "maintenance window")
+		metrics.eventDropped("maintenance")
+		return
+	}
+
+	// Пропускаем события, не несущие новых изменений
+	hash := hashContent(string(eventData.Data))
+	playerKey := instanceKey(eventData.Instance, eventData.SteamID64)
+	if isDuplicateEvent(eventData.Type, playerKey, eventData.Event, hash) {
+		deliveryLog.Debugf("Skipping duplicate %s event for SteamID %s within dedup window",
+			eventData.Event, eventData.SteamID64)
+		metrics.eventCoalesced("dedup")
+		return
+	}
+
+	// Все попытки доставки одного события идут с одним идентификатором
+	eventData = tagEvent(eventData)
+	eventData.EventID = newEventID()
+	eventData.Sequence = sequences.assign(playerKey)
+	eventData = stampEvent(eventData, hash)
+
+	// В dry-run режиме конвейера событие только логируется
+	if pipelineFor(eventData.Type).Mode == pipelineDryRun {
+		deliveryLog.Debugf("[dry-run] Would send %s event for SteamID %s, Data length=%d",
+			eventData.Event, eventData.SteamID64, len(eventData.Data))
+		rememberDelivered(eventData.Type, playerKey, eventData.Event, hash)
+		recordOutcome(eventData, sink.OutcomeDryRun, "")
+		return
+	}
+
+	playerSyncs.sent(eventData)
+
+	// Событие сохраняется в очередь до отправки и удаляется только после подтверждения
+	if err := eventQueueStore.add(eventData); err != nil {
+		deliveryLog.Errorf("Error persisting event %s to queue: %v", eventData.EventID, err)
+	}
+
+	// Во время паузы по Retry-After и в окне обслуживания событие ждет
+	// в очереди. Оно уже принято к доставке: такое же событие до повтора
+	// из очереди - дубль, а подтверждение учитывает повторная доставка.
+	if isThrottled() {
+		deliveryLog.Debugf("Sender is throttled until %s, event %s for SteamID %s queued",
+			throttleEnd().Format(time.RFC3339), eventData.EventID, eventData.SteamID64)
+		rememberDelivered(eventData.Type, playerKey, eventData.Event, hash)
+		recordOutcome(eventData, sink.OutcomeQueued, "throttled")
+		return
+	}
+	if maintenanceHoldsQueue() {
+		deliveryLog.Debugf("Maintenance window is active, event %s for SteamID %s queued",
+			eventData.EventID, eventData.SteamID64)
+		rememberDelivered(eventData.Type, playerKey, eventData.Event, hash)
+		recordOutcome(eventData, sink.OutcomeQueued, "maintenance window")
+		return
+	}
+
+	dispatchDelivery(ctx, eventData, hash)
+}
+
+// deliverPayload отправляет событие с учетом лимита размера payload
+func deliverPayload(ctx context.Context, eventData EventData) error {
+	// Payload больше лимита обрабатываем согласно настройке oversize_mode
+	if isOversized(eventData) {
+		switch cfg.OversizeMode {
+		case oversizeChunk:
+			chunks := events.Split(eventData, cfg.MaxPayloadSize)
+			deliveryLog.Infof("Payload for SteamID %s is %d bytes, sending as %d chunks",
+				eventData.SteamID64, len(eventData.Data), len(chunks))
+			for _, chunk := range chunks {
+				if err := deliverWithRetry(ctx, chunk, sendEvent); err != nil {
+					return err
+				}
+			}
+			return nil
+		case oversizeMultipart:
+			deliveryLog.Infof("Payload for SteamID %s is %d bytes, uploading via multipart endpoint",
+				eventData.SteamID64, len(eventData.Data))
+			return deliverWithRetry(ctx, eventData, sendMultipart)
+		default:
+			deliveryLog.Infof("Payload for SteamID %s is %d bytes, truncating to %d bytes",
+				eventData.SteamID64, len(eventData.Data), cfg.MaxPayloadSize)
+			eventData = events.Truncate(eventData, cfg.MaxPayloadSize)
+		}
+	}
+
+	return deliverWithRetry(ctx, eventData, sendEvent)
+}
+
+// deliverWithRetry отправляет событие указанной функцией с повторными попытками.
+// Если бэкенд отклонил событие как неповторяемое, возвращается *backendError.
+func deliverWithRetry(ctx context.Context, eventData EventData, send func(context.Context, EventData) ApiResponse) error {
+	policy := retryPolicyFor("http")
+	var apiResponse ApiResponse
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		attemptCtx, cancel := policy.attemptContext(ctx)
+		apiResponse = send(attemptCtx, eventData)
+		cancel()
+
+		// При остановке агента не ждем следующих попыток - событие остается в очереди
+		if err := ctx.Err(); err != nil {
+			deliveryLog.Warnf("Delivery for SteamID %s cancelled: %v", eventData.SteamID64, err)
+			return err
+		}
 
 		if apiResponse.Success {
-			return // Успешно отправлено
+			return nil // Успешно отправлено
+		}
+
+		// Бэкенд просит подождать - не тратим попытки, событие остается в очереди
+		if apiResponse.RetryAfter > 0 {
+			startThrottle(apiResponse.StatusCode, apiResponse.RetryAfter)
+			return fmt.Errorf("backend asked to retry after %v", apiResponse.RetryAfter)
+		}
+
+		// Повторы не пройдут проверку Cloudflare - прерываем попытки
+		if apiResponse.IsChallenge {
+			deliveryLog.Warnf("API request was stopped by Cloudflare, stopping retries for SteamID %s", eventData.SteamID64)
+			notify(alertCloudflareChallenge, SeverityCritical, "API request blocked by Cloudflare",
+				fmt.Sprintf("Event %s for SteamID %s was blocked: %s", eventData.Event, eventData.SteamID64, apiResponse.Error))
+			return errors.New(apiResponse.Error)
 		}
 
 		// Если получили HTML вместо JSON, прерываем попытки
 		if apiResponse.IsHTML {
-			fileLogger.Printf("API returned HTML page (likely authentication required), stopping retries for SteamID %s", eventData.SteamID64)
-			return
+			deliveryLog.Warnf("API returned HTML page (likely authentication required), stopping retries for SteamID %s", eventData.SteamID64)
+			notify(alertHTMLResponse, SeverityCritical, "API returned HTML page",
+				fmt.Sprintf("Event %s for SteamID %s was rejected: %s", eventData.Event, eventData.SteamID64, apiResponse.Error))
+			return errors.New(apiResponse.Error)
+		}
+
+		// Бэкенд сообщил, что повтор не поможет
+		if backendErr := apiResponse.BackendError; backendErr != nil && !backendErr.retryable() {
+			deliveryLog.Warnf("Backend rejected event %s for SteamID %s as not retryable: %v",
+				eventData.EventID, eventData.SteamID64, backendErr)
+			return backendErr
 		}
 
-		if attempt < maxRetries {
-			fileLogger.Printf("Attempt %d failed for SteamID %s, retrying in %v...", attempt, eventData.SteamID64, retryDelay)
-			time.Sleep(retryDelay)
+		if attempt < policy.MaxAttempts {
+			metrics.eventRetried()
+			delay := policy.backoff(attempt)
+			deliveryLog.Warnf("Attempt %d failed for SteamID %s, retrying in %v...", attempt, eventData.SteamID64, delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				deliveryLog.Warnf("Delivery for SteamID %s cancelled: %v", eventData.SteamID64, err)
+				return err
+			}
 		}
 	}
 
-	fileLogger.Printf("All %d attempts failed for SteamID %s", maxRetries, eventData.SteamID64)
+	deliveryLog.Errorf("All %d attempts failed for SteamID %s", policy.MaxAttempts, eventData.SteamID64)
+	notify(alertDeliveryFailed, SeverityWarning, "Event delivery failed",
+		fmt.Sprintf("All %d attempts failed for event %s, SteamID %s", policy.MaxAttempts, eventData.Event, eventData.SteamID64))
+	return fmt.Errorf("all %d attempts failed: %s", policy.MaxAttempts, apiResponse.Error)
 }
 
-func sendEvent(eventData EventData) ApiResponse {
+func sendEvent(ctx context.Context, eventData EventData) ApiResponse {
 	// Логируем что именно отправляем
-	fileLogger.Printf("Sending event to API: SteamID=%s, Event=%s, Data length=%d",
+	deliveryLog.Debugf("Sending event to API: SteamID=%s, Event=%s, Data length=%d",
 		eventData.SteamID64, eventData.Event, len(eventData.Data))
 
-	jsonData, err := json.Marshal(eventData)
+	eventData, err := prepareWireEvent(eventData)
+	if err != nil {
+		deliveryLog.Errorf("Error encrypting payload: %v", err)
+		return ApiResponse{
+			Timestamp: time.Now().Format(time.RFC3339),
+			EventType: eventData.Event,
+			SteamID:   eventData.SteamID64,
+			Success:   false,
+			Error:     fmt.Sprintf("Payload encryption error: %v", err),
+		}
+	}
+
+	// Шаблон тела задает и его кодирование
+	var body []byte
+	contentType := "application/json"
+	switch {
+	case httpTemplate != nil:
+		body, err = httpTemplate.Render(eventData)
+		contentType = httpTemplate.ContentType()
+	case contentTypeFor(eventData) == contentForm:
+		body = formBody(eventData)
+		contentType = "application/x-www-form-urlencoded"
+	case contentTypeFor(eventData) == contentMultipart:
+		body, contentType, err = multipartBody(eventData)
+	default:
+		body, err = json.Marshal(wireEvent(eventData))
+	}
 	if err != nil {
-		fileLogger.Printf("Error marshaling JSON: %v", err)
+		deliveryLog.Errorf("Error encoding payload: %v", err)
 		return ApiResponse{
 			Timestamp: time.Now().Format(time.RFC3339),
 			EventType: eventData.Event,
 			SteamID:   eventData.SteamID64,
 			Success:   false,
-			Error:     fmt.Sprintf("JSON marshal error: %v", err),
+			Error:     fmt.Sprintf("Payload encoding error: %v", err),
 		}
 	}
 
-	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpointFor(eventData), bytes.NewBuffer(body))
 	if err != nil {
-		fileLogger.Printf("Error creating request: %v", err)
+		deliveryLog.Errorf("Error creating request: %v", err)
 		return ApiResponse{
 			Timestamp: time.Now().Format(time.RFC3339),
 			EventType: eventData.Event,
@@ -426,12 +1148,54 @@ func sendEvent(eventData EventData) ApiResponse {
 		}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", "FileWatcher/1.0")
+	req.Header.Set("Content-Type", contentType)
+
+	return executeRequest(req, eventData)
+}
+
+// prepareWireEvent готовит событие к отправке в API: имя события панели,
+// data строкой для прежнего формата и шифрование data
+func prepareWireEvent(eventData EventData) (EventData, error) {
+	eventData.Event = wireEventName(eventData.Event)
+	// Прежний формат: data всегда строка, JSON внутри экранирован
+	if cfg.DataAsString {
+		eventData.Data = events.String(events.Text(eventData.Data))
+	}
+	return encryptPayload(eventData)
+}
+
+// executeRequest выполняет подготовленный запрос и разбирает ответ API
+func executeRequest(req *http.Request, eventData EventData) ApiResponse {
+	ctx, span := tracer.StartClient(req.Context(), "send")
+	defer span.End()
+	span.SetAttr("event", eventData.Event)
+	span.SetAttr("event_id", eventData.EventID)
+	span.SetAttr("http.url", req.URL.Redacted())
+	req = req.WithContext(ctx)
+	tracing.Inject(ctx, req.Header)
+
+	setPanelHeaders(req)
+	setInstanceHeaders(req, eventData)
 	// Добавляем заголовки для предотвращения кэширования
 	req.Header.Set("Cache-Control", "no-cache")
 	req.Header.Set("Pragma", "no-cache")
+	// Позволяет бэкенду отбросить повторную доставку того же события
+	if eventData.EventID != "" {
+		req.Header.Set("Idempotency-Key", eventData.EventID)
+	}
+	setEncryptionHeaders(req, eventData)
+	if err := signRequest(req); err != nil {
+		deliveryLog.Errorf("Error signing request: %v", err)
+		return ApiResponse{
+			Timestamp: time.Now().Format(time.RFC3339),
+			EventType: eventData.Event,
+			SteamID:   eventData.SteamID64,
+			Success:   false,
+			Error:     fmt.Sprintf("Request signing error: %v", err),
+		}
+	}
 
+	req, phase := traceRequest(req)
 	startTime := time.Now()
 	resp, err := httpClient.Do(req)
 	responseTime := time.Since(startTime)
@@ -444,8 +1208,10 @@ func sendEvent(eventData EventData) ApiResponse {
 
 	if err != nil {
 		apiResponse.Success = false
-		apiResponse.Error = err.Error()
+		apiResponse.Error = fmt.Sprintf("failed during %s: %s", phase, describeTransportError(err))
+		span.SetError(errors.New(apiResponse.Error))
 		logApiResponse(apiResponse, responseTime)
+		dumpFailedExchange(req, nil, "", apiResponse.Error)
 		return apiResponse
 	}
 	defer resp.Body.Close()
@@ -453,56 +1219,75 @@ func sendEvent(eventData EventData) ApiResponse {
 	body, _ := io.ReadAll(resp.Body)
 	bodyStr := string(body)
 
-	// Проверяем, является ли ответ HTML
-	isHTML := strings.Contains(bodyStr, "<!DOCTYPE html>") ||
-		strings.Contains(bodyStr, "<html") ||
-		strings.Contains(bodyStr, "Steam") ||
-		strings.Contains(bodyStr, "Sign In")
+	// Проверяем ответ по критериям успеха для endpoint
+	verdict := evaluateResponse(req.URL.String(), resp, bodyStr)
 
 	apiResponse.StatusCode = resp.StatusCode
 	apiResponse.Body = truncateBody(bodyStr)
-	apiResponse.Success = resp.StatusCode >= 200 && resp.StatusCode < 300 && !isHTML
-	apiResponse.IsHTML = isHTML
+	apiResponse.Success = verdict.success
+	apiResponse.IsHTML = verdict.kind == responseHTML || verdict.kind == responseMarker
+	apiResponse.IsChallenge = verdict.kind == responseChallenge
+	apiResponse.RetryAfter = retryAfterFor(resp)
+
+	if apiResponse.IsChallenge {
+		apiResponse.Error = "Cloudflare blocked the request (configure Access service token headers or a WAF bypass for the agent): " + verdict.reason
+	} else if apiResponse.IsHTML {
+		apiResponse.Error = "Server returned HTML page instead of JSON (likely authentication required or wrong endpoint): " + verdict.reason
+	} else if backendErr := parseBackendError(bodyStr); backendErr != nil {
+		// Явный отказ бэкенда - не доставка, даже при 2xx
+		apiResponse.Success = false
+		apiResponse.BackendError = backendErr
+		apiResponse.Error = backendErr.Error()
+	} else if !verdict.success {
+		apiResponse.Error = verdict.reason
+	} else if cfg.AckMode == ackModeStrict {
+		// В строгом режиме 2xx без явного подтверждения - не доставка
+		if err := verifyAck(bodyStr, eventData.EventID); err != nil {
+			apiResponse.Success = false
+			apiResponse.Error = err.Error()
+		}
+	}
 
-	if isHTML {
-		apiResponse.Error = "Server returned HTML page instead of JSON (likely authentication required or wrong endpoint)"
+	span.SetAttr("http.status_code", resp.StatusCode)
+	if !apiResponse.Success {
+		span.SetError(errors.New(apiResponse.Error))
 	}
 
 	// Логируем результат отправки
 	logApiResponse(apiResponse, responseTime)
 
 	if apiResponse.Success {
-		fileLogger.Printf("Successfully sent event %s for SteamID %s (Response time: %v, Status: %d)",
+		deliveryLog.Debugf("Successfully sent event %s for SteamID %s (Response time: %v, Status: %d)",
 			eventData.Event, eventData.SteamID64, responseTime, resp.StatusCode)
 		log.Printf("Successfully sent event %s for SteamID %s", eventData.Event, eventData.SteamID64)
 	} else {
-		if apiResponse.IsHTML {
-			fileLogger.Printf("API returned HTML page for SteamID %s: %d - Response contains Steam login page (Response time: %v)",
+		if apiResponse.IsChallenge {
+			deliveryLog.Errorf("API request for SteamID %s was stopped by Cloudflare: %d (Response time: %v)",
 				eventData.SteamID64, resp.StatusCode, responseTime)
-			log.Printf("API returned Steam login page for SteamID %s - check API endpoint and authentication", eventData.SteamID64)
+			log.Printf("API request for SteamID %s was stopped by Cloudflare - check Access headers", eventData.SteamID64)
+		} else if apiResponse.IsHTML {
+			deliveryLog.Errorf("API returned HTML page for SteamID %s: %d - %s (Response time: %v)",
+				eventData.SteamID64, resp.StatusCode, verdict.reason, responseTime)
+			log.Printf("API returned HTML page for SteamID %s - check API endpoint and authentication", eventData.SteamID64)
 		} else {
-			fileLogger.Printf("Error response from server for SteamID %s: %d - %s (Response time: %v)",
+			deliveryLog.Errorf("Error response from server for SteamID %s: %d - %s (Response time: %v)",
 				eventData.SteamID64, resp.StatusCode, truncateBody(bodyStr), responseTime)
 			log.Printf("Error response from server: %d - %s", resp.StatusCode, truncateBody(bodyStr))
 		}
+		dumpFailedExchange(req, resp, bodyStr, apiResponse.Error)
 	}
 
 	return apiResponse
 }
 
-func truncateBody(body string) string {
-	if len(body) > 500 {
-		return body[:500] + "... [truncated]"
-	}
-	return body
-}
-
 func logApiResponse(response ApiResponse, responseTime time.Duration) {
 	// Форматируем ответ для лога
 	status := "SUCCESS"
 	if !response.Success {
 		status = "ERROR"
-		if response.IsHTML {
+		if response.IsChallenge {
+			status = "CF_CHALLENGE"
+		} else if response.IsHTML {
 			status = "HTML_RESPONSE"
 		}
 	}
@@ -519,14 +1304,22 @@ func logApiResponse(response ApiResponse, responseTime time.Duration) {
 		response.Body,
 	)
 
-	fileLogger.Println(logEntry)
+	// Успешные ответы - на каждое событие, поэтому только в debug
+	if response.Success {
+		deliveryLog.Debugf("%s", logEntry)
+	} else {
+		deliveryLog.Warnf("%s", logEntry)
+	}
 
 	// Также выводим в консоль для удобства мониторинга
 	if response.Success {
 		log.Printf("API Success - Event: %s, SteamID: %s, Status: %d, Time: %v",
 			response.EventType, response.SteamID, response.StatusCode, responseTime)
+	} else if response.IsChallenge {
+		log.Printf("API Cloudflare Challenge - Event: %s, SteamID: %s, Status: %d",
+			response.EventType, response.SteamID, response.StatusCode)
 	} else if response.IsHTML {
-		log.Printf("API HTML Response - Event: %s, SteamID: %s, Status: %d - Server returned Steam login page",
+		log.Printf("API HTML Response - Event: %s, SteamID: %s, Status: %d - Server returned HTML page",
 			response.EventType, response.SteamID, response.StatusCode)
 	} else {
 		log.Printf("API Error - Event: %s, SteamID: %s, Status: %d, Error: %s",
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow - период, когда сервер массово переписывает файлы
+// (ночной рестарт, вайп) и события не должны уходить в панель
+type MaintenanceWindow struct {
+	Name string `json:"name"`
+	// Начало окна в формате cron: "минута час день месяц день_недели", например "0 4 * * *"
+	Schedule string   `json:"schedule"`
+	Duration Duration `json:"duration"`
+	// События, которые отбрасываются в окне. Если список пуст, все события
+	// сохраняются в очередь и отправляются после окончания окна.
+	SuppressEvents []string `json:"suppress_events"`
+
+	schedule *cronSchedule
+}
+
+// Длительность окна: не меньше минуты (шаг расписания cron) и не больше
+// суток, чтобы проверка активности была дешевой
+const (
+	minMaintenanceDuration = time.Minute
+	maxMaintenanceDuration = 24 * time.Hour
+)
+
+func validateMaintenanceWindows(windows []MaintenanceWindow) error {
+	for i := range windows {
+		w := &windows[i]
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("#%d", i+1)
+		}
+		schedule, err := parseCron(w.Schedule)
+		if err != nil {
+			return fmt.Errorf("maintenance window %s: %v", w.Name, err)
+		}
+		if w.Duration.Duration < minMaintenanceDuration || w.Duration.Duration > maxMaintenanceDuration {
+			return fmt.Errorf("maintenance window %s: duration must be between 1m and 24h", w.Name)
+		}
+		w.schedule = schedule
+	}
+	return nil
+}
+
+// active проверяет, что окно началось не раньше чем duration назад
+func (w *MaintenanceWindow) active(now time.Time) bool {
+	now = now.Truncate(time.Minute)
+	for start := now; now.Sub(start) < w.Duration.Duration; start = start.Add(-time.Minute) {
+		if w.schedule.matches(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Активные окна пересчитываются раз в минуту
+var (
+	maintenanceCheckedAt time.Time
+	maintenanceActive    []*MaintenanceWindow
+)
+
+func activeMaintenanceWindows() []*MaintenanceWindow {
+	if len(cfg.Maintenance) == 0 {
+		return nil
+	}
+
+	now := time.Now().Truncate(time.Minute)
+	if now.Equal(maintenanceCheckedAt) {
+		return maintenanceActive
+	}
+
+	var active []*MaintenanceWindow
+	for i := range cfg.Maintenance {
+		if cfg.Maintenance[i].active(now) {
+			active = append(active, &cfg.Maintenance[i])
+		}
+	}
+	if len(active) != len(maintenanceActive) {
+		if len(active) > 0 {
+			agentLog.Infof("Maintenance window started: %s", maintenanceNames(active))
+		} else {
+			agentLog.Infof("Maintenance window ended, queued events will be sent")
+		}
+	}
+	maintenanceCheckedAt = now
+	maintenanceActive = active
+	return active
+}
+
+// maintenanceSuppresses проверяет, что событие отбрасывается активным окном
+func maintenanceSuppresses(event string) bool {
+	for _, w := range activeMaintenanceWindows() {
+		for _, name := range w.SuppressEvents {
+			if name == event {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maintenanceHoldsQueue проверяет, что активно окно, в котором события только копятся в очереди
+func maintenanceHoldsQueue() bool {
+	for _, w := range activeMaintenanceWindows() {
+		if len(w.SuppressEvents) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func maintenanceNames(windows []*MaintenanceWindow) string {
+	names := make([]string, 0, len(windows))
+	for _, w := range windows {
+		names = append(names, w.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+// cronSchedule - разобранное cron-выражение из пяти полей
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+	// День месяца и день недели заданы оба - достаточно совпадения одного (как в cron)
+	domRestricted, dowRestricted bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q must have 5 fields", expr)
+	}
+
+	limits := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+	sets := make([]map[int]bool, 5)
+	for i, field := range fields {
+		set, err := parseCronField(field, limits[i][0], limits[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("schedule %q: %v", expr, err)
+		}
+		sets[i] = set
+	}
+	// Воскресенье можно задать как 0 и как 7
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parseCronField разбирает поле вида "*", "5", "1-5", "*/15", "0,30"
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step, part = s, part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("value %q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+func (c *cronSchedule) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	if c.domRestricted && c.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
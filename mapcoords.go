@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"agent-ws/sink"
+)
+
+// MapCoordinatesConfig - перевод позиции игрока из сохранения в координаты
+// изображения карты, чтобы панель рисовала игроков без своей калибровки
+type MapCoordinatesConfig struct {
+	// Поле сохранения с позицией вида "X=... Y=... Z=..."
+	LocationField string `json:"location_field"`
+	// Калибровка по имени карты (map_name сервера или экземпляра,
+	// например Gateway или Spiro); без калибровки позиция не добавляется
+	Maps map[string]MapCalibration `json:"maps"`
+}
+
+// MapCalibration - мировые координаты краев изображения карты. Край может
+// быть больше противоположного, если ось изображения направлена против мировой.
+type MapCalibration struct {
+	Left   float64 `json:"left"`
+	Right  float64 `json:"right"`
+	Top    float64 `json:"top"`
+	Bottom float64 `json:"bottom"`
+	// Горизонталь изображения соответствует мировой оси Y, а вертикаль - X
+	SwapAxes bool `json:"swap_axes"`
+}
+
+func (c MapCoordinatesConfig) validate() error {
+	if len(c.Maps) > 0 && c.LocationField == "" {
+		return fmt.Errorf("map_coordinates.location_field is required")
+	}
+	for name, m := range c.Maps {
+		if m.Left == m.Right || m.Top == m.Bottom {
+			return fmt.Errorf("map_coordinates.maps.%s: opposite edges must differ", name)
+		}
+	}
+	return nil
+}
+
+// mapNameFor возвращает имя карты сервера или экземпляра
+func mapNameFor(instance string) string {
+	if inst := instanceFor(instance); inst != nil && inst.MapName != "" {
+		return inst.MapName
+	}
+	return cfg.Identity.MapName
+}
+
+// mapCalibration ищет калибровку карты без учета регистра имени
+func mapCalibration(mapName string) (MapCalibration, bool) {
+	for name, m := range cfg.MapCoordinates.Maps {
+		if strings.EqualFold(name, mapName) {
+			return m, true
+		}
+	}
+	return MapCalibration{}, false
+}
+
+// savePosition читает позицию игрока из сохранения и переводит ее в
+// координаты карты экземпляра: 0..1 от левого верхнего угла изображения
+func savePosition(instance, content string) *sink.Position {
+	if _, ok := mapCalibration(mapNameFor(instance)); !ok || content == "" {
+		return nil
+	}
+	var save map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &save); err != nil {
+		return nil
+	}
+	return positionFromSave(instance, save)
+}
+
+// positionFromSave переводит позицию из разобранного сохранения
+func positionFromSave(instance string, save map[string]interface{}) *sink.Position {
+	calibration, ok := mapCalibration(mapNameFor(instance))
+	if !ok {
+		return nil
+	}
+	location, _ := save[cfg.MapCoordinates.LocationField].(string)
+	world, ok := parseVector(location)
+	if !ok {
+		return nil
+	}
+
+	horizontal, vertical := world[0], world[1]
+	if calibration.SwapAxes {
+		horizontal, vertical = vertical, horizontal
+	}
+	return &sink.Position{
+		X:      (horizontal - calibration.Left) / (calibration.Right - calibration.Left),
+		Y:      (vertical - calibration.Top) / (calibration.Bottom - calibration.Top),
+		WorldX: world[0],
+		WorldY: world[1],
+		WorldZ: world[2],
+	}
+}
+
+// parseVector разбирает вектор Unreal вида "X=1.0 Y=2.0 Z=3.0"
+func parseVector(s string) ([3]float64, bool) {
+	var v [3]float64
+	seen := 0
+	for _, part := range strings.Fields(s) {
+		axis, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return v, false
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return v, false
+		}
+		switch axis {
+		case "X":
+			v[0] = f
+		case "Y":
+			v[1] = f
+		case "Z":
+			v[2] = f
+		default:
+			return v, false
+		}
+		seen++
+	}
+	return v, seen == 3
+}
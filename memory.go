@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// Профили использования памяти
+const (
+	memoryProfileDefault = "default"
+	memoryProfileBounded = "bounded"
+)
+
+// Время без новых событий, после которого файл считается дописанным
+const pendingSettleDelay = 1 * time.Second
+
+var (
+	fileHashes    *state.Store[string] // Хэши содержимого всех отслеживаемых файлов
+	pendingEvents *eventQueue
+)
+
+func boundedMemory() bool {
+	return cfg.MemoryProfile == memoryProfileBounded
+}
+
+// cacheContent сохраняет хэш и содержимое файла в кэш. В bounded-режиме
+// хранится только хэш, чтобы память не росла вместе с числом игроков.
+func cacheContent(filename, content string) {
+	fileHashes.Set(filename, hashContent(content))
+	if boundedMemory() {
+		return
+	}
+	fileCache.Set(filename, content)
+}
+
+func forgetContent(filename string) {
+	fileCache.Delete(filename)
+	fileHashes.Delete(filename)
+}
+
+// cachedHash возвращает хэш последнего прочитанного содержимого файла
+func cachedHash(filename string) (string, bool) {
+	if hash, ok := fileHashes.Get(filename); ok {
+		return hash, true
+	}
+	if content, ok := fileCache.Get(filename); ok {
+		return hashContent(content), true
+	}
+	return "", false
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile считает хэш файла потоково, не загружая его целиком в память
+func hashFile(filename string) (string, error) {
+	f, err := deps.Files.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// pendingEvent - отложенное событие файла, ожидающее обработки
+type pendingEvent struct {
+	filename  string
+	steamID   string
+	op        fsnotify.Op
+	updatedAt time.Time
+	// Когда файл попал в очередь - начало трассы события
+	queuedAt time.Time
+}
+
+// eventQueue - ограниченная очередь событий со слиянием по имени файла.
+// На один файл в очереди приходится не больше одного события.
+type eventQueue struct {
+	order    []string
+	items    map[string]*pendingEvent
+	capacity int
+	dropped  int
+}
+
+func newEventQueue(capacity int) *eventQueue {
+	return &eventQueue{
+		items:    make(map[string]*pendingEvent),
+		capacity: capacity,
+	}
+}
+
+// push добавляет событие в очередь, объединяя его с уже ожидающим событием того же файла.
+// Возвращает false, если очередь заполнена и событие отброшено.
+func (q *eventQueue) push(filename, steamID string, op fsnotify.Op) bool {
+	now := time.Now()
+
+	if existing, ok := q.items[filename]; ok {
+		switch {
+		case existing.op&fsnotify.Create != 0 && op&fsnotify.Remove != 0:
+			// Файл создан и удален до обработки - отправлять нечего
+			delete(q.items, filename)
+			metrics.eventCoalesced("debounce")
+			return true
+		case existing.op&fsnotify.Create != 0 && op&fsnotify.Write != 0:
+			// Запись после создания остается созданием
+		case existing.op&fsnotify.Remove != 0 && op&fsnotify.Create != 0:
+			// Файл пересоздан - для бэкенда это изменение
+			existing.op = fsnotify.Write
+		default:
+			existing.op = op
+		}
+		existing.updatedAt = now
+		metrics.eventCoalesced("debounce")
+		return true
+	}
+
+	if len(q.items) >= q.capacity {
+		q.dropped++
+		metrics.eventDropped("queue_full")
+		return false
+	}
+
+	q.items[filename] = &pendingEvent{filename: filename, steamID: steamID, op: op, updatedAt: now, queuedAt: now}
+	q.order = append(q.order, filename)
+	return true
+}
+
+// takeSettled извлекает из очереди события, по которым не было изменений дольше settle
+func (q *eventQueue) takeSettled(settle time.Duration) []pendingEvent {
+	var ready []pendingEvent
+	now := time.Now()
+	remaining := q.order[:0]
+
+	for _, filename := range q.order {
+		item, ok := q.items[filename]
+		if !ok {
+			continue // Событие было отменено слиянием
+		}
+		if now.Sub(item.updatedAt) < settle {
+			remaining = append(remaining, filename)
+			continue
+		}
+		ready = append(ready, *item)
+		delete(q.items, filename)
+	}
+
+	q.order = remaining
+	return ready
+}
+
+// processPendingEvents обрабатывает события очереди, файлы которых перестали меняться
+func processPendingEvents(ctx context.Context, fileStates *state.Store[time.Time]) {
+	settled := pendingEvents.takeSettled(pendingSettleDelay)
+	sortPendingByPriority(settled)
+	for _, ev := range settled {
+		handlePendingEvent(ctx, ev, fileStates)
+	}
+
+	if pendingEvents.dropped > 0 {
+		watchLog.Warnf("Pending queue is full (capacity %d), dropped %d events",
+			pendingEvents.capacity, pendingEvents.dropped)
+		pendingEvents.dropped = 0
+	}
+}
+
+func handlePendingEvent(ctx context.Context, ev pendingEvent, fileStates *state.Store[time.Time]) {
+	// Ожидание в очереди со слиянием - стадия debounce
+	ctx, span := startFileTrace(ctx, ev.filename, ev.steamID, ev.op, ev.queuedAt)
+	defer span.End()
+	_, wait := tracer.StartAt(ctx, "debounce", ev.queuedAt)
+	wait.End()
+
+	switch {
+	case ev.op&fsnotify.Create != 0:
+		handleFileCreate(ctx, ev.filename, ev.steamID, fileStates)
+	case ev.op&fsnotify.Write != 0:
+		handleFileWrite(ctx, ev.filename, ev.steamID, fileStates)
+	case ev.op&fsnotify.Remove != 0:
+		handleFileRemove(ctx, ev.filename, ev.steamID, fileStates)
+	case ev.op&fsnotify.Rename != 0:
+		handleFileRename(ctx, ev.filename, ev.steamID, fileStates)
+	}
+}
+
+// initFileStatesBounded сканирует директорию, сохраняя только время изменения и хэш файлов
+func initFileStatesBounded(ctx context.Context, fileStates *state.Store[time.Time]) {
+	for _, t := range watchTargets {
+		initTargetStatesBounded(ctx, t, fileStates)
+	}
+	watchLog.Infof("Initialized hash-only tracking for %d files", fileStates.Len())
+}
+
+func initTargetStatesBounded(ctx context.Context, t *WatchTarget, fileStates *state.Store[time.Time]) {
+	files, err := os.ReadDir(t.Path)
+	if err != nil {
+		watchLog.Errorf("Error reading directory: %v", err)
+		return
+	}
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		if file.IsDir() || isIgnored(file.Name()) {
+			continue
+		}
+		fullPath := filepath.Join(t.Path, file.Name())
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+		fileStates.Set(fullPath, info.ModTime())
+
+		hash, err := hashFile(fullPath)
+		if err != nil {
+			watchLog.Errorf("Error hashing file %s: %v", file.Name(), err)
+			continue
+		}
+		fileHashes.Set(fullPath, hash)
+
+		// Содержимое не кэшируется, но для событий гибели и роста
+		// нужно прежнее состояние динозавра
+		if dinoTracking() && isPlayerFile(fullPath) {
+			if content, err := readFileContentWithRetry(ctx, fullPath); err == nil {
+				rememberDino(fullPath, content)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// Файлов в папке самых крупных серверов, под которые рассчитан bounded-режим
+const boundedScaleFiles = 50000
+
+// Bounded-режим на 50k файлов: содержимое не кэшируется, состояние файла
+// ограничено хэшем и временем изменения, очередь событий не растет выше лимита
+func TestBoundedProfileScale(t *testing.T) {
+	if testing.Short() {
+		t.Skip("creates 50k files")
+	}
+
+	a := newTestAgent(t)
+	cfg.MemoryProfile = memoryProfileBounded
+	pendingEvents = newEventQueue(cfg.MaxPendingEvents)
+	t.Cleanup(func() { pendingEvents = nil })
+
+	content := `{"CharacterClass":"Carnotaurus","Growth":0.75,"Padding":"` + strings.Repeat("x", 1024) + `"}`
+	for i := 0; i < boundedScaleFiles; i++ {
+		if err := os.WriteFile(a.path(fmt.Sprintf("7656119%010d", i)), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	fileStates := state.New[time.Time]()
+	initFileStatesBounded(context.Background(), fileStates)
+	for i := 0; i < boundedScaleFiles; i++ {
+		pendingEvents.push(a.path(fmt.Sprintf("7656119%010d", i)), "", fsnotify.Write)
+	}
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	if n := fileStates.Len(); n != boundedScaleFiles {
+		t.Fatalf("tracking %d files, want %d", n, boundedScaleFiles)
+	}
+	if n := fileCache.Len(); n != 0 {
+		t.Errorf("content cache holds %d files in bounded mode", n)
+	}
+	if n := len(pendingEvents.items); n > cfg.MaxPendingEvents {
+		t.Errorf("pending queue holds %d events, limit %d", n, cfg.MaxPendingEvents)
+	}
+	// Путь, время изменения, хэш и запись очереди - меньше килобайта на файл,
+	// тогда как содержимое файлов заняло бы больше 50 МБ
+	perFile := (int64(after.HeapAlloc) - int64(before.HeapAlloc)) / boundedScaleFiles
+	if perFile > 1024 {
+		t.Errorf("state grows by %d bytes per file, want at most 1024", perFile)
+	}
+	t.Logf("%d files: %d bytes of state per file", boundedScaleFiles, perFile)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// Верхние границы корзин гистограммы задержки доставки, в секундах
+var latencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// eventMetrics - счетчики событий файловой системы и отправленных событий:
+// по ним видно, сколько событий слито debounce/dedup, сколько отброшено
+// и сколько проходит от изменения файла до доставки
+type eventMetrics struct {
+	mu        sync.Mutex
+	detected  map[string]uint64
+	delivered uint64
+	failed    uint64
+	retried   uint64
+	coalesced map[string]uint64
+	dropped   map[string]uint64
+	rescans   map[string]uint64
+
+	// Счетчики по экземплярам (только при заданных instances)
+	instanceDetected  map[string]uint64
+	instanceDelivered map[string]uint64
+	instanceFailed    map[string]uint64
+
+	// Гистограмма задержки от обнаружения изменения до доставки
+	latencyBuckets []uint64
+	latencySum     time.Duration
+	latencyCount   uint64
+
+	// Значения на момент прошлой сводки в логе и максимум за интервал
+	last        metricsTotals
+	intervalMax time.Duration
+}
+
+// metricsTotals - итоговые значения счетчиков
+type metricsTotals struct {
+	detected, delivered, failed, coalesced, dropped uint64
+	latencySum                                      time.Duration
+	latencyCount                                    uint64
+}
+
+var (
+	metrics = newEventMetrics()
+	// Время последнего события файловой системы по имени файла
+	detectedAt = state.New[time.Time]()
+)
+
+func newEventMetrics() *eventMetrics {
+	return &eventMetrics{
+		detected:  make(map[string]uint64),
+		coalesced: make(map[string]uint64),
+		dropped:   make(map[string]uint64),
+		rescans:   make(map[string]uint64),
+
+		instanceDetected:  make(map[string]uint64),
+		instanceDelivered: make(map[string]uint64),
+		instanceFailed:    make(map[string]uint64),
+
+		latencyBuckets: make([]uint64, len(latencyBuckets)),
+	}
+}
+
+// fileEventDetected учитывает событие файловой системы и запоминает время
+// обнаружения, от которого считается задержка доставки
+func (m *eventMetrics) fileEventDetected(filename string, op fsnotify.Op) {
+	detectedAt.Set(filename, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detected[fsOpName(op)]++
+	if t := targetFor(filename); t != nil && t.instance != "" {
+		m.instanceDetected[t.instance]++
+	}
+}
+
+func (m *eventMetrics) eventDelivered(eventData EventData) {
+	reportStats.sent()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.delivered++
+	if eventData.Instance != "" {
+		m.instanceDelivered[eventData.Instance]++
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339Nano, eventData.OccurredAt)
+	if err != nil {
+		return
+	}
+	latency := time.Since(occurredAt)
+	m.latencySum += latency
+	m.latencyCount++
+	m.intervalMax = max(m.intervalMax, latency)
+	for i, bound := range latencyBuckets {
+		if latency.Seconds() <= bound {
+			m.latencyBuckets[i]++
+			break
+		}
+	}
+}
+
+func (m *eventMetrics) eventFailed(eventData EventData) {
+	reportStats.failed()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failed++
+	if eventData.Instance != "" {
+		m.instanceFailed[eventData.Instance]++
+	}
+}
+
+// eventRetried учитывает повторную попытку отправки события
+func (m *eventMetrics) eventRetried() {
+	reportStats.retried()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retried++
+}
+
+// eventCoalesced учитывает событие, слитое с другим (debounce, dedup)
+func (m *eventMetrics) eventCoalesced(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.coalesced[reason]++
+}
+
+// eventDropped учитывает событие, которое не будет отправлено
+func (m *eventMetrics) eventDropped(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropped[reason]++
+}
+
+// watchRescanned учитывает повторное сканирование папок из-за потерянных событий
+func (m *eventMetrics) watchRescanned(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rescans[reason]++
+}
+
+func (m *eventMetrics) totals() metricsTotals {
+	return metricsTotals{
+		detected:     sumCounts(m.detected),
+		delivered:    m.delivered,
+		failed:       m.failed,
+		coalesced:    sumCounts(m.coalesced),
+		dropped:      sumCounts(m.dropped),
+		latencySum:   m.latencySum,
+		latencyCount: m.latencyCount,
+	}
+}
+
+// logSummary пишет в лог сводку за время с прошлой сводки
+func (m *eventMetrics) logSummary() {
+	m.mu.Lock()
+	now := m.totals()
+	last := m.last
+	maxLatency := m.intervalMax
+	m.last = now
+	m.intervalMax = 0
+	coalesced := formatCounts(m.coalesced)
+	dropped := formatCounts(m.dropped)
+	delivered := formatCounts(m.instanceDelivered)
+	m.mu.Unlock()
+
+	var avgLatency time.Duration
+	if n := now.latencyCount - last.latencyCount; n > 0 {
+		avgLatency = (now.latencySum - last.latencySum) / time.Duration(n)
+	}
+	agentLog.Infof("METRICS | Detected: %d | Delivered: %d | Failed: %d | Coalesced: %d | Dropped: %d | Latency avg: %v max: %v | Totals coalesced: %s | Totals dropped: %s",
+		now.detected-last.detected, now.delivered-last.delivered, now.failed-last.failed,
+		now.coalesced-last.coalesced, now.dropped-last.dropped,
+		avgLatency.Round(time.Millisecond), maxLatency.Round(time.Millisecond), coalesced, dropped)
+	if len(cfg.Instances) > 0 {
+		agentLog.Infof("METRICS | Totals delivered by instance: %s", delivered)
+	}
+}
+
+// writePrometheus выводит счетчики в текстовом формате Prometheus
+func (m *eventMetrics) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeCounterVec(w, "agent_ws_fs_events_total", "File system events detected in watched directories.", "op", m.detected)
+	fmt.Fprintf(w, "# HELP agent_ws_events_delivered_total Events delivered to all sinks.\n# TYPE agent_ws_events_delivered_total counter\nagent_ws_events_delivered_total %d\n", m.delivered)
+	fmt.Fprintf(w, "# HELP agent_ws_events_failed_total Delivery passes that failed and left the event queued.\n# TYPE agent_ws_events_failed_total counter\nagent_ws_events_failed_total %d\n", m.failed)
+	fmt.Fprintf(w, "# HELP agent_ws_delivery_retries_total Repeated delivery attempts after a failed send.\n# TYPE agent_ws_delivery_retries_total counter\nagent_ws_delivery_retries_total %d\n", m.retried)
+	writeCounterVec(w, "agent_ws_events_coalesced_total", "Events merged into another event by debounce or dedup.", "reason", m.coalesced)
+	writeCounterVec(w, "agent_ws_events_dropped_total", "Events that will not be delivered.", "reason", m.dropped)
+	writeCounterVec(w, "agent_ws_watch_rescans_total", "Rescans of watched directories after possibly lost file system events.", "reason", m.rescans)
+	if len(cfg.Instances) > 0 {
+		writeCounterVec(w, "agent_ws_instance_fs_events_total", "File system events detected per server instance.", "instance", m.instanceDetected)
+		writeCounterVec(w, "agent_ws_instance_events_delivered_total", "Events delivered per server instance.", "instance", m.instanceDelivered)
+		writeCounterVec(w, "agent_ws_instance_events_failed_total", "Failed delivery passes per server instance.", "instance", m.instanceFailed)
+	}
+
+	name := "agent_ws_delivery_latency_seconds"
+	fmt.Fprintf(w, "# HELP %s Time from file change detection to delivery.\n# TYPE %s histogram\n", name, name)
+	var cumulative uint64
+	for i, bound := range latencyBuckets {
+		cumulative += m.latencyBuckets[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", name, m.latencySum.Seconds(), name, m.latencyCount)
+}
+
+func writeCounterVec(w io.Writer, name, help, label string, counts map[string]uint64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, key := range sortedKeys(counts) {
+		fmt.Fprintf(w, "%s{%s=%q} %d\n", name, label, key, counts[key])
+	}
+}
+
+func handleAdminMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	metrics.writePrometheus(w)
+}
+
+// fsOpName - операция события файловой системы для меток метрик
+func fsOpName(op fsnotify.Op) string {
+	switch {
+	case op&fsnotify.Create != 0:
+		return opAdd
+	case op&fsnotify.Write != 0:
+		return opChange
+	case op&fsnotify.Remove != 0:
+		return opDelete
+	case op&fsnotify.Rename != 0:
+		return "rename"
+	}
+	return "other"
+}
+
+func sumCounts(counts map[string]uint64) uint64 {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+func formatCounts(counts map[string]uint64) string {
+	if len(counts) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(counts))
+	for _, key := range sortedKeys(counts) {
+		parts = append(parts, fmt.Sprintf("%s=%d", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func sortedKeys(counts map[string]uint64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
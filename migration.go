@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// Сколько переименованный файл ждет появления под новым SteamID.
+// Если за это время файл с тем же содержимым не появился, старое
+// имя считается удаленным.
+const migrationWindow = 5 * time.Second
+
+// renamedFile - файл, исчезнувший при переименовании
+type renamedFile struct {
+	steamID string
+	// Хэш последнего содержимого; пусто, если содержимое не читалось
+	hash      string
+	renamedAt time.Time
+}
+
+// Переименованные файлы, ожидающие нового имени, по старому пути
+var pendingRenames = state.New[renamedFile]()
+
+// holdRename откладывает удаление переименованного файла, чтобы связать
+// его с новым именем. Возвращает false, если перенос для папки выключен.
+func holdRename(filename, steamID string) bool {
+	t := targetFor(filename)
+	if t == nil || !eventEnabled(t.MigrateEvent) {
+		return false
+	}
+	hash, _ := cachedHash(filename)
+	pendingRenames.Set(filename, renamedFile{steamID: steamID, hash: hash, renamedAt: time.Now()})
+	watchLog.Debugf("File %s renamed, waiting %v for its new name", filepath.Base(filename), migrationWindow)
+	return true
+}
+
+// takeRename ищет переименованный файл той же папки с другим SteamID
+// и тем же содержимым - источник нового файла
+func takeRename(filename, steamID, content string) (string, renamedFile, bool) {
+	dir := filepath.Dir(filename)
+	hash := hashContent(content)
+
+	var (
+		oldName string
+		found   renamedFile
+	)
+	for name, r := range pendingRenames.Snapshot() {
+		if filepath.Dir(name) != dir || r.steamID == steamID || time.Since(r.renamedAt) > migrationWindow {
+			continue
+		}
+		if r.hash != "" && r.hash != hash {
+			continue
+		}
+		// При нескольких кандидатах берем самый ранний
+		if oldName == "" || r.renamedAt.Before(found.renamedAt) {
+			oldName, found = name, r
+		}
+	}
+	if oldName == "" {
+		return "", renamedFile{}, false
+	}
+	pendingRenames.Delete(oldName)
+	return oldName, found, true
+}
+
+// handleFileMigrate отправляет одно событие переноса вместо пары delete и add,
+// чтобы панель перенесла запись игрока на новый SteamID
+func handleFileMigrate(ctx context.Context, oldName string, old renamedFile, filename, steamID, content string, fileStates *state.Store[time.Time]) {
+	forgetContent(oldName)
+	dinoStates.Delete(oldName)
+	fileStates.Delete(oldName)
+	cacheContent(filename, content)
+	rememberDino(filename, content)
+	backupSave(filename, steamID, content)
+
+	if eventData, err := fileEvent(ctx, filename, opMigrate, steamID, content); err == nil {
+		eventData.OldSteamID64 = old.steamID
+		watchLog.Infof("File %s renamed to %s, sending migrate event from SteamID %s to %s",
+			filepath.Base(oldName), filepath.Base(filename), old.steamID, steamID)
+		sendEventWithRetry(ctx, eventData)
+	}
+	fileStates.Set(filename, time.Now())
+	playerRemoved(ctx, oldName, old.steamID)
+	playerWritten(ctx, filename, steamID)
+}
+
+// flushExpiredRenames отправляет удаление для файлов, не появившихся под новым именем
+func flushExpiredRenames(ctx context.Context, fileStates *state.Store[time.Time]) {
+	for name, r := range pendingRenames.Snapshot() {
+		if time.Since(r.renamedAt) <= migrationWindow {
+			continue
+		}
+		pendingRenames.Delete(name)
+		if _, err := os.Stat(name); err == nil {
+			continue // Файл вернулся под прежним именем
+		}
+		if _, tracked := fileStates.Get(name); tracked {
+			handleFileRemove(ctx, name, r.steamID, fileStates)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Событие достижения порога роста
+const eventGrowthMilestone = "growth-milestone"
+
+// GrowthMilestonesConfig - события, когда рост динозавра переходит
+// настроенные пороги, например 0.25, 0.5, 0.75 и 1.0 (взрослый)
+type GrowthMilestonesConfig struct {
+	// Пороги роста (пусто - выключено)
+	Thresholds []float64 `json:"thresholds"`
+}
+
+func (c GrowthMilestonesConfig) validate() error {
+	for _, th := range c.Thresholds {
+		if th <= 0 || th > 1 {
+			return fmt.Errorf("growth_milestones.thresholds must be in (0, 1], got %v", th)
+		}
+	}
+	return nil
+}
+
+// detectGrowthMilestones отправляет событие по каждому порогу, который рост
+// динозавра перешел между прежним и новым состоянием
+func detectGrowthMilestones(ctx context.Context, filename, steamID string, previous, current dinoState) {
+	if len(cfg.GrowthMilestones.Thresholds) == 0 {
+		return
+	}
+	before, after := previous.fields, current.fields
+	// Другой класс - новый динозавр, а не рост прежнего
+	class, _ := after["CharacterClass"].(string)
+	if before["CharacterClass"] != after["CharacterClass"] {
+		return
+	}
+	oldGrowth, newGrowth := saveNumber(before["Growth"]), saveNumber(after["Growth"])
+	if oldGrowth == nil || newGrowth == nil || *newGrowth <= *oldGrowth {
+		return
+	}
+
+	thresholds := append([]float64(nil), cfg.GrowthMilestones.Thresholds...)
+	sort.Float64s(thresholds)
+	t := targetFor(filename)
+	for _, th := range thresholds {
+		if *oldGrowth >= th || *newGrowth < th {
+			continue
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"milestone":       th,
+			"growth":          *newGrowth,
+			"previous_growth": *oldGrowth,
+			"character_class": class,
+		})
+		watchLog.Infof("Dino of SteamID %s reached growth %v", steamID, th)
+		sendEventWithRetry(ctx, EventData{
+			SteamID64: steamID,
+			Type:      "milestone",
+			Event:     eventGrowthMilestone,
+			Data:      data,
+			Instance:  t.instance,
+		})
+	}
+}
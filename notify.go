@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Severity - уровень важности уведомления
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityCritical:
+		return "critical"
+	}
+	return "unknown"
+}
+
+func parseSeverity(value string) (Severity, error) {
+	switch strings.ToLower(value) {
+	case "", "info":
+		return SeverityInfo, nil
+	case "warning", "warn":
+		return SeverityWarning, nil
+	case "critical", "error":
+		return SeverityCritical, nil
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", value)
+}
+
+// Ключи алертов, по которым можно настраивать маршрутизацию
+const (
+	alertDeliveryFailed      = "delivery_failed"
+	alertHTMLResponse        = "html_response"
+	alertCloudflareChallenge = "cloudflare_challenge"
+	alertWatcherError        = "watcher_error"
+	alertBackpressure        = "backpressure"
+	alertWatcherDown         = "watcher_down"
+	alertDiskSpace           = "disk_space"
+)
+
+// Notification - уведомление, независимое от канала доставки
+type Notification struct {
+	Key      string
+	Severity Severity
+	Title    string
+	Message  string
+	Time     time.Time
+}
+
+// Notifier - канал доставки уведомлений (Discord, Telegram, Slack, email, webhook)
+type Notifier interface {
+	Name() string
+	Notify(n Notification) error
+}
+
+// NotifierConfig - настройки одного канала уведомлений
+type NotifierConfig struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Минимальная важность, начиная с которой канал получает уведомления
+	MinSeverity string `json:"min_severity"`
+	// Ключи алертов для канала (пусто - все)
+	Alerts []string `json:"alerts"`
+
+	// Discord, Slack, webhook
+	URL string `json:"url"`
+
+	// Telegram
+	BotToken string `json:"bot_token"`
+	ChatID   string `json:"chat_id"`
+
+	// Email
+	SMTPHost string   `json:"smtp_host"`
+	SMTPPort int      `json:"smtp_port"`
+	Username string   `json:"username"`
+	Password string   `json:"password"`
+	From     string   `json:"from"`
+	To       []string `json:"to"`
+}
+
+// route - канал вместе с правилами маршрутизации
+type route struct {
+	notifier    Notifier
+	minSeverity Severity
+	alerts      map[string]bool
+}
+
+func (r route) accepts(n Notification) bool {
+	if n.Severity < r.minSeverity {
+		return false
+	}
+	return len(r.alerts) == 0 || r.alerts[n.Key]
+}
+
+var (
+	notifyRoutes []route
+	// Отправляемые в фоне уведомления, которые ждем при остановке
+	notifyWG sync.WaitGroup
+)
+
+// Сколько ждем отправки уведомлений при остановке агента
+const notifyShutdownTimeout = 10 * time.Second
+
+func initNotifiers(configs []NotifierConfig) error {
+	notifyRoutes = nil
+
+	for _, nc := range configs {
+		notifier, err := newNotifier(nc)
+		if err != nil {
+			return err
+		}
+
+		minSeverity, err := parseSeverity(nc.MinSeverity)
+		if err != nil {
+			return fmt.Errorf("notifier %s: %v", notifier.Name(), err)
+		}
+
+		r := route{notifier: notifier, minSeverity: minSeverity}
+		if len(nc.Alerts) > 0 {
+			r.alerts = make(map[string]bool)
+			for _, key := range nc.Alerts {
+				r.alerts[key] = true
+			}
+		}
+		notifyRoutes = append(notifyRoutes, r)
+		agentLog.Infof("Notifier enabled: %s (min severity: %s)", notifier.Name(), minSeverity)
+	}
+	return nil
+}
+
+func newNotifier(nc NotifierConfig) (Notifier, error) {
+	name := nc.Name
+	if name == "" {
+		name = nc.Type
+	}
+
+	switch nc.Type {
+	case "discord":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("notifier %s: url is required", name)
+		}
+		return &discordNotifier{name: name, url: nc.URL}, nil
+	case "slack":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("notifier %s: url is required", name)
+		}
+		return &slackNotifier{name: name, url: nc.URL}, nil
+	case "webhook":
+		if nc.URL == "" {
+			return nil, fmt.Errorf("notifier %s: url is required", name)
+		}
+		return &webhookNotifier{name: name, url: nc.URL}, nil
+	case "telegram":
+		if nc.BotToken == "" || nc.ChatID == "" {
+			return nil, fmt.Errorf("notifier %s: bot_token and chat_id are required", name)
+		}
+		return &telegramNotifier{name: name, botToken: nc.BotToken, chatID: nc.ChatID}, nil
+	case "email":
+		if nc.SMTPHost == "" || nc.From == "" || len(nc.To) == 0 {
+			return nil, fmt.Errorf("notifier %s: smtp_host, from and to are required", name)
+		}
+		port := nc.SMTPPort
+		if port == 0 {
+			port = 587
+		}
+		return &emailNotifier{
+			name:     name,
+			addr:     fmt.Sprintf("%s:%d", nc.SMTPHost, port),
+			host:     nc.SMTPHost,
+			username: nc.Username,
+			password: nc.Password,
+			from:     nc.From,
+			to:       nc.To,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier type %q", nc.Type)
+}
+
+// notify рассылает уведомление во все подходящие каналы, не блокируя вызывающего
+func notify(key string, severity Severity, title, message string) {
+	n := Notification{
+		Key:      key,
+		Severity: severity,
+		Title:    title,
+		Message:  message,
+		Time:     time.Now(),
+	}
+
+	for _, r := range notifyRoutes {
+		if !r.accepts(n) {
+			continue
+		}
+		notifyWG.Add(1)
+		go func(notifier Notifier) {
+			defer notifyWG.Done()
+			if err := notifier.Notify(n); err != nil {
+				agentLog.Errorf("Error sending notification via %s: %v", notifier.Name(), err)
+			}
+		}(r.notifier)
+	}
+}
+
+// waitNotifications ждет отправки фоновых уведомлений, но не дольше timeout
+func waitNotifications(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		notifyWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		agentLog.Warnf("Timed out waiting for pending notifications")
+	}
+}
+
+// formatNotification - общий текстовый вид уведомления для всех каналов
+func formatNotification(n Notification) string {
+	return fmt.Sprintf("[%s] %s\n%s", strings.ToUpper(n.Severity.String()), n.Title, n.Message)
+}
+
+// postJSON отправляет JSON в канал уведомлений и проверяет статус ответа
+func postJSON(target string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(target, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+type discordNotifier struct {
+	name string
+	url  string
+}
+
+func (d *discordNotifier) Name() string { return d.name }
+
+func (d *discordNotifier) Notify(n Notification) error {
+	return postJSON(d.url, map[string]string{"content": formatNotification(n)})
+}
+
+type slackNotifier struct {
+	name string
+	url  string
+}
+
+func (s *slackNotifier) Name() string { return s.name }
+
+func (s *slackNotifier) Notify(n Notification) error {
+	return postJSON(s.url, map[string]string{"text": formatNotification(n)})
+}
+
+type webhookNotifier struct {
+	name string
+	url  string
+}
+
+func (w *webhookNotifier) Name() string { return w.name }
+
+func (w *webhookNotifier) Notify(n Notification) error {
+	return postJSON(w.url, map[string]string{
+		"key":       n.Key,
+		"severity":  n.Severity.String(),
+		"title":     n.Title,
+		"message":   n.Message,
+		"timestamp": n.Time.Format(time.RFC3339),
+	})
+}
+
+type telegramNotifier struct {
+	name     string
+	botToken string
+	chatID   string
+}
+
+func (t *telegramNotifier) Name() string { return t.name }
+
+func (t *telegramNotifier) Notify(n Notification) error {
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", url.PathEscape(t.botToken))
+	return postJSON(endpoint, map[string]string{
+		"chat_id": t.chatID,
+		"text":    formatNotification(n),
+	})
+}
+
+type emailNotifier struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (e *emailNotifier) Name() string { return e.name }
+
+func (e *emailNotifier) Notify(n Notification) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		auth = smtp.PlainAuth("", e.username, e.password, e.host)
+	}
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: [agent-ws] %s\r\n\r\n%s\r\n",
+		e.from, strings.Join(e.to, ", "), n.Title, formatNotification(n))
+	return smtp.SendMail(e.addr, auth, e.from, e.to, []byte(msg))
+}
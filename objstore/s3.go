@@ -0,0 +1,222 @@
+// Package objstore - минимальный клиент S3-совместимых хранилищ (AWS S3,
+// MinIO, Backblaze B2, Cloudflare R2): загрузка объектов и правило
+// удаления старых версий. Запросы подписываются AWS Signature V4.
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Config - подключение к бакету
+type Config struct {
+	// Адрес хранилища, например https://s3.eu-central-1.amazonaws.com
+	// или http://minio:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Бакет в пути (endpoint/bucket/key) вместо имени хоста (bucket.endpoint/key);
+	// нужен большинству самостоятельно развернутых хранилищ
+	PathStyle bool
+	// Класс хранения новых объектов (пусто - по умолчанию бакета)
+	StorageClass string
+}
+
+// Client выполняет запросы к бакету
+type Client struct {
+	c      Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+func New(client *http.Client, c Config) (*Client, error) {
+	if c.Bucket == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return nil, fmt.Errorf("bucket, access_key and secret_key are required")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Endpoint == "" {
+		c.Endpoint = "https://s3." + c.Region + ".amazonaws.com"
+	}
+	base, err := url.Parse(c.Endpoint)
+	if err != nil || base.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", c.Endpoint)
+	}
+	return &Client{c: c, base: base, client: client, now: time.Now}, nil
+}
+
+// Put загружает объект под ключом key
+func (s *Client) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	if s.c.StorageClass != "" {
+		header.Set("X-Amz-Storage-Class", s.c.StorageClass)
+	}
+	return s.do(ctx, "PUT", key, "", body, header)
+}
+
+// SetExpiration задает правило жизненного цикла бакета: объекты с префиксом
+// prefix удаляются через days дней. Заменяет прочие правила бакета.
+func (s *Client) SetExpiration(ctx context.Context, prefix string, days int) error {
+	body := []byte(fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>`+
+		`<LifecycleConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`+
+		`<Rule><ID>agent-ws-expire</ID><Filter><Prefix>%s</Prefix></Filter><Status>Enabled</Status>`+
+		`<Expiration><Days>%d</Days></Expiration></Rule></LifecycleConfiguration>`, xmlEscape(prefix), days))
+
+	sum := md5.Sum(body)
+	header := http.Header{}
+	header.Set("Content-Type", "application/xml")
+	header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+	return s.do(ctx, "PUT", "", "lifecycle=", body, header)
+}
+
+func (s *Client) do(ctx context.Context, method, key, query string, body []byte, header http.Header) error {
+	u := *s.base
+	path := strings.TrimRight(u.Path, "/")
+	if s.c.PathStyle {
+		path += "/" + s.c.Bucket
+	} else {
+		u.Host = s.c.Bucket + "." + u.Host
+	}
+	if key != "" {
+		path += "/" + key
+	}
+	if path == "" {
+		path = "/"
+	}
+	u.Path = path
+	u.RawPath = escapePath(path)
+	u.RawQuery = query
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	s.sign(req, body)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s: status %d: %s", method, u.Path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// sign добавляет заголовок Authorization по AWS Signature V4
+func (s *Client) sign(req *http.Request, body []byte) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Подписываются host и все заголовки запроса
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.RawQuery),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.c.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.c.SecretKey), day)
+	key = hmacSHA256(key, s.c.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.c.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery сортирует параметры запроса; параметр без значения
+// записывается как name=
+func canonicalQuery(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	parts := strings.Split(raw, "&")
+	for i, part := range parts {
+		if !strings.Contains(part, "=") {
+			parts[i] = part + "="
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "&")
+}
+
+// escapePath кодирует путь по правилам S3: все, кроме A-Z a-z 0-9 - _ . ~ и /
+func escapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func xmlEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;").Replace(s)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+)
+
+// OffsetSyncConfig - сверка очереди с последними событиями, принятыми бэкендом
+type OffsetSyncConfig struct {
+	// Endpoint, возвращающий последний принятый номер события и event_id
+	// по игрокам (пусто - выключено)
+	URL string `json:"url"`
+}
+
+// backendOffsets - последние события, обработанные бэкендом, по игрокам
+type backendOffsets struct {
+	Players []struct {
+		SteamID64 string `json:"steamid64"`
+		Instance  string `json:"instance"`
+		Sequence  uint64 `json:"sequence"`
+		EventID   string `json:"event_id"`
+	} `json:"players"`
+}
+
+// Сверка выполняется один раз за запуск - при первом успешном запросе
+var offsetsSynced bool
+
+// syncBackendOffsets запрашивает у бэкенда последние принятые события и
+// убирает из очереди то, что он уже обработал: после переустановки агента
+// с восстановленной очередью бэкенд не получает тысячи событий повторно.
+// Номера событий продолжаются с номеров бэкенда.
+func syncBackendOffsets(ctx context.Context) {
+	if cfg.OffsetSync.URL == "" || offsetsSynced {
+		return
+	}
+
+	var offsets backendOffsets
+	if err := fetchBackendJSON(ctx, cfg.OffsetSync.URL, &offsets); err != nil {
+		deliveryLog.Warnf("Error fetching backend offsets, will retry before redelivery: %v", err)
+		return
+	}
+	offsetsSynced = true
+
+	type offset struct {
+		sequence uint64
+		eventID  string
+	}
+	known := make(map[string]offset, len(offsets.Players))
+	for _, p := range offsets.Players {
+		key := instanceKey(p.Instance, p.SteamID64)
+		known[key] = offset{sequence: p.Sequence, eventID: p.EventID}
+		// Подтверждение бэкенда заменяет потерянный файл номеров
+		sequences.ack(key, p.Sequence)
+	}
+	sequences.flush()
+
+	entries, err := eventQueueStore.entries()
+	if err != nil {
+		deliveryLog.Errorf("Error reading persistent queue: %v", err)
+		return
+	}
+
+	// Событие с последним event_id бэкенда и все, что стояло в очереди
+	// раньше него по тому же игроку, уже обработаны
+	processedUpTo := make(map[string]int)
+	for i, entry := range entries {
+		ev := entry.event
+		if o, ok := known[instanceKey(ev.Instance, ev.SteamID64)]; ok && o.eventID != "" && ev.EventID == o.eventID {
+			processedUpTo[instanceKey(ev.Instance, ev.SteamID64)] = i
+		}
+	}
+
+	trimmed := 0
+	for i, entry := range entries {
+		ev := entry.event
+		key := instanceKey(ev.Instance, ev.SteamID64)
+		o, ok := known[key]
+		if !ok {
+			continue
+		}
+		last, seen := processedUpTo[key]
+		// События без номера (служебные) сверяются только по event_id
+		if (ev.Sequence != 0 && ev.Sequence <= o.sequence) || (seen && i <= last) {
+			eventQueueStore.remove(ev.EventID)
+			metrics.eventDropped("offset_sync")
+			trimmed++
+		}
+	}
+
+	deliveryLog.Infof("Backend offsets synced for %d players, %d already processed events removed from queue",
+		len(known), trimmed)
+}
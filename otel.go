@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"time"
+
+	"agent-ws/tracing"
+)
+
+// TracingConfig - трассировка конвейера событий (обнаружение, ожидание
+// дописи, чтение, преобразование, отправка, подтверждение) в OpenTelemetry
+type TracingConfig struct {
+	// Адрес OTLP/HTTP коллектора, например http://otel-collector:4318 (пусто - выключено)
+	Endpoint string            `json:"endpoint"`
+	Headers  map[string]string `json:"headers"`
+	// Доля трассируемых событий от 0 до 1
+	SampleRate float64 `json:"sample_rate"`
+	// service.name в коллекторе (по умолчанию agent-ws)
+	ServiceName string `json:"service_name"`
+}
+
+// Трассировка конвейера (nil - выключена, спаны не создаются)
+var tracer *tracing.Tracer
+
+func validateTracing(c TracingConfig) error {
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("tracing.sample_rate must be between 0 and 1")
+	}
+	return nil
+}
+
+// initTracing включает выгрузку спанов; вызывается после initHTTPClient
+func initTracing(c TracingConfig) {
+	if c.Endpoint == "" {
+		return
+	}
+	service := c.ServiceName
+	if service == "" {
+		service = "agent-ws"
+	}
+	tracer = tracing.New(httpClient, tracing.Options{
+		Endpoint:   c.Endpoint,
+		Headers:    c.Headers,
+		SampleRate: c.SampleRate,
+		Resource: map[string]string{
+			"service.name":    service,
+			"service.version": agentVersion,
+			"host.name":       agentHostname,
+			"agent.id":        cfg.Identity.AgentID,
+			"server.name":     cfg.Identity.ServerName,
+		},
+		// Ошибки выгрузки идут в консоль, а не в лог: лог на каждый сбой коллектора не нужен
+		OnError: func(err error) { log.Printf("Tracing error: %v", err) },
+	})
+	agentLog.Infof("Tracing pipeline to %s (sample rate %.2f)", c.Endpoint, c.SampleRate)
+}
+
+func closeTracing() {
+	tracer.Close()
+}
+
+// startFileTrace начинает трассу события файла с момента start
+func startFileTrace(ctx context.Context, filename, steamID string, op fmt.Stringer, start time.Time) (context.Context, *tracing.Span) {
+	ctx, span := tracer.StartAt(ctx, "file_event", start)
+	span.SetAttr("file", filepath.Base(filename))
+	span.SetAttr("steamid", steamID)
+	span.SetAttr("op", op.String())
+	return ctx, span
+}
+
+// debounce ждет, пока игра допишет файл (стадия debounce)
+func debounce(ctx context.Context, d time.Duration) error {
+	_, span := tracer.Start(ctx, "debounce")
+	defer span.End()
+	return sleepContext(ctx, d)
+}
+
+// readEventContent читает файл для события (стадия read)
+func readEventContent(ctx context.Context, filename string) (string, error) {
+	ctx, span := tracer.Start(ctx, "read")
+	defer span.End()
+	content, err := readFileContentWithRetry(ctx, filename)
+	span.SetAttr("bytes", len(content))
+	span.SetError(err)
+	return content, err
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// Файлы, измененные позже, могут еще ждать в канале watcher или в debounce,
+// поэтому проверка пропусков их не учитывает
+const gapScanGrace = 10 * time.Second
+
+// Причины повторного сканирования папок
+const (
+	rescanOverflow = "overflow"
+	rescanGap      = "gap"
+)
+
+// rescanLostEvents сканирует папки заново, когда события файловой системы
+// могли потеряться: буфер inotify/ReadDirectoryChangesW переполнился или
+// проверка нашла файлы, не совпадающие с fileStates
+func rescanLostEvents(ctx context.Context, targets []*WatchTarget, reason, detail string, fileStates *state.Store[time.Time]) {
+	metrics.watchRescanned(reason)
+
+	var added, changed int
+	for _, t := range targets {
+		a, c := resyncTarget(ctx, t, fileStates)
+		added += a
+		changed += c
+	}
+	checkForDeletedFiles(ctx, fileStates)
+
+	watchLog.Warnf("Events possibly lost (%s), rescanned: %d added, %d changed", detail, added, changed)
+}
+
+// scanForGaps сравнивает папки с fileStates: файл, о котором агент не знает,
+// или файл, измененный позже записанного времени, означает пропущенное
+// событие. Папка с расхождениями сканируется заново.
+func scanForGaps(ctx context.Context, fileStates *state.Store[time.Time]) {
+	// Пока события копятся в очередях, расхождения ожидаемы
+	if paused || !watcherState.healthy() || backpressureActive {
+		return
+	}
+	if pendingEvents != nil && len(pendingEvents.items) > 0 {
+		return
+	}
+
+	for _, t := range watchTargets {
+		if ctx.Err() != nil {
+			return
+		}
+		if missed := findGaps(t, fileStates); missed > 0 {
+			rescanLostEvents(ctx, []*WatchTarget{t}, rescanGap,
+				fmt.Sprintf("%d files out of sync in %s", missed, t.Path), fileStates)
+		}
+	}
+}
+
+func findGaps(t *WatchTarget, fileStates *state.Store[time.Time]) int {
+	files, err := os.ReadDir(t.Path)
+	if err != nil {
+		return 0
+	}
+
+	missed := 0
+	cutoff := time.Now().Add(-gapScanGrace)
+	for _, file := range files {
+		if file.IsDir() || isIgnored(file.Name()) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		filename := filepath.Join(t.Path, file.Name())
+		if getSteamIDFromFilename(filename) == "" {
+			continue
+		}
+		if _, renamed := pendingRenames.Get(filename); renamed {
+			continue
+		}
+
+		known, tracked := fileStates.Get(filename)
+		if !tracked || info.ModTime().After(known) {
+			watchLog.Debugf("Gap scan: %s is out of sync", file.Name())
+			missed++
+		}
+	}
+	return missed
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"agent-ws/events"
+)
+
+// isOversized проверяет, превышает ли поле data настроенный лимит
+func isOversized(eventData EventData) bool {
+	return cfg.MaxPayloadSize > 0 && len(eventData.Data) > cfg.MaxPayloadSize
+}
+
+// sendMultipart загружает содержимое файла на отдельный endpoint как multipart/form-data
+func sendMultipart(ctx context.Context, eventData EventData) ApiResponse {
+	deliveryLog.Debugf("Uploading multipart event: SteamID=%s, Event=%s, Data length=%d",
+		eventData.SteamID64, eventData.Event, len(eventData.Data))
+
+	eventData.Event = wireEventName(eventData.Event)
+	eventData, err := encryptPayload(eventData)
+	if err != nil {
+		return multipartError(eventData, err)
+	}
+
+	body, contentType, err := multipartBody(eventData)
+	if err != nil {
+		return multipartError(eventData, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", multipartEndpointFor(eventData), bytes.NewReader(body))
+	if err != nil {
+		deliveryLog.Errorf("Error creating multipart request: %v", err)
+		return multipartError(eventData, err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return executeRequest(req, eventData)
+}
+
+func validateContentType(name, value string) error {
+	switch value {
+	case contentJSON, contentForm, contentMultipart:
+		return nil
+	}
+	return fmt.Errorf("%s must be %s, %s or %s, got %q", name, contentJSON, contentForm, contentMultipart, value)
+}
+
+// contentTypeFor возвращает кодирование тела для API события: его экземпляра или общее
+func contentTypeFor(eventData EventData) string {
+	if inst := instanceFor(eventData.Instance); inst != nil && inst.ContentType != "" {
+		return inst.ContentType
+	}
+	return cfg.ContentType
+}
+
+// eventFields возвращает поля события для form и multipart. Необязательные
+// поля передаются, только если заданы; data передается отдельно.
+func eventFields(eventData EventData) url.Values {
+	fields := url.Values{
+		"steamid64": {eventData.SteamID64},
+		"type":      {eventData.Type},
+		"event":     {eventData.Event},
+		"event_id":  {eventData.EventID},
+		"sequence":  {fmt.Sprint(eventData.Sequence)},
+	}
+	for name, value := range map[string]string{
+		"old_steamid64": eventData.OldSteamID64,
+		"agent_id":      eventData.AgentID,
+		"server_name":   eventData.ServerName,
+		"map_name":      eventData.MapName,
+		"instance":      eventData.Instance,
+	} {
+		if value != "" {
+			fields.Set(name, value)
+		}
+	}
+	if eventData.ChunkID != "" {
+		fields.Set("chunk_id", eventData.ChunkID)
+		fields.Set("parent_event_id", eventData.ParentEventID)
+		fields.Set("chunk_index", fmt.Sprint(eventData.ChunkIndex))
+		fields.Set("chunk_total", fmt.Sprint(eventData.ChunkTotal))
+	}
+	if eventData.Truncated {
+		fields.Set("truncated", "true")
+		fields.Set("original_size", fmt.Sprint(eventData.OriginalSize))
+	}
+	if eventData.Encrypted {
+		fields.Set("encrypted", "true")
+	}
+	if eventData.Replayed {
+		fields.Set("replayed", "true")
+		fields.Set("replay_of", eventData.ReplayOf)
+	}
+	if p := eventData.Position; p != nil {
+		fields.Set("position_x", strconv.FormatFloat(p.X, 'f', -1, 64))
+		fields.Set("position_y", strconv.FormatFloat(p.Y, 'f', -1, 64))
+	}
+	return fields
+}
+
+// formBody кодирует событие как application/x-www-form-urlencoded
+// с содержимым сохранения в поле data
+func formBody(eventData EventData) []byte {
+	fields := eventFields(eventData)
+	fields.Set("data", events.Text(eventData.Data))
+	return []byte(fields.Encode())
+}
+
+// multipartBody кодирует событие как multipart/form-data: поля события
+// и файл сохранения <steamid>.json в части data
+func multipartBody(eventData EventData) ([]byte, string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	fields := eventFields(eventData)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writer.WriteField(name, fields.Get(name)); err != nil {
+			return nil, "", err
+		}
+	}
+
+	part, err := writer.CreateFormFile("data", eventData.SteamID64+".json")
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := part.Write([]byte(events.Text(eventData.Data))); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return body.Bytes(), writer.FormDataContentType(), nil
+}
+
+func multipartError(eventData EventData, err error) ApiResponse {
+	return ApiResponse{
+		Timestamp: time.Now().Format(time.RFC3339),
+		EventType: eventData.Event,
+		SteamID:   eventData.SteamID64,
+		Success:   false,
+		Error:     fmt.Sprintf("Multipart build error: %v", err),
+	}
+}
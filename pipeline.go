@@ -0,0 +1,59 @@
+package main
+
+import "fmt"
+
+// Режимы работы конвейера событий
+const (
+	pipelineLive   = "live"
+	pipelineDryRun = "dry-run"
+	pipelineShadow = "shadow"
+)
+
+// PipelineConfig - режим работы конвейера событий одного типа ("player", "server").
+// В dry-run события обрабатываются и логируются, но не отправляются,
+// в shadow - отправляются на отдельный endpoint вместо рабочего.
+type PipelineConfig struct {
+	Mode               string `json:"mode"`
+	ShadowURL          string `json:"shadow_url"`
+	ShadowMultipartURL string `json:"shadow_multipart_url"`
+}
+
+func pipelineFor(eventType string) PipelineConfig {
+	if p, ok := cfg.Pipelines[eventType]; ok {
+		return p
+	}
+	return PipelineConfig{Mode: pipelineLive}
+}
+
+// endpointFor возвращает URL для отправки события с учетом shadow-режима
+func endpointFor(eventData EventData) string {
+	if p := pipelineFor(eventData.Type); p.Mode == pipelineShadow {
+		return p.ShadowURL
+	}
+	if inst := instanceFor(eventData.Instance); inst != nil && inst.APIURL != "" {
+		return inst.APIURL
+	}
+	return cfg.APIURL
+}
+
+func multipartEndpointFor(eventData EventData) string {
+	if p := pipelineFor(eventData.Type); p.Mode == pipelineShadow && p.ShadowMultipartURL != "" {
+		return p.ShadowMultipartURL
+	}
+	return cfg.MultipartURL
+}
+
+func validatePipelines(pipelines map[string]PipelineConfig) error {
+	for name, p := range pipelines {
+		switch p.Mode {
+		case pipelineLive, pipelineDryRun:
+		case pipelineShadow:
+			if p.ShadowURL == "" {
+				return fmt.Errorf("pipeline %s: shadow_url is required in shadow mode", name)
+			}
+		default:
+			return fmt.Errorf("pipeline %s: unknown mode %q", name, p.Mode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"agent-ws/state"
+)
+
+// playerSync - состояние синхронизации игрока с панелью с момента запуска агента
+type playerSync struct {
+	LastEvent    string    `json:"last_event,omitempty"`
+	LastEventID  string    `json:"last_event_id,omitempty"`
+	LastSentHash string    `json:"last_sent_hash,omitempty"`
+	LastSentAt   time.Time `json:"last_sent_at,omitzero"`
+	AckedHash    string    `json:"acked_hash,omitempty"`
+	LastAckAt    time.Time `json:"last_ack_at,omitzero"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitzero"`
+}
+
+// playerSyncTracker хранит состояние по instanceKey. Обновляется из
+// основного цикла и воркеров доставки.
+type playerSyncTracker struct {
+	mu      sync.Mutex
+	players map[string]*playerSync
+}
+
+var playerSyncs = &playerSyncTracker{players: make(map[string]*playerSync)}
+
+func (t *playerSyncTracker) update(eventData EventData, fn func(p *playerSync)) {
+	if eventData.SteamID64 == "" {
+		return
+	}
+	key := instanceKey(eventData.Instance, eventData.SteamID64)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.players[key]
+	if !ok {
+		p = &playerSync{}
+		t.players[key] = p
+	}
+	fn(p)
+}
+
+// sent отмечает событие, поставленное в доставку
+func (t *playerSyncTracker) sent(eventData EventData) {
+	t.update(eventData, func(p *playerSync) {
+		p.LastEvent, p.LastEventID = eventData.Event, eventData.EventID
+		p.LastSentHash, p.LastSentAt = eventData.ContentHash, time.Now()
+	})
+}
+
+// acked отмечает событие, которое панель подтвердила
+func (t *playerSyncTracker) acked(eventData EventData) {
+	t.update(eventData, func(p *playerSync) {
+		if eventData.ContentHash != "" {
+			p.AckedHash = eventData.ContentHash
+		}
+		p.LastAckAt = time.Now()
+		p.LastError = ""
+	})
+}
+
+// failed отмечает неудачную доставку события
+func (t *playerSyncTracker) failed(eventData EventData, err error) {
+	t.update(eventData, func(p *playerSync) {
+		p.LastError, p.LastErrorAt = err.Error(), time.Now()
+	})
+}
+
+func (t *playerSyncTracker) get(key string) (playerSync, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.players[key]
+	if !ok {
+		return playerSync{}, false
+	}
+	return *p, true
+}
+
+// playerStatus - ответ на вопрос «синхронизировано ли сохранение игрока с панелью»
+type playerStatus struct {
+	SteamID64 string `json:"steamid64"`
+	Instance  string `json:"instance,omitempty"`
+	// Нет событий в очереди и последнее отправленное содержимое подтверждено
+	Synced bool `json:"synced"`
+	// Файл сохранения, как его видит агент
+	File        string `json:"file,omitempty"`
+	FileModTime string `json:"file_mod_time,omitempty"`
+	FileHash    string `json:"file_hash,omitempty"`
+
+	AckedSequence uint64 `json:"acked_sequence"`
+	PendingEvents int    `json:"pending_events"`
+	StreamEvents  int    `json:"stream_events,omitempty"`
+	// События с момента запуска агента (пусто - событий не было)
+	Sync *playerSync `json:"sync,omitempty"`
+}
+
+// collectPlayerStatus собирает состояние игрока. Вызывается в основном цикле.
+func collectPlayerStatus(instance, steamID string, fileStates *state.Store[time.Time]) (playerStatus, error) {
+	key := instanceKey(instance, steamID)
+	status := playerStatus{SteamID64: steamID, Instance: instance, AckedSequence: sequences.ackedFor(key)}
+
+	if players := playersTarget(instance); players != nil {
+		if filename := trackedSave(players, steamID, fileStates); filename != "" {
+			modTime, _ := fileStates.Get(filename)
+			status.File = filepath.Base(filename)
+			status.FileModTime = modTime.Format(time.RFC3339)
+			if hash, ok := cachedHash(filename); ok {
+				status.FileHash = hash
+			}
+		}
+	}
+
+	queued, err := eventQueueStore.pending()
+	if err != nil {
+		return status, err
+	}
+	for _, ev := range queued {
+		if ev.SteamID64 != steamID || ev.Instance != instance {
+			continue
+		}
+		if _, ok := streamedEvents.Get(ev.EventID); ok {
+			status.StreamEvents++
+		} else {
+			status.PendingEvents++
+		}
+	}
+
+	if p, ok := playerSyncs.get(key); ok {
+		status.Sync = &p
+	}
+	status.Synced = status.PendingEvents == 0 && status.StreamEvents == 0 &&
+		(status.Sync == nil || status.Sync.LastSentHash == status.Sync.AckedHash)
+	return status, nil
+}
+
+// handleAdminPlayer возвращает состояние синхронизации игрока:
+// GET /players/{steamid}?instance=...
+func handleAdminPlayer(w http.ResponseWriter, r *http.Request) {
+	var status playerStatus
+	var err error
+	if !inMainLoop(w, r, func(_ context.Context, fileStates *state.Store[time.Time]) {
+		status, err = collectPlayerStatus(r.URL.Query().Get("instance"), r.PathValue("steamid"), fileStates)
+	}) {
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// runStatus - команда agent-ws status --steamid X: состояние синхронизации
+// игрока из работающего агента через локальный API
+func runStatus(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	steamID := fs.String("steamid", "", "SteamID64 of the player")
+	instance := fs.String("instance", "", "server instance of the player")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *steamID == "" {
+		fmt.Println("--steamid is required")
+		return 2
+	}
+	if cfg.AdminAPI.Listen == "" {
+		fmt.Println("The admin API is disabled; set admin_api.listen to query the running agent")
+		return 1
+	}
+
+	status, err := fetchPlayerStatus(ctx, *instance, *steamID)
+	if err != nil {
+		fmt.Println("Error querying the agent:", err)
+		return 1
+	}
+	printPlayerStatus(status)
+	if !status.Synced {
+		return 1
+	}
+	return 0
+}
+
+func fetchPlayerStatus(ctx context.Context, instance, steamID string) (playerStatus, error) {
+	host, port, err := net.SplitHostPort(cfg.AdminAPI.Listen)
+	if err != nil {
+		return playerStatus{}, fmt.Errorf("invalid admin_api.listen: %v", err)
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	u := url.URL{Scheme: "http", Host: net.JoinHostPort(host, port), Path: "/players/" + steamID}
+	if instance != "" {
+		u.RawQuery = url.Values{"instance": {instance}}.Encode()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, adminCallTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return playerStatus{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+cfg.AdminAPI.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return playerStatus{}, fmt.Errorf("is the agent running? %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return playerStatus{}, fmt.Errorf("status %d - %s", resp.StatusCode, truncateBody(string(body)))
+	}
+	var status playerStatus
+	if err := json.Unmarshal(body, &status); err != nil {
+		return playerStatus{}, err
+	}
+	return status, nil
+}
+
+func printPlayerStatus(s playerStatus) {
+	verdict := "synced"
+	if !s.Synced {
+		verdict = "NOT synced"
+	}
+	name := s.SteamID64
+	if s.Instance != "" {
+		name = s.Instance + "/" + name
+	}
+	fmt.Printf("Player %s: %s\n", name, verdict)
+
+	if s.File != "" {
+		fmt.Printf("  save file:      %s (modified %s)\n", s.File, s.FileModTime)
+	} else {
+		fmt.Println("  save file:      not tracked")
+	}
+	fmt.Printf("  acked sequence: %d\n", s.AckedSequence)
+	fmt.Printf("  pending events: %d", s.PendingEvents)
+	if s.StreamEvents > 0 {
+		fmt.Printf(" (+%d in an open stream)", s.StreamEvents)
+	}
+	fmt.Println()
+
+	if s.Sync == nil {
+		fmt.Println("  no events for this player since the agent started")
+		return
+	}
+	p := s.Sync
+	fmt.Printf("  last event:     %s (%s) at %s\n", p.LastEvent, p.LastEventID, p.LastSentAt.Format(time.RFC3339))
+	fmt.Printf("  last sent hash: %s\n", p.LastSentHash)
+	if !p.LastAckAt.IsZero() {
+		fmt.Printf("  last ack:       %s, hash %s\n", p.LastAckAt.Format(time.RFC3339), p.AckedHash)
+	} else {
+		fmt.Println("  last ack:       none since the agent started")
+	}
+	if p.LastError != "" {
+		fmt.Printf("  last error:     %s at %s\n", p.LastError, p.LastErrorAt.Format(time.RFC3339))
+	}
+}
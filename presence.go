@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Выводимые события присутствия игрока
+const (
+	eventPlayerActive   = "player-active"
+	eventPlayerInactive = "player-inactive"
+)
+
+// PresenceConfig - вывод присутствия игроков по записи их сохранений:
+// игра периодически пишет файл игрока, пока он на сервере
+type PresenceConfig struct {
+	Enabled bool `json:"enabled"`
+	// Сколько файл игрока не должен меняться, чтобы игрок считался вышедшим
+	IdleThreshold Duration `json:"idle_threshold"`
+}
+
+func (c PresenceConfig) validate() error {
+	if c.Enabled && c.IdleThreshold.Duration <= 0 {
+		return fmt.Errorf("presence.idle_threshold must be positive")
+	}
+	return nil
+}
+
+// playerPresence - активность игрока с момента первой записи его файла
+type playerPresence struct {
+	firstWrite time.Time
+	lastWrite  time.Time
+}
+
+// Активные игроки по SteamID. Используется только в основном цикле.
+var activePlayers = make(map[string]*playerPresence)
+
+// presenceEvent формирует событие присутствия игрока
+func presenceEvent(event, steamID string, p *playerPresence, reason string) EventData {
+	payload := map[string]interface{}{
+		"first_write": p.firstWrite.UTC().Format(time.RFC3339),
+		"last_write":  p.lastWrite.UTC().Format(time.RFC3339),
+	}
+	if reason != "" {
+		payload["reason"] = reason
+	}
+	data, _ := json.Marshal(payload)
+
+	return EventData{
+		SteamID64: steamID,
+		Type:      "presence",
+		Event:     event,
+		Data:      data,
+	}
+}
+
+// playerWritten отмечает запись файла игрока. Первая запись после
+// простоя означает, что игрок зашел на сервер.
+func playerWritten(ctx context.Context, filename, steamID string) {
+	if !cfg.Presence.Enabled || !isPlayerFile(filename) {
+		return
+	}
+
+	now := time.Now()
+	if p, ok := activePlayers[steamID]; ok {
+		p.lastWrite = now
+		return
+	}
+
+	p := &playerPresence{firstWrite: now, lastWrite: now}
+	activePlayers[steamID] = p
+	watchLog.Debugf("Player %s is active", steamID)
+	sendEventWithRetry(ctx, presenceEvent(eventPlayerActive, steamID, p, ""))
+}
+
+// playerRemoved отмечает удаление файла игрока: активный игрок считается вышедшим
+func playerRemoved(ctx context.Context, filename, steamID string) {
+	if !cfg.Presence.Enabled || !isPlayerFile(filename) {
+		return
+	}
+	if p, ok := activePlayers[steamID]; ok {
+		delete(activePlayers, steamID)
+		watchLog.Debugf("Player %s is inactive: file deleted", steamID)
+		sendEventWithRetry(ctx, presenceEvent(eventPlayerInactive, steamID, p, "file_deleted"))
+	}
+}
+
+// checkIdlePlayers считает вышедшими игроков, файлы которых
+// не менялись дольше порога
+func checkIdlePlayers(ctx context.Context) {
+	if !cfg.Presence.Enabled {
+		return
+	}
+
+	now := time.Now()
+	for steamID, p := range activePlayers {
+		if now.Sub(p.lastWrite) < cfg.Presence.IdleThreshold.Duration {
+			continue
+		}
+		delete(activePlayers, steamID)
+		watchLog.Debugf("Player %s is inactive: no writes for %v", steamID, now.Sub(p.lastWrite).Round(time.Second))
+		sendEventWithRetry(ctx, presenceEvent(eventPlayerInactive, steamID, p, "idle"))
+	}
+}
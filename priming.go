@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// PrimingConfig - первичная синхронизация со снимком состояния бэкенда
+type PrimingConfig struct {
+	// Endpoint, возвращающий известное бэкенду состояние игроков (пусто - выключено)
+	SnapshotURL string `json:"snapshot_url"`
+	// Файл-маркер: если существует, первичная синхронизация уже выполнена
+	MarkerFile string `json:"marker_file"`
+}
+
+// backendSnapshot - известное бэкенду состояние файлов игроков
+type backendSnapshot struct {
+	Players []struct {
+		SteamID64 string `json:"steamid64"`
+		Hash      string `json:"hash"`
+	} `json:"players"`
+}
+
+// primeFromBackend сравнивает локальные файлы со снимком бэкенда и отправляет
+// только реальные расхождения. Выполняется один раз - до появления маркера.
+func primeFromBackend(ctx context.Context, fileStates *state.Store[time.Time]) {
+	if cfg.Priming.SnapshotURL == "" {
+		return
+	}
+	if _, err := os.Stat(cfg.Priming.MarkerFile); err == nil {
+		return
+	}
+
+	players := playersTarget("")
+	if players == nil {
+		commandLog.Warnf("No player watch target configured, priming skipped")
+		return
+	}
+
+	commandLog.Infof("Priming from backend snapshot: %s", cfg.Priming.SnapshotURL)
+	var snapshot backendSnapshot
+	if err := fetchBackendJSON(ctx, cfg.Priming.SnapshotURL, &snapshot); err != nil {
+		commandLog.Errorf("Error fetching backend snapshot, priming skipped: %v", err)
+		return
+	}
+
+	known := make(map[string]string, len(snapshot.Players))
+	for _, p := range snapshot.Players {
+		known[p.SteamID64] = p.Hash
+	}
+
+	var added, changed, deleted, unchanged int
+	local := make(map[string]bool, fileStates.Len())
+	for filename := range fileStates.Snapshot() {
+		if !isPlayerFile(filename) {
+			continue
+		}
+		steamID := getSteamIDFromFilename(filename)
+		local[steamID] = true
+
+		remoteHash, exists := known[steamID]
+		hash, ok := localHash(filename)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case !exists:
+			sendPrimingEvent(ctx, players, filename, steamID, opAdd)
+			added++
+		case remoteHash != hash:
+			sendPrimingEvent(ctx, players, filename, steamID, opChange)
+			changed++
+		default:
+			unchanged++
+		}
+	}
+
+	// Игроки, о которых знает бэкенд, но файлов которых больше нет
+	for steamID := range known {
+		if local[steamID] {
+			continue
+		}
+		// Без содержимого преобразования не применяются
+		ev, _ := players.newEvent(opDelete, steamID, "")
+		sendEventWithRetry(ctx, ev)
+		deleted++
+	}
+
+	// Прерванная синхронизация повторится при следующем запуске
+	if ctx.Err() != nil {
+		commandLog.Warnf("Priming interrupted: %v", ctx.Err())
+		return
+	}
+
+	commandLog.Infof("Priming finished: %d added, %d changed, %d deleted, %d unchanged",
+		added, changed, deleted, unchanged)
+
+	if err := os.WriteFile(cfg.Priming.MarkerFile, []byte(time.Now().Format(time.RFC3339)), 0644); err != nil {
+		commandLog.Errorf("Error writing priming marker %s: %v", cfg.Priming.MarkerFile, err)
+	}
+}
+
+// errBackendNotFound - бэкенд не знает запрошенный объект (404)
+var errBackendNotFound = errors.New("status 404")
+
+// fetchBackendJSON запрашивает у панели JSON-документ состояния бэкенда
+func fetchBackendJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	setPanelHeaders(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", errBackendNotFound, truncateBody(string(body)))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d - %s", resp.StatusCode, truncateBody(string(body)))
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("parse response: %v", err)
+	}
+	return nil
+}
+
+// localHash возвращает хэш содержимого файла из кэша или считает его с диска
+func localHash(filename string) (string, bool) {
+	if hash, ok := cachedHash(filename); ok {
+		return hash, true
+	}
+
+	hash, err := hashFile(filename)
+	if err != nil {
+		commandLog.Errorf("Error hashing file %s: %v", filepath.Base(filename), err)
+		return "", false
+	}
+	return hash, true
+}
+
+func sendPrimingEvent(ctx context.Context, t *WatchTarget, filename, steamID, op string) {
+	content, err := readFileContentWithRetry(ctx, filename)
+	if err != nil {
+		commandLog.Errorf("Error reading file %s for priming: %v", filepath.Base(filename), err)
+		return
+	}
+
+	if ev, err := t.newEvent(op, steamID, content); err == nil {
+		sendEventWithRetry(ctx, ev)
+	}
+}
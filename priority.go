@@ -0,0 +1,57 @@
+package main
+
+import "sort"
+
+// defaultEventPriorities - события жизненного цикла важнее массовых изменений
+func defaultEventPriorities() map[string]int {
+	return map[string]int{
+		"delete-dino-data":  30,
+		"migrate-dino-data": 30,
+		"add-dino-data":     20,
+		"change-dino-data":  10,
+	}
+}
+
+// inheritEventPriorities дает событиям папки без настроенного приоритета
+// приоритет стандартного события игроков той же операции
+func inheritEventPriorities(t *WatchTarget) {
+	for _, op := range []string{opAdd, opChange, opDelete, opMigrate} {
+		event := t.eventName(op)
+		if _, ok := cfg.EventPriorities[event]; ok {
+			continue
+		}
+		if p, ok := cfg.EventPriorities[op+"-dino-data"]; ok {
+			cfg.EventPriorities[event] = p
+		}
+	}
+}
+
+// eventPriority возвращает приоритет события (без настройки - 0)
+func eventPriority(event string) int {
+	return cfg.EventPriorities[event]
+}
+
+// sortByPriority упорядочивает накопившиеся события так, чтобы важные ушли первыми.
+// События одного ключа доставки (экземпляр и SteamID, как у воркеров)
+// сохраняют порядок: вся группа получает приоритет самого важного из ее
+// событий, иначе бэкенд мог бы получить delete раньше add.
+func sortByPriority(events []EventData) {
+	groupPriority := make(map[string]int)
+	for _, ev := range events {
+		key := deliveryKey(ev)
+		if p, ok := groupPriority[key]; !ok || eventPriority(ev.Event) > p {
+			groupPriority[key] = eventPriority(ev.Event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return groupPriority[deliveryKey(events[i])] > groupPriority[deliveryKey(events[j])]
+	})
+}
+
+// sortPendingByPriority упорядочивает отложенные события файлов по приоритету
+func sortPendingByPriority(events []pendingEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventPriority(fileEventName(events[i].filename, events[i].op)) >
+			eventPriority(fileEventName(events[j].filename, events[j].op))
+	})
+}
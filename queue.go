@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// persistentQueue - очередь недоставленных событий на диске. Событие
+// записывается до первой попытки отправки и удаляется только после
+// подтверждения бэкендом, поэтому переживает падение агента и недоступность API.
+type persistentQueue struct {
+	dir string
+}
+
+var eventQueueStore *persistentQueue
+
+func openPersistentQueue(dir string) (*persistentQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create queue dir: %v", err)
+	}
+	return &persistentQueue{dir: dir}, nil
+}
+
+// Имя файла начинается со времени постановки, чтобы сортировка по имени
+// давала порядок постановки в очередь
+func (q *persistentQueue) path(eventData EventData) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d-%s.json", time.Now().UnixNano(), eventData.EventID))
+}
+
+func (q *persistentQueue) add(eventData EventData) error {
+	data, err := json.Marshal(eventData)
+	if err != nil {
+		return err
+	}
+	if data, err = sealState(data); err != nil {
+		return err
+	}
+	return writeFileAtomic(q.path(eventData), data)
+}
+
+func (q *persistentQueue) remove(eventID string) {
+	matches, _ := filepath.Glob(filepath.Join(q.dir, "*-"+eventID+".json"))
+	for _, match := range matches {
+		if err := os.Remove(match); err != nil && !os.IsNotExist(err) {
+			deliveryLog.Errorf("Error removing queued event %s: %v", eventID, err)
+		}
+	}
+}
+
+// pending возвращает события очереди в порядке постановки
+func (q *persistentQueue) pending() ([]EventData, error) {
+	entries, err := q.entries()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]EventData, 0, len(entries))
+	for _, entry := range entries {
+		events = append(events, entry.event)
+	}
+	return events, nil
+}
+
+// queuedEntry - событие очереди и время его постановки
+type queuedEntry struct {
+	queuedAt time.Time
+	event    EventData
+}
+
+func (q *persistentQueue) entries() ([]queuedEntry, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := queuedNames(entries)
+	sort.Strings(names)
+
+	events := make([]queuedEntry, 0, len(names))
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(q.dir, name))
+		if err != nil {
+			deliveryLog.Errorf("Error reading queued event %s: %v", name, err)
+			continue
+		}
+
+		if data, err = openState(data); err != nil {
+			// Без ключа событие не прочитать, но и удалять его нельзя
+			deliveryLog.Errorf("Error decrypting queued event %s: %v", name, err)
+			continue
+		}
+
+		var eventData EventData
+		if err := json.Unmarshal(data, &eventData); err != nil {
+			// Поврежденный файл не должен блокировать очередь
+			deliveryLog.Warnf("Dropping corrupted queued event %s: %v", name, err)
+			os.Remove(filepath.Join(q.dir, name))
+			continue
+		}
+		var queuedAt time.Time
+		if nanos, err := strconv.ParseInt(strings.SplitN(name, "-", 2)[0], 10, 64); err == nil {
+			queuedAt = time.Unix(0, nanos)
+		}
+		events = append(events, queuedEntry{queuedAt: queuedAt, event: eventData})
+	}
+	return events, nil
+}
+
+// len возвращает число записанных событий; недописанные .tmp файлы
+// прерванной записи не считаются
+func (q *persistentQueue) len() int {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return 0
+	}
+	return len(queuedNames(entries))
+}
+
+// queuedNames возвращает имена файлов событий очереди
+func queuedNames(entries []os.DirEntry) []string {
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// redeliverQueued повторно отправляет события из очереди. При первой же
+// неудаче проход прерывается - бэкенд, скорее всего, недоступен.
+func redeliverQueued(ctx context.Context) {
+	if isThrottled() || maintenanceHoldsQueue() {
+		return
+	}
+
+	// Если бэкенд был недоступен при запуске, сверка выполняется здесь
+	syncBackendOffsets(ctx)
+
+	events, err := eventQueueStore.pending()
+	if err != nil {
+		deliveryLog.Errorf("Error reading persistent queue: %v", err)
+		return
+	}
+	// События открытых потоков ждут их ответа
+	events = withoutStreamed(events)
+	if len(events) == 0 {
+		return
+	}
+
+	sortByPriority(events)
+
+	// С воркерами события уходят параллельно по SteamID; новый проход
+	// начинается, только когда закончился предыдущий
+	if deliveryDispatcher != nil {
+		if inFlightEvents.Len() > 0 {
+			return
+		}
+		deliveryLog.Infof("Redelivering %d queued events", len(events))
+		for _, eventData := range events {
+			dispatchDelivery(ctx, eventData, "")
+		}
+		return
+	}
+
+	deliveryLog.Infof("Redelivering %d queued events", len(events))
+	for _, eventData := range events {
+		if !completeDelivery(ctx, eventData, "") {
+			deliveryLog.Warnf("Redelivery stopped, %d events remain queued", eventQueueStore.len())
+			return
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// RCONConfig - подключение к RCON сервера Evrima
+type RCONConfig struct {
+	// Адрес RCON, например 127.0.0.1:8888 (пусто - выключено)
+	Address  string   `json:"address"`
+	Password string   `json:"password"`
+	Timeout  Duration `json:"timeout"`
+}
+
+// Коды пакетов RCON Evrima
+const (
+	rconAuth     byte = 0x01
+	rconExecute  byte = 0x02
+	rconAnnounce byte = 0x10
+	rconBan      byte = 0x20
+	rconKick     byte = 0x30
+	rconSave     byte = 0x50
+)
+
+// rconClient - клиент RCON Evrima. Соединение открывается на каждую команду,
+// чтобы не держать сессию, которую сервер закрывает при рестарте.
+type rconClient struct {
+	address  string
+	password string
+	timeout  time.Duration
+}
+
+func newRCONClient(c RCONConfig) *rconClient {
+	return &rconClient{address: c.Address, password: c.Password, timeout: c.Timeout.Duration}
+}
+
+// execute подключается, авторизуется и выполняет команду, возвращая ответ сервера
+func (c *rconClient) execute(ctx context.Context, code byte, payload string) (string, error) {
+	dialer := net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.address)
+	if err != nil {
+		return "", fmt.Errorf("rcon connect: %v", err)
+	}
+	defer conn.Close()
+
+	reply, err := c.roundTrip(conn, append([]byte{rconAuth}, c.password...))
+	if err != nil {
+		return "", fmt.Errorf("rcon auth: %v", err)
+	}
+	if !strings.Contains(reply, "Accepted") {
+		return "", fmt.Errorf("rcon auth rejected: %s", reply)
+	}
+
+	packet := append([]byte{rconExecute, code}, payload...)
+	reply, err = c.roundTrip(conn, packet)
+	if err != nil {
+		return "", fmt.Errorf("rcon command: %v", err)
+	}
+	return reply, nil
+}
+
+func (c *rconClient) roundTrip(conn net.Conn, packet []byte) (string, error) {
+	if err := conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return "", err
+	}
+
+	if _, err := conn.Write(append(packet, 0x00)); err != nil {
+		return "", err
+	}
+
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimRight(buf[:n], "\x00")), nil
+}
+
+// executeRCONCommand выполняет игровую команду, полученную от бэкенда
+func executeRCONCommand(ctx context.Context, cmd Command) (bool, string) {
+	if cfg.RCON.Address == "" {
+		return false, "rcon is not configured"
+	}
+
+	var code byte
+	var payload string
+	switch cmd.Name {
+	case "announce":
+		if cmd.Args["message"] == "" {
+			return false, "message is required"
+		}
+		code, payload = rconAnnounce, cmd.Args["message"]
+	case "kick":
+		if cmd.Args["steamid"] == "" {
+			return false, "steamid is required"
+		}
+		code, payload = rconKick, cmd.Args["steamid"]+","+cmd.Args["reason"]
+	case "ban":
+		if cmd.Args["steamid"] == "" {
+			return false, "steamid is required"
+		}
+		code, payload = rconBan, strings.Join([]string{
+			cmd.Args["steamid"], cmd.Args["reason"], cmd.Args["duration"],
+		}, ",")
+	case "save":
+		code = rconSave
+	default:
+		return false, fmt.Sprintf("unsupported rcon command %q", cmd.Name)
+	}
+
+	reply, err := newRCONClient(cfg.RCON).execute(ctx, code, payload)
+	recordAudit(auditEntry{
+		Action:    auditRCON,
+		Command:   cmd.Name,
+		CommandID: cmd.ID,
+		Target:    cmd.Args["steamid"],
+		Details:   map[string]string{"payload": payload},
+	}, err)
+	if err != nil {
+		return false, err.Error()
+	}
+	return true, reply
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"agent-ws/sink"
+)
+
+// replayFilter - какие события отправить повторно
+type replayFilter struct {
+	from, to time.Time
+	steamID  string
+}
+
+func (f replayFilter) matches(at time.Time, eventData EventData) bool {
+	if !f.from.IsZero() && at.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && at.After(f.to) {
+		return false
+	}
+	return f.steamID == "" || eventData.SteamID64 == f.steamID
+}
+
+// runReplay - команда agent-ws replay: повторная отправка событий из архива
+// или очереди, например после восстановления базы панели из бэкапа
+func runReplay(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := fs.String("from", "", "start time (RFC3339 or 2006-01-02 15:04)")
+	to := fs.String("to", "", "end time (RFC3339 or 2006-01-02 15:04)")
+	steamID := fs.String("steamid", "", "replay only events of this SteamID")
+	source := fs.String("source", "archive", "where to read events: archive or queue")
+	dryRun := fs.Bool("dry-run", false, "only list matching events")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var filter replayFilter
+	var err error
+	if filter.from, err = parseReplayTime(*from); err != nil {
+		fmt.Println("Invalid --from:", err)
+		return 2
+	}
+	if filter.to, err = parseReplayTime(*to); err != nil {
+		fmt.Println("Invalid --to:", err)
+		return 2
+	}
+	filter.steamID = *steamID
+
+	var events []EventData
+	switch *source {
+	case "archive":
+		events, err = archivedEvents(filter)
+	case "queue":
+		events, err = queuedEvents(filter)
+	default:
+		fmt.Printf("Unknown --source %q, use archive or queue\n", *source)
+		return 2
+	}
+	if err != nil {
+		fmt.Println("Error reading events:", err)
+		return 1
+	}
+
+	fmt.Printf("Found %d events to replay\n", len(events))
+	if *dryRun {
+		for _, ev := range events {
+			fmt.Printf("  %s %s %s (seq %d)\n", ev.EventID, ev.SteamID64, ev.Event, ev.Sequence)
+		}
+		return 0
+	}
+
+	if err := initHTTPClient(); err != nil {
+		fmt.Println("Error initializing HTTP client:", err)
+		return 1
+	}
+	if err := initPayloadEncryption(cfg.PayloadEncryption); err != nil {
+		fmt.Println("Error initializing payload encryption:", err)
+		return 1
+	}
+	if err := initSinks(); err != nil {
+		fmt.Println("Error initializing sinks:", err)
+		return 1
+	}
+	defer closeSinks()
+
+	var sent int
+	for _, ev := range events {
+		// Новый event_id: с исходным получатели отбросили бы повтор как дубль
+		ev.Replayed, ev.ReplayOf, ev.EventID = true, ev.EventID, newEventID()
+		if err := deliverEvent(ctx, ev); err != nil {
+			fmt.Printf("Replay stopped at event %s: %v, %d of %d sent\n", ev.ReplayOf, err, sent, len(events))
+			return 1
+		}
+		sent++
+	}
+	fmt.Printf("Replayed %d events\n", sent)
+	return 0
+}
+
+func parseReplayTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02 15:04", value, time.Local)
+}
+
+// archivedEvents читает события из JSONL-архива. Событие попадает в архив
+// при каждой попытке, поэтому берется одна запись на event_id; отброшенные
+// и dry-run события не повторяются.
+func archivedEvents(filter replayFilter) ([]EventData, error) {
+	raw, ok := cfg.Sinks["archive"]
+	if !ok {
+		return nil, fmt.Errorf("archive sink is not configured")
+	}
+	var c sink.ArchiveConfig
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("parse archive config: %v", err)
+	}
+
+	files, err := sink.ArchiveFiles(c.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []EventData
+	seen := make(map[string]bool)
+	for _, path := range files {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+		for scanner.Scan() {
+			var record sink.ArchiveRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				continue
+			}
+			switch record.Outcome {
+			case sink.OutcomeDropped, sink.OutcomeDryRun:
+				continue
+			}
+			ev := record.Event
+			// Прошлые повторы не повторяются: исходное событие тоже в архиве
+			if ev.EventID == "" || ev.ReplayOf != "" || seen[ev.EventID] || !filter.matches(record.Time, ev) {
+				continue
+			}
+			seen[ev.EventID] = true
+			events = append(events, ev)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %v", path, err)
+		}
+	}
+	return events, nil
+}
+
+// queuedEvents читает недоставленные события из очереди на диске
+func queuedEvents(filter replayFilter) ([]EventData, error) {
+	if err := initStateEncryption(cfg.StateEncryptionKey); err != nil {
+		return nil, err
+	}
+	queue, err := openPersistentQueue(cfg.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := queue.entries()
+	if err != nil {
+		return nil, err
+	}
+	var events []EventData
+	for _, entry := range entries {
+		if filter.matches(entry.queuedAt, entry.event) {
+			events = append(events, entry.event)
+		}
+	}
+	return events, nil
+}
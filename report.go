@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Сколько часов статистики хранится, пока отчет не удается отправить
+const reportMaxHours = 48
+
+// DeliveryReportConfig - периодическая отправка статистики доставки панели
+type DeliveryReportConfig struct {
+	// Endpoint для отчетов (пусто - выключено)
+	URL      string   `json:"url"`
+	Interval Duration `json:"interval"`
+}
+
+// hourlyCounts - счетчики доставки за один час
+type hourlyCounts struct {
+	Hour    string `json:"hour"`
+	Sent    uint64 `json:"sent"`
+	Failed  uint64 `json:"failed"`
+	Retried uint64 `json:"retried"`
+}
+
+// deliveryStats копит счетчики по часам до успешной отправки отчета
+type deliveryStats struct {
+	mu    sync.Mutex
+	hours map[time.Time]*hourlyCounts
+}
+
+var reportStats = &deliveryStats{hours: make(map[time.Time]*hourlyCounts)}
+
+// count увеличивает счетчик текущего часа
+func (s *deliveryStats) count(update func(c *hourlyCounts)) {
+	hour := time.Now().UTC().Truncate(time.Hour)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.hours[hour]
+	if !ok {
+		c = &hourlyCounts{Hour: hour.Format(time.RFC3339)}
+		s.hours[hour] = c
+		s.trim()
+	}
+	update(c)
+}
+
+func (s *deliveryStats) sent()    { s.count(func(c *hourlyCounts) { c.Sent++ }) }
+func (s *deliveryStats) failed()  { s.count(func(c *hourlyCounts) { c.Failed++ }) }
+func (s *deliveryStats) retried() { s.count(func(c *hourlyCounts) { c.Retried++ }) }
+
+// trim удаляет самые старые часы сверх лимита
+func (s *deliveryStats) trim() {
+	for len(s.hours) > reportMaxHours {
+		var oldest time.Time
+		for hour := range s.hours {
+			if oldest.IsZero() || hour.Before(oldest) {
+				oldest = hour
+			}
+		}
+		delete(s.hours, oldest)
+	}
+}
+
+// snapshot возвращает счетчики по часам в хронологическом порядке
+func (s *deliveryStats) snapshot() []hourlyCounts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hours := make([]hourlyCounts, 0, len(s.hours))
+	for _, c := range s.hours {
+		hours = append(hours, *c)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Hour < hours[j].Hour })
+	return hours
+}
+
+// forgetBefore удаляет отправленные часы. Текущий час остается и
+// отправляется в следующем отчете с накопленными значениями.
+func (s *deliveryStats) forgetBefore(hour time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for h := range s.hours {
+		if h.Before(hour) {
+			delete(s.hours, h)
+		}
+	}
+}
+
+// sendDeliveryReport отправляет панели статистику доставки по часам.
+// Панель заменяет значения часа, поэтому повторная отправка безопасна.
+func sendDeliveryReport(ctx context.Context) {
+	currentHour := time.Now().UTC().Truncate(time.Hour)
+	report := map[string]interface{}{
+		"agent_id":     cfg.Identity.AgentID,
+		"server_name":  cfg.Identity.ServerName,
+		"generated_at": time.Now().UTC().Format(time.RFC3339),
+		"queued":       eventQueueStore.len(),
+		"hours":        reportStats.snapshot(),
+	}
+
+	if err := postDeliveryReport(ctx, report); err != nil {
+		deliveryLog.Errorf("Error sending delivery report: %v", err)
+		return
+	}
+	reportStats.forgetBefore(currentHour)
+}
+
+func postDeliveryReport(ctx context.Context, report interface{}) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.DeliveryReport.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setPanelHeaders(req)
+	if err := signRequest(req); err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("status %d - %s", resp.StatusCode, truncateBody(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-ws/state"
+)
+
+// Сколько раз сразу пробуем заменить файл, пока его держит игра
+const restoreAttempts = 5
+
+// restoreSave возвращает сохранение игрока из локальной копии на момент at
+// (последняя копия не позже at; нулевое at - самая свежая копия).
+// Текущий файл перед заменой сам сохраняется в копии, поэтому
+// восстановление можно отменить повторным восстановлением.
+func restoreSave(ctx context.Context, cmd Command, at time.Time, fileStates *state.Store[time.Time]) (string, error) {
+	instance, steamID := cmd.Args["instance"], cmd.Args["steamid"]
+	if cfg.Backup.Dir == "" {
+		return "", fmt.Errorf("backups are disabled")
+	}
+	versions, err := listBackups(instance, steamID)
+	if err != nil {
+		return "", err
+	}
+	players := playersTarget(instance)
+	if players == nil {
+		return "", fmt.Errorf("no watch target with type player")
+	}
+
+	var version *backupVersion
+	for i := range versions {
+		if at.IsZero() || !versions[i].At.After(at) {
+			version = &versions[i]
+		}
+	}
+	if version == nil {
+		return "", fmt.Errorf("no backup of SteamID %s at or before %s", steamID, at.Format(time.RFC3339))
+	}
+
+	content, err := readBackup(version.Path)
+	if err != nil {
+		return "", fmt.Errorf("read backup: %v", err)
+	}
+
+	// Расширение исходного файла хранится в имени копии: <время>.json[.zst]
+	name := strings.TrimSuffix(filepath.Base(version.Path), ".zst")
+	filename := filepath.Join(players.Path, steamID+strings.TrimPrefix(name, version.At.Format(backupTimeLayout)))
+
+	if current, err := os.ReadFile(filename); err == nil && len(current) > 0 {
+		if _, err := writeBackup(cfg.Backup, instance, steamID, filepath.Ext(filename), current, time.Now()); err != nil {
+			return "", fmt.Errorf("back up current save: %v", err)
+		}
+	}
+
+	w := &gameWrite{filename: filename, content: content, command: cmd.Name, commandID: cmd.ID}
+	pending, err := writeGameFile(ctx, w, fileStates)
+	if err != nil {
+		return "", err
+	}
+	if pending != "" {
+		return fmt.Sprintf("restore of %s from backup taken %s: %s", filepath.Base(filename), version.At.Format(time.RFC3339), pending), nil
+	}
+	commandLog.Infof("Restored save of SteamID %s from backup taken %s", steamID, version.At.Format(time.RFC3339))
+	return fmt.Sprintf("restored %s from backup taken %s", filepath.Base(filename), version.At.Format(time.RFC3339)), nil
+}
+
+// replaceSave записывает содержимое во временный файл рядом и подменяет им
+// сохранение. Пока файл заблокирован игрой, замена повторяется до attempts
+// раз; если игра так и не отпустила файл, сохранение остается прежним.
+func replaceSave(ctx context.Context, filename string, content []byte, attempts int) error {
+	// Временный файл подпадает под ignore_patterns и не порождает событий
+	tmp := filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".restore.tmp")
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	delay := fileReadDelay
+	for attempt := 1; ; attempt++ {
+		err := os.Rename(tmp, filename)
+		if err == nil {
+			return nil
+		}
+		if !isLockViolation(err) {
+			return err
+		}
+		if attempt >= attempts {
+			return &saveLockedError{name: filepath.Base(filename)}
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+		delay = min(delay*2, fileLockMaxDelay)
+	}
+}
+
+// parseRestoreTime разбирает момент восстановления: RFC3339, формат
+// имен копий или пусто - последняя копия
+func parseRestoreTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(backupTimeLayout, value); err == nil {
+		return t, nil
+	}
+	return parseReplayTime(value)
+}
+
+// executeRestoreCommand - команда restore: args steamid, timestamp
+// и instance (для агента с несколькими серверами)
+func executeRestoreCommand(ctx context.Context, cmd Command, fileStates *state.Store[time.Time]) (bool, string) {
+	steamID := cmd.Args["steamid"]
+	if steamID == "" {
+		return false, "steamid is required"
+	}
+	at, err := parseRestoreTime(cmd.Args["timestamp"])
+	if err != nil {
+		return false, fmt.Sprintf("invalid timestamp: %v", err)
+	}
+	message, err := restoreSave(ctx, cmd, at, fileStates)
+	if err != nil {
+		return false, err.Error()
+	}
+	return true, message
+}
+
+// handleAdminBackups возвращает список копий игрока; ?instance= - экземпляра
+func handleAdminBackups(w http.ResponseWriter, r *http.Request) {
+	versions, err := listBackups(r.URL.Query().Get("instance"), r.PathValue("steamid"))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	list := make([]string, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, v.At.Format(time.RFC3339Nano))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"steamid": r.PathValue("steamid"), "backups": list})
+}
+
+// handleAdminRestore восстанавливает сохранение игрока из копии:
+// POST /restore/{steamid}?timestamp=...&instance=... Результат, как и у команд бэкенда,
+// отправляется панели.
+func handleAdminRestore(w http.ResponseWriter, r *http.Request) {
+	cmd := Command{
+		ID:   "admin-" + newEventID(),
+		Name: "restore",
+		Args: map[string]string{
+			"steamid":   r.PathValue("steamid"),
+			"timestamp": r.URL.Query().Get("timestamp"),
+			"instance":  r.URL.Query().Get("instance"),
+		},
+	}
+
+	var result CommandResult
+	if !inMainLoop(w, r, func(ctx context.Context, fileStates *state.Store[time.Time]) {
+		result = executeCommand(ctx, cmd, fileStates)
+		reportCommandResult(ctx, result)
+	}) {
+		return
+	}
+
+	status := http.StatusOK
+	if !result.Success {
+		status = http.StatusConflict
+	} else if result.Pending {
+		status = http.StatusAccepted
+	}
+	writeJSON(w, status, result)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// resyncDirectory сверяет отслеживаемые папки с кэшем и отправляет все расхождения:
+// новые файлы - как add, измененные - как change, пропавшие - как delete
+func resyncDirectory(ctx context.Context, fileStates *state.Store[time.Time]) {
+	watchLog.Infof("Starting resync of watch directories")
+
+	var added, changed int
+	for _, t := range watchTargets {
+		a, c := resyncTarget(ctx, t, fileStates)
+		added += a
+		changed += c
+	}
+
+	checkForDeletedFiles(ctx, fileStates)
+	watchLog.Infof("Resync finished: %d added, %d changed", added, changed)
+}
+
+func resyncTarget(ctx context.Context, t *WatchTarget, fileStates *state.Store[time.Time]) (added, changed int) {
+	files, err := os.ReadDir(t.Path)
+	if err != nil {
+		watchLog.Errorf("Error reading directory %s for resync: %v", t.Path, err)
+		return
+	}
+	queued := queuedHashes()
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return added, changed
+		}
+		if file.IsDir() || isIgnored(file.Name()) {
+			continue
+		}
+		filename := filepath.Join(t.Path, file.Name())
+		steamID := getSteamIDFromFilename(filename)
+		if steamID == "" {
+			continue
+		}
+
+		if _, tracked := fileStates.Get(filename); !tracked {
+			if !checkResyncConflict(ctx, t, filename, steamID, fileStates) {
+				handleFileCreate(ctx, filename, steamID, fileStates)
+			}
+			added++
+			continue
+		}
+
+		content, err := readFileContentWithRetry(ctx, filename)
+		if err != nil {
+			watchLog.Errorf("Error reading file %s for resync: %v", file.Name(), err)
+			continue
+		}
+		cacheContent(filename, content)
+		key := dedupKey(t.EventType, instanceKey(t.instance, steamID))
+		if contentAcked(t, filename, steamID, content) || queued[key][eventDataHash(t, steamID, content)] {
+			continue
+		}
+
+		watchLog.Debugf("Resync: sending change event for SteamID %s", steamID)
+		ev, err := t.newEvent(opChange, steamID, content)
+		if err != nil {
+			continue
+		}
+		sendEventWithRetry(ctx, ev)
+		if info, err := os.Stat(filename); err == nil {
+			fileStates.Set(filename, info.ModTime())
+		}
+		changed++
+	}
+	return added, changed
+}
+
+// pauseEmission приостанавливает отправку событий, например на время вайпа сервера
+func pauseEmission(source string) {
+	if paused {
+		return
+	}
+	paused = true
+	watchLog.Infof("Event emission paused via %s", source)
+}
+
+// resumeEmission возобновляет отправку и, если нужно, догоняет изменения,
+// пропущенные за время паузы
+func resumeEmission(ctx context.Context, source string, resync bool, fileStates *state.Store[time.Time]) {
+	if !paused {
+		return
+	}
+	paused = false
+	watchLog.Infof("Event emission resumed via %s", source)
+	if resync {
+		resyncDirectory(ctx, fileStates)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"agent-ws/sink"
+)
+
+// RetryPolicy - устойчивость доставки в sink: повторные попытки с растущей
+// паузой, таймаут попытки и circuit breaker. Нулевые поля политики
+// отдельного sink берутся из общей политики retry.
+type RetryPolicy struct {
+	// Всего попыток доставки события, включая первую
+	MaxAttempts int `json:"max_attempts"`
+	// Пауза перед первым повтором, множитель ее роста и предел
+	InitialBackoff    Duration `json:"initial_backoff"`
+	BackoffMultiplier float64  `json:"backoff_multiplier"`
+	MaxBackoff        Duration `json:"max_backoff"`
+	// Таймаут одной попытки (0 - только таймауты HTTP-клиента)
+	Timeout Duration `json:"timeout"`
+	// После breaker_threshold неудачных доставок подряд sink пропускается
+	// на breaker_cooldown, события ждут в очереди (0 - выключено)
+	BreakerThreshold int      `json:"breaker_threshold"`
+	BreakerCooldown  Duration `json:"breaker_cooldown"`
+}
+
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    Duration{Duration: 2 * time.Second},
+		BackoffMultiplier: 1,
+		MaxBackoff:        Duration{Duration: time.Minute},
+		BreakerCooldown:   Duration{Duration: time.Minute},
+	}
+}
+
+// withDefaults дополняет незаданные поля политики из base
+func (p RetryPolicy) withDefaults(base RetryPolicy) RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = base.MaxAttempts
+	}
+	if p.InitialBackoff.Duration == 0 {
+		p.InitialBackoff = base.InitialBackoff
+	}
+	if p.BackoffMultiplier == 0 {
+		p.BackoffMultiplier = base.BackoffMultiplier
+	}
+	if p.MaxBackoff.Duration == 0 {
+		p.MaxBackoff = base.MaxBackoff
+	}
+	if p.Timeout.Duration == 0 {
+		p.Timeout = base.Timeout
+	}
+	if p.BreakerThreshold == 0 {
+		p.BreakerThreshold = base.BreakerThreshold
+	}
+	if p.BreakerCooldown.Duration == 0 {
+		p.BreakerCooldown = base.BreakerCooldown
+	}
+	return p
+}
+
+func validateRetryPolicy(name string, p RetryPolicy) error {
+	switch {
+	case p.MaxAttempts < 0:
+		return fmt.Errorf("%s.max_attempts must not be negative", name)
+	case p.BackoffMultiplier < 0 || (p.BackoffMultiplier > 0 && p.BackoffMultiplier < 1):
+		return fmt.Errorf("%s.backoff_multiplier must be at least 1", name)
+	case p.InitialBackoff.Duration < 0 || p.MaxBackoff.Duration < 0 || p.Timeout.Duration < 0:
+		return fmt.Errorf("%s: backoff and timeout must not be negative", name)
+	case p.BreakerThreshold < 0 || p.BreakerCooldown.Duration < 0:
+		return fmt.Errorf("%s: breaker settings must not be negative", name)
+	}
+	return nil
+}
+
+func validateRetryPolicies(c *Config) error {
+	if err := validateRetryPolicy("retry", c.Retry); err != nil {
+		return err
+	}
+	for name, p := range c.SinkRetry {
+		if name != "http" && c.Sinks[name] == nil && !instanceHasSink(c, name) {
+			return fmt.Errorf("sink_retry: sink %q is not configured", name)
+		}
+		if err := validateRetryPolicy("sink_retry."+name, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryPolicyFor возвращает политику sink с учетом общей
+func retryPolicyFor(name string) RetryPolicy {
+	base := cfg.Retry.withDefaults(defaultRetryPolicy())
+	if p, ok := cfg.SinkRetry[name]; ok {
+		return p.withDefaults(base)
+	}
+	return base
+}
+
+// backoff возвращает паузу после неудачной попытки attempt (с 1)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff.Duration)
+	for i := 1; i < attempt; i++ {
+		delay *= p.BackoffMultiplier
+	}
+	if limit := float64(p.MaxBackoff.Duration); limit > 0 && delay > limit {
+		delay = limit
+	}
+	return time.Duration(delay)
+}
+
+// attemptContext ограничивает одну попытку таймаутом политики
+func (p RetryPolicy) attemptContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.Timeout.Duration <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, p.Timeout.Duration)
+}
+
+// errCircuitOpen - sink временно пропускается после серии неудач
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker размыкается после threshold неудачных доставок подряд.
+// Через cooldown пропускается одна пробная доставка: успех замыкает
+// breaker, неудача снова размыкает его на cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	b.failures, b.probing = 0, false
+	b.mu.Unlock()
+}
+
+// failure учитывает неудачу и сообщает, что breaker только что разомкнулся
+func (b *circuitBreaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	return true
+}
+
+// policySink применяет к sink его политику: повторные попытки с таймаутом
+// (кроме http - у доставки в панель свой цикл попыток) и circuit breaker
+type policySink struct {
+	name    string
+	policy  RetryPolicy
+	retry   bool
+	breaker *circuitBreaker
+	sink.Sink
+}
+
+func newPolicySink(name string, s sink.Sink) *policySink {
+	policy := retryPolicyFor(name)
+	ps := &policySink{name: name, policy: policy, retry: name != "http", Sink: s}
+	if policy.BreakerThreshold > 0 {
+		ps.breaker = &circuitBreaker{threshold: policy.BreakerThreshold, cooldown: policy.BreakerCooldown.Duration}
+	}
+	return ps
+}
+
+func (s *policySink) Send(ctx context.Context, ev sink.Event) error {
+	if s.breaker != nil && !s.breaker.allow() {
+		return fmt.Errorf("sink %s: %w", s.name, errCircuitOpen)
+	}
+
+	err := s.send(ctx, ev)
+	if s.breaker == nil || ctx.Err() != nil {
+		return err
+	}
+	// Отказ бэкенда принять событие - не сбой sink
+	var backendErr *backendError
+	if err == nil || (errors.As(err, &backendErr) && !backendErr.retryable()) {
+		s.breaker.success()
+	} else if s.breaker.failure() {
+		deliveryLog.Warnf("Circuit breaker for sink %s opened after %d failed deliveries, pausing for %v",
+			s.name, s.policy.BreakerThreshold, s.policy.BreakerCooldown.Duration)
+	}
+	return err
+}
+
+func (s *policySink) send(ctx context.Context, ev sink.Event) error {
+	if !s.retry {
+		return s.Sink.Send(ctx, ev)
+	}
+
+	var err error
+	for attempt := 1; attempt <= s.policy.MaxAttempts; attempt++ {
+		attemptCtx, cancel := s.policy.attemptContext(ctx)
+		err = s.Sink.Send(attemptCtx, ev)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if attempt < s.policy.MaxAttempts {
+			metrics.eventRetried()
+			delay := s.policy.backoff(attempt)
+			deliveryLog.Warnf("Attempt %d to sink %s failed for event %s: %v, retrying in %v",
+				attempt, s.name, ev.EventID, err, delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
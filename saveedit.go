@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// SaveEditsConfig - запись на диск сохранений игроков, измененных в панели.
+// Панель присылает новое содержимое командой apply_save (опросом команд
+// или через webhook).
+type SaveEditsConfig struct {
+	Enabled bool `json:"enabled"`
+	// Не применять правку, пока игрок на сервере (по данным presence):
+	// игра перезапишет файл своим состоянием
+	RequireOffline bool `json:"require_offline"`
+}
+
+// Хэши правок панели по имени файла: событие файла, вызванное записью
+// правки, не отправляется панели обратно. Используется только в основном цикле.
+var appliedEdits = state.New[string]()
+
+// executeApplySaveCommand - команда apply_save: args steamid, content,
+// instance (для агента с несколькими серверами) и base_hash - хэш
+// сохранения, которое правили в панели
+func executeApplySaveCommand(ctx context.Context, cmd Command, fileStates *state.Store[time.Time]) (bool, string) {
+	if !cfg.SaveEdits.Enabled {
+		return false, "save edits are disabled"
+	}
+	steamID, content := cmd.Args["steamid"], cmd.Args["content"]
+	if steamID == "" || content == "" {
+		return false, "steamid and content are required"
+	}
+	message, err := applySaveEdit(ctx, cmd, fileStates)
+	if err != nil {
+		return false, err.Error()
+	}
+	return true, message
+}
+
+// applySaveEdit заменяет сохранение игрока содержимым из панели. Если
+// base_hash задан, а файл с тех пор изменился, правка не применяется.
+// Текущий файл перед заменой сохраняется в локальных копиях.
+func applySaveEdit(ctx context.Context, cmd Command, fileStates *state.Store[time.Time]) (string, error) {
+	instance, steamID, content := cmd.Args["instance"], cmd.Args["steamid"], cmd.Args["content"]
+	players := playersTarget(instance)
+	if players == nil {
+		return "", fmt.Errorf("no watch target with type player")
+	}
+	filename := trackedSave(players, steamID, fileStates)
+	if filename == "" {
+		return "", fmt.Errorf("no save of SteamID %s", steamID)
+	}
+	if filepath.Ext(filename) == ".json" && !json.Valid([]byte(content)) {
+		return "", fmt.Errorf("content is not valid JSON")
+	}
+	if _, online := activePlayers[steamID]; online && cfg.SaveEdits.RequireOffline {
+		return "", fmt.Errorf("player %s is online, try again when the player is offline", steamID)
+	}
+
+	current, err := readFileContentWithRetry(ctx, filename)
+	if err != nil {
+		return "", fmt.Errorf("read current save: %v", err)
+	}
+	if baseHash := cmd.Args["base_hash"]; baseHash != "" && hashContent(current) != baseHash {
+		return "", fmt.Errorf("save of SteamID %s changed since it was edited in the panel", steamID)
+	}
+	if hashContent(content) == hashContent(current) {
+		return fmt.Sprintf("%s is already up to date", filepath.Base(filename)), nil
+	}
+
+	if cfg.Backup.Dir != "" {
+		if _, err := writeBackup(cfg.Backup, instance, steamID, filepath.Ext(filename), []byte(current), time.Now()); err != nil {
+			return "", fmt.Errorf("back up current save: %v", err)
+		}
+	}
+
+	w := &gameWrite{
+		filename:   filename,
+		content:    []byte(content),
+		command:    cmd.Name,
+		commandID:  cmd.ID,
+		expectHash: hashContent(current),
+		panelEdit:  true,
+	}
+	pending, err := writeGameFile(ctx, w, fileStates)
+	if err != nil {
+		return "", err
+	}
+	if pending != "" {
+		return fmt.Sprintf("panel edit of %s: %s", filepath.Base(filename), pending), nil
+	}
+	commandLog.Infof("Applied panel edit to save of SteamID %s", steamID)
+	return fmt.Sprintf("applied panel edit to %s", filepath.Base(filename)), nil
+}
+
+// takeAppliedEdit сообщает, что содержимое файла - только что записанная
+// правка панели
+func takeAppliedEdit(filename, content string) bool {
+	hash, ok := appliedEdits.Get(filename)
+	if !ok {
+		return false
+	}
+	appliedEdits.Delete(filename)
+	return hash == hashContent(content)
+}
+
+// trackedSave возвращает отслеживаемый файл сохранения игрока в папке игроков
+func trackedSave(players *WatchTarget, steamID string, fileStates *state.Store[time.Time]) string {
+	for filename := range fileStates.Snapshot() {
+		if getSteamIDFromFilename(filename) == steamID && targetFor(filename) == players {
+			return filename
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sequenceTracker выдает монотонные номера событий по SteamID и хранит
+// последний подтвержденный бэкендом номер, чтобы после перезапуска
+// нумерация продолжилась, а бэкенд мог обнаружить пропуски
+type sequenceTracker struct {
+	mu    sync.Mutex
+	path  string
+	next  map[string]uint64
+	acked map[string]uint64
+	dirty bool
+}
+
+var sequences *sequenceTracker
+
+func loadSequences(path string) (*sequenceTracker, error) {
+	t := &sequenceTracker{
+		path:  path,
+		next:  make(map[string]uint64),
+		acked: make(map[string]uint64),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return t, nil
+		}
+		return nil, fmt.Errorf("read sequence file: %v", err)
+	}
+	if data, err = openState(data); err != nil {
+		return nil, fmt.Errorf("read sequence file: %v", err)
+	}
+	if err := json.Unmarshal(data, &t.acked); err != nil {
+		return nil, fmt.Errorf("parse sequence file: %v", err)
+	}
+	return t, nil
+}
+
+// assign возвращает следующий номер события для SteamID
+func (t *sequenceTracker) assign(steamID string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	seq, ok := t.next[steamID]
+	if !ok {
+		seq = t.acked[steamID] + 1
+	}
+	t.next[steamID] = seq + 1
+	return seq
+}
+
+// ack запоминает номер события, доставленного бэкенду
+func (t *sequenceTracker) ack(steamID string, seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if seq > t.acked[steamID] {
+		t.acked[steamID] = seq
+		t.dirty = true
+	}
+}
+
+// ackedFor возвращает последний подтвержденный номер события SteamID
+func (t *sequenceTracker) ackedFor(steamID string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.acked[steamID]
+}
+
+// flush сохраняет подтвержденные номера на диск, если они изменились
+func (t *sequenceTracker) flush() {
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return
+	}
+	data, err := json.Marshal(t.acked)
+	t.dirty = false
+	t.mu.Unlock()
+
+	if err == nil {
+		data, err = sealState(data)
+	}
+	if err != nil {
+		deliveryLog.Errorf("Error encoding sequences: %v", err)
+		return
+	}
+	if err := writeFileAtomic(t.path, data); err != nil {
+		deliveryLog.Errorf("Error saving sequences to %s: %v", t.path, err)
+	}
+}
+
+// writeFileAtomic пишет файл через временный файл и переименование,
+// чтобы при сбое не остался наполовину записанный файл
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Счетчик запасных идентификаторов событий
+var fallbackIDs atomic.Uint64
+
+// newEventID генерирует UUID v4 для идемпотентной доставки. Если системный
+// генератор случайных чисел недоступен, идентификатор собирается из времени
+// и счетчика процесса: доставка не должна останавливаться из-за этого.
+func newEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		deliveryLog.Warnf("crypto/rand failed, using time-based event id: %v", err)
+		binary.BigEndian.PutUint64(b[0:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(b[8:16], fallbackIDs.Add(1)^uint64(os.Getpid())<<32)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
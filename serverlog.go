@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ServerLogConfig - настройки чтения лога сервера Evrima
+type ServerLogConfig struct {
+	Enabled bool `json:"enabled"`
+	// Путь к логу сервера (TheIsle.log)
+	Path         string    `json:"path"`
+	PollInterval Duration  `json:"poll_interval"`
+	Rules        []LogRule `json:"rules"`
+}
+
+// LogRule - правило разбора строки лога. Именованные группы регулярного
+// выражения попадают в data события, группа steamid - в steamid64.
+type LogRule struct {
+	Event   string `json:"event"`
+	Pattern string `json:"pattern"`
+}
+
+// Правила по умолчанию для основных строк лога Evrima
+var defaultLogRules = []LogRule{
+	{
+		Event:   "player-join",
+		Pattern: `LogTheIsleJoinData: (?:\[[^\]]*\] )?(?P<name>.+?) \[(?P<steamid>\d{17})\] Joined The Server`,
+	},
+	{
+		Event:   "player-leave",
+		Pattern: `LogTheIsleJoinData: (?:\[[^\]]*\] )?(?P<name>.+?) \[(?P<steamid>\d{17})\] Left The Server`,
+	},
+	{
+		Event:   "chat-message",
+		Pattern: `LogTheIsleChatData: \[(?P<channel>[^\]]+)\] (?P<name>.+?) \[(?P<steamid>\d{17})\]: (?P<message>.*)`,
+	},
+	{
+		Event:   "player-kill",
+		Pattern: `LogTheIsleKillData: (?:\[[^\]]*\] )?(?P<killer>.+?) \[(?P<steamid>\d{17})\].*Killed the following player: (?P<victim>.+?), \[(?P<victim_steamid>\d{17})\]`,
+	},
+	{
+		Event:   "admin-command",
+		Pattern: `LogTheIsleCommandData: (?:\[[^\]]*\] )?(?P<name>.+?) \[(?P<steamid>\d{17})\] used command: (?P<command>.*)`,
+	},
+}
+
+type compiledLogRule struct {
+	event string
+	re    *regexp.Regexp
+}
+
+// logTailer следит за логом сервера, дочитывая новые строки с запомненного смещения
+type logTailer struct {
+	path    string
+	rules   []compiledLogRule
+	offset  int64
+	partial string
+}
+
+var serverLogTailer *logTailer
+
+func newLogTailer(c ServerLogConfig) (*logTailer, error) {
+	rules := c.Rules
+	if len(rules) == 0 {
+		rules = defaultLogRules
+	}
+
+	t := &logTailer{path: c.Path}
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("server log rule %s: %v", rule.Event, err)
+		}
+		t.rules = append(t.rules, compiledLogRule{event: rule.Event, re: re})
+	}
+
+	// Начинаем с конца файла, чтобы не пересылать старую историю
+	if info, err := os.Stat(c.Path); err == nil {
+		t.offset = info.Size()
+	}
+	return t, nil
+}
+
+// poll дочитывает новые строки лога и отправляет события по сработавшим правилам
+func (t *logTailer) poll(ctx context.Context) {
+	f, err := os.Open(t.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			watchLog.Errorf("Error opening server log %s: %v", t.path, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		watchLog.Errorf("Error stating server log %s: %v", t.path, err)
+		return
+	}
+
+	// Лог был пересоздан или обрезан при рестарте сервера
+	if info.Size() < t.offset {
+		watchLog.Warnf("Server log %s was truncated, reading from start", t.path)
+		t.offset = 0
+		t.partial = ""
+	}
+	if info.Size() == t.offset {
+		return
+	}
+
+	if _, err := f.Seek(t.offset, io.SeekStart); err != nil {
+		watchLog.Errorf("Error seeking server log %s: %v", t.path, err)
+		return
+	}
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		t.offset += int64(len(line))
+
+		if err != nil {
+			// Неполную строку дочитаем в следующий раз
+			t.partial += line
+			break
+		}
+
+		t.handleLine(ctx, strings.TrimRight(t.partial+line, "\r\n"))
+		t.partial = ""
+	}
+}
+
+func (t *logTailer) handleLine(ctx context.Context, line string) {
+	for _, rule := range t.rules {
+		match := rule.re.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		fields := map[string]string{"line": line}
+		for i, name := range rule.re.SubexpNames() {
+			if name != "" && i < len(match) {
+				fields[name] = match[i]
+			}
+		}
+
+		data, err := json.Marshal(fields)
+		if err != nil {
+			watchLog.Errorf("Error encoding server log event %s: %v", rule.event, err)
+			return
+		}
+
+		watchLog.Debugf("Server log event: %s, SteamID: %s", rule.event, fields["steamid"])
+		sendEventWithRetry(ctx, EventData{
+			SteamID64: fields["steamid"],
+			Type:      "server",
+			Event:     rule.event,
+			Data:      data,
+		})
+		return
+	}
+}
+
+func initServerLog(c ServerLogConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.Path == "" {
+		return fmt.Errorf("server_log.path is required when server log is enabled")
+	}
+
+	tailer, err := newLogTailer(c)
+	if err != nil {
+		return err
+	}
+	serverLogTailer = tailer
+	watchLog.Infof("Tailing server log: %s (%d rules)", c.Path, len(tailer.rules))
+	return nil
+}
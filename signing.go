@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Заголовки подписи исходящих запросов
+const (
+	signatureHeader          = "X-Signature"
+	signatureTimestampHeader = "X-Signature-Timestamp"
+	signatureNonceHeader     = "X-Signature-Nonce"
+)
+
+// signRequest подписывает запрос ключом агента: X-Signature = "sha256=" +
+// hex(HMAC-SHA256(key, body + timestamp + nonce)). Метка времени и одноразовый
+// nonce позволяют бэкенду отбрасывать повторно отправленные запросы.
+func signRequest(req *http.Request) error {
+	if cfg.SigningKey == "" {
+		return nil
+	}
+
+	var body []byte
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return fmt.Errorf("read body for signing: %v", err)
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("read body for signing: %v", err)
+		}
+	}
+
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return fmt.Errorf("generate nonce: %v", err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce[:])
+
+	req.Header.Set(signatureHeader, "sha256="+computeSignature(cfg.SigningKey, body, timestamp, nonceHex))
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureNonceHeader, nonceHex)
+	return nil
+}
+
+func computeSignature(key string, body []byte, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte(nonce))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,293 @@
+// Package simulate генерирует правдоподобные сохранения игроков Evrima и
+// меняет папку Players с заданной частотой: создание, перезапись, удаление
+// и переименование файлов. Так агент проверяется на скорость и корректность
+// без живого игрового сервера.
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Виды изменений папки
+const (
+	OpCreate = "create"
+	OpWrite  = "write"
+	OpDelete = "delete"
+	OpRename = "rename"
+)
+
+// Op - выполненное изменение папки
+type Op struct {
+	Kind string
+	// SteamID файла и новый SteamID для переименования
+	SteamID    string
+	NewSteamID string
+}
+
+// Rates - частота изменений каждого вида, операций в секунду
+type Rates struct {
+	Create float64
+	Write  float64
+	Delete float64
+	Rename float64
+}
+
+func (r Rates) total() float64 {
+	return r.Create + r.Write + r.Delete + r.Rename
+}
+
+// Options - параметры симуляции
+type Options struct {
+	Dir string
+	// Число игроков, сохранения которых создаются перед началом изменений
+	Players  int
+	Rates    Rates
+	Duration time.Duration
+	Seed     int64
+	// Писать сохранение в два приема с паузой, как игра на медленном диске
+	PartialWrites bool
+}
+
+// Stats - число выполненных изменений по видам
+type Stats struct {
+	Created, Written, Deleted, Renamed int
+}
+
+func (s Stats) Total() int {
+	return s.Created + s.Written + s.Deleted + s.Renamed
+}
+
+// Simulator меняет файлы игроков в папке Dir
+type Simulator struct {
+	opts    Options
+	rng     *rand.Rand
+	players map[string]bool
+	nextID  uint64
+	stats   Stats
+}
+
+func New(opts Options) *Simulator {
+	return &Simulator{
+		opts:    opts,
+		rng:     rand.New(rand.NewSource(opts.Seed)),
+		players: make(map[string]bool),
+		nextID:  uint64(opts.Seed%1000000) * 1000,
+	}
+}
+
+// SteamID формирует SteamID64 игрока по порядковому номеру
+func SteamID(n uint64) string {
+	return fmt.Sprintf("7656119%010d", 8000000000+n%1000000000)
+}
+
+// Players возвращает SteamID игроков, файлы которых сейчас существуют
+func (s *Simulator) Players() []string {
+	ids := make([]string, 0, len(s.players))
+	for id := range s.players {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Path возвращает путь к файлу игрока
+func (s *Simulator) Path(steamID string) string {
+	return filepath.Join(s.opts.Dir, steamID+".json")
+}
+
+// Populate создает сохранения начальных игроков
+func (s *Simulator) Populate() error {
+	for i := 0; i < s.opts.Players; i++ {
+		if _, err := s.apply(OpCreate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step выполняет одно случайное изменение с вероятностью по частотам
+func (s *Simulator) Step() (Op, error) {
+	r := s.opts.Rates
+	pick := s.rng.Float64() * r.total()
+	kind := OpRename
+	switch {
+	case pick < r.Create:
+		kind = OpCreate
+	case pick < r.Create+r.Write:
+		kind = OpWrite
+	case pick < r.Create+r.Write+r.Delete:
+		kind = OpDelete
+	}
+	return s.apply(kind)
+}
+
+// Run создает начальных игроков и меняет файлы с заданной частотой,
+// пока не истечет Duration или не отменен контекст
+func (s *Simulator) Run(ctx context.Context, onOp func(Op)) (Stats, error) {
+	if s.opts.Rates.total() <= 0 {
+		return s.stats, fmt.Errorf("at least one rate must be positive")
+	}
+	if err := os.MkdirAll(s.opts.Dir, 0755); err != nil {
+		return s.stats, err
+	}
+	if err := s.Populate(); err != nil {
+		return s.stats, err
+	}
+
+	interval := time.Duration(float64(time.Second) / s.opts.Rates.total())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.After(s.opts.Duration)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return s.stats, nil
+		case <-deadline:
+			return s.stats, nil
+		case <-ticker.C:
+			op, err := s.Step()
+			if err != nil {
+				return s.stats, err
+			}
+			if onOp != nil {
+				onOp(op)
+			}
+		}
+	}
+}
+
+func (s *Simulator) apply(kind string) (Op, error) {
+	// Менять нечего - создаем нового игрока
+	if len(s.players) == 0 {
+		kind = OpCreate
+	}
+
+	switch kind {
+	case OpCreate:
+		id := s.newSteamID()
+		if err := s.writeSave(id); err != nil {
+			return Op{}, err
+		}
+		s.players[id] = true
+		s.stats.Created++
+		return Op{Kind: OpCreate, SteamID: id}, nil
+
+	case OpWrite:
+		id := s.randomPlayer()
+		if err := s.writeSave(id); err != nil {
+			return Op{}, err
+		}
+		s.stats.Written++
+		return Op{Kind: OpWrite, SteamID: id}, nil
+
+	case OpDelete:
+		id := s.randomPlayer()
+		if err := os.Remove(s.Path(id)); err != nil {
+			return Op{}, err
+		}
+		delete(s.players, id)
+		s.stats.Deleted++
+		return Op{Kind: OpDelete, SteamID: id}, nil
+
+	default:
+		id, newID := s.randomPlayer(), s.newSteamID()
+		if err := os.Rename(s.Path(id), s.Path(newID)); err != nil {
+			return Op{}, err
+		}
+		delete(s.players, id)
+		s.players[newID] = true
+		s.stats.Renamed++
+		return Op{Kind: OpRename, SteamID: id, NewSteamID: newID}, nil
+	}
+}
+
+func (s *Simulator) newSteamID() string {
+	s.nextID++
+	return SteamID(s.nextID)
+}
+
+func (s *Simulator) randomPlayer() string {
+	ids := s.Players()
+	return ids[s.rng.Intn(len(ids))]
+}
+
+// writeSave записывает новое сохранение игрока на место старого
+func (s *Simulator) writeSave(steamID string) error {
+	data := Save(s.rng)
+	if !s.opts.PartialWrites {
+		return os.WriteFile(s.Path(steamID), data, 0644)
+	}
+
+	f, err := os.Create(s.Path(steamID))
+	if err != nil {
+		return err
+	}
+	half := len(data) / 2
+	if _, err := f.Write(data[:half]); err != nil {
+		f.Close()
+		return err
+	}
+	time.Sleep(time.Duration(5+s.rng.Intn(20)) * time.Millisecond)
+	if _, err := f.Write(data[half:]); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Классы динозавров Evrima
+var characterClasses = []string{
+	"Carnotaurus", "Ceratosaurus", "Deinosuchus", "Dilophosaurus", "Herrerasaurus",
+	"Omniraptor", "Pteranodon", "Troodon", "Beipiaosaurus", "Gallimimus",
+	"Diabloceratops", "Dryosaurus", "Hypsilophodon", "Maiasaura", "Pachycephalosaurus",
+	"Stegosaurus", "Tenontosaurus", "Tyrannosaurus", "Allosaurus", "Triceratops",
+}
+
+// Save генерирует сохранение игрока в формате папки Players
+func Save(rng *rand.Rand) []byte {
+	class := characterClasses[rng.Intn(len(characterClasses))]
+	vector := func(scale float64) string {
+		return fmt.Sprintf("X=%.3f Y=%.3f Z=%.3f",
+			(rng.Float64()*2-1)*scale, (rng.Float64()*2-1)*scale, rng.Float64()*scale/10)
+	}
+
+	skin := make(map[string]int)
+	for i := 1; i <= 6; i++ {
+		skin[fmt.Sprintf("SkinPaletteSection%d", i)] = rng.Intn(255)
+	}
+
+	save := map[string]interface{}{
+		"CharacterClass":         class,
+		"DNA":                    "",
+		"Location_Isle_V3":       vector(500000),
+		"Rotation_Isle_V3":       fmt.Sprintf("P=0.000000 Y=%.6f R=0.000000", rng.Float64()*360-180),
+		"CameraRotation_Isle_V3": fmt.Sprintf("P=%.6f Y=%.6f R=0.000000", rng.Float64()*60-30, rng.Float64()*360-180),
+		"CameraDistance_Isle_V3": fmt.Sprintf("%.6f", 200+rng.Float64()*800),
+		"Growth":                 fmt.Sprintf("%.6f", rng.Float64()),
+		"Hunger":                 fmt.Sprintf("%.6f", rng.Float64()*100),
+		"Thirst":                 fmt.Sprintf("%.6f", rng.Float64()*100),
+		"Stamina":                fmt.Sprintf("%.6f", rng.Float64()*100),
+		"Health":                 fmt.Sprintf("%.6f", 100+rng.Float64()*4900),
+		"BleedingRate":           fmt.Sprintf("%.6f", rng.Float64()*0.1),
+		"Oxygen":                 fmt.Sprintf("%d", 40+rng.Intn(60)),
+		"bGender":                rng.Intn(2) == 1,
+		"bIsResting":             rng.Intn(4) == 0,
+		"bBrokenLegs":            rng.Intn(20) == 0,
+		"ProgressPoints":         fmt.Sprintf("%d", rng.Intn(5000)),
+		"MarksTemp":              fmt.Sprintf("%d", rng.Intn(20000)),
+		"UnlockedCharacters":     "",
+		"SkinPalette":            skin,
+		"SkinPaletteVariation":   fmt.Sprintf("%d.000000", rng.Intn(5)),
+	}
+
+	data, _ := json.MarshalIndent(save, "", "\t")
+	return data
+}
@@ -0,0 +1,115 @@
+package simulate
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveLooksLikeEvrimaSave(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var save map[string]interface{}
+	if err := json.Unmarshal(Save(rng), &save); err != nil {
+		t.Fatalf("save is not valid JSON: %v", err)
+	}
+	for _, key := range []string{"CharacterClass", "Location_Isle_V3", "Growth", "Health", "bGender"} {
+		if _, ok := save[key]; !ok {
+			t.Errorf("save has no %s", key)
+		}
+	}
+}
+
+// listPlayers возвращает SteamID файлов в папке
+func listPlayers(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, strings.TrimSuffix(e.Name(), ".json"))
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func runSteps(t *testing.T, opts Options, steps int) (*Simulator, []Op) {
+	t.Helper()
+	sim := New(opts)
+	if err := sim.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	var ops []Op
+	for i := 0; i < steps; i++ {
+		op, err := sim.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ops = append(ops, op)
+	}
+	return sim, ops
+}
+
+// С одним seed симуляция повторяется, а папка совпадает с учетом симулятора
+func TestStepsAreDeterministic(t *testing.T) {
+	opts := Options{Players: 10, Rates: Rates{Create: 1, Write: 5, Delete: 1, Rename: 1}, Seed: 42}
+
+	opts.Dir = t.TempDir()
+	first, firstOps := runSteps(t, opts, 200)
+	opts.Dir = t.TempDir()
+	second, secondOps := runSteps(t, opts, 200)
+
+	if !reflect.DeepEqual(firstOps, secondOps) {
+		t.Fatal("same seed produced different operations")
+	}
+	if !reflect.DeepEqual(first.Players(), second.Players()) {
+		t.Fatal("same seed produced different players")
+	}
+	if got := listPlayers(t, opts.Dir); !reflect.DeepEqual(got, second.Players()) {
+		t.Fatalf("directory has %v, simulator tracks %v", got, second.Players())
+	}
+
+	kinds := make(map[string]int)
+	for _, op := range firstOps {
+		kinds[op.Kind]++
+	}
+	for _, kind := range []string{OpCreate, OpWrite, OpDelete, OpRename} {
+		if kinds[kind] == 0 {
+			t.Errorf("no %s operations in 200 steps", kind)
+		}
+	}
+}
+
+func TestRunRespectsDuration(t *testing.T) {
+	sim := New(Options{
+		Dir:           filepath.Join(t.TempDir(), "Players"),
+		Players:       3,
+		Rates:         Rates{Write: 100},
+		Duration:      200 * time.Millisecond,
+		Seed:          7,
+		PartialWrites: true,
+	})
+
+	var ops int
+	stats, err := sim.Run(context.Background(), func(Op) { ops++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Created != 3 || stats.Written == 0 || stats.Written != ops {
+		t.Fatalf("stats = %+v, callbacks = %d", stats, ops)
+	}
+}
+
+func TestRunRequiresRates(t *testing.T) {
+	if _, err := New(Options{Dir: t.TempDir()}).Run(context.Background(), nil); err == nil {
+		t.Fatal("expected error without rates")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-ws/simulate"
+)
+
+// runSimulate - команда agent-ws simulate: генерирует сохранения игроков и
+// меняет их с заданной частотой в тестовой папке, за которой следит агент
+func runSimulate(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	dir := fs.String("dir", "", "directory to write simulated player saves to (required)")
+	players := fs.Int("players", 50, "number of players created before churn starts")
+	duration := fs.Duration("duration", time.Minute, "how long to churn files")
+	create := fs.Float64("create", 0.5, "file creates per second")
+	write := fs.Float64("write", 5, "file rewrites per second")
+	remove := fs.Float64("delete", 0.2, "file deletes per second")
+	rename := fs.Float64("rename", 0.1, "file renames per second")
+	seed := fs.Int64("seed", 0, "random seed (0 - current time)")
+	partial := fs.Bool("partial-writes", false, "write saves in two parts with a pause")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *dir == "" {
+		fmt.Println("--dir is required")
+		return 2
+	}
+	// Симуляция удаляет и переименовывает файлы - не даем направить ее
+	// в настоящую папку сервера
+	for _, t := range append(defaultWatchTargets(), cfg.WatchTargets...) {
+		if strings.EqualFold(filepath.Clean(*dir), filepath.Clean(t.Path)) {
+			fmt.Printf("Refusing to simulate in %s: it is a real watch path\n", *dir)
+			return 2
+		}
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+
+	sim := simulate.New(simulate.Options{
+		Dir:     *dir,
+		Players: *players,
+		Rates: simulate.Rates{
+			Create: *create,
+			Write:  *write,
+			Delete: *remove,
+			Rename: *rename,
+		},
+		Duration:      *duration,
+		Seed:          *seed,
+		PartialWrites: *partial,
+	})
+
+	fmt.Printf("Simulating %d players in %s for %v (seed %d)\n", *players, *dir, *duration, *seed)
+	start := time.Now()
+	stats, err := sim.Run(ctx, nil)
+	elapsed := time.Since(start)
+	fmt.Printf("Created: %d, rewritten: %d, deleted: %d, renamed: %d, players now: %d\n",
+		stats.Created, stats.Written, stats.Deleted, stats.Renamed, len(sim.Players()))
+	fmt.Printf("%d operations in %v (%.1f ops/s)\n", stats.Total(), elapsed.Round(time.Millisecond),
+		float64(stats.Total())/elapsed.Seconds())
+	if err != nil {
+		fmt.Println("Simulation stopped with error:", err)
+		return 1
+	}
+	return 0
+}
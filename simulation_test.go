@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"agent-ws/simulate"
+	"agent-ws/watcher"
+)
+
+// Случайная смена файлов на настоящем watcher: после затишья последнее
+// состояние каждого игрока на стороне API совпадает с папкой
+func TestSimulatedChurnConverges(t *testing.T) {
+	if testing.Short() {
+		t.Skip("simulated churn uses the real file watcher")
+	}
+
+	a := newTestAgent(t)
+	// Bounded-режим сливает события файла, иначе каждое событие ждет чтения
+	cfg.MemoryProfile = memoryProfileBounded
+	pendingEvents = newEventQueue(cfg.MaxPendingEvents)
+	t.Cleanup(func() { pendingEvents = nil })
+	fileWatcher.Close()
+	deps.Watch = watcher.New
+	if err := startWatcher(); err != nil {
+		t.Fatal(err)
+	}
+	a.run(t)
+
+	sim := simulate.New(simulate.Options{
+		Dir:     a.dir,
+		Players: 5,
+		Rates:   simulate.Rates{Create: 1, Write: 6, Delete: 1, Rename: 1},
+		Seed:    1,
+	})
+	if err := sim.Populate(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 40; i++ {
+		if _, err := sim.Step(); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Последние данные каждого игрока по событиям API
+	players := make(map[string]string)
+	for quiet := time.After(5 * time.Second); ; {
+		select {
+		case ev := <-a.received:
+			switch ev.Event {
+			case "add-dino-data", "change-dino-data":
+				players[ev.SteamID64] = string(ev.Data)
+			case "delete-dino-data":
+				delete(players, ev.SteamID64)
+			}
+			quiet = time.After(5 * time.Second)
+			continue
+		case <-quiet:
+		}
+		break
+	}
+
+	got := make([]string, 0, len(players))
+	for steamID := range players {
+		got = append(got, steamID)
+	}
+	sort.Strings(got)
+	if want := sim.Players(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("API knows players %v, directory has %v", got, want)
+	}
+	for steamID, data := range players {
+		content, err := os.ReadFile(sim.Path(steamID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Агент отправляет JSON без пробелов
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, content); err != nil {
+			t.Fatal(err)
+		}
+		if compact.String() != data {
+			t.Errorf("API has stale data for SteamID %s", steamID)
+		}
+	}
+}
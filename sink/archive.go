@@ -0,0 +1,174 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("archive", func(config json.RawMessage) (Sink, error) {
+		c := ArchiveConfig{MaxSizeMB: 100, MaxFiles: 10}
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewArchive(c)
+	})
+}
+
+// Исходы доставки, записываемые в архив
+const (
+	OutcomeDelivered = "delivered"
+	OutcomeFailed    = "failed"
+	OutcomeQueued    = "queued"
+	OutcomeDropped   = "dropped"
+	OutcomeRejected  = "rejected"
+	OutcomeDryRun    = "dry-run"
+)
+
+// Recorder - sink, который записывает каждое событие вместе с исходом его
+// доставки. Агент вызывает Record вместо Send после доставки в остальные sink.
+type Recorder interface {
+	Record(ev Event, outcome, detail string) error
+}
+
+// ArchiveConfig - локальный архив событий в формате JSONL
+type ArchiveConfig struct {
+	Dir string `json:"dir"`
+	// Размер файла, после которого начинается новый, и число хранимых старых файлов
+	MaxSizeMB int `json:"max_size_mb"`
+	MaxFiles  int `json:"max_files"`
+}
+
+// ArchiveRecord - строка архива
+type ArchiveRecord struct {
+	Time    time.Time `json:"time"`
+	Outcome string    `json:"outcome"`
+	Detail  string    `json:"detail,omitempty"`
+	Event   Event     `json:"event"`
+}
+
+// Имя текущего файла архива; старые файлы получают метку времени ротации
+const archiveCurrent = "events.jsonl"
+
+// Archive дописывает события в events.jsonl и ротирует файл по размеру
+type Archive struct {
+	mu     sync.Mutex
+	config ArchiveConfig
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+}
+
+func NewArchive(c ArchiveConfig) (*Archive, error) {
+	if c.Dir == "" {
+		return nil, fmt.Errorf("dir is required")
+	}
+	if c.MaxSizeMB <= 0 || c.MaxFiles < 0 {
+		return nil, fmt.Errorf("max_size_mb must be positive and max_files must not be negative")
+	}
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("create archive dir: %v", err)
+	}
+
+	a := &Archive{config: c}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Archive) open() error {
+	f, err := os.OpenFile(filepath.Join(a.config.Dir, archiveCurrent), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open archive: %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file, a.writer, a.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+func (a *Archive) Send(_ context.Context, ev Event) error {
+	return a.Record(ev, OutcomeDelivered, "")
+}
+
+func (a *Archive) Record(ev Event, outcome, detail string) error {
+	line, err := json.Marshal(ArchiveRecord{Time: time.Now().UTC(), Outcome: outcome, Detail: detail, Event: ev})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.size+int64(len(line)) > int64(a.config.MaxSizeMB)*1024*1024 && a.size > 0 {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := a.writer.Write(line); err != nil {
+		return err
+	}
+	a.size += int64(len(line))
+	return a.writer.Flush()
+}
+
+// rotate переименовывает текущий файл и удаляет самые старые архивы сверх лимита
+func (a *Archive) rotate() error {
+	a.writer.Flush()
+	a.file.Close()
+
+	current := filepath.Join(a.config.Dir, archiveCurrent)
+	rotated := filepath.Join(a.config.Dir, "events-"+time.Now().UTC().Format("20060102T150405.000000000")+".jsonl")
+	if err := os.Rename(current, rotated); err != nil {
+		return fmt.Errorf("rotate archive: %v", err)
+	}
+
+	old, err := ArchiveFiles(a.config.Dir)
+	if err == nil {
+		// Последний в списке - новый текущий файл, его не считаем
+		old = old[:len(old)-1]
+		for len(old) > a.config.MaxFiles {
+			os.Remove(old[0])
+			old = old[1:]
+		}
+	}
+	return a.open()
+}
+
+func (a *Archive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.writer.Flush()
+	return a.file.Close()
+}
+
+// ArchiveFiles возвращает файлы архива от старых к новым
+func ArchiveFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "events-") && strings.HasSuffix(name, ".jsonl") {
+			rotated = append(rotated, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(rotated)
+	return append(rotated, filepath.Join(dir, archiveCurrent)), nil
+}
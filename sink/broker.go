@@ -0,0 +1,176 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+func init() {
+	Register("kafka", func(config json.RawMessage) (Sink, error) {
+		var c BrokerConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewKafka(c)
+	})
+	Register("nats", func(config json.RawMessage) (Sink, error) {
+		var c BrokerConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewNATS(c)
+	})
+}
+
+// BrokerConfig - отправка событий в Kafka или NATS
+type BrokerConfig struct {
+	// Адреса брокеров: host:9092 для Kafka, nats://host:4222 для NATS
+	Brokers []string `json:"brokers"`
+	// Топик Kafka или префикс subject NATS
+	Topic    string `json:"topic"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// NATS: публиковать через JetStream и ждать подтверждения сохранения
+	JetStream bool `json:"jetstream"`
+}
+
+func (c BrokerConfig) validate() error {
+	if len(c.Brokers) == 0 || c.Topic == "" {
+		return fmt.Errorf("brokers and topic are required")
+	}
+	return nil
+}
+
+// Kafka пишет события с ключом SteamID, поэтому все события игрока
+// попадают в одну партицию и читаются по порядку
+type Kafka struct {
+	writer   *kafka.Writer
+	template *Template
+}
+
+func NewKafka(c BrokerConfig) (*Kafka, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(c.Brokers...),
+		Topic:        c.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		WriteTimeout: defaultTimeout,
+		MaxAttempts:  1,
+	}
+	if c.Username != "" {
+		writer.Transport = &kafka.Transport{
+			SASL: plain.Mechanism{Username: c.Username, Password: c.Password},
+		}
+	}
+	return &Kafka{writer: writer}, nil
+}
+
+func (s *Kafka) SetTemplate(t *Template) {
+	s.template = t
+}
+
+func (s *Kafka) Send(ctx context.Context, ev Event) error {
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(ev.SteamID64),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "event_id", Value: []byte(ev.EventID)},
+			{Key: "event", Value: []byte(ev.Event)},
+		},
+	})
+}
+
+func (s *Kafka) Close() error {
+	return s.writer.Close()
+}
+
+// NATS публикует события в subject <topic>.<steamid64>
+type NATS struct {
+	topic    string
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+	template *Template
+}
+
+func NewNATS(c BrokerConfig) (*NATS, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+
+	opts := []nats.Option{
+		nats.Name("agent-ws"),
+		nats.Timeout(10 * time.Second),
+		nats.MaxReconnects(-1),
+	}
+	if c.Username != "" {
+		opts = append(opts, nats.UserInfo(c.Username, c.Password))
+	}
+
+	conn, err := nats.Connect(strings.Join(c.Brokers, ","), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %v", err)
+	}
+
+	s := &NATS{topic: c.Topic, conn: conn}
+	if c.JetStream {
+		if s.js, err = conn.JetStream(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats jetstream: %v", err)
+		}
+	}
+	return s, nil
+}
+
+func (s *NATS) SetTemplate(t *Template) {
+	s.template = t
+}
+
+func (s *NATS) Send(ctx context.Context, ev Event) error {
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+
+	subject := s.topic
+	if ev.SteamID64 != "" {
+		subject += "." + ev.SteamID64
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if s.js != nil {
+		// JetStream отбрасывает дубли по Nats-Msg-Id при повторной доставке
+		_, err := s.js.Publish(subject, payload, nats.MsgId(ev.EventID), nats.Context(ctx))
+		return err
+	}
+
+	if err := s.conn.Publish(subject, payload); err != nil {
+		return err
+	}
+	// Без JetStream подтверждением служит получение сообщения сервером
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *NATS) Close() error {
+	s.conn.Close()
+	return nil
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
+
+func init() {
+	Register("database", func(config json.RawMessage) (Sink, error) {
+		var c DatabaseConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewDatabase(c)
+	})
+}
+
+// DatabaseConfig - запись событий напрямую в таблицу MySQL/PostgreSQL
+type DatabaseConfig struct {
+	// mysql или postgres
+	Driver string `json:"driver"`
+	// Строка подключения драйвера
+	DSN   string `json:"dsn"`
+	Table string `json:"table"`
+	// Колонка таблицы -> поле события: steamid64, type, event, data, event_id,
+	// sequence, agent_id, server_name, map_name, created_at.
+	// По умолчанию каждое поле пишется в одноименную колонку.
+	Columns map[string]string `json:"columns"`
+}
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// eventColumns - поля события, доступные для записи в таблицу
+var eventColumns = map[string]func(Event) interface{}{
+	"steamid64":   func(e Event) interface{} { return e.SteamID64 },
+	"type":        func(e Event) interface{} { return e.Type },
+	"event":       func(e Event) interface{} { return e.Event },
+	"data":        func(e Event) interface{} { return string(e.Data) },
+	"event_id":    func(e Event) interface{} { return e.EventID },
+	"sequence":    func(e Event) interface{} { return int64(e.Sequence) },
+	"agent_id":    func(e Event) interface{} { return e.AgentID },
+	"server_name": func(e Event) interface{} { return e.ServerName },
+	"map_name":    func(e Event) interface{} { return e.MapName },
+	"created_at":  func(e Event) interface{} { return time.Now().UTC() },
+}
+
+// Database пишет каждое событие отдельной строкой. Для защиты от дублей
+// при повторной доставке на колонке event_id стоит держать уникальный индекс.
+type Database struct {
+	db     *sql.DB
+	query  string
+	fields []string
+}
+
+func NewDatabase(c DatabaseConfig) (*Database, error) {
+	var driver string
+	switch c.Driver {
+	case "mysql":
+		driver = "mysql"
+	case "postgres", "postgresql":
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unknown driver %q", c.Driver)
+	}
+	if c.DSN == "" {
+		return nil, fmt.Errorf("dsn is required")
+	}
+	if !sqlIdentifier.MatchString(c.Table) {
+		return nil, fmt.Errorf("invalid table name %q", c.Table)
+	}
+
+	mapping := c.Columns
+	if len(mapping) == 0 {
+		mapping = make(map[string]string)
+		for _, field := range []string{"steamid64", "type", "event", "data", "event_id", "sequence"} {
+			mapping[field] = field
+		}
+	}
+
+	columns := make([]string, 0, len(mapping))
+	for column := range mapping {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	s := &Database{}
+	quoted := make([]string, 0, len(columns))
+	placeholders := make([]string, 0, len(columns))
+	for i, column := range columns {
+		field := mapping[column]
+		if _, ok := eventColumns[field]; !ok {
+			return nil, fmt.Errorf("column %s: unknown event field %q", column, field)
+		}
+		if !sqlIdentifier.MatchString(column) {
+			return nil, fmt.Errorf("invalid column name %q", column)
+		}
+		s.fields = append(s.fields, field)
+		quoted = append(quoted, quoteIdentifier(driver, column))
+		if driver == "postgres" {
+			placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		} else {
+			placeholders = append(placeholders, "?")
+		}
+	}
+	s.query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdentifier(driver, c.Table), strings.Join(quoted, ", "), strings.Join(placeholders, ", "))
+
+	db, err := sql.Open(driver, c.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(2)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	// Соединение открывается при первой записи: недоступная при запуске
+	// база не должна останавливать агента
+	s.db = db
+	return s, nil
+}
+
+func (s *Database) Ping(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+func quoteIdentifier(driver, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if driver == "mysql" {
+			parts[i] = "`" + part + "`"
+		} else {
+			parts[i] = `"` + part + `"`
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+func (s *Database) Send(ctx context.Context, ev Event) error {
+	args := make([]interface{}, len(s.fields))
+	for i, field := range s.fields {
+		args[i] = eventColumns[field](ev)
+	}
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	_, err := s.db.ExecContext(ctx, s.query, args...)
+	return err
+}
+
+func (s *Database) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,63 @@
+package sink
+
+import "encoding/json"
+
+// Position - позиция игрока: X и Y - координаты на изображении карты
+// от 0 до 1 от левого верхнего угла, World* - координаты из сохранения
+type Position struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	WorldX float64 `json:"world_x"`
+	WorldY float64 `json:"world_y"`
+	WorldZ float64 `json:"world_z"`
+}
+
+// Event - событие агента, как оно отправляется получателям
+type Event struct {
+	SteamID64 string `json:"steamid64"`
+	// Прежний SteamID - для события переноса сохранения на другой аккаунт
+	OldSteamID64 string `json:"old_steamid64,omitempty"`
+	Type         string `json:"type"`
+	Event        string `json:"event"`
+	// Корректный JSON встраивается как есть, остальное - JSON-строкой
+	Data json.RawMessage `json:"data"`
+
+	// Идентификатор события (одинаковый для всех попыток доставки)
+	// и номер события в рамках SteamID
+	EventID  string `json:"event_id"`
+	Sequence uint64 `json:"sequence"`
+
+	// Операция с файлом (add, change, delete), время события и хэши
+	// текущего и предыдущего содержимого - для схемы события v2
+	Op           string `json:"op,omitempty"`
+	OccurredAt   string `json:"occurred_at,omitempty"`
+	ContentHash  string `json:"content_hash,omitempty"`
+	PreviousHash string `json:"previous_hash,omitempty"`
+
+	// Событие отправлено повторно командой replay под новым event_id;
+	// replay_of - event_id исходного события
+	Replayed bool   `json:"replayed,omitempty"`
+	ReplayOf string `json:"replay_of,omitempty"`
+
+	// Поле data зашифровано общим с панелью ключом
+	Encrypted bool `json:"encrypted,omitempty"`
+
+	// Агент и игровой сервер, с которого пришло событие
+	AgentID    string `json:"agent_id,omitempty"`
+	ServerName string `json:"server_name,omitempty"`
+	MapName    string `json:"map_name,omitempty"`
+	// Экземпляр сервера, если агент обслуживает несколько серверов
+	Instance string `json:"instance,omitempty"`
+
+	// Позиция игрока на карте, если для карты задана калибровка
+	Position *Position `json:"position,omitempty"`
+
+	// Заполняются только для payload, превысивших лимит размера
+	Truncated    bool   `json:"truncated,omitempty"`
+	OriginalSize int    `json:"original_size,omitempty"`
+	ChunkID      string `json:"chunk_id,omitempty"`
+	// Идентификатор исходного события: у каждой части свой event_id
+	ParentEventID string `json:"parent_event_id,omitempty"`
+	ChunkIndex    int    `json:"chunk_index,omitempty"`
+	ChunkTotal    int    `json:"chunk_total,omitempty"`
+}
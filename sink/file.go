@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+func init() {
+	Register("file", func(config json.RawMessage) (Sink, error) {
+		var c FileConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewFile(c)
+	})
+}
+
+// FileConfig - запись событий в файл, по строке на событие
+type FileConfig struct {
+	Path string `json:"path"`
+	// Сбрасывать файл на диск после каждого события
+	Sync bool `json:"sync"`
+}
+
+// File дописывает события в файл для внешних обработчиков. В отличие от
+// архива пишет только доставляемые события и поддерживает шаблоны тела.
+type File struct {
+	mu   sync.Mutex
+	file *os.File
+	sync bool
+	// Шаблон тела события (nil - стандартный JSON)
+	template *Template
+}
+
+func NewFile(c FileConfig) (*File, error) {
+	if c.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return nil, fmt.Errorf("create dir: %v", err)
+	}
+	f, err := os.OpenFile(c.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open file: %v", err)
+	}
+	return &File{file: f, sync: c.Sync}, nil
+}
+
+func (s *File) SetTemplate(t *Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.template = t
+}
+
+func (s *File) Send(_ context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(payload, '\n')); err != nil {
+		return fmt.Errorf("file write: %v", err)
+	}
+	if s.sync {
+		if err := s.file.Sync(); err != nil {
+			return fmt.Errorf("file sync: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *File) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,403 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("mqtt", func(config json.RawMessage) (Sink, error) {
+		var c MQTTConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewMQTT(c)
+	})
+}
+
+// Шаблон топика по умолчанию
+const defaultMQTTTopic = "evrima/{server}/{steamid}/{event}"
+
+// MQTTConfig - публикация событий в MQTT-брокер (Mosquitto и подобные)
+type MQTTConfig struct {
+	// Адрес брокера, например 127.0.0.1:1883 (8883 для TLS)
+	Address  string `json:"address"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Идентификатор клиента (по умолчанию agent-ws-<имя хоста>)
+	ClientID string `json:"client_id"`
+	// Шаблон топика: {server}, {steamid}, {event}, {type}, {instance}, {agent}
+	Topic string `json:"topic"`
+	// QoS публикации: 0 - без подтверждения, 1 - хотя бы раз, 2 - ровно один раз
+	QoS    int  `json:"qos"`
+	Retain bool `json:"retain"`
+
+	// Подключение по TLS; ca_file - PEM с корневыми сертификатами брокера
+	TLS                bool   `json:"tls"`
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+func (c MQTTConfig) validate() error {
+	if c.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+	if c.QoS < 0 || c.QoS > 2 {
+		return fmt.Errorf("qos must be 0, 1 or 2")
+	}
+	if strings.ContainsAny(c.Topic, "+#") {
+		return fmt.Errorf("topic must not contain wildcards + or #")
+	}
+	return nil
+}
+
+// Типы пакетов MQTT 3.1.1
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttPubrec     = 0x50
+	mqttPubrel     = 0x62
+	mqttPubcomp    = 0x70
+	mqttDisconnect = 0xE0
+)
+
+// MQTT публикует события по протоколу MQTT 3.1.1. Соединение держится
+// открытым и пересоздается при следующей отправке после ошибки.
+type MQTT struct {
+	mu       sync.Mutex
+	config   MQTTConfig
+	tls      *tls.Config
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	// Шаблон тела события (nil - стандартный JSON)
+	template *Template
+}
+
+func NewMQTT(c MQTTConfig) (*MQTT, error) {
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	if c.Topic == "" {
+		c.Topic = defaultMQTTTopic
+	}
+	if c.ClientID == "" {
+		host, _ := os.Hostname()
+		c.ClientID = "agent-ws-" + host
+	}
+
+	s := &MQTT{config: c}
+	if c.TLS {
+		tlsConfig, err := mqttTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		s.tls = tlsConfig
+	}
+
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func mqttTLSConfig(c MQTTConfig) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address: %v", err)
+	}
+	tlsConfig := &tls.Config{ServerName: host, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+func (s *MQTT) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("mqtt connect: %v", err)
+	}
+	if s.tls != nil {
+		tlsConn := tls.Client(conn, s.tls)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("mqtt tls: %v", err)
+		}
+		conn = tlsConn
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	// Чистая сессия без keepalive: брокер не хранит состояние между
+	// подключениями, неотправленные события остаются в очереди агента
+	var body []byte
+	body = appendMQTTString(body, "MQTT")
+	flags := byte(0x02)
+	if s.config.Username != "" {
+		flags |= 0x80
+		if s.config.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, 4, flags, 0, 0)
+	body = appendMQTTString(body, s.config.ClientID)
+	if s.config.Username != "" {
+		body = appendMQTTString(body, s.config.Username)
+		if s.config.Password != "" {
+			body = appendMQTTString(body, s.config.Password)
+		}
+	}
+
+	if err := s.write(ctx, mqttConnect, body); err != nil {
+		s.closeConn()
+		return fmt.Errorf("mqtt connect: %v", err)
+	}
+	packet, reply, err := s.read()
+	if err != nil {
+		s.closeConn()
+		return fmt.Errorf("mqtt connack: %v", err)
+	}
+	if packet != mqttConnack || len(reply) != 2 {
+		s.closeConn()
+		return fmt.Errorf("mqtt connack: unexpected packet 0x%02x", packet)
+	}
+	if reply[1] != 0 {
+		s.closeConn()
+		return fmt.Errorf("mqtt connect refused: %s", mqttConnackReason(reply[1]))
+	}
+	return nil
+}
+
+func mqttConnackReason(code byte) string {
+	switch code {
+	case 1:
+		return "unacceptable protocol version"
+	case 2:
+		return "client identifier rejected"
+	case 3:
+		return "server unavailable"
+	case 4:
+		return "bad user name or password"
+	case 5:
+		return "not authorized"
+	}
+	return fmt.Sprintf("code %d", code)
+}
+
+func (s *MQTT) SetTemplate(t *Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.template = t
+}
+
+func (s *MQTT) Send(ctx context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+
+	if err := s.publish(ctx, mqttTopic(s.config.Topic, ev), payload); err != nil {
+		s.closeConn()
+		return fmt.Errorf("mqtt publish: %v", err)
+	}
+	return nil
+}
+
+// publish отправляет PUBLISH и при QoS 1 и 2 дожидается подтверждения брокера
+func (s *MQTT) publish(ctx context.Context, topic string, payload []byte) error {
+	header := byte(mqttPublish) | byte(s.config.QoS)<<1
+	if s.config.Retain {
+		header |= 0x01
+	}
+
+	body := appendMQTTString(nil, topic)
+	var id uint16
+	if s.config.QoS > 0 {
+		id = s.nextPacketID()
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+
+	if err := s.write(ctx, header, body); err != nil {
+		return err
+	}
+
+	switch s.config.QoS {
+	case 1:
+		return s.expect(mqttPuback, id)
+	case 2:
+		if err := s.expect(mqttPubrec, id); err != nil {
+			return err
+		}
+		if err := s.write(ctx, mqttPubrel, binary.BigEndian.AppendUint16(nil, id)); err != nil {
+			return err
+		}
+		return s.expect(mqttPubcomp, id)
+	}
+	return nil
+}
+
+func (s *MQTT) nextPacketID() uint16 {
+	s.packetID++
+	if s.packetID == 0 {
+		s.packetID = 1
+	}
+	return s.packetID
+}
+
+// expect читает подтверждение публикации с нужным номером пакета
+func (s *MQTT) expect(packet byte, id uint16) error {
+	got, body, err := s.read()
+	if err != nil {
+		return err
+	}
+	if got&0xF0 != packet&0xF0 || len(body) != 2 {
+		return fmt.Errorf("unexpected packet 0x%02x", got)
+	}
+	if got := binary.BigEndian.Uint16(body); got != id {
+		return fmt.Errorf("acknowledgement for packet %d, expected %d", got, id)
+	}
+	return nil
+}
+
+func (s *MQTT) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.SetDeadline(time.Now().Add(time.Second))
+		s.conn.Write([]byte{mqttDisconnect, 0})
+	}
+	return s.closeConn()
+}
+
+func (s *MQTT) closeConn() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// write отправляет пакет: заголовок, оставшаяся длина и тело
+func (s *MQTT) write(ctx context.Context, header byte, body []byte) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+
+	packet := []byte{header}
+	// Оставшаяся длина - число переменной длины, по 7 бит на байт
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	_, err := s.conn.Write(append(packet, body...))
+	return err
+}
+
+func (s *MQTT) read() (byte, []byte, error) {
+	header, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, fmt.Errorf("invalid remaining length")
+		}
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttTopic подставляет поля события в шаблон топика. Символы / + # в
+// значениях заменяются, чтобы значение не меняло уровни топика.
+func mqttTopic(template string, ev Event) string {
+	server := ev.ServerName
+	if server == "" {
+		server = ev.AgentID
+	}
+	if server == "" {
+		server = "unknown"
+	}
+	value := func(v string) string {
+		if v == "" {
+			return "_"
+		}
+		return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(v)
+	}
+	return strings.NewReplacer(
+		"{server}", value(server),
+		"{steamid}", value(ev.SteamID64),
+		"{event}", value(ev.Event),
+		"{type}", value(ev.Type),
+		"{instance}", value(ev.Instance),
+		"{agent}", value(ev.AgentID),
+	).Replace(template)
+}
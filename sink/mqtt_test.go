@@ -0,0 +1,173 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMQTTTopic(t *testing.T) {
+	ev := Event{
+		SteamID64:  "76561198000000001",
+		Type:       "player",
+		Event:      "add-dino-data",
+		Instance:   "main",
+		AgentID:    "agent-1",
+		ServerName: "EU #1",
+	}
+	for _, tc := range []struct {
+		template string
+		ev       Event
+		want     string
+	}{
+		{defaultMQTTTopic, ev, "evrima/EU _1/76561198000000001/add-dino-data"},
+		{"{type}/{instance}/{agent}", ev, "player/main/agent-1"},
+		// Без имени сервера подставляется идентификатор агента
+		{"{server}", Event{AgentID: "agent-1"}, "agent-1"},
+		{"{server}", Event{}, "unknown"},
+		// Пустые значения и разделители не добавляют уровней топика
+		{"a/{steamid}/{event}", Event{Event: "x/y+z"}, "a/_/x_y_z"},
+	} {
+		if got := mqttTopic(tc.template, tc.ev); got != tc.want {
+			t.Errorf("mqttTopic(%q) = %q, want %q", tc.template, got, tc.want)
+		}
+	}
+}
+
+func TestMQTTConfigValidation(t *testing.T) {
+	for _, c := range []MQTTConfig{
+		{},
+		{Address: "127.0.0.1:1883", QoS: -1},
+		{Address: "127.0.0.1:1883", QoS: 3},
+		{Address: "127.0.0.1:1883", Topic: "evrima/+/{steamid}"},
+		{Address: "127.0.0.1:1883", Topic: "evrima/#"},
+	} {
+		if err := c.validate(); err == nil {
+			t.Errorf("config %+v: expected error", c)
+		}
+	}
+	for qos := 0; qos <= 2; qos++ {
+		if err := (MQTTConfig{Address: "127.0.0.1:1883", QoS: qos}).validate(); err != nil {
+			t.Errorf("qos %d: %v", qos, err)
+		}
+	}
+}
+
+func TestMQTTTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewTLSServer(nil)
+	server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := mqttTLSConfig(MQTTConfig{Address: "broker.example.com:8883", CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ServerName != "broker.example.com" || c.RootCAs == nil || c.InsecureSkipVerify {
+		t.Errorf("tls config = %+v", c)
+	}
+
+	for name, c := range map[string]MQTTConfig{
+		"address without port": {Address: "broker.example.com"},
+		"missing CA file":      {Address: "broker.example.com:8883", CAFile: filepath.Join(dir, "missing.pem")},
+		"CA file without PEM":  {Address: "broker.example.com:8883", CAFile: emptyFile},
+	} {
+		if _, err := mqttTLSConfig(c); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+// mqttBroker принимает одно подключение, подтверждает публикации по их QoS
+// и передает полученные пакеты PUBLISH в published
+func mqttBroker(t *testing.T, published chan<- []byte) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Пакеты сервера кодируются так же, как пакеты клиента
+		broker := &MQTT{conn: conn, reader: bufio.NewReader(conn)}
+		ctx := context.Background()
+		for {
+			header, body, err := broker.read()
+			if err != nil {
+				return
+			}
+			switch header & 0xF0 {
+			case mqttConnect:
+				broker.write(ctx, mqttConnack, []byte{0, 0})
+			case mqttPublish:
+				published <- append([]byte{header}, body...)
+				qos := header >> 1 & 0x03
+				if qos == 0 {
+					continue
+				}
+				topicLen := int(binary.BigEndian.Uint16(body))
+				id := body[2+topicLen : 4+topicLen]
+				if qos == 1 {
+					broker.write(ctx, mqttPuback, id)
+				} else {
+					broker.write(ctx, mqttPubrec, id)
+				}
+			case mqttPubrel & 0xF0:
+				broker.write(ctx, mqttPubcomp, body)
+			case mqttDisconnect:
+				return
+			}
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestMQTTPublishQoS(t *testing.T) {
+	for qos := 0; qos <= 2; qos++ {
+		published := make(chan []byte, 2)
+		s, err := NewMQTT(MQTTConfig{Address: mqttBroker(t, published), QoS: qos, Retain: true})
+		if err != nil {
+			t.Fatalf("qos %d: %v", qos, err)
+		}
+
+		// Две публикации подряд проверяют, что подтверждение первой дочитано
+		for _, id := range []string{"id-1", "id-2"} {
+			ev := Event{EventID: id, SteamID64: "76561198000000001", Event: "add-dino-data", ServerName: "eu", Data: json.RawMessage(`{}`)}
+			if err := s.Send(context.Background(), ev); err != nil {
+				t.Fatalf("qos %d, send %s: %v", qos, id, err)
+			}
+			packet := <-published
+			if got := int(packet[0] >> 1 & 0x03); got != qos || packet[0]&0x01 == 0 {
+				t.Errorf("qos %d: publish header 0x%02x", qos, packet[0])
+			}
+			topicLen := int(binary.BigEndian.Uint16(packet[1:]))
+			if topic := string(packet[3 : 3+topicLen]); topic != "evrima/eu/76561198000000001/add-dino-data" {
+				t.Errorf("qos %d: topic %q", qos, topic)
+			}
+			if !strings.Contains(string(packet), `"event_id":"`+id+`"`) {
+				t.Errorf("qos %d: payload %q does not carry %s", qos, packet, id)
+			}
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,148 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// proxyServer принимает одно соединение, открывает туннель к цели
+// функцией open и пересылает данные в обе стороны
+func proxyServer(t *testing.T, open func(conn net.Conn) (string, bool)) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		target, ok := open(conn)
+		if !ok {
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer upstream.Close()
+		go io.Copy(upstream, conn)
+		io.Copy(conn, upstream)
+	}()
+	return l.Addr().String()
+}
+
+// httpConnectProxy - HTTP-прокси с методом CONNECT и логином user:pass
+func httpConnectProxy(t *testing.T) string {
+	return proxyServer(t, func(conn net.Conn) (string, bool) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil || req.Method != http.MethodConnect {
+			t.Errorf("proxy got %v, %v", req, err)
+			return "", false
+		}
+		if req.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+			io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+			return "", false
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		return req.Host, true
+	})
+}
+
+// socks5Proxy - SOCKS5-прокси, требующий логин user:pass
+func socks5Proxy(t *testing.T) string {
+	return proxyServer(t, func(conn net.Conn) (string, bool) {
+		r := bufio.NewReader(conn)
+		head := make([]byte, 2)
+		io.ReadFull(r, head)
+		io.ReadFull(r, make([]byte, head[1]))
+		conn.Write([]byte{0x05, 0x02})
+
+		read := func() string {
+			n, _ := r.ReadByte()
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			return string(b)
+		}
+		r.ReadByte()
+		if user, pass := read(), read(); user != "user" || pass != "pass" {
+			conn.Write([]byte{0x01, 0x01})
+			return "", false
+		}
+		conn.Write([]byte{0x01, 0x00})
+
+		req := make([]byte, 4)
+		io.ReadFull(r, req)
+		var host string
+		switch req[3] {
+		case 0x01:
+			ip := make([]byte, 4)
+			io.ReadFull(r, ip)
+			host = net.IP(ip).String()
+		case 0x03:
+			host = read()
+		}
+		port := make([]byte, 2)
+		io.ReadFull(r, port)
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 127, 0, 0, 1, 0, 0})
+		return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))), true
+	})
+}
+
+func TestWebSocketThroughProxy(t *testing.T) {
+	for name, start := range map[string]func(*testing.T) string{
+		"http":   httpConnectProxy,
+		"socks5": socks5Proxy,
+	} {
+		t.Run(name, func(t *testing.T) {
+			received := make(chan Event, 1)
+			server := wsServer(t, received)
+			defer server.Close()
+
+			proxyURL := &url.URL{Scheme: name, Host: start(t), User: url.UserPassword("user", "pass")}
+			s, err := NewWebSocket(WebSocketConfig{
+				URL:     "ws" + strings.TrimPrefix(server.URL, "http"),
+				Headers: map[string]string{"Authorization": "Bearer secret"},
+				Ack:     true,
+			}, WebSocketDialer{Proxy: http.ProxyURL(proxyURL)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+
+			if err := s.Send(context.Background(), Event{EventID: "id-1", Data: []byte(`{}`)}); err != nil {
+				t.Fatal(err)
+			}
+			if got := <-received; got.EventID != "id-1" {
+				t.Errorf("server got %+v", got)
+			}
+		})
+	}
+}
+
+func TestWebSocketProxyAuthRejected(t *testing.T) {
+	server := wsServer(t, make(chan Event))
+	defer server.Close()
+
+	proxyURL := &url.URL{Scheme: "http", Host: httpConnectProxy(t), User: url.UserPassword("user", "wrong")}
+	s, err := NewWebSocket(WebSocketConfig{URL: "ws" + strings.TrimPrefix(server.URL, "http")},
+		WebSocketDialer{Proxy: http.ProxyURL(proxyURL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send(context.Background(), Event{EventID: "id-1"}); err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("send with wrong proxy password: got %v, want 407", err)
+	}
+}
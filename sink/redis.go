@@ -0,0 +1,206 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("redis", func(config json.RawMessage) (Sink, error) {
+		var c RedisConfig
+		if err := decodeConfig(config, &c); err != nil {
+			return nil, err
+		}
+		return NewRedis(c)
+	})
+}
+
+// RedisConfig - публикация событий в Redis
+type RedisConfig struct {
+	// Адрес Redis, например 127.0.0.1:6379
+	Address  string `json:"address"`
+	Password string `json:"password"`
+	DB       int    `json:"db"`
+	// Канал для PUBLISH (пусто - не публиковать)
+	Channel string `json:"channel"`
+	// Stream для XADD (пусто - не добавлять) и его примерный максимальный размер
+	Stream       string `json:"stream"`
+	StreamMaxLen int    `json:"stream_max_len"`
+}
+
+// Redis отправляет события по протоколу RESP. Соединение держится
+// открытым и пересоздается при следующей отправке после ошибки.
+type Redis struct {
+	mu     sync.Mutex
+	config RedisConfig
+	conn   net.Conn
+	reader *bufio.Reader
+	// Шаблон тела события (nil - стандартный JSON)
+	template *Template
+}
+
+func NewRedis(c RedisConfig) (*Redis, error) {
+	if c.Address == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	if c.Channel == "" && c.Stream == "" {
+		return nil, fmt.Errorf("channel or stream is required")
+	}
+
+	s := &Redis{config: c}
+	ctx, cancel := withTimeout(context.Background())
+	defer cancel()
+	if err := s.connect(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Redis) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("redis connect: %v", err)
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	if s.config.Password != "" {
+		if _, err := s.command(ctx, "AUTH", s.config.Password); err != nil {
+			s.closeConn()
+			return fmt.Errorf("redis auth: %v", err)
+		}
+	}
+	if s.config.DB != 0 {
+		if _, err := s.command(ctx, "SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			s.closeConn()
+			return fmt.Errorf("redis select: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Redis) SetTemplate(t *Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.template = t
+}
+
+func (s *Redis) Send(ctx context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+
+	if s.config.Channel != "" {
+		if _, err := s.command(ctx, "PUBLISH", s.config.Channel, string(payload)); err != nil {
+			s.closeConn()
+			return fmt.Errorf("redis publish: %v", err)
+		}
+	}
+
+	if s.config.Stream != "" {
+		args := []string{"XADD", s.config.Stream}
+		if s.config.StreamMaxLen > 0 {
+			args = append(args, "MAXLEN", "~", strconv.Itoa(s.config.StreamMaxLen))
+		}
+		args = append(args, "*",
+			"event_id", ev.EventID,
+			"steamid64", ev.SteamID64,
+			"event", ev.Event,
+			"payload", string(payload))
+		if _, err := s.command(ctx, args...); err != nil {
+			s.closeConn()
+			return fmt.Errorf("redis xadd: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *Redis) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeConn()
+}
+
+func (s *Redis) closeConn() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// command отправляет команду массивом bulk-строк и читает ответ
+func (s *Redis) command(ctx context.Context, args ...string) (string, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := s.conn.Write([]byte(b.String())); err != nil {
+		return "", err
+	}
+	return s.readReply()
+}
+
+func (s *Redis) readReply() (string, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", fmt.Errorf("%s", line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid bulk reply %q", line)
+		}
+		if n < 0 {
+			return "", nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(s.reader, buf); err != nil {
+			return "", err
+		}
+		return string(buf[:n]), nil
+	}
+	return "", fmt.Errorf("unexpected reply %q", line)
+}
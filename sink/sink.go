@@ -0,0 +1,132 @@
+// Package sink содержит места доставки событий агента: HTTP API, WebSocket,
+// файлы, базы данных, Redis, брокеры сообщений. Новые получатели регистрируются через Register
+// и подключаются из конфигурации без изменений в ядре агента.
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Sink - место доставки событий
+type Sink interface {
+	// Send доставляет событие и возвращает ошибку, если получатель его не принял.
+	// Получатель должен отбрасывать дубли по Event.EventID: при повторной
+	// доставке агент пропускает sink, уже принявшие событие, но после
+	// перезапуска агента событие может прийти снова.
+	Send(ctx context.Context, ev Event) error
+	Close() error
+}
+
+// Pinger - sink, который проверяет доступность получателя без отправки события
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Factory создает sink по его секции конфигурации
+type Factory func(config json.RawMessage) (Sink, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register регистрирует вид sink под именем, используемым в конфигурации
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := factories[name]; exists {
+		panic("sink: duplicate registration of " + name)
+	}
+	factories[name] = f
+}
+
+// Registered проверяет, что вид sink зарегистрирован
+func Registered(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names возвращает имена зарегистрированных видов sink
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open создает sink зарегистрированного вида
+func Open(name string, config json.RawMessage) (Sink, error) {
+	mu.RLock()
+	f, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q", name)
+	}
+
+	s, err := f(config)
+	if err != nil {
+		return nil, fmt.Errorf("%s sink: %v", name, err)
+	}
+	return s, nil
+}
+
+// Named - sink с именем для логов и ошибок
+type Named struct {
+	Name string
+	Sink
+}
+
+// Multi отправляет событие во все sink по порядку. Доставка останавливается
+// на первой ошибке, чтобы событие осталось в очереди агента.
+type Multi []Named
+
+func (m Multi) Send(ctx context.Context, ev Event) error {
+	for _, s := range m {
+		if err := s.Send(ctx, ev); err != nil {
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return nil
+}
+
+func (m Multi) Close() error {
+	var first error
+	for _, s := range m {
+		if err := s.Close(); err != nil && first == nil {
+			first = fmt.Errorf("%s: %w", s.Name, err)
+		}
+	}
+	return first
+}
+
+// Таймаут операций sink, если контекст вызова его не задает
+const defaultTimeout = 30 * time.Second
+
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, defaultTimeout)
+}
+
+// decodeConfig разбирает секцию конфигурации sink
+func decodeConfig(config json.RawMessage, v interface{}) error {
+	if len(config) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(config, v); err != nil {
+		return fmt.Errorf("parse config: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Форматы тела, которое строит шаблон
+const (
+	FormatJSON = "json"
+	FormatForm = "form"
+	FormatText = "text"
+)
+
+var templateContentTypes = map[string]string{
+	FormatJSON: "application/json",
+	FormatForm: "application/x-www-form-urlencoded",
+	FormatText: "text/plain; charset=utf-8",
+}
+
+// TemplateConfig - тело событий в формате другой панели вместо
+// стандартного JSON агента
+type TemplateConfig struct {
+	// Шаблон Go text/template над Event: {{.SteamID64}}, {{.Event}},
+	// {{json .Data}}, {{field .Data "Growth"}}; или путь к файлу с ним
+	Template string `json:"template"`
+	File     string `json:"file"`
+	// Формат результата: json (по умолчанию, результат проверяется), form, text
+	Format string `json:"format"`
+}
+
+// Template строит тело события по шаблону
+type Template struct {
+	tmpl   *template.Template
+	format string
+}
+
+// Templated - sink, тело событий которого можно задать шаблоном
+type Templated interface {
+	SetTemplate(t *Template)
+}
+
+var templateFuncs = template.FuncMap{
+	// json - значение в JSON; json.RawMessage вставляется как есть
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// field - значение по пути через точку из JSON-данных события
+	"field": func(data json.RawMessage, path string) (interface{}, error) {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, nil
+		}
+		for _, key := range strings.Split(path, ".") {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, nil
+			}
+			v = m[key]
+		}
+		return v, nil
+	},
+	// default - значение или замена, если оно пустое
+	"default": func(fallback, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return fallback
+		}
+		return v
+	},
+}
+
+func NewTemplate(c TemplateConfig) (*Template, error) {
+	text := c.Template
+	if c.File != "" {
+		if text != "" {
+			return nil, fmt.Errorf("template and file are mutually exclusive")
+		}
+		b, err := os.ReadFile(c.File)
+		if err != nil {
+			return nil, fmt.Errorf("read template: %v", err)
+		}
+		text = string(b)
+	}
+	if text == "" {
+		return nil, fmt.Errorf("template or file is required")
+	}
+
+	format := c.Format
+	if format == "" {
+		format = FormatJSON
+	}
+	if _, ok := templateContentTypes[format]; !ok {
+		return nil, fmt.Errorf("unknown template format %q", format)
+	}
+
+	tmpl, err := template.New("payload").Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse template: %v", err)
+	}
+	return &Template{tmpl: tmpl, format: format}, nil
+}
+
+// Render строит тело события. Для формата json результат должен быть
+// корректным JSON, иначе событие не отправляется.
+func (t *Template) Render(ev Event) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.tmpl.Execute(&b, ev); err != nil {
+		return nil, fmt.Errorf("render template: %v", err)
+	}
+	if t.format == FormatJSON && !json.Valid(b.Bytes()) {
+		return nil, fmt.Errorf("template rendered invalid JSON for event %s", ev.EventID)
+	}
+	return b.Bytes(), nil
+}
+
+// ContentType возвращает тип содержимого для формата шаблона
+func (t *Template) ContentType() string {
+	return templateContentTypes[t.format]
+}
+
+// encode возвращает тело события: по шаблону или стандартный JSON
+func encode(t *Template, ev Event) ([]byte, error) {
+	if t == nil {
+		return json.Marshal(ev)
+	}
+	return t.Render(ev)
+}
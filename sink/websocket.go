@@ -0,0 +1,349 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocketConfig - отправка событий текстовыми сообщениями WebSocket
+type WebSocketConfig struct {
+	// ws://host/path или wss://host/path
+	URL string `json:"url"`
+	// Дополнительные заголовки запроса подключения, например Authorization
+	Headers map[string]string `json:"headers"`
+	// Ждать от сервера сообщения {"event_id": "..."} на каждое событие.
+	// Без подтверждения событие считается доставленным после записи в соединение.
+	Ack bool `json:"ack"`
+}
+
+// WebSocketDialer - установка соединения с сервером WebSocket
+type WebSocketDialer struct {
+	// TCP-соединение с сервером или прокси
+	Dial func(ctx context.Context, network, address string) (net.Conn, error)
+	// Выбор прокси, как в http.Transport (nil - без прокси). Поддерживаются
+	// http, https и socks5 с логином и паролем в URL.
+	Proxy func(*http.Request) (*url.URL, error)
+	// Настройки TLS для wss (nil - по умолчанию)
+	TLS *tls.Config
+}
+
+// Коды сообщений WebSocket
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+	wsPing  = 0x9
+	wsPong  = 0xa
+)
+
+// Наибольшее сообщение сервера, которое читает sink (подтверждения и ping)
+const wsMaxFrame = 64 << 10
+
+// WebSocket держит одно соединение с сервером и пересоздает его
+// при следующей отправке после ошибки
+type WebSocket struct {
+	mu     sync.Mutex
+	config WebSocketConfig
+	url    *url.URL
+	dialer WebSocketDialer
+	conn   net.Conn
+	reader *bufio.Reader
+	// Шаблон тела события (nil - стандартный JSON)
+	template *Template
+}
+
+// NewWebSocket проверяет настройки; соединение открывается при первой отправке
+func NewWebSocket(c WebSocketConfig, d WebSocketDialer) (*WebSocket, error) {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		return nil, fmt.Errorf("url must be ws://host/path or wss://host/path")
+	}
+	if d.Dial == nil {
+		var nd net.Dialer
+		d.Dial = nd.DialContext
+	}
+	return &WebSocket{config: c, url: u, dialer: d}, nil
+}
+
+func (s *WebSocket) SetTemplate(t *Template) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.template = t
+}
+
+func (s *WebSocket) Send(ctx context.Context, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+
+	payload, err := encode(s.template, ev)
+	if err != nil {
+		return err
+	}
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	if err := s.conn.SetDeadline(deadline); err != nil {
+		s.closeConn()
+		return fmt.Errorf("websocket: %v", err)
+	}
+
+	err = writeWSFrame(s.conn, wsText, payload, true)
+	if err == nil && s.config.Ack {
+		err = s.waitAck(ev.EventID)
+	}
+	if err != nil {
+		s.closeConn()
+		return fmt.Errorf("websocket send: %v", err)
+	}
+	return nil
+}
+
+func (s *WebSocket) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.SetDeadline(time.Now().Add(time.Second))
+		writeWSFrame(s.conn, wsClose, nil, true)
+	}
+	return s.closeConn()
+}
+
+func (s *WebSocket) closeConn() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn, s.reader = nil, nil
+	return err
+}
+
+func (s *WebSocket) connect(ctx context.Context) error {
+	port := s.url.Port()
+	if port == "" {
+		port = "80"
+		if s.url.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	conn, err := s.dial(ctx, net.JoinHostPort(s.url.Hostname(), port))
+	if err != nil {
+		return fmt.Errorf("websocket connect: %v", err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if s.url.Scheme == "wss" {
+		tlsConfig := &tls.Config{}
+		if s.dialer.TLS != nil {
+			tlsConfig = s.dialer.TLS.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = s.url.Hostname()
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return fmt.Errorf("websocket tls: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	reader := bufio.NewReader(conn)
+	if err := s.handshake(conn, reader); err != nil {
+		conn.Close()
+		return fmt.Errorf("websocket handshake: %v", err)
+	}
+	s.conn, s.reader = conn, reader
+	return nil
+}
+
+// dial соединяется с сервером напрямую или через прокси, выбранный для его URL
+func (s *WebSocket) dial(ctx context.Context, address string) (net.Conn, error) {
+	if s.dialer.Proxy != nil {
+		scheme := "http"
+		if s.url.Scheme == "wss" {
+			scheme = "https"
+		}
+		proxyURL, err := s.dialer.Proxy(&http.Request{URL: &url.URL{Scheme: scheme, Host: address}})
+		if err != nil {
+			return nil, err
+		}
+		if proxyURL != nil {
+			return dialProxy(ctx, s.dialer.Dial, proxyURL, address)
+		}
+	}
+	return s.dialer.Dial(ctx, "tcp", address)
+}
+
+// handshake переключает HTTP-соединение на протокол WebSocket (RFC 6455)
+func (s *WebSocket) handshake(conn net.Conn, reader *bufio.Reader) error {
+	var nonce [16]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce[:])
+
+	header := make(http.Header)
+	for name, value := range s.config.Headers {
+		header.Set(name, value)
+	}
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Version", "13")
+	header.Set("Sec-WebSocket-Key", key)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\nHost: %s\r\n", s.url.RequestURI(), s.url.Host)
+	header.Write(&b)
+	b.WriteString("\r\n")
+	if _, err := io.WriteString(conn, b.String()); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("server responded %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != wsAccept(key) {
+		return fmt.Errorf("invalid Sec-WebSocket-Accept")
+	}
+	return nil
+}
+
+// waitAck читает сообщения сервера до подтверждения события, отвечая на ping
+func (s *WebSocket) waitAck(eventID string) error {
+	for {
+		opcode, payload, err := readWSFrame(s.reader)
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case wsPing:
+			if err := writeWSFrame(s.conn, wsPong, payload, true); err != nil {
+				return err
+			}
+		case wsClose:
+			return fmt.Errorf("connection closed by server")
+		case wsText:
+			var ack struct {
+				EventID string `json:"event_id"`
+			}
+			if json.Unmarshal(payload, &ack) == nil && ack.EventID == eventID {
+				return nil
+			}
+		}
+	}
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// writeWSFrame пишет одно сообщение; сообщения клиента всегда маскируются
+func writeWSFrame(w io.Writer, opcode byte, payload []byte, masked bool) error {
+	frame := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] = byte(n)
+	case n <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	if !masked {
+		frame = append(frame, payload...)
+		_, err := w.Write(frame)
+		return err
+	}
+	frame[1] |= 0x80
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, c := range payload {
+		frame = append(frame, c^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// readWSFrame читает одно сообщение; фрагментированные сообщения не поддерживаются
+func readWSFrame(r *bufio.Reader) (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	if head[0]&0x80 == 0 {
+		return 0, nil, fmt.Errorf("fragmented messages are not supported")
+	}
+	opcode := head[0] & 0x0f
+
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxFrame {
+		return 0, nil, fmt.Errorf("message of %d bytes is too large", n)
+	}
+
+	var mask [4]byte
+	masked := head[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,121 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// wsServer принимает подключение WebSocket и передает полученные
+// сообщения в received; на каждое сообщение отвечает ping и подтверждением
+func wsServer(t *testing.T, received chan<- Event) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		rw.Flush()
+
+		for {
+			opcode, payload, err := readWSFrame(rw.Reader)
+			if err != nil || opcode == wsClose {
+				return
+			}
+			if opcode == wsPong {
+				continue
+			}
+			var ev Event
+			if err := json.Unmarshal(payload, &ev); err != nil {
+				t.Errorf("server got %q: %v", payload, err)
+				return
+			}
+			received <- ev
+			writeWSFrame(conn, wsPing, []byte("ping"), false)
+			ack, _ := json.Marshal(map[string]string{"event_id": ev.EventID})
+			writeWSFrame(conn, wsText, ack, false)
+		}
+	}))
+}
+
+func TestWebSocketSendWithAck(t *testing.T) {
+	received := make(chan Event, 2)
+	server := wsServer(t, received)
+	defer server.Close()
+
+	s, err := NewWebSocket(WebSocketConfig{
+		URL:     "ws" + strings.TrimPrefix(server.URL, "http") + "/events",
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Ack:     true,
+	}, WebSocketDialer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Второе сообщение длиннее 125 байт проверяет расширенную длину
+	for _, ev := range []Event{
+		{EventID: "id-1", SteamID64: "76561198000000001", Event: "add-dino-data", Data: json.RawMessage(`{"Growth":1}`)},
+		{EventID: "id-2", SteamID64: "76561198000000001", Data: json.RawMessage(`"` + strings.Repeat("x", 300) + `"`)},
+	} {
+		if err := s.Send(context.Background(), ev); err != nil {
+			t.Fatalf("send %s: %v", ev.EventID, err)
+		}
+		if got := <-received; got.EventID != ev.EventID || string(got.Data) != string(ev.Data) {
+			t.Errorf("server got %+v, want %+v", got, ev)
+		}
+	}
+}
+
+func TestWebSocketHandshakeRejected(t *testing.T) {
+	server := wsServer(t, make(chan Event))
+	defer server.Close()
+
+	s, err := NewWebSocket(WebSocketConfig{URL: "ws" + strings.TrimPrefix(server.URL, "http")}, WebSocketDialer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Send(context.Background(), Event{EventID: "id-1"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("send without token: got %v, want handshake error with 401", err)
+	}
+}
+
+func TestWebSocketConfigValidation(t *testing.T) {
+	for _, url := range []string{"", "http://example.com/events", "ws://"} {
+		if _, err := NewWebSocket(WebSocketConfig{URL: url}, WebSocketDialer{}); err == nil {
+			t.Errorf("url %q: expected error", url)
+		}
+	}
+}
+
+func TestWSFrameRoundTrip(t *testing.T) {
+	for _, size := range []int{0, 125, 126, 70000} {
+		payload := []byte(strings.Repeat("a", size))
+		var b strings.Builder
+		if err := writeWSFrame(&b, wsText, payload, true); err != nil {
+			t.Fatal(err)
+		}
+		opcode, got, err := readWSFrame(bufio.NewReader(strings.NewReader(b.String())))
+		if size > wsMaxFrame {
+			if err == nil {
+				t.Errorf("size %d: expected too large error", size)
+			}
+			continue
+		}
+		if err != nil || opcode != wsText || string(got) != string(payload) {
+			t.Errorf("size %d: got opcode %d, %d bytes, %v", size, opcode, len(got), err)
+		}
+	}
+}
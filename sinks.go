@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"agent-ws/sink"
+	"agent-ws/state"
+)
+
+func init() {
+	sink.Register("http", func(json.RawMessage) (sink.Sink, error) {
+		return httpSink{}, nil
+	})
+	// WebSocket подключается с настройками TLS и прокси агента
+	sink.Register("websocket", func(config json.RawMessage) (sink.Sink, error) {
+		var c sink.WebSocketConfig
+		if len(config) > 0 {
+			if err := json.Unmarshal(config, &c); err != nil {
+				return nil, fmt.Errorf("parse config: %v", err)
+			}
+		}
+		tlsConfig, err := buildTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		proxy, err := proxyFunc(cfg.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		return sink.NewWebSocket(c, sink.WebSocketDialer{TLS: tlsConfig, Proxy: proxy})
+	})
+}
+
+// httpSink - доставка в HTTP API панели с лимитом размера payload и повторными попытками
+type httpSink struct{}
+
+// Шаблон тела событий HTTP API (nil - стандартный JSON агента)
+var httpTemplate *sink.Template
+
+func (httpSink) SetTemplate(t *sink.Template) {
+	httpTemplate = t
+}
+
+func (httpSink) Send(ctx context.Context, ev sink.Event) error {
+	return deliverPayload(ctx, ev)
+}
+
+func (httpSink) Close() error {
+	return nil
+}
+
+// sinkSet - получатели событий и sink, записывающие исход доставки (архив)
+type sinkSet struct {
+	sinks     sink.Multi
+	recorders []sink.Named
+}
+
+var (
+	sinks sink.Multi
+	// Sink, записывающие исход доставки каждого события (архив)
+	recorders []sink.Named
+	// Собственные sink экземпляров серверов
+	instanceSinks = make(map[string]sinkSet)
+	// Останавливает фоновые проверки доступности sink
+	stopSinkChecks = func() {}
+)
+
+// initSinks подключает HTTP API и дополнительные sink из конфигурации
+func initSinks() error {
+	closeSinks()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopSinkChecks = cancel
+
+	var names []string
+	if !cfg.DisableHTTP {
+		names = append(names, "http")
+	} else {
+		deliveryLog.Infof("HTTP API delivery is disabled, events go only to configured sinks")
+	}
+	set, err := openSinks(ctx, names, cfg.Sinks, "")
+	if err != nil {
+		return err
+	}
+	sinks, recorders = set.sinks, set.recorders
+
+	for _, inst := range cfg.Instances {
+		if len(inst.Sinks) == 0 {
+			continue
+		}
+		set, err := openSinks(ctx, nil, inst.Sinks, inst.Name)
+		if err != nil {
+			closeSinks()
+			return fmt.Errorf("instance %s: %v", inst.Name, err)
+		}
+		instanceSinks[inst.Name] = set
+	}
+	return nil
+}
+
+// openSinks открывает sink names и sink из configs по порядку имен
+func openSinks(ctx context.Context, names []string, configs map[string]json.RawMessage, instance string) (sinkSet, error) {
+	extra := make([]string, 0, len(configs))
+	for name := range configs {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	names = append(names, extra...)
+
+	var set sinkSet
+	for _, name := range names {
+		s, err := sink.Open(name, configs[name])
+		if err != nil {
+			set.close()
+			return sinkSet{}, err
+		}
+		if err := applySinkTemplate(name, s); err != nil {
+			s.Close()
+			set.close()
+			return sinkSet{}, err
+		}
+		if _, ok := s.(sink.Recorder); ok {
+			set.recorders = append(set.recorders, sink.Named{Name: name, Sink: s})
+		} else {
+			set.sinks = append(set.sinks, sink.Named{Name: name, Sink: newPolicySink(name, s)})
+		}
+		if instance != "" {
+			deliveryLog.Infof("Sink enabled for instance %s: %s", instance, name)
+		} else {
+			deliveryLog.Infof("Sink enabled: %s", name)
+		}
+		if p, ok := s.(sink.Pinger); ok {
+			go checkSink(ctx, name, p)
+		}
+	}
+	return set, nil
+}
+
+// checkSink проверяет, доступен ли sink после запуска. Недоступный sink не
+// останавливает агента: его события ждут в очереди, а проверка повторяется
+// с растущей паузой, пока получатель не ответит.
+func checkSink(ctx context.Context, name string, p sink.Pinger) {
+	err := p.Ping(ctx)
+	if err == nil || ctx.Err() != nil {
+		return
+	}
+	deliveryLog.Warnf("Sink %s is unreachable: %v; its events wait in the queue, retrying in the background", name, err)
+
+	for backoff := watcherMinBackoff; ; backoff = min(backoff*2, watcherMaxBackoff) {
+		if sleepContext(ctx, backoff) != nil {
+			return
+		}
+		if err := p.Ping(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			deliveryLog.Debugf("Sink %s is still unreachable: %v", name, err)
+			continue
+		}
+		deliveryLog.Infof("Sink %s is reachable again", name)
+		return
+	}
+}
+
+func (s sinkSet) close() {
+	if err := s.sinks.Close(); err != nil {
+		deliveryLog.Errorf("Error closing sink %v", err)
+	}
+	if err := sink.Multi(s.recorders).Close(); err != nil {
+		deliveryLog.Errorf("Error closing sink %v", err)
+	}
+}
+
+func closeSinks() {
+	stopSinkChecks()
+	sinkSet{sinks: sinks, recorders: recorders}.close()
+	for name, set := range instanceSinks {
+		set.close()
+		delete(instanceSinks, name)
+	}
+	sinks, recorders = nil, nil
+	httpTemplate = nil
+}
+
+// applySinkTemplate задает sink шаблон тела событий из sink_templates
+func applySinkTemplate(name string, s sink.Sink) error {
+	c, ok := cfg.SinkTemplates[name]
+	if !ok {
+		return nil
+	}
+	templated, ok := s.(sink.Templated)
+	if !ok {
+		return fmt.Errorf("%s sink does not support payload templates", name)
+	}
+	t, err := sink.NewTemplate(c)
+	if err != nil {
+		return fmt.Errorf("%s sink template: %v", name, err)
+	}
+	templated.SetTemplate(t)
+	return nil
+}
+
+func validateSinkTemplates(c *Config) error {
+	for name, tc := range c.SinkTemplates {
+		if name != "http" && c.Sinks[name] == nil && !instanceHasSink(c, name) {
+			return fmt.Errorf("sink_templates: sink %q is not configured", name)
+		}
+		if _, err := sink.NewTemplate(tc); err != nil {
+			return fmt.Errorf("sink_templates.%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// sinksFor возвращает получателей события: HTTP API и sink его экземпляра
+// или общие sink
+func sinksFor(eventData EventData) sinkSet {
+	set, ok := instanceSinks[eventData.Instance]
+	if !ok {
+		return sinkSet{sinks: sinks, recorders: recorders}
+	}
+	var targets sink.Multi
+	if len(sinks) > 0 && sinks[0].Name == "http" {
+		targets = append(targets, sinks[0])
+	}
+	return sinkSet{sinks: append(targets, set.sinks...), recorders: set.recorders}
+}
+
+// migrateLegacySinks переносит секции database, redis и broker, которые
+// были до sinks, в sinks: иначе после обновления агент молча перестал бы
+// в них писать. Возвращает предупреждения о перенесенных ключах.
+func migrateLegacySinks(c *Config) ([]string, error) {
+	legacy := []struct {
+		key string
+		raw json.RawMessage
+	}{
+		{"database", c.LegacyDatabase},
+		{"redis", c.LegacyRedis},
+		{"broker", c.LegacyBroker},
+	}
+	c.LegacyDatabase, c.LegacyRedis, c.LegacyBroker = nil, nil, nil
+
+	var notes []string
+	for _, l := range legacy {
+		if len(l.raw) == 0 || string(l.raw) == "null" {
+			continue
+		}
+		var section struct {
+			DSN     string `json:"dsn"`
+			Address string `json:"address"`
+			Kind    string `json:"kind"`
+		}
+		if err := json.Unmarshal(l.raw, &section); err != nil {
+			return nil, fmt.Errorf("%s: %v", l.key, err)
+		}
+
+		// Пустой dsn, address или kind выключал sink
+		var name string
+		switch {
+		case l.key == "database" && section.DSN != "":
+			name = "database"
+		case l.key == "redis" && section.Address != "":
+			name = "redis"
+		case l.key == "broker" && (section.Kind == "kafka" || section.Kind == "nats"):
+			name = section.Kind
+		case l.key == "broker" && section.Kind != "":
+			return nil, fmt.Errorf("broker: unknown kind %q", section.Kind)
+		default:
+			notes = append(notes, fmt.Sprintf("%s is deprecated and disabled, remove it", l.key))
+			continue
+		}
+		if _, exists := c.Sinks[name]; exists {
+			return nil, fmt.Errorf("%s and sinks.%s are both set, remove %s", l.key, name, l.key)
+		}
+		if c.Sinks == nil {
+			c.Sinks = make(map[string]json.RawMessage)
+		}
+		c.Sinks[name] = l.raw
+		notes = append(notes, fmt.Sprintf("%s is deprecated, used as sinks.%s; move it there", l.key, name))
+	}
+	return notes, nil
+}
+
+func validateSinks(c *Config) error {
+	for name := range c.Sinks {
+		if name == "http" || !sink.Registered(name) {
+			return fmt.Errorf("unknown sink %q (available: %v)", name, sink.Names())
+		}
+	}
+	if c.DisableHTTP && len(c.Sinks) == 0 {
+		return fmt.Errorf("disable_http requires at least one other sink")
+	}
+	return nil
+}
+
+// deliverEvent доставляет событие во все sink. Событие считается доставленным,
+// только если его приняли все получатели. Событие, которое бэкенд отклонил
+// как неповторяемое, возвращает errEventRejected: повторять его бессмысленно.
+func deliverEvent(ctx context.Context, eventData EventData) error {
+	err := sendToSinks(ctx, sinksFor(eventData).sinks, eventData)
+	var backendErr *backendError
+	switch {
+	case err == nil:
+		recordOutcome(eventData, sink.OutcomeDelivered, "")
+		return nil
+	case errors.Is(err, errCircuitOpen):
+		// Событие ждет в очереди, пока sink снова не станет доступен
+		deliveryLog.Debugf("Event %s for SteamID %s postponed: %v", eventData.EventID, eventData.SteamID64, err)
+		return err
+	case errors.As(err, &backendErr) && !backendErr.retryable():
+		deliveryLog.Warnf("Event %s for SteamID %s was rejected: %v",
+			eventData.EventID, eventData.SteamID64, err)
+		recordOutcome(eventData, sink.OutcomeRejected, err.Error())
+		partialDeliveries.Delete(eventData.EventID)
+		return fmt.Errorf("%w: %v", errEventRejected, err)
+	default:
+		deliveryLog.Errorf("Error delivering event %s for SteamID %s: %v",
+			eventData.EventID, eventData.SteamID64, err)
+		recordOutcome(eventData, sink.OutcomeFailed, err.Error())
+		return err
+	}
+}
+
+// Sink, уже принявшие событие с незавершенной доставкой, по EventID:
+// при повторе событие уходит только в остальные sink
+var partialDeliveries = state.New[map[string]bool]()
+
+// Сколько незавершенных доставок помнится. Сверх этого событие при повторе
+// может снова уйти в sink, который его уже принял (получатели отбрасывают
+// дубли по EventID).
+const maxPartialDeliveries = 10000
+
+// sendToSinks отправляет событие по порядку в sink, которые его еще не
+// приняли, и останавливается на первой ошибке
+func sendToSinks(ctx context.Context, targets sink.Multi, eventData EventData) error {
+	done, _ := partialDeliveries.Get(eventData.EventID)
+	for _, s := range targets {
+		if done[s.Name] {
+			continue
+		}
+		if err := s.Send(ctx, eventData); err != nil {
+			if len(done) > 0 && eventData.EventID != "" && partialDeliveries.Len() < maxPartialDeliveries {
+				partialDeliveries.Set(eventData.EventID, done)
+			}
+			return fmt.Errorf("%s: %w", s.Name, err)
+		}
+		// Копия: сохраненный набор может читать другой воркер
+		accepted := make(map[string]bool, len(done)+1)
+		for name := range done {
+			accepted[name] = true
+		}
+		accepted[s.Name] = true
+		done = accepted
+	}
+	partialDeliveries.Delete(eventData.EventID)
+	return nil
+}
+
+// errEventRejected - событие отклонено бэкендом и не будет доставлено повторно
+var errEventRejected = errors.New("event rejected by backend")
+
+// recordOutcome записывает событие и исход его обработки в архив
+func recordOutcome(eventData EventData, outcome, detail string) {
+	for _, r := range sinksFor(eventData).recorders {
+		if err := r.Sink.(sink.Recorder).Record(eventData, outcome, detail); err != nil {
+			deliveryLog.Errorf("Error recording event %s to %s: %v", eventData.EventID, r.Name, err)
+		}
+	}
+}
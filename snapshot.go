@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"agent-ws/state"
+)
+
+// snapshotFile - файл игрока в полном снимке папки
+type snapshotFile struct {
+	SteamID64 string `json:"steamid64"`
+	Hash      string `json:"hash"`
+	Size      int    `json:"size"`
+	ModTime   string `json:"mod_time"`
+	Content   string `json:"content"`
+}
+
+// playerSnapshot - снимок папки игроков: тело события full-snapshot
+// и формат сохраненных снимков
+type playerSnapshot struct {
+	GeneratedAt string         `json:"generated_at"`
+	Count       int            `json:"count"`
+	Files       []snapshotFile `json:"files"`
+}
+
+// Формат имени сохраненного снимка
+const snapshotFileLayout = "snapshot-20060102-150405.json"
+
+// takeStartupSnapshot снимает папку игроков при старте: отправляет ее бэкенду
+// (snapshot_on_startup) и сохраняет на диск (snapshot_dir)
+func takeStartupSnapshot(ctx context.Context, fileStates *state.Store[time.Time]) {
+	if !cfg.SnapshotOnStartup && cfg.SnapshotDir == "" {
+		return
+	}
+
+	snapshot := playerSnapshot{GeneratedAt: time.Now().Format(time.RFC3339), Files: []snapshotFile{}}
+	for filename, modTime := range fileStates.Snapshot() {
+		if ctx.Err() != nil {
+			return
+		}
+		if !isPlayerFile(filename) {
+			continue
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			deliveryLog.Errorf("Error reading %s for snapshot: %v", filepath.Base(filename), err)
+			continue
+		}
+		snapshot.Files = append(snapshot.Files, newSnapshotFile(filename, modTime, content))
+	}
+	snapshot.Count = len(snapshot.Files)
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		deliveryLog.Errorf("Error encoding startup snapshot: %v", err)
+		return
+	}
+
+	if cfg.SnapshotDir != "" {
+		if path, err := saveSnapshot(cfg.SnapshotDir, data); err != nil {
+			agentLog.Errorf("Error saving startup snapshot: %v", err)
+		} else {
+			agentLog.Infof("Startup snapshot saved to %s: %d files", path, snapshot.Count)
+		}
+	}
+	if cfg.SnapshotOnStartup {
+		uploadStartupSnapshot(ctx, data, snapshot.Count)
+	}
+}
+
+func newSnapshotFile(filename string, modTime time.Time, content []byte) snapshotFile {
+	return snapshotFile{
+		SteamID64: getSteamIDFromFilename(filename),
+		Hash:      hashContent(string(content)),
+		Size:      len(content),
+		ModTime:   modTime.Format(time.RFC3339),
+		Content:   string(content),
+	}
+}
+
+// uploadStartupSnapshot отправляет всю папку игроков одним событием full-snapshot,
+// чтобы бэкенд мог пересобрать состояние с нуля
+func uploadStartupSnapshot(ctx context.Context, data []byte, count int) {
+	deliveryLog.Infof("Uploading startup snapshot: %d files, %d bytes", count, len(data))
+	if cfg.MaxPayloadSize > 0 && len(data) > cfg.MaxPayloadSize && cfg.OversizeMode == oversizeTruncate {
+		deliveryLog.Warnf("Snapshot exceeds max_payload_size and will be truncated; use oversize_mode chunk or multipart")
+	}
+
+	eventType := "player"
+	if t := playersTarget(""); t != nil {
+		eventType = t.EventType
+	}
+	sendEventWithRetry(ctx, EventData{
+		Type:  eventType,
+		Event: "full-snapshot",
+		Data:  data,
+	})
+}
+
+// saveSnapshot записывает снимок в папку под именем с временем создания.
+// При заданном state_encryption_key снимок шифруется, как очередь.
+func saveSnapshot(dir string, data []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := sealState(data)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, time.Now().Format(snapshotFileLayout))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return path, nil
+}
+
+// loadSnapshot читает сохраненный снимок
+func loadSnapshot(path string) (playerSnapshot, error) {
+	var snapshot playerSnapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return snapshot, err
+	}
+	if data, err = openState(data); err != nil {
+		return snapshot, fmt.Errorf("snapshot %s: %v", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("parse snapshot %s: %v", filepath.Base(path), err)
+	}
+	return snapshot, nil
+}
+
+// scanSnapshot снимает папку с сохранениями игроков прямо с диска
+func scanSnapshot(dir string) (playerSnapshot, error) {
+	snapshot := playerSnapshot{GeneratedAt: time.Now().Format(time.RFC3339), Files: []snapshotFile{}}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return snapshot, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || isIgnored(entry.Name()) {
+			continue
+		}
+		filename := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Files = append(snapshot.Files, newSnapshotFile(filename, info.ModTime(), content))
+	}
+	snapshot.Count = len(snapshot.Files)
+	return snapshot, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"agent-ws/state"
+)
+
+// Что агент делает при запуске с файлами, которые уже лежат в папках
+const (
+	// Только кэшировать: панель получает события о последующих изменениях
+	startupCache = "cache"
+	// Отправить каждый файл событием add, как новый
+	startupAdd = "add"
+	// Сверить папки, как при resync: файлы уходят событием change,
+	// если их содержимое не ждет доставки в очереди
+	startupResync = "resync"
+)
+
+// emitStartupEvents отправляет события по существующим файлам согласно startup_mode
+func emitStartupEvents(ctx context.Context, fileStates *state.Store[time.Time]) {
+	switch cfg.StartupMode {
+	case startupAdd:
+		sendStartupAdds(ctx, fileStates)
+	case startupResync:
+		resyncDirectory(ctx, fileStates)
+	}
+}
+
+func sendStartupAdds(ctx context.Context, fileStates *state.Store[time.Time]) {
+	files := make([]string, 0, fileStates.Len())
+	for filename := range fileStates.Snapshot() {
+		files = append(files, filename)
+	}
+	sort.Strings(files)
+
+	sent := 0
+	for _, filename := range files {
+		if ctx.Err() != nil {
+			return
+		}
+		t := targetFor(filename)
+		steamID := getSteamIDFromFilename(filename)
+		if t == nil || steamID == "" {
+			continue
+		}
+		content, err := readFileContentWithRetry(ctx, filename)
+		if err != nil {
+			watchLog.Errorf("Error reading file %s at startup: %v", filepath.Base(filename), err)
+			continue
+		}
+		ev, err := t.newEvent(opAdd, steamID, content)
+		if err != nil {
+			continue
+		}
+		sendEventWithRetry(ctx, ev)
+		sent++
+	}
+	watchLog.Infof("Startup: sent add events for %d existing files", sent)
+}
@@ -0,0 +1,52 @@
+// Package state содержит потокобезопасные хранилища состояния агента,
+// которые читают и меняют основной цикл, отправители и локальный API.
+package state
+
+import "sync"
+
+// Store - потокобезопасное хранилище ключ-значение
+type Store[V any] struct {
+	mu    sync.RWMutex
+	items map[string]V
+}
+
+func New[V any]() *Store[V] {
+	return &Store[V]{items: make(map[string]V)}
+}
+
+func (s *Store[V]) Get(key string) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.items[key]
+	return v, ok
+}
+
+func (s *Store[V]) Set(key string, v V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items[key] = v
+}
+
+func (s *Store[V]) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.items, key)
+}
+
+func (s *Store[V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.items)
+}
+
+// Snapshot возвращает копию содержимого, которую можно обходить
+// и менять хранилище во время обхода
+func (s *Store[V]) Snapshot() map[string]V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot := make(map[string]V, len(s.items))
+	for k, v := range s.items {
+		snapshot[k] = v
+	}
+	return snapshot
+}
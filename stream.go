@@ -0,0 +1,266 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"agent-ws/sink"
+	"agent-ws/state"
+)
+
+// StreamingConfig - доставка событий потоком NDJSON: один POST с chunked-телом
+// держится открытым и получает события построчно, пока не наберется
+// max_events событий или не пройдет max_duration; затем открывается новый
+// запрос. Для очень нагруженных серверов это убирает накладные расходы
+// HTTP на каждое событие.
+type StreamingConfig struct {
+	// Endpoint, принимающий поток NDJSON (пусто - выключено). Ответ 2xx
+	// подтверждает все события потока, иначе они остаются в очереди.
+	URL         string   `json:"url"`
+	MaxDuration Duration `json:"max_duration"`
+	MaxEvents   int      `json:"max_events"`
+	// Сжатие потока: gzip или none
+	Compression string `json:"compression"`
+}
+
+const (
+	streamCompressionNone = "none"
+	streamCompressionGzip = "gzip"
+)
+
+func (c StreamingConfig) validate(cfg *Config) error {
+	if c.URL == "" {
+		return nil
+	}
+	if c.MaxDuration.Duration <= 0 || c.MaxEvents <= 0 {
+		return fmt.Errorf("streaming.max_duration and max_events must be positive")
+	}
+	if c.Compression != streamCompressionNone && c.Compression != streamCompressionGzip {
+		return fmt.Errorf("streaming.compression must be %s or %s", streamCompressionNone, streamCompressionGzip)
+	}
+	// Подпись считается по всему телу, а тело потока заранее не известно
+	if cfg.SigningKey != "" {
+		return fmt.Errorf("streaming does not support signing_key")
+	}
+	// Поток подтверждает события только для HTTP API
+	if cfg.DisableHTTP || len(cfg.Sinks) > 0 {
+		return fmt.Errorf("streaming delivers only to the HTTP API, other sinks are not supported")
+	}
+	for _, inst := range cfg.Instances {
+		if len(inst.Sinks) > 0 {
+			return fmt.Errorf("streaming delivers only to the HTTP API, instance %s has other sinks", inst.Name)
+		}
+	}
+	return nil
+}
+
+// streamedEvent - событие, записанное в открытый поток и ждущее его ответа
+type streamedEvent struct {
+	event EventData
+	hash  string
+}
+
+// eventStream - один запрос потока NDJSON
+type eventStream struct {
+	pipe   *io.PipeWriter
+	writer io.Writer
+	gzip   *gzip.Writer
+	events []streamedEvent
+	closed bool
+}
+
+var (
+	streamMu      sync.Mutex
+	currentStream *eventStream
+	// Запросы потоков, ответ которых еще не обработан
+	streamsRunning sync.WaitGroup
+	// События в открытых потоках: повторная доставка из очереди их пропускает
+	streamedEvents = state.New[struct{}]()
+)
+
+// streamable проверяет, можно ли отправить событие потоком. Большие
+// payload и события конвейеров в режиме shadow идут обычными запросами.
+func streamable(eventData EventData) bool {
+	return cfg.Streaming.URL != "" && !isOversized(eventData) &&
+		pipelineFor(eventData.Type).Mode != pipelineShadow
+}
+
+// streamEvent записывает событие в открытый поток, открывая новый при
+// необходимости. Событие остается в очереди, пока поток не подтвердит его.
+// Может выполняться в воркере доставки.
+func streamEvent(eventData EventData, hash string) error {
+	wire, err := prepareWireEvent(eventData)
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(wireEvent(wire))
+	if err != nil {
+		return err
+	}
+
+	streamMu.Lock()
+	defer streamMu.Unlock()
+
+	if currentStream == nil {
+		currentStream = openStream()
+	}
+	s := currentStream
+
+	if _, err := s.writer.Write(append(line, '\n')); err == nil && s.gzip != nil {
+		// Строка уходит в сеть сразу, а не копится в буфере сжатия
+		err = s.gzip.Flush()
+	}
+	if err != nil {
+		closeStreamLocked(s)
+		return fmt.Errorf("stream write: %v", err)
+	}
+
+	s.events = append(s.events, streamedEvent{event: eventData, hash: hash})
+	streamedEvents.Set(eventData.EventID, struct{}{})
+	if len(s.events) >= cfg.Streaming.MaxEvents {
+		closeStreamLocked(s)
+	}
+	return nil
+}
+
+// openStream начинает запрос потока; вызывается под streamMu
+func openStream() *eventStream {
+	reader, pipe := io.Pipe()
+	s := &eventStream{pipe: pipe, writer: pipe}
+	if cfg.Streaming.Compression == streamCompressionGzip {
+		s.gzip = gzip.NewWriter(pipe)
+		s.writer = s.gzip
+	}
+
+	time.AfterFunc(cfg.Streaming.MaxDuration.Duration, func() {
+		streamMu.Lock()
+		closeStreamLocked(s)
+		streamMu.Unlock()
+	})
+
+	streamsRunning.Add(1)
+	go runStream(s, reader)
+	return s
+}
+
+// closeStreamLocked завершает тело запроса потока; следующее событие
+// откроет новый поток. Вызывается под streamMu.
+func closeStreamLocked(s *eventStream) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.gzip != nil {
+		s.gzip.Close()
+	}
+	s.pipe.Close()
+	if currentStream == s {
+		currentStream = nil
+	}
+}
+
+// runStream выполняет запрос потока и по его ответу подтверждает события
+func runStream(s *eventStream, body *io.PipeReader) {
+	defer streamsRunning.Done()
+
+	// Общий таймаут запроса клиента не подходит: поток открыт max_duration
+	ctx, cancel := context.WithTimeout(context.Background(),
+		cfg.Streaming.MaxDuration.Duration+cfg.Timeouts.Request.Duration)
+	defer cancel()
+
+	err := postStream(ctx, body)
+	// Запись в поток, который сервер уже закрыл, сразу завершается ошибкой
+	body.CloseWithError(fmt.Errorf("stream request finished"))
+
+	streamMu.Lock()
+	closeStreamLocked(s)
+	events := s.events
+	streamMu.Unlock()
+
+	if err != nil {
+		deliveryLog.Warnf("Event stream failed, %d events stay in persistent queue for redelivery: %v", len(events), err)
+	} else {
+		deliveryLog.Debugf("Event stream delivered %d events", len(events))
+	}
+	for _, e := range events {
+		finishStreamedEvent(e, err)
+	}
+}
+
+func postStream(ctx context.Context, body io.Reader) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.Streaming.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if cfg.Streaming.Compression == streamCompressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	setPanelHeaders(req)
+
+	client := &http.Client{Transport: httpClient.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s", describeTransportError(err))
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d - %s", resp.StatusCode, truncateBody(string(respBody)))
+	}
+	return nil
+}
+
+// finishStreamedEvent завершает доставку события потока так же, как
+// completeDelivery: подтвержденное убирается из очереди
+func finishStreamedEvent(e streamedEvent, err error) {
+	ev := e.event
+	defer streamedEvents.Delete(ev.EventID)
+
+	if err != nil {
+		metrics.eventFailed(ev)
+		playerSyncs.failed(ev, err)
+		return
+	}
+	eventQueueStore.remove(ev.EventID)
+	sequences.ack(instanceKey(ev.Instance, ev.SteamID64), ev.Sequence)
+	recordOutcome(ev, sink.OutcomeDelivered, "stream")
+	metrics.eventDelivered(ev)
+	playerSyncs.acked(ev)
+	rememberAcked(ev)
+	if e.hash != "" {
+		rememberDelivered(ev.Type, instanceKey(ev.Instance, ev.SteamID64), ev.Event, e.hash)
+	}
+}
+
+// closeEventStream завершает открытый поток при остановке агента и ждет
+// ответов всех потоков, чтобы подтвержденные события не отправлялись повторно
+func closeEventStream() {
+	streamMu.Lock()
+	if currentStream != nil {
+		closeStreamLocked(currentStream)
+	}
+	streamMu.Unlock()
+	streamsRunning.Wait()
+}
+
+// withoutStreamed убирает из списка события, ждущие ответа потока
+func withoutStreamed(events []EventData) []EventData {
+	if streamedEvents.Len() == 0 {
+		return events
+	}
+	kept := events[:0]
+	for _, ev := range events {
+		if _, ok := streamedEvents.Get(ev.EventID); !ok {
+			kept = append(kept, ev)
+		}
+	}
+	return kept
+}
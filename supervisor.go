@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"agent-ws/state"
+)
+
+// Пауза между попытками восстановить watcher: растет вдвое до максимума
+const (
+	watcherMinBackoff = 2 * time.Second
+	watcherMaxBackoff = time.Minute
+)
+
+// watcherHealth - состояние watcher для /health и heartbeat. Меняется только
+// в основном цикле, но читается обработчиком /health, поэтому под мьютексом.
+type watcherHealth struct {
+	mu        sync.Mutex
+	down      bool
+	lastError string
+	downSince time.Time
+	restarts  int
+
+	// Поля ниже используются только основным циклом
+	backoff time.Duration
+	retryAt time.Time
+}
+
+var watcherState watcherHealth
+
+// healthy сообщает, работает ли watcher
+func (h *watcherHealth) healthy() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return !h.down
+}
+
+// status возвращает состояние watcher для API и heartbeat
+func (h *watcherHealth) status() map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := map[string]interface{}{
+		"healthy":  !h.down,
+		"restarts": h.restarts,
+	}
+	if h.lastError != "" {
+		status["last_error"] = h.lastError
+	}
+	if h.down {
+		status["down_since"] = h.downSince.Format(time.RFC3339)
+		status["next_retry"] = h.retryAt.Format(time.RFC3339)
+	}
+	return status
+}
+
+// watcherFailed останавливает watcher и планирует повторный запуск вместо
+// завершения агента: папка может пропасть на время обновления сервера
+func watcherFailed(err error) {
+	if fileWatcher != nil {
+		fileWatcher.Close()
+		fileWatcher = nil
+	}
+
+	h := &watcherState
+	h.mu.Lock()
+	wasDown := h.down
+	if !h.down {
+		h.down = true
+		h.downSince = time.Now()
+		h.backoff = watcherMinBackoff
+	} else {
+		h.backoff = min(h.backoff*2, watcherMaxBackoff)
+	}
+	h.lastError = err.Error()
+	h.retryAt = time.Now().Add(h.backoff)
+	backoff := h.backoff
+	h.mu.Unlock()
+
+	watchLog.Warnf("File watcher is down: %v, retrying in %v", err, backoff)
+	if !wasDown {
+		notify(alertWatcherDown, SeverityCritical, "File watcher is down",
+			fmt.Sprintf("%v. The agent keeps running and retries with backoff.", err))
+	}
+}
+
+// restartWatcher пересоздает watcher и подписывает его на отслеживаемые папки
+func restartWatcher() error {
+	old := fileWatcher
+	if err := startWatcher(); err != nil {
+		return err
+	}
+	if old != nil {
+		old.Close()
+	}
+
+	h := &watcherState
+	h.mu.Lock()
+	wasDown := h.down
+	h.down = false
+	h.restarts++
+	h.mu.Unlock()
+
+	if wasDown {
+		watchLog.Infof("File watcher recovered")
+		notify(alertWatcherDown, SeverityInfo, "File watcher recovered", "Watching directories again")
+	}
+	return nil
+}
+
+// superviseWatcher вызывается основным циклом: проверяет доступность
+// отслеживаемых папок и восстанавливает watcher после сбоя. После
+// восстановления изменения, пропущенные за время простоя, догоняются сверкой.
+func superviseWatcher(ctx context.Context, fileStates *state.Store[time.Time]) {
+	if watcherState.healthy() {
+		for _, t := range watchTargets {
+			if _, err := os.Stat(t.Path); err != nil {
+				watcherFailed(fmt.Errorf("watch path %s is unavailable: %v", t.Path, err))
+				return
+			}
+		}
+
+		// Подписка на пересозданную папку молча перестает приносить события
+		if reason := staleWatch(); reason != "" {
+			watchLog.Warnf("File watch went stale: %s, re-creating watcher", reason)
+			if err := restartWatcher(); err != nil {
+				watcherFailed(err)
+				return
+			}
+			if !paused {
+				resyncDirectory(ctx, fileStates)
+			}
+		}
+		return
+	}
+
+	if time.Now().Before(watcherState.retryAt) {
+		return
+	}
+	if err := restartWatcher(); err != nil {
+		watcherFailed(err)
+		return
+	}
+	if !paused {
+		resyncDirectory(ctx, fileStates)
+	}
+}
+
+// watchedDir - отслеживаемая папка на момент подписки watcher и время
+// последнего события в ней. Используется только основным циклом.
+type watchedDir struct {
+	info      os.FileInfo
+	lastEvent time.Time
+	// Папка удалялась или переименовывалась: подписка на нее потеряна,
+	// даже если новая папка получила тот же номер inode
+	removed bool
+}
+
+var watchedDirs map[string]*watchedDir
+
+// rememberWatchedDirs запоминает папки, на которые подписан watcher
+func rememberWatchedDirs() {
+	watchedDirs = make(map[string]*watchedDir, len(watchTargets))
+	now := time.Now()
+	for _, t := range watchTargets {
+		info, err := os.Stat(t.Path)
+		if err != nil {
+			continue
+		}
+		watchedDirs[filepath.Clean(t.Path)] = &watchedDir{info: info, lastEvent: now}
+	}
+}
+
+// watchActivity отмечает событие в папке, в том числе для файлов,
+// которые агент не обрабатывает
+func watchActivity(event fsnotify.Event) {
+	name := filepath.Clean(event.Name)
+	if dir, ok := watchedDirs[name]; ok && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+		dir.removed = true
+	}
+	if dir, ok := watchedDirs[filepath.Dir(name)]; ok {
+		dir.lastEvent = time.Now()
+	}
+}
+
+// staleWatch ищет папку, подписка на которую перестала работать: папку
+// удалили и создали заново (переустановка сервера, перемонтирование тома)
+// или ее время изменения растет, а событий нет
+func staleWatch() string {
+	for path, dir := range watchedDirs {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // Недоступную папку обрабатывает superviseWatcher
+		}
+		if dir.removed || !os.SameFile(dir.info, info) {
+			return fmt.Sprintf("directory %s was re-created", path)
+		}
+		// Событие приходит сразу после изменения папки; запас - на задержку
+		// доставки событий и грубое время изменения на некоторых томах
+		if info.ModTime().After(dir.lastEvent.Add(gapScanGrace)) && time.Since(info.ModTime()) > gapScanGrace {
+			return fmt.Sprintf("directory %s changed at %s without file events", path, info.ModTime().Format(time.RFC3339))
+		}
+	}
+	return ""
+}
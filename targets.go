@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"agent-ws/events"
+)
+
+// Способы преобразования содержимого файла в поле data
+const (
+	// Содержимое отправляется как есть (JSON-сохранения игроков)
+	parserRaw = "raw"
+	// Содержимое кодируется в base64 (бинарные файлы базы мира)
+	parserBase64 = "base64"
+)
+
+// Виды изменений файла
+const (
+	opAdd    = "add"
+	opChange = "change"
+	opDelete = "delete"
+	// Файл переименован на другой SteamID
+	opMigrate = "migrate"
+)
+
+// WatchTarget - отслеживаемая папка базы Evrima и профиль ее событий
+type WatchTarget struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Тип данных папки (player - сохранения игроков) и по умолчанию
+	// значение поля type в событиях
+	Type   string `json:"type"`
+	Parser string `json:"parser"`
+	// Значение поля type в событиях, если панель ждет другое
+	// (например dino вместо player)
+	EventType string `json:"event_type"`
+	// Имена событий; по умолчанию add-<name>-data, change-<name>-data,
+	// delete-<name>-data и migrate-<name>-data. Переименованные события
+	// получают приоритет стандартных событий игроков той же операции.
+	AddEvent     string `json:"add_event"`
+	ChangeEvent  string `json:"change_event"`
+	DeleteEvent  string `json:"delete_event"`
+	MigrateEvent string `json:"migrate_event"`
+	// Преобразования JSON перед отправкой (только для parser raw)
+	Transforms []TransformConfig `json:"transforms"`
+
+	transformers []Transformer
+	// Экземпляр сервера, которому принадлежит папка
+	instance string
+}
+
+var watchTargets []*WatchTarget
+
+func defaultWatchTargets() []WatchTarget {
+	return []WatchTarget{{
+		Name:         "players",
+		Path:         watchPath,
+		Type:         "player",
+		Parser:       parserRaw,
+		AddEvent:     "add-dino-data",
+		ChangeEvent:  "change-dino-data",
+		DeleteEvent:  "delete-dino-data",
+		MigrateEvent: "migrate-dino-data",
+	}}
+}
+
+// initWatchTargets подготавливает профили папок из конфигурации
+func initWatchTargets(targets []WatchTarget) error {
+	if len(targets) == 0 && len(cfg.Instances) == 0 {
+		targets = defaultWatchTargets()
+	}
+	targets = append(targets[:len(targets):len(targets)], instanceWatchTargets()...)
+
+	watchTargets = nil
+	seen := make(map[string]bool)
+	for i := range targets {
+		t := targets[i]
+		if t.Name == "" || t.Path == "" {
+			return fmt.Errorf("watch target #%d: name and path are required", i+1)
+		}
+
+		t.Path = filepath.Clean(t.Path)
+		if seen[strings.ToLower(t.Path)] {
+			return fmt.Errorf("watch target %s: path %s is already watched", t.Name, t.Path)
+		}
+		seen[strings.ToLower(t.Path)] = true
+
+		if t.Type == "" {
+			t.Type = t.Name
+		}
+		if t.EventType == "" {
+			t.EventType = t.Type
+		}
+		switch t.Parser {
+		case "":
+			t.Parser = parserRaw
+		case parserRaw, parserBase64:
+		default:
+			return fmt.Errorf("watch target %s: unknown parser %q", t.Name, t.Parser)
+		}
+		if len(t.Transforms) > 0 && t.Parser != parserRaw {
+			return fmt.Errorf("watch target %s: transforms require parser %s", t.Name, parserRaw)
+		}
+		chain, err := newTransformers(t.Transforms)
+		if err != nil {
+			return fmt.Errorf("watch target %s: %v", t.Name, err)
+		}
+		t.transformers = chain
+
+		if t.AddEvent == "" {
+			t.AddEvent = "add-" + t.Name + "-data"
+		}
+		if t.ChangeEvent == "" {
+			t.ChangeEvent = "change-" + t.Name + "-data"
+		}
+		if t.DeleteEvent == "" {
+			t.DeleteEvent = "delete-" + t.Name + "-data"
+		}
+		if t.MigrateEvent == "" {
+			t.MigrateEvent = "migrate-" + t.Name + "-data"
+		}
+		inheritEventPriorities(&t)
+
+		watchTargets = append(watchTargets, &t)
+	}
+	return nil
+}
+
+// targetFor возвращает профиль папки, в которой лежит файл
+func targetFor(filename string) *WatchTarget {
+	dir := strings.ToLower(filepath.Dir(filename))
+	for _, t := range watchTargets {
+		if strings.ToLower(t.Path) == dir {
+			return t
+		}
+	}
+	return nil
+}
+
+// playersTarget возвращает папку сохранений игроков экземпляра
+// (пусто - серверов из общей конфигурации)
+func playersTarget(instance string) *WatchTarget {
+	for _, t := range watchTargets {
+		if t.Type == "player" && t.instance == instance {
+			return t
+		}
+	}
+	return nil
+}
+
+// isPlayerFile проверяет, что файл - сохранение игрока
+func isPlayerFile(filename string) bool {
+	t := targetFor(filename)
+	return t != nil && t.Type == "player"
+}
+
+func (t *WatchTarget) eventName(op string) string {
+	switch op {
+	case opAdd:
+		return t.AddEvent
+	case opChange:
+		return t.ChangeEvent
+	case opMigrate:
+		return t.MigrateEvent
+	}
+	return t.DeleteEvent
+}
+
+// newEvent формирует событие об изменении файла этой папки. Ошибка означает,
+// что к содержимому не удалось применить преобразования: событие без data.
+func (t *WatchTarget) newEvent(op, key, content string) (EventData, error) {
+	data := events.Payload(content)
+	if t.Parser == parserBase64 && content != "" {
+		data = events.String(base64.StdEncoding.EncodeToString([]byte(content)))
+	}
+
+	return applyTransformers(t.transformers, EventData{
+		SteamID64: key,
+		Type:      t.EventType,
+		Event:     t.eventName(op),
+		Op:        op,
+		Data:      data,
+		Instance:  t.instance,
+		Position:  savePosition(t.instance, content),
+	})
+}
+
+// fileEvent формирует событие для файла по профилю его папки (стадия transform).
+// Временем события считается момент его обнаружения в файловой системе.
+func fileEvent(ctx context.Context, filename, op, key, content string) (EventData, error) {
+	_, span := tracer.Start(ctx, "transform")
+	defer span.End()
+
+	t := targetFor(filename)
+	if t == nil {
+		t = watchTargets[0]
+	}
+	ev, err := t.newEvent(op, key, content)
+	span.SetError(err)
+	if at, ok := detectedAt.Get(filename); ok {
+		ev.OccurredAt = at.UTC().Format(time.RFC3339Nano)
+		detectedAt.Delete(filename)
+	}
+	return ev, err
+}
+
+// expectsJSON сообщает, что файл должен содержать JSON: сохранения в папках
+// с парсером raw (base64 - для бинарных файлов)
+func expectsJSON(filename string) bool {
+	t := targetFor(filename)
+	return t != nil && t.Parser == parserRaw
+}
+
+// isAddThenChange проверяет, что change следует за add того же профиля
+func isAddThenChange(lastEvent, event string) bool {
+	for _, t := range watchTargets {
+		if lastEvent == t.AddEvent && event == t.ChangeEvent {
+			return true
+		}
+	}
+	return false
+}
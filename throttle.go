@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Пауза, если бэкенд ответил 429 без заголовка Retry-After
+	defaultThrottleDelay = 30 * time.Second
+	// Верхняя граница паузы, чтобы ошибочный Retry-After не остановил агент надолго
+	maxThrottleDelay = time.Hour
+)
+
+// Состояние ограничения скорости со стороны бэкенда. Меняется
+// воркерами доставки, поэтому доступ только под throttleMu.
+var (
+	throttleMu     sync.Mutex
+	throttledUntil time.Time
+	// Число периодов ограничения и их суммарная длительность с момента запуска
+	throttlePeriods  int
+	throttledTotal   time.Duration
+	lastThrottleCode int
+)
+
+// retryAfterFor возвращает паузу, которую просит бэкенд:
+// для 429 и 503 с заголовком Retry-After, для 429 без него - паузу по умолчанию
+func retryAfterFor(resp *http.Response) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+
+	delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return defaultThrottleDelay
+		}
+		return 0
+	}
+	return delay
+}
+
+// parseRetryAfter разбирает Retry-After в секундах или в виде HTTP-даты
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if delay < time.Second {
+		delay = time.Second
+	}
+	if delay > maxThrottleDelay {
+		delay = maxThrottleDelay
+	}
+	return delay, true
+}
+
+// isThrottled сообщает, что отправка приостановлена по просьбе бэкенда
+func isThrottled() bool {
+	return time.Now().Before(throttleEnd())
+}
+
+// throttleEnd возвращает время окончания паузы
+func throttleEnd() time.Time {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+	return throttledUntil
+}
+
+// throttleStatus возвращает состояние ограничения для API
+func throttleStatus() map[string]interface{} {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	status := map[string]interface{}{
+		"active":        time.Now().Before(throttledUntil),
+		"periods":       throttlePeriods,
+		"total_seconds": int64(throttledTotal.Seconds()),
+		"last_status":   lastThrottleCode,
+	}
+	if time.Now().Before(throttledUntil) {
+		status["until"] = throttledUntil.Format(time.RFC3339)
+	}
+	return status
+}
+
+// startThrottle приостанавливает отправку на указанное время
+func startThrottle(statusCode int, delay time.Duration) {
+	throttleMu.Lock()
+	defer throttleMu.Unlock()
+
+	until := time.Now().Add(delay)
+	if until.Before(throttledUntil) {
+		return
+	}
+
+	throttlePeriods++
+	throttledTotal += delay
+	lastThrottleCode = statusCode
+	throttledUntil = until
+	deliveryLog.Warnf("THROTTLED | HTTP: %d | Pausing sender for %v until %s | Periods: %d | Total: %v",
+		statusCode, delay, until.Format(time.RFC3339), throttlePeriods, throttledTotal)
+}
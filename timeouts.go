@@ -0,0 +1,79 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// TimeoutsConfig - таймауты исходящих запросов по фазам
+type TimeoutsConfig struct {
+	// Установка TCP-соединения (включая DNS)
+	Dial Duration `json:"dial"`
+	// TLS-рукопожатие
+	TLSHandshake Duration `json:"tls_handshake"`
+	// Ожидание заголовков ответа после отправки запроса
+	ResponseHeader Duration `json:"response_header"`
+	// Весь запрос целиком, включая чтение тела ответа
+	Request Duration `json:"request"`
+}
+
+func (t TimeoutsConfig) validate() error {
+	for name, d := range map[string]Duration{
+		"dial":            t.Dial,
+		"tls_handshake":   t.TLSHandshake,
+		"response_header": t.ResponseHeader,
+		"request":         t.Request,
+	} {
+		if d.Duration <= 0 {
+			return fmt.Errorf("timeouts.%s must be positive", name)
+		}
+	}
+	return nil
+}
+
+// newDialer создает dialer с таймаутом установки соединения
+func newDialer(t TimeoutsConfig) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   t.Dial.Duration,
+		KeepAlive: 30 * time.Second,
+	}
+}
+
+// requestPhase запоминает, до какой фазы дошел запрос, чтобы в ошибке
+// было видно, что именно оказалось медленным: DNS, соединение, TLS или ответ
+type requestPhase struct {
+	mu    sync.Mutex
+	phase string
+}
+
+func (p *requestPhase) set(phase string) {
+	p.mu.Lock()
+	p.phase = phase
+	p.mu.Unlock()
+}
+
+func (p *requestPhase) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.phase
+}
+
+// traceRequest подключает к запросу отслеживание фаз
+func traceRequest(req *http.Request) (*http.Request, *requestPhase) {
+	p := &requestPhase{phase: "connection setup"}
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { p.set("dns lookup") },
+		ConnectStart:         func(string, string) { p.set("tcp connect") },
+		TLSHandshakeStart:    func() { p.set("tls handshake") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { p.set("sending request") },
+		GotConn:              func(httptrace.GotConnInfo) { p.set("sending request") },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { p.set("waiting for response headers") },
+		GotFirstResponseByte: func() { p.set("reading response") },
+	}
+	return req.WithContext(httptrace.WithClientTrace(req.Context(), trace)), p
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLSConfig - настройки TLS для исходящих HTTP-запросов
+type TLSConfig struct {
+	// PEM-файл с дополнительными корневыми сертификатами (для self-signed прокси)
+	CAFile string `json:"ca_file"`
+	// Клиентский сертификат и ключ для mTLS
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// Минимальная версия TLS: 1.0, 1.1, 1.2 или 1.3
+	MinVersion string `json:"min_version"`
+	// Отключает проверку сертификата сервера. Небезопасно, только для отладки.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+func buildTLSConfig(c TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+
+	if c.MinVersion != "" {
+		version, ok := tlsVersions[c.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls.min_version %q", c.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %v", err)
+		}
+
+		// Добавляем свои сертификаты к системным, а не заменяем их
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.InsecureSkipVerify {
+		deliveryLog.Warnf("TLS certificate verification is disabled (tls.insecure_skip_verify). " +
+			"Connections to the API can be intercepted; use tls.ca_file instead.")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	return tlsConfig, nil
+}
+
+// describeTransportError добавляет к ошибкам сертификатов подсказку по настройке TLS
+func describeTransportError(err error) string {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return err.Error() + " (server certificate is signed by an unknown CA; add it via tls.ca_file)"
+	case errors.As(err, &hostname):
+		return err.Error() + " (certificate does not match the API host name; check api URL or proxy certificate)"
+	case errors.As(err, &invalid):
+		return err.Error() + " (certificate is expired or not valid yet; check server certificate and system clock)"
+	}
+	return err.Error()
+}
@@ -0,0 +1,254 @@
+// Package tracing - легкая трассировка конвейера событий в модели
+// OpenTelemetry: спаны с trace/span ID, атрибутами и статусом выгружаются
+// пачками в коллектор по OTLP/HTTP (JSON). Без настроенного Tracer все
+// операции ничего не делают, поэтому вызовы не нужно оборачивать проверками.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+func (id SpanID) String() string  { return hex.EncodeToString(id[:]) }
+
+// Span - одна стадия обработки события
+type Span struct {
+	tracer   *Tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	sampled  bool
+
+	name  string
+	kind  int
+	start time.Time
+
+	mu      sync.Mutex
+	end     time.Time
+	attrs   map[string]interface{}
+	failed  bool
+	message string
+}
+
+// Виды спанов OTLP
+const (
+	KindInternal = 1
+	KindClient   = 3
+)
+
+type spanKey struct{}
+
+// FromContext возвращает текущий спан контекста или nil
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SetAttr добавляет атрибут спана: строку, число или bool
+func (s *Span) SetAttr(key string, value interface{}) {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	s.attrs[key] = value
+	s.mu.Unlock()
+}
+
+// SetError помечает стадию как неуспешную
+func (s *Span) SetError(err error) {
+	if s == nil || !s.sampled || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.failed, s.message = true, err.Error()
+	s.mu.Unlock()
+}
+
+// End завершает спан и ставит его в очередь выгрузки; повторный вызов ничего не делает
+func (s *Span) End() {
+	if s == nil || !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	s.tracer.export(s)
+}
+
+// Options - настройки трассировки
+type Options struct {
+	// Адрес OTLP/HTTP коллектора, например http://collector:4318
+	Endpoint string
+	Headers  map[string]string
+	// Доля трассируемых событий от 0 до 1
+	SampleRate float64
+	// Атрибуты ресурса: service.name, host.name и т.п.
+	Resource map[string]string
+	// Пачка спанов и интервал выгрузки неполной пачки
+	BatchSize     int
+	FlushInterval time.Duration
+	// Вызывается при ошибке выгрузки (спаны пачки теряются)
+	OnError func(error)
+}
+
+// Tracer создает спаны и выгружает завершенные в фоне
+type Tracer struct {
+	opts    Options
+	client  *http.Client
+	spans   chan *Span
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+
+	mu  sync.Mutex
+	rng *mathrand.Rand
+}
+
+// Сколько завершенных спанов ждут выгрузки; лишние отбрасываются
+const spanBufferSize = 10000
+
+func New(client *http.Client, opts Options) *Tracer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 256
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(error) {}
+	}
+	t := &Tracer{
+		opts:    opts,
+		client:  client,
+		spans:   make(chan *Span, spanBufferSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		rng:     mathrand.New(mathrand.NewSource(time.Now().UnixNano())),
+	}
+	go t.run()
+	return t
+}
+
+// Start начинает спан стадии сейчас
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	return t.StartAt(ctx, name, time.Now())
+}
+
+// StartAt начинает спан с заданного момента - для стадий, начало которых
+// известно задним числом (ожидание в очереди)
+func (t *Tracer) StartAt(ctx context.Context, name string, start time.Time) (context.Context, *Span) {
+	return t.start(ctx, name, KindInternal, start)
+}
+
+// StartClient начинает спан исходящего запроса
+func (t *Tracer) StartClient(ctx context.Context, name string) (context.Context, *Span) {
+	return t.start(ctx, name, KindClient, time.Now())
+}
+
+func (t *Tracer) start(ctx context.Context, name string, kind int, start time.Time) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{tracer: t, name: name, kind: kind, start: start, attrs: make(map[string]interface{})}
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID, span.parentID, span.sampled = parent.traceID, parent.spanID, parent.sampled
+	} else {
+		rand.Read(span.traceID[:])
+		span.sampled = t.sample()
+	}
+	rand.Read(span.spanID[:])
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sample решает, трассируется ли новое событие; решение наследуют все его стадии
+func (t *Tracer) sample() bool {
+	if t.opts.SampleRate >= 1 {
+		return true
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rng.Float64() < t.opts.SampleRate
+}
+
+// Inject передает контекст трассировки в заголовке traceparent (W3C),
+// чтобы бэкенд мог продолжить трассу
+func Inject(ctx context.Context, header http.Header) {
+	span := FromContext(ctx)
+	if span == nil || !span.sampled {
+		return
+	}
+	header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", span.traceID, span.spanID))
+}
+
+func (t *Tracer) export(s *Span) {
+	select {
+	case <-t.done:
+	case t.spans <- s:
+	default:
+	}
+}
+
+// Close выгружает завершенные спаны и останавливает трассировку
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() { close(t.done) })
+	<-t.stopped
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(t.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.upload(batch); err != nil {
+			t.opts.OnError(fmt.Errorf("export %d spans: %v", len(batch), err))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) >= t.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.done:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSpansExportAsOTLP(t *testing.T) {
+	requests := make(chan otlpRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		requests <- req
+	}))
+	defer server.Close()
+
+	tracer := New(server.Client(), Options{
+		Endpoint:      server.URL,
+		SampleRate:    1,
+		Resource:      map[string]string{"service.name": "agent-ws"},
+		FlushInterval: time.Hour,
+	})
+	ctx, root := tracer.Start(context.Background(), "file_event")
+	root.SetAttr("steamid", "76561198000000001")
+	sendCtx, send := tracer.StartClient(ctx, "send")
+	send.SetAttr("http.status_code", 502)
+	send.SetError(errors.New("bad gateway"))
+
+	header := http.Header{}
+	Inject(sendCtx, header)
+	send.End()
+	root.End()
+	tracer.Close()
+
+	req := <-requests
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	child, parent := spans[0], spans[1]
+	if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID || parent.ParentSpanID != "" {
+		t.Fatalf("spans are not linked: %+v %+v", child, parent)
+	}
+	if child.Kind != KindClient || child.Status.Code != 2 || child.Status.Message != "bad gateway" {
+		t.Fatalf("send span = %+v", child)
+	}
+	if want := "00-" + child.TraceID + "-" + child.SpanID + "-01"; header.Get("traceparent") != want {
+		t.Fatalf("traceparent = %q, want %q", header.Get("traceparent"), want)
+	}
+	if attr := req.ResourceSpans[0].Resource.Attributes[0]; attr.Key != "service.name" {
+		t.Fatalf("resource attribute = %+v", attr)
+	}
+}
+
+func TestUnsampledTraceIsNotExported(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { calls++ }))
+	defer server.Close()
+
+	tracer := New(server.Client(), Options{Endpoint: server.URL, SampleRate: 0})
+	ctx, root := tracer.Start(context.Background(), "file_event")
+	_, child := tracer.Start(ctx, "read")
+	header := http.Header{}
+	Inject(ctx, header)
+	child.End()
+	root.End()
+	tracer.Close()
+
+	if calls != 0 || header.Get("traceparent") != "" {
+		t.Fatalf("unsampled trace exported: calls=%d traceparent=%q", calls, header.Get("traceparent"))
+	}
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "read")
+	span.SetAttr("bytes", 1)
+	span.SetError(errors.New("x"))
+	span.End()
+	tracer.Close()
+	if FromContext(ctx) != nil {
+		t.Fatal("nil tracer must not put spans into context")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Виды шагов преобразования
+const (
+	transformRename   = "rename"
+	transformDrop     = "drop"
+	transformTemplate = "template"
+	transformSelect   = "select"
+)
+
+// TransformConfig - шаг преобразования JSON из поля data перед отправкой
+type TransformConfig struct {
+	// rename, drop, select или template
+	Kind string `json:"kind"`
+	// rename: старый путь -> новый путь (вложенные поля через точку)
+	Fields map[string]string `json:"fields"`
+	// drop: удаляемые поля, например "Inventory" или "Stats.Password";
+	// select: единственные отправляемые поля, например "CharacterClass",
+	// "Growth", "bIsAlive" и "Location_Isle_V3"
+	Paths []string `json:"paths"`
+	// template: Go-шаблон, результат которого (JSON) становится новым data.
+	// В шаблоне доступны .Event (EventData) и .Data (разобранный JSON)
+	Template string `json:"template"`
+}
+
+// Transformer - шаг конвейера преобразования данных
+type Transformer interface {
+	Transform(ev EventData, data interface{}) (interface{}, error)
+}
+
+// newTransformer создает шаг преобразования по конфигурации
+func newTransformer(c TransformConfig) (Transformer, error) {
+	switch c.Kind {
+	case transformRename:
+		if len(c.Fields) == 0 {
+			return nil, fmt.Errorf("rename: fields are required")
+		}
+		// Порядок переименований не зависит от обхода map: пересекающиеся
+		// пути дают один результат при каждом запуске
+		order := make([]string, 0, len(c.Fields))
+		for from := range c.Fields {
+			order = append(order, from)
+		}
+		sort.Strings(order)
+		return renameTransformer{fields: c.Fields, order: order}, nil
+	case transformDrop:
+		if len(c.Paths) == 0 {
+			return nil, fmt.Errorf("drop: paths are required")
+		}
+		return dropTransformer{paths: c.Paths}, nil
+	case transformSelect:
+		if len(c.Paths) == 0 {
+			return nil, fmt.Errorf("select: paths are required")
+		}
+		return selectTransformer{paths: c.Paths}, nil
+	case transformTemplate:
+		tmpl, err := template.New("transform").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Option("missingkey=zero").Parse(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("template: %v", err)
+		}
+		return templateTransformer{tmpl: tmpl}, nil
+	}
+	return nil, fmt.Errorf("unknown transform kind %q", c.Kind)
+}
+
+// newTransformers собирает конвейер преобразований
+func newTransformers(configs []TransformConfig) ([]Transformer, error) {
+	var chain []Transformer
+	for i, c := range configs {
+		t, err := newTransformer(c)
+		if err != nil {
+			return nil, fmt.Errorf("transform #%d: %v", i+1, err)
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
+
+// applyTransformers прогоняет JSON из data через конвейер. Если data - не
+// JSON или шаг завершился ошибкой, исходные данные не отправляются: правило
+// drop могло убирать из них чувствительные поля. Тогда возвращается событие
+// без data и ошибка.
+func applyTransformers(chain []Transformer, ev EventData) (EventData, error) {
+	if len(chain) == 0 || len(ev.Data) == 0 {
+		return ev, nil
+	}
+	fail := func(err error) (EventData, error) {
+		deliveryLog.Errorf("Dropping data of %s event for %s: %v", ev.Event, ev.SteamID64, err)
+		ev.Data = nil
+		return ev, err
+	}
+
+	// Текст, который не разобрался как JSON, встроен JSON-строкой
+	data, err := decodeJSON(ev.Data)
+	if err != nil {
+		return fail(fmt.Errorf("data is not JSON, transforms cannot be applied: %v", err))
+	}
+	if _, ok := data.(map[string]interface{}); !ok {
+		return fail(fmt.Errorf("data is not a JSON object, transforms cannot be applied"))
+	}
+
+	for _, t := range chain {
+		if data, err = t.Transform(ev, data); err != nil {
+			return fail(fmt.Errorf("transform failed: %v", err))
+		}
+	}
+
+	out, err := json.Marshal(data)
+	if err != nil {
+		return fail(fmt.Errorf("encode transformed data: %v", err))
+	}
+	ev.Data = out
+	return ev, nil
+}
+
+// decodeJSON разбирает JSON, сохраняя числа как json.Number: через float64
+// целые больше 2^53 (SteamID, счетчики) потеряли бы младшие цифры
+func decodeJSON(b []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+// renameTransformer переименовывает и переносит поля
+type renameTransformer struct {
+	fields map[string]string
+	// Старые пути по алфавиту
+	order []string
+}
+
+func (r renameTransformer) Transform(_ EventData, data interface{}) (interface{}, error) {
+	for _, from := range r.order {
+		to := r.fields[from]
+		value, ok := lookupJSONPath(data, from)
+		if !ok {
+			continue
+		}
+		deleteJSONPath(data, from)
+		if err := setJSONPath(data, to, value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// dropTransformer удаляет поля, например чувствительные данные
+type dropTransformer struct {
+	paths []string
+}
+
+func (d dropTransformer) Transform(_ EventData, data interface{}) (interface{}, error) {
+	for _, path := range d.paths {
+		deleteJSONPath(data, path)
+	}
+	return data, nil
+}
+
+// selectTransformer оставляет только перечисленные поля - для панелей,
+// которым не нужно сохранение целиком. Отсутствующие в файле поля пропускаются.
+type selectTransformer struct {
+	paths []string
+}
+
+func (s selectTransformer) Transform(_ EventData, data interface{}) (interface{}, error) {
+	out := make(map[string]interface{})
+	for _, path := range s.paths {
+		value, ok := lookupJSONPath(data, path)
+		if !ok {
+			continue
+		}
+		if err := setJSONPath(out, path, value); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// templateTransformer полностью перестраивает JSON по шаблону
+type templateTransformer struct {
+	tmpl *template.Template
+}
+
+func (t templateTransformer) Transform(ev EventData, data interface{}) (interface{}, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, map[string]interface{}{"Event": ev, "Data": data}); err != nil {
+		return nil, err
+	}
+
+	out, err := decodeJSON(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("template output is not JSON: %v", err)
+	}
+	return out, nil
+}
+
+// splitJSONPath возвращает объект-родитель и последний ключ пути
+func splitJSONPath(data interface{}, path string) (map[string]interface{}, string, bool) {
+	parentPath, key := "", path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		parentPath, key = path[:i], path[i+1:]
+	}
+
+	parent := data
+	if parentPath != "" {
+		var ok bool
+		if parent, ok = lookupJSONPath(data, parentPath); !ok {
+			return nil, "", false
+		}
+	}
+	obj, ok := parent.(map[string]interface{})
+	return obj, key, ok
+}
+
+func deleteJSONPath(data interface{}, path string) {
+	if obj, key, ok := splitJSONPath(data, path); ok {
+		delete(obj, key)
+	}
+}
+
+// setJSONPath записывает значение, создавая недостающие вложенные объекты
+func setJSONPath(data interface{}, path string, value interface{}) error {
+	obj, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("cannot set %s: data is not an object", path)
+	}
+
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := obj[key].(map[string]interface{})
+		if !ok {
+			if _, exists := obj[key]; exists {
+				return fmt.Errorf("cannot set %s: %s is not an object", path, key)
+			}
+			next = make(map[string]interface{})
+			obj[key] = next
+		}
+		obj = next
+	}
+	obj[keys[len(keys)-1]] = value
+	return nil
+}
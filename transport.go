@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// TransportConfig - повторное использование соединений с API панели.
+// Для далеких панелей каждое новое TLS-соединение добавляет к событию
+// сотни миллисекунд.
+type TransportConfig struct {
+	// HTTP/2 для HTTPS-запросов: все события идут по одному соединению
+	HTTP2 bool `json:"http2"`
+	// Сколько простаивающее соединение держится открытым (0 - без повторного использования)
+	KeepAlive Duration `json:"keep_alive"`
+	// Простаивающих соединений на хост и предел всех соединений на хост (0 - без предела)
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int `json:"max_conns_per_host"`
+	// Сколько хранить адреса, полученные из DNS (0 - спрашивать DNS каждый раз)
+	DNSCacheTTL Duration `json:"dns_cache_ttl"`
+	// Открыть соединения с API при запуске, до первых событий
+	Prewarm bool `json:"prewarm"`
+}
+
+func (c TransportConfig) validate() error {
+	if c.KeepAlive.Duration < 0 || c.DNSCacheTTL.Duration < 0 {
+		return fmt.Errorf("transport: keep_alive and dns_cache_ttl must not be negative")
+	}
+	if c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 {
+		return fmt.Errorf("transport: connection limits must not be negative")
+	}
+	return nil
+}
+
+// newTransport создает транспорт HTTP-клиента по настройкам соединений
+func newTransport(c TransportConfig, t TimeoutsConfig) *http.Transport {
+	dial := newDialer(t).DialContext
+	if c.DNSCacheTTL.Duration > 0 {
+		dial = (&cachingDialer{dialer: newDialer(t), ttl: c.DNSCacheTTL.Duration}).DialContext
+	}
+
+	return &http.Transport{
+		DialContext:           dial,
+		TLSHandshakeTimeout:   t.TLSHandshake.Duration,
+		ResponseHeaderTimeout: t.ResponseHeader.Duration,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   c.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       c.MaxConnsPerHost,
+		IdleConnTimeout:       c.KeepAlive.Duration,
+		DisableKeepAlives:     c.KeepAlive.Duration == 0,
+		ForceAttemptHTTP2:     c.HTTP2,
+	}
+}
+
+// cachingDialer запоминает адреса хостов на ttl, чтобы всплеск событий
+// не ждал DNS перед каждым новым соединением
+type cachingDialer struct {
+	dialer *net.Dialer
+	ttl    time.Duration
+
+	mu    sync.Mutex
+	hosts map[string]resolvedHost
+}
+
+type resolvedHost struct {
+	addrs   []string
+	expires time.Time
+}
+
+func (d *cachingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	addrs, err := d.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	// Адрес мог смениться - следующее соединение спросит DNS заново
+	d.forget(host)
+	return nil, lastErr
+}
+
+func (d *cachingDialer) resolve(ctx context.Context, host string) ([]string, error) {
+	d.mu.Lock()
+	cached, ok := d.hosts[host]
+	d.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.addrs, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	if d.hosts == nil {
+		d.hosts = make(map[string]resolvedHost)
+	}
+	d.hosts[host] = resolvedHost{addrs: addrs, expires: time.Now().Add(d.ttl)}
+	d.mu.Unlock()
+	return addrs, nil
+}
+
+func (d *cachingDialer) forget(host string) {
+	d.mu.Lock()
+	delete(d.hosts, host)
+	d.mu.Unlock()
+}
+
+// prewarmConnections открывает соединения с API панели и экземпляров
+// запросом OPTIONS, чтобы DNS, TCP и TLS первых событий уже были позади.
+// Ответ API не важен: соединение остается в пуле клиента.
+func prewarmConnections(ctx context.Context) {
+	if !cfg.Transport.Prewarm || cfg.DisableHTTP {
+		return
+	}
+
+	endpoints := []string{cfg.APIURL}
+	for _, inst := range cfg.Instances {
+		endpoints = append(endpoints, inst.APIURL)
+	}
+
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint)
+		if endpoint == "" || err != nil || seen[u.Host] {
+			continue
+		}
+		seen[u.Host] = true
+
+		start := time.Now()
+		req, err := http.NewRequestWithContext(ctx, http.MethodOptions, endpoint, nil)
+		if err != nil {
+			continue
+		}
+		setPanelHeaders(req)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			deliveryLog.Warnf("Error prewarming connection to %s: %s", u.Host, describeTransportError(err))
+			continue
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		deliveryLog.Infof("Connection to %s prewarmed in %v (%s)", u.Host, time.Since(start).Round(time.Millisecond), resp.Proto)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// UpdateConfig - обновление агента из канала релизов
+type UpdateConfig struct {
+	// URL манифеста последнего релиза (пусто - обновление выключено)
+	ManifestURL string `json:"manifest_url"`
+	// Открытый ключ Ed25519 (base64), которым подписываются бинарники релизов
+	PublicKey string `json:"public_key"`
+	// Проверять обновления автоматически и перезапускаться на новую версию
+	Auto          bool     `json:"auto"`
+	CheckInterval Duration `json:"check_interval"`
+}
+
+// releaseManifest - описание последнего релиза
+type releaseManifest struct {
+	Version string `json:"version"`
+	URL     string `json:"url"`
+	SHA256  string `json:"sha256"`
+	// Подпись Ed25519 в base64 сообщения releaseSigningMessage: подписываются
+	// и версия, и хэш бинарника, чтобы старый подписанный бинарник нельзя
+	// было выдать за новую версию
+	Signature string `json:"signature"`
+}
+
+// releaseSigningMessage - подписываемое сообщение релиза:
+// "agent-ws release <версия> <sha256 бинарника в hex>"
+func releaseSigningMessage(version string, sum [sha256.Size]byte) []byte {
+	return []byte("agent-ws release " + version + " " + hex.EncodeToString(sum[:]))
+}
+
+func (u UpdateConfig) validate() error {
+	if u.ManifestURL == "" {
+		return nil
+	}
+	if _, err := updatePublicKey(u.PublicKey); err != nil {
+		return err
+	}
+	if u.Auto && u.CheckInterval.Duration <= 0 {
+		return fmt.Errorf("update.check_interval must be positive")
+	}
+	return nil
+}
+
+func updatePublicKey(value string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("update.public_key must be base64: %v", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("update.public_key must be %d bytes, got %d", ed25519.PublicKeySize, len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// runSelfUpdate - команда agent-ws self-update
+func runSelfUpdate(ctx context.Context) int {
+	if cfg.Update.ManifestURL == "" {
+		fmt.Println("Self-update is not configured: set update.manifest_url in", configFile)
+		return 1
+	}
+
+	updated, version, err := selfUpdate(ctx)
+	switch {
+	case err != nil:
+		fmt.Println("Self-update failed:", err)
+		return 1
+	case updated:
+		fmt.Printf("Updated agent from %s to %s, restart the service to use the new version\n", agentVersion, version)
+	default:
+		fmt.Printf("Agent is up to date (%s)\n", agentVersion)
+	}
+	return 0
+}
+
+// checkForUpdate проверяет обновление и при успешной установке планирует перезапуск.
+// Вызывается только из основного цикла.
+func checkForUpdate(ctx context.Context) {
+	updated, version, err := selfUpdate(ctx)
+	if err != nil {
+		agentLog.Errorf("Error checking for agent update: %v", err)
+		return
+	}
+	if updated {
+		agentLog.Infof("Agent updated from %s to %s, restarting", agentVersion, version)
+		restartRequested = true
+	}
+}
+
+// selfUpdate скачивает релиз новее текущей версии, проверяет хэш и подпись
+// и заменяет исполняемый файл. Старый файл сохраняется с суффиксом .old:
+// запущенный exe в Windows нельзя перезаписать, но можно переименовать.
+func selfUpdate(ctx context.Context) (bool, string, error) {
+	manifest, err := fetchReleaseManifest(ctx)
+	if err != nil {
+		return false, "", err
+	}
+	if compareVersions(manifest.Version, agentVersion) <= 0 {
+		return false, manifest.Version, nil
+	}
+
+	agentLog.Infof("Downloading agent %s from %s", manifest.Version, manifest.URL)
+	binary, err := downloadRelease(ctx, manifest.URL)
+	if err != nil {
+		return false, "", err
+	}
+	if err := verifyRelease(manifest, binary); err != nil {
+		return false, "", err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return false, "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return false, "", err
+	}
+
+	newPath := exe + ".new"
+	oldPath := exe + ".old"
+	if err := os.WriteFile(newPath, binary, 0755); err != nil {
+		return false, "", fmt.Errorf("write new binary: %v", err)
+	}
+	os.Remove(oldPath)
+	if err := os.Rename(exe, oldPath); err != nil {
+		os.Remove(newPath)
+		return false, "", fmt.Errorf("move current binary: %v", err)
+	}
+	if err := os.Rename(newPath, exe); err != nil {
+		// Возвращаем рабочий бинарник на место
+		os.Rename(oldPath, exe)
+		return false, "", fmt.Errorf("install new binary: %v", err)
+	}
+	return true, manifest.Version, nil
+}
+
+func fetchReleaseManifest(ctx context.Context) (*releaseManifest, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", cfg.Update.ManifestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fetch release manifest: %v", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch release manifest: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("fetch release manifest: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch release manifest: status %d - %s", resp.StatusCode, truncateBody(string(body)))
+	}
+
+	var manifest releaseManifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, fmt.Errorf("parse release manifest: %v", err)
+	}
+	if manifest.Version == "" || manifest.URL == "" || manifest.Signature == "" {
+		return nil, fmt.Errorf("release manifest must contain version, url and signature")
+	}
+	return &manifest, nil
+}
+
+func downloadRelease(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("download release: %v", err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download release: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("download release: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// verifyRelease проверяет, что релиз новее текущей версии, и контрольную
+// сумму и подпись скачанного бинарника вместе с версией
+func verifyRelease(manifest *releaseManifest, binary []byte) error {
+	if compareVersions(manifest.Version, agentVersion) <= 0 {
+		return fmt.Errorf("release %s is not newer than the running version %s", manifest.Version, agentVersion)
+	}
+	sum := sha256.Sum256(binary)
+	if manifest.SHA256 != "" && !strings.EqualFold(hex.EncodeToString(sum[:]), manifest.SHA256) {
+		return fmt.Errorf("release checksum mismatch")
+	}
+
+	key, err := updatePublicKey(cfg.Update.PublicKey)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.StdEncoding.DecodeString(manifest.Signature)
+	if err != nil {
+		return fmt.Errorf("release signature must be base64: %v", err)
+	}
+	if !ed25519.Verify(key, releaseSigningMessage(manifest.Version, sum), signature) {
+		return fmt.Errorf("release signature is invalid")
+	}
+	return nil
+}
+
+// compareVersions сравнивает версии вида 1.2.3 (допускается префикс v)
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// Статусы проверок validate-config и стадий doctor
+const (
+	checkOK   = "OK"
+	checkWarn = "WARN"
+	checkFail = "FAIL"
+	checkSkip = "SKIP"
+)
+
+// configCheck - результат одной проверки validate-config и совет,
+// как исправить проблему
+type configCheck struct {
+	status string
+	name   string
+	detail string
+	fix    string
+}
+
+// configChecker собирает результаты проверок и печатает их по мере выполнения
+type configChecker struct {
+	checks []configCheck
+}
+
+func (c *configChecker) add(status, name, detail, fix string) {
+	check := configCheck{status: status, name: name, detail: detail, fix: fix}
+	c.checks = append(c.checks, check)
+
+	fmt.Printf("[%-4s] %s: %s\n", status, name, detail)
+	if fix != "" && status != checkOK {
+		fmt.Printf("       fix: %s\n", fix)
+	}
+}
+
+func (c *configChecker) count(status string) int {
+	n := 0
+	for _, check := range c.checks {
+		if check.status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// runValidateConfig - команда agent-ws validate-config: проверка конфигурации
+// и окружения (папки, права, диск, TLS, доступность API и токен) до запуска
+// агента, чтобы ошибки настройки не всплывали только в логе во время работы
+func runValidateConfig(args []string) int {
+	fs := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	path := fs.String("config", configFile, "configuration file to check")
+	timeout := fs.Duration("timeout", 10*time.Second, "timeout of the API probe")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var checker configChecker
+	c, ok := checkConfigFile(&checker, *path)
+	if ok {
+		cfg = c
+		checkWatchTargets(&checker)
+		checkStateDirs(&checker)
+		checkFreeSpace(&checker)
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		checkAPI(ctx, &checker)
+	}
+
+	failed, warned := checker.count(checkFail), checker.count(checkWarn)
+	fmt.Printf("\n%d checks, %d failed, %d warnings\n", len(checker.checks), failed, warned)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkConfigFile читает и проверяет файл конфигурации. Если файл не
+// разобран, остальные проверки не имеют смысла.
+func checkConfigFile(checker *configChecker, path string) (Config, bool) {
+	c := defaultConfig()
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		checker.add(checkWarn, "config file", path+" not found, built-in defaults are used",
+			"create "+path+" with at least api_url set")
+	case err != nil:
+		checker.add(checkFail, "config file", err.Error(), "grant the agent account read access to "+path)
+		return c, false
+	default:
+		if err := json.Unmarshal(data, &c); err != nil {
+			detail, fix := jsonErrorDetail(data, err)
+			checker.add(checkFail, "config syntax", detail, fix)
+			return c, false
+		}
+		checker.add(checkOK, "config syntax", path, "")
+	}
+
+	notes, err := migrateLegacySinks(&c)
+	if err != nil {
+		checker.add(checkFail, "deprecated option", err.Error(), "move the section into sinks")
+	}
+	for _, note := range notes {
+		checker.add(checkWarn, "deprecated option", note, "move the section into sinks")
+	}
+
+	if err := c.validate(); err != nil {
+		checker.add(checkFail, "config values", err.Error(), "correct the option named in the error")
+	} else {
+		checker.add(checkOK, "config values", "all options are valid", "")
+	}
+	return c, true
+}
+
+// jsonErrorDetail дополняет ошибку разбора JSON строкой и колонкой
+func jsonErrorDetail(data []byte, err error) (string, string) {
+	var offset int64 = -1
+	fix := "correct the value type of the reported option"
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+		fix = "fix the JSON at the reported line, e.g. a missing comma or quote"
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	}
+	if offset < 0 || offset > int64(len(data)) {
+		return err.Error(), fix
+	}
+
+	line, col := 1, 1
+	for _, b := range data[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Sprintf("line %d, column %d: %v", line, col, err), fix
+}
+
+func checkWatchTargets(checker *configChecker) {
+	if err := initWatchTargets(cfg.WatchTargets); err != nil {
+		checker.add(checkFail, "watch targets", err.Error(), "correct watch_targets in the configuration")
+		return
+	}
+
+	for _, t := range watchTargets {
+		name := "watch path " + t.Name
+		if t.instance != "" {
+			name = "watch path " + t.instance + "/" + t.Name
+		}
+
+		info, err := os.Stat(t.Path)
+		switch {
+		case os.IsNotExist(err):
+			fix := "create the directory or correct the path in watch_targets"
+			if cfg.WaitForDirectory {
+				checker.add(checkWarn, name, t.Path+" does not exist yet, the agent will wait for it", fix)
+			} else {
+				checker.add(checkFail, name, t.Path+" does not exist", fix)
+			}
+			continue
+		case err != nil:
+			checker.add(checkFail, name, err.Error(), "grant the agent account read access to "+t.Path)
+			continue
+		case !info.IsDir():
+			checker.add(checkFail, name, t.Path+" is not a directory", "point watch_targets to the directory with the saves")
+			continue
+		}
+
+		files, err := os.ReadDir(t.Path)
+		if err != nil {
+			checker.add(checkFail, name, err.Error(), "grant the agent account read access to "+t.Path)
+			continue
+		}
+		checker.add(checkOK, name, fmt.Sprintf("%s readable, %d entries", t.Path, len(files)), "")
+	}
+}
+
+// stateDirs возвращает папки, в которые агент пишет: лог, очередь,
+// кэш, копии и файлы состояния
+func stateDirs() map[string]string {
+	dirs := map[string]string{
+		"log":        filepath.Dir(logFile),
+		"queue_dir":  cfg.QueueDir,
+		"backup.dir": cfg.Backup.Dir,
+	}
+	optional := map[string]string{
+		"content_cache_dir": cfg.ContentCacheDir,
+		"snapshot_dir":      cfg.SnapshotDir,
+		"sequence_file":     filepath.Dir(cfg.SequenceFile),
+		"blocklist_file":    filepath.Dir(cfg.BlocklistFile),
+		"body_dump_file":    filepath.Dir(cfg.BodyDumpFile),
+	}
+	for name, dir := range optional {
+		if dir != "" && dir != "." {
+			dirs[name] = dir
+		}
+	}
+	for name, dir := range dirs {
+		if dir == "" {
+			delete(dirs, name)
+		}
+	}
+	return dirs
+}
+
+func checkStateDirs(checker *configChecker) {
+	dirs := stateDirs()
+	names := make([]string, 0, len(dirs))
+	for name := range dirs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dir := dirs[name]
+		existing := existingDir(dir)
+		if existing == "" {
+			checker.add(checkFail, "writable "+name, dir+": no existing parent directory", "create "+dir+" or choose another path")
+			continue
+		}
+
+		f, err := os.CreateTemp(existing, ".agent-ws-check-*")
+		if err != nil {
+			checker.add(checkFail, "writable "+name, err.Error(), "grant the agent account write access to "+existing)
+			continue
+		}
+		f.Close()
+		os.Remove(f.Name())
+
+		detail := dir + " is writable"
+		if existing != filepath.Clean(dir) {
+			detail = dir + " will be created in " + existing
+		}
+		checker.add(checkOK, "writable "+name, detail, "")
+	}
+}
+
+// existingDir возвращает dir, если папка есть, иначе ближайшую
+// существующую родительскую, в которой она будет создана
+func existingDir(dir string) string {
+	dir = filepath.Clean(dir)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+	return existingParent(dir)
+}
+
+// checkFreeSpace проверяет место на дисках с логом, очередью и копиями
+func checkFreeSpace(checker *configChecker) {
+	dirs := stateDirs()
+	checked := make(map[string]bool)
+	for _, name := range []string{"log", "queue_dir", "backup.dir"} {
+		dir := existingDir(dirs[name])
+		if dirs[name] == "" || dir == "" || checked[dir] {
+			continue
+		}
+		checked[dir] = true
+
+		free, err := diskFreeBytes(dir)
+		if err != nil {
+			checker.add(checkWarn, "disk space "+name, err.Error(), "")
+			continue
+		}
+		detail := fmt.Sprintf("%d MB free on %s", free/(1024*1024), dir)
+		if free < minFreeDiskSpace {
+			checker.add(checkFail, "disk space "+name, "low disk space: "+detail,
+				fmt.Sprintf("free at least %d MB or move %s to another disk", minFreeDiskSpace/(1024*1024), name))
+			continue
+		}
+		checker.add(checkOK, "disk space "+name, detail, "")
+	}
+}
+
+// checkAPI проверяет настройки TLS и пробным запросом - доступность API
+// панели и принятие токена для общей конфигурации и каждого экземпляра
+func checkAPI(ctx context.Context, checker *configChecker) {
+	if _, err := buildTLSConfig(cfg.TLS); err != nil {
+		checker.add(checkFail, "tls", err.Error(), "check tls.ca_file, tls.cert_file and tls.key_file")
+		return
+	}
+	if err := initHTTPClient(); err != nil {
+		checker.add(checkFail, "http client", err.Error(), "check the proxy and tls settings")
+		return
+	}
+	checker.add(checkOK, "tls", "TLS settings are valid", "")
+
+	probeAPI(ctx, checker, "api", cfg.APIURL, nil)
+	for _, inst := range cfg.Instances {
+		if inst.APIURL != "" || len(inst.Headers) > 0 {
+			url := inst.APIURL
+			if url == "" {
+				url = cfg.APIURL
+			}
+			probeAPI(ctx, checker, "api "+inst.Name, url, inst.Headers)
+		}
+	}
+}
+
+// probeAPI отправляет OPTIONS на url (HEAD, если сервер не поддерживает
+// OPTIONS) и разбирает ответ: сетевые ошибки и ошибки TLS - недоступность,
+// 401 и 403 - неверный токен
+func probeAPI(ctx context.Context, checker *configChecker, name, url string, headers map[string]string) {
+	var resp *http.Response
+	for _, method := range []string{"OPTIONS", "HEAD"} {
+		req, err := http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			checker.add(checkFail, name, err.Error(), "correct api_url")
+			return
+		}
+		setPanelHeaders(req)
+		for header, value := range headers {
+			req.Header.Set(header, value)
+		}
+
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			detail, fix := describeProbeError(err)
+			checker.add(checkFail, name+" reachability", detail, fix)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed && resp.StatusCode != http.StatusNotImplemented {
+			break
+		}
+	}
+
+	status := fmt.Sprintf("%s %s: HTTP %d", resp.Request.Method, url, resp.StatusCode)
+	checker.add(checkOK, name+" reachability", status, "")
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		checker.add(checkFail, name+" token", "credentials rejected: "+status,
+			"check the API key and Cloudflare Access headers in headers")
+	case resp.StatusCode == http.StatusNotFound:
+		checker.add(checkWarn, name+" token", "endpoint not found: "+status, "check the path in api_url")
+	case resp.StatusCode >= 500:
+		checker.add(checkWarn, name+" token", "server error: "+status, "the panel may be down, check its status")
+	default:
+		checker.add(checkOK, name+" token", "credentials accepted", "")
+	}
+}
+
+// describeProbeError объясняет ошибку пробного запроса и подсказывает исправление
+func describeProbeError(err error) (string, string) {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+
+	switch {
+	case errors.As(err, &unknownAuthority):
+		return "TLS certificate is not trusted: " + err.Error(),
+			"add the issuing CA to tls.ca_file (e.g. for a TLS-inspecting proxy)"
+	case errors.As(err, &hostname):
+		return "TLS certificate does not match the host: " + err.Error(),
+			"use the host name the certificate was issued for in api_url"
+	case errors.As(err, &invalid):
+		return "TLS certificate is invalid: " + err.Error(),
+			"check the server certificate and the system clock"
+	case errors.As(err, &dnsErr):
+		return "host not found: " + err.Error(), "check the host name in api_url and DNS settings"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection refused: " + err.Error(), "check the port in api_url and that the panel is running"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out: " + err.Error(), "check firewall rules and the proxy setting"
+	}
+	return err.Error(), "check api_url, proxy and network access from this machine"
+}
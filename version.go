@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+// Информация о сборке, задается при сборке:
+//
+//	go build -ldflags "-X main.agentVersion=1.2.0 -X main.agentCommit=$(git rev-parse --short HEAD) -X main.agentBuildDate=2024-01-01T00:00:00Z"
+var (
+	agentVersion   = "1.0.0"
+	agentCommit    = "unknown"
+	agentBuildDate = "unknown"
+)
+
+// versionInfo возвращает сведения о сборке для API, heartbeat и события version
+func versionInfo() map[string]string {
+	return map[string]string{
+		"version":    agentVersion,
+		"commit":     agentCommit,
+		"build_date": agentBuildDate,
+		"go_version": runtime.Version(),
+		"platform":   runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
+// userAgent возвращает User-Agent из конфигурации или стандартный агента
+func userAgent() string {
+	if cfg.UserAgent != "" {
+		return cfg.UserAgent
+	}
+	return fmt.Sprintf("FileWatcher/%s (agent-ws; %s)", agentVersion, agentCommit)
+}
+
+// runVersion - команда agent-ws version
+func runVersion() int {
+	fmt.Printf("agent-ws %s (commit %s, built %s, %s)\n", agentVersion, agentCommit, agentBuildDate, runtime.Version())
+	return 0
+}
+
+// sendVersionEvent сообщает панели версию агента при запуске.
+// Выключается через events.version.enabled.
+func sendVersionEvent(ctx context.Context) {
+	if !eventEnabled("version") {
+		return
+	}
+
+	data, err := json.Marshal(versionInfo())
+	if err != nil {
+		agentLog.Errorf("Error encoding version event: %v", err)
+		return
+	}
+
+	sendEventWithRetry(ctx, EventData{
+		SteamID64: cfg.Identity.AgentID,
+		Type:      "agent",
+		Event:     "version",
+		Data:      data,
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Как часто писать в лог, что агент все еще ждет папку
+const waitProgressInterval = 30 * time.Second
+
+// waitForDirectories ждет появления отслеживаемых папок, например папки
+// Players на новом сервере до первого сохранения. Вместо самой папки
+// отслеживается ближайшая существующая родительская.
+func waitForDirectories(ctx context.Context) error {
+	for _, t := range watchTargets {
+		if err := waitForDirectory(ctx, filepath.Clean(t.Path)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func waitForDirectory(ctx context.Context, dir string) error {
+	start := time.Now()
+	progress := time.NewTicker(waitProgressInterval)
+	defer progress.Stop()
+
+	waiting := false
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			if waiting {
+				watchLog.Infof("Directory %s appeared after %v", dir, time.Since(start).Round(time.Second))
+				log.Println("Directory appeared:", dir)
+			}
+			return nil
+		}
+
+		parent := existingParent(dir)
+		if parent == "" {
+			return fmt.Errorf("no existing parent directory for %s", dir)
+		}
+		if !waiting {
+			watchLog.Infof("Waiting for directory %s to appear (watching %s)", dir, parent)
+			log.Println("Waiting for directory to appear:", dir)
+			waiting = true
+		}
+
+		if err := waitForChange(ctx, parent, progress.C, dir, start); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForChange ждет создания чего-либо в родительской папке. Появиться может
+// и промежуточная папка - тогда следующий проход подпишется на нее.
+// Тик прогресса тоже приводит к повторной проверке на случай пропущенного события.
+func waitForChange(ctx context.Context, parent string, progress <-chan time.Time, dir string, start time.Time) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Add(parent); err != nil {
+		return fmt.Errorf("error watching %s: %v", parent, err)
+	}
+	// Папка могла появиться между проверкой и подпиской
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&fsnotify.Create != 0 {
+				return nil
+			}
+
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			watchLog.Errorf("Error watching %s: %v", parent, err)
+
+		case <-progress:
+			watchLog.Warnf("Still waiting for directory %s (%v elapsed)", dir, time.Since(start).Round(time.Second))
+			return nil
+		}
+	}
+}
+
+// existingParent возвращает ближайшую существующую родительскую папку
+func existingParent(dir string) string {
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		if info, err := os.Stat(parent); err == nil && info.IsDir() {
+			return parent
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,91 @@
+// Package watcher - источник событий файловой системы для агента.
+// Агент работает с интерфейсом Source, поэтому в тестах fsnotify
+// заменяется на Fake без настоящей папки сервера.
+package watcher
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Event - событие файловой системы
+type Event = fsnotify.Event
+
+// Операции событий файловой системы
+const (
+	Create = fsnotify.Create
+	Write  = fsnotify.Write
+	Remove = fsnotify.Remove
+	Rename = fsnotify.Rename
+)
+
+// Source - источник событий отслеживаемых папок
+type Source interface {
+	Events() <-chan Event
+	Errors() <-chan error
+	Close() error
+}
+
+// fsSource - Source на fsnotify
+type fsSource struct {
+	w *fsnotify.Watcher
+}
+
+// New создает fsnotify watcher и подписывает его на папки
+func New(paths []string) (Source, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("error creating watcher: %v", err)
+	}
+
+	for _, path := range paths {
+		if err := w.Add(path); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("error adding watch path %s: %v", path, err)
+		}
+	}
+	return &fsSource{w: w}, nil
+}
+
+func (s *fsSource) Events() <-chan Event { return s.w.Events }
+func (s *fsSource) Errors() <-chan error { return s.w.Errors }
+func (s *fsSource) Close() error         { return s.w.Close() }
+
+// Fake - Source, события которого передаются вызовом Send
+type Fake struct {
+	events chan Event
+	errors chan error
+	once   sync.Once
+}
+
+// NewFake создает Fake с буфером событий
+func NewFake() *Fake {
+	return &Fake{
+		events: make(chan Event, 100),
+		errors: make(chan error, 10),
+	}
+}
+
+// Send передает событие файла name с операцией op
+func (f *Fake) Send(name string, op fsnotify.Op) {
+	f.events <- Event{Name: name, Op: op}
+}
+
+// Fail передает ошибку watcher
+func (f *Fake) Fail(err error) {
+	f.errors <- err
+}
+
+func (f *Fake) Events() <-chan Event { return f.events }
+func (f *Fake) Errors() <-chan error { return f.errors }
+
+// Close закрывает каналы, как fsnotify при остановке
+func (f *Fake) Close() error {
+	f.once.Do(func() {
+		close(f.events)
+		close(f.errors)
+	})
+	return nil
+}
@@ -0,0 +1,85 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// waitFor ждет событие с операцией op для файла name
+func waitFor(t *testing.T, s Source, name string, op fsnotify.Op) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-s.Events():
+			if ev.Name == name && ev.Op&op != 0 {
+				return
+			}
+		case err := <-s.Errors():
+			t.Fatalf("watcher error: %v", err)
+		case <-timeout:
+			t.Fatalf("no %s event for %s", op, filepath.Base(name))
+		}
+	}
+}
+
+func TestSourceReportsFileOperations(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	name := filepath.Join(dir, "76561198000000001.json")
+	if err := os.WriteFile(name, []byte(`{"Growth":0.5}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, name, Create)
+
+	if err := os.WriteFile(name, []byte(`{"Growth":0.6}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, name, Write)
+
+	renamed := filepath.Join(dir, "76561198000000002.json")
+	if err := os.Rename(name, renamed); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, name, Rename)
+
+	if err := os.Remove(renamed); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, s, renamed, Remove)
+}
+
+func TestNewFailsForMissingDirectory(t *testing.T) {
+	if _, err := New([]string{filepath.Join(t.TempDir(), "Players")}); err == nil {
+		t.Fatal("expected error for missing directory")
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	f.Send("a.json", Create)
+	f.Fail(errors.New("overflow"))
+
+	if ev := <-f.Events(); ev.Name != "a.json" || ev.Op != Create {
+		t.Fatalf("got %v", ev)
+	}
+	if err := <-f.Errors(); err == nil || err.Error() != "overflow" {
+		t.Fatalf("got %v", err)
+	}
+
+	f.Close()
+	f.Close()
+	if _, ok := <-f.Events(); ok {
+		t.Fatal("events channel is open after Close")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"agent-ws/state"
+)
+
+// CommandWebhookConfig - прием команд от панели входящими HTTPS-запросами,
+// когда панель может достучаться до агента, а опрос или WebSocket закрыты
+type CommandWebhookConfig struct {
+	// Адрес прослушивания, например 0.0.0.0:8443 (пусто - выключено)
+	Listen string `json:"listen"`
+	Token  string `json:"token"`
+	// Сертификат и ключ HTTPS
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+}
+
+func (c CommandWebhookConfig) validate() error {
+	if c.Listen == "" {
+		return nil
+	}
+	if c.Token == "" {
+		return fmt.Errorf("commands.webhook.token is required when the webhook is enabled")
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("commands.webhook.cert_file and key_file are required when the webhook is enabled")
+	}
+	return nil
+}
+
+// Максимальный размер тела команды
+const webhookMaxBody = 64 * 1024
+
+// runCommandWebhook обслуживает прием команд до отмены контекста агента.
+// Занятый адрес, как и у локального API, привязывается повторно.
+func runCommandWebhook(ctx context.Context, c CommandWebhookConfig) error {
+	if c.Listen == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /commands", handleWebhookCommand)
+
+	server := &http.Server{
+		Addr:              c.Listen,
+		Handler:           requireAdminToken(c.Token, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	l, err := listenWithRetry(ctx, commandLog, "command webhook", c.Listen)
+	if err != nil {
+		return nil
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		commandLog.Infof("Command webhook listening on %s", c.Listen)
+		serveErr <- server.ServeTLS(l, c.CertFile, c.KeyFile)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return fmt.Errorf("command webhook stopped: %v", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), adminShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		commandLog.Errorf("Error shutting down command webhook: %v", err)
+	}
+	<-serveErr
+	return nil
+}
+
+// handleWebhookCommand выполняет команду панели тем же обработчиком, что и
+// опрос команд, и возвращает результат в ответе. Результат также
+// отправляется на commands.result_url. Повтор команды с тем же id
+// возвращает сохраненный результат без повторного выполнения.
+func handleWebhookCommand(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, webhookMaxBody+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if len(body) > webhookMaxBody {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "command is too large"})
+		return
+	}
+
+	var cmd Command
+	if err := json.Unmarshal(body, &cmd); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid command: %v", err)})
+		return
+	}
+	if cmd.ID == "" || cmd.Name == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "id and command are required"})
+		return
+	}
+
+	var result CommandResult
+	if !inMainLoop(w, r, func(ctx context.Context, fileStates *state.Store[time.Time]) {
+		var executed bool
+		if result, executed = executeCommandOnce(ctx, cmd, fileStates); executed {
+			reportCommandResult(ctx, result)
+		}
+	}) {
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}